@@ -3,11 +3,11 @@ package account
 import (
 	"context"
 	"fmt"
-	"time"
+	"io"
 
 	"github.com/donaldnash/go-marketplace/account/pb"
+	"github.com/donaldnash/go-marketplace/grpcclient"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 type Client struct {
@@ -15,20 +15,33 @@ type Client struct {
 	service pb.AccountServiceClient
 }
 
+// readMethods are the methods retried while the account service is unavailable.
+var readMethods = []string{
+	"GetAccount",
+	"GetAccounts",
+	"GetAddress",
+	"GetAddresses",
+	"GetSeller",
+	"GetSellers",
+	"GetWishlist",
+	"GetWishlists",
+	"GetSharedWishlist",
+}
+
+// NewClient returns a client of the account service at url with the default
+// options. It does not wait for the service to be up.
 func NewClient(url string) (*Client, error) {
+	return NewClientWithOptions(url, grpcclient.DefaultOptions())
+}
+
+func NewClientWithOptions(url string, o grpcclient.Options) (*Client, error) {
 	if url == "" {
 		return nil, fmt.Errorf("account service URL cannot be empty")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	conn, err := grpc.DialContext(ctx, url,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock(),
-	)
+	conn, err := grpcclient.Dial(url, pb.AccountService_ServiceDesc.ServiceName, readMethods, o)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to account service: %v", err)
+		return nil, fmt.Errorf("failed to create account service client: %v", err)
 	}
 	c := pb.NewAccountServiceClient(conn)
 	return &Client{conn, c}, nil
@@ -38,10 +51,12 @@ func (c *Client) Close() {
 	c.conn.Close()
 }
 
-func (c *Client) PostAccount(ctx context.Context, name string) (*Account, error) {
+// PostAccount creates an account. callerID is the account asking for it, or
+// "" for anonymous callers; it scopes idempotencyKey.
+func (c *Client) PostAccount(ctx context.Context, name string, callerID string, idempotencyKey string) (*Account, error) {
 	r, err := c.service.PostAccount(
 		ctx,
-		&pb.PostAccountRequest{Name: name},
+		&pb.PostAccountRequest{Name: name, IdempotencyKey: idempotencyKey, CallerId: callerID},
 	)
 	if err != nil {
 		return nil, err
@@ -77,3 +92,180 @@ func (c *Client) GetAccounts(ctx context.Context, skip uint64, take uint64) ([]A
 	}
 	return accounts, nil
 }
+
+// StreamAccounts calls fn with every account until fn returns an error.
+func (c *Client) StreamAccounts(ctx context.Context, fn func(Account) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.service.StreamAccounts(ctx, &pb.StreamAccountsRequest{})
+	if err != nil {
+		return err
+	}
+	for {
+		a, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(Account{ID: a.Id, Name: a.Name}); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) PostAddress(ctx context.Context, a Address) (*Address, error) {
+	r, err := c.service.PostAddress(ctx, &pb.PostAddressRequest{Address: addressToProto(a)})
+	if err != nil {
+		return nil, err
+	}
+	created := addressFromProto(r.Address)
+	return &created, nil
+}
+
+func (c *Client) UpdateAddress(ctx context.Context, a Address) (*Address, error) {
+	r, err := c.service.UpdateAddress(ctx, &pb.UpdateAddressRequest{Address: addressToProto(a)})
+	if err != nil {
+		return nil, err
+	}
+	updated := addressFromProto(r.Address)
+	return &updated, nil
+}
+
+func (c *Client) DeleteAddress(ctx context.Context, accountID string, id string) error {
+	_, err := c.service.DeleteAddress(ctx, &pb.DeleteAddressRequest{AccountId: accountID, Id: id})
+	return err
+}
+
+func (c *Client) GetAddress(ctx context.Context, accountID string, id string) (*Address, error) {
+	r, err := c.service.GetAddress(ctx, &pb.GetAddressRequest{AccountId: accountID, Id: id})
+	if err != nil {
+		return nil, err
+	}
+	a := addressFromProto(r.Address)
+	return &a, nil
+}
+
+func (c *Client) GetAddresses(ctx context.Context, accountID string) ([]Address, error) {
+	r, err := c.service.GetAddresses(ctx, &pb.GetAddressesRequest{AccountId: accountID})
+	if err != nil {
+		return nil, err
+	}
+	addresses := []Address{}
+	for _, a := range r.Addresses {
+		addresses = append(addresses, addressFromProto(a))
+	}
+	return addresses, nil
+}
+
+func (c *Client) PostSeller(ctx context.Context, accountID string, name string) (*Seller, error) {
+	r, err := c.service.PostSeller(ctx, &pb.PostSellerRequest{AccountId: accountID, Name: name})
+	if err != nil {
+		return nil, err
+	}
+	s := sellerFromProto(r.Seller)
+	return &s, nil
+}
+
+func (c *Client) GetSeller(ctx context.Context, accountID string) (*Seller, error) {
+	r, err := c.service.GetSeller(ctx, &pb.GetSellerRequest{AccountId: accountID})
+	if err != nil {
+		return nil, err
+	}
+	s := sellerFromProto(r.Seller)
+	return &s, nil
+}
+
+func (c *Client) GetSellers(ctx context.Context, skip uint64, take uint64) ([]Seller, error) {
+	r, err := c.service.GetSellers(ctx, &pb.GetSellersRequest{Skip: skip, Take: take})
+	if err != nil {
+		return nil, err
+	}
+	sellers := []Seller{}
+	for _, s := range r.Sellers {
+		sellers = append(sellers, sellerFromProto(s))
+	}
+	return sellers, nil
+}
+
+func (c *Client) CreateWishlist(ctx context.Context, accountID string, name string) (*Wishlist, error) {
+	r, err := c.service.CreateWishlist(ctx, &pb.CreateWishlistRequest{AccountId: accountID, Name: name})
+	if err != nil {
+		return nil, err
+	}
+	w := wishlistFromProto(r.Wishlist)
+	return &w, nil
+}
+
+func (c *Client) DeleteWishlist(ctx context.Context, accountID string, id string) error {
+	_, err := c.service.DeleteWishlist(ctx, &pb.DeleteWishlistRequest{AccountId: accountID, Id: id})
+	return err
+}
+
+func (c *Client) GetWishlist(ctx context.Context, accountID string, id string) (*Wishlist, error) {
+	r, err := c.service.GetWishlist(ctx, &pb.GetWishlistRequest{AccountId: accountID, Id: id})
+	if err != nil {
+		return nil, err
+	}
+	w := wishlistFromProto(r.Wishlist)
+	return &w, nil
+}
+
+func (c *Client) GetWishlists(ctx context.Context, accountID string) ([]Wishlist, error) {
+	r, err := c.service.GetWishlists(ctx, &pb.GetWishlistsRequest{AccountId: accountID})
+	if err != nil {
+		return nil, err
+	}
+	wishlists := []Wishlist{}
+	for _, w := range r.Wishlists {
+		wishlists = append(wishlists, wishlistFromProto(w))
+	}
+	return wishlists, nil
+}
+
+func (c *Client) AddWishlistItem(ctx context.Context, accountID string, wishlistID string, item WishlistItem) (*Wishlist, error) {
+	r, err := c.service.AddWishlistItem(ctx, &pb.AddWishlistItemRequest{
+		AccountId:  accountID,
+		WishlistId: wishlistID,
+		Item:       wishlistItemToProto(item),
+	})
+	if err != nil {
+		return nil, err
+	}
+	w := wishlistFromProto(r.Wishlist)
+	return &w, nil
+}
+
+func (c *Client) RemoveWishlistItem(ctx context.Context, accountID string, wishlistID string, productID string, variantID string) (*Wishlist, error) {
+	r, err := c.service.RemoveWishlistItem(ctx, &pb.RemoveWishlistItemRequest{
+		AccountId:  accountID,
+		WishlistId: wishlistID,
+		ProductId:  productID,
+		VariantId:  variantID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	w := wishlistFromProto(r.Wishlist)
+	return &w, nil
+}
+
+func (c *Client) ShareWishlist(ctx context.Context, accountID string, id string, shared bool) (*Wishlist, error) {
+	r, err := c.service.ShareWishlist(ctx, &pb.ShareWishlistRequest{AccountId: accountID, Id: id, Shared: shared})
+	if err != nil {
+		return nil, err
+	}
+	w := wishlistFromProto(r.Wishlist)
+	return &w, nil
+}
+
+func (c *Client) GetSharedWishlist(ctx context.Context, token string) (*Wishlist, error) {
+	r, err := c.service.GetSharedWishlist(ctx, &pb.GetSharedWishlistRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+	w := wishlistFromProto(r.Wishlist)
+	return &w, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -8,18 +9,38 @@ import (
 	"time"
 
 	"github.com/donaldnash/go-marketplace/account"
+	"github.com/donaldnash/go-marketplace/migrate"
+	"github.com/donaldnash/go-marketplace/outbox"
+	"github.com/donaldnash/go-marketplace/ratelimit"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tinrab/retry"
+	"google.golang.org/grpc"
 )
 
+type MigrateConfig struct {
+	DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
+}
+
 type Config struct {
 	DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
 	Port        int    `envconfig:"PORT" default:"8081"`
+	AutoMigrate bool   `envconfig:"AUTO_MIGRATE" default:"false"`
+	// Per-method gRPC quotas such as "PostAccount=5/s:10"; other methods get
+	// RATE_LIMIT_DEFAULT, or no limit when it is empty
+	RateLimits       string `envconfig:"RATE_LIMITS"`
+	RateLimitDefault string `envconfig:"RATE_LIMIT_DEFAULT"`
+	outbox.Config
 }
 
 func main() {
 	// Initialize logger
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	log.Println("Starting Account service...")
 
 	// Load configuration
@@ -28,8 +49,13 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	log.Printf("Configuration loaded:\n  Database URL: %s\n  Port: %d",
-		cfg.DatabaseURL, cfg.Port)
+	log.Printf("Configuration loaded:\n  Database URL: %s\n  Port: %d\n  Auto migrate: %t\n  Event publisher: %s",
+		cfg.DatabaseURL, cfg.Port, cfg.AutoMigrate, cfg.Publisher)
+
+	// Apply pending schema migrations
+	if cfg.AutoMigrate {
+		applyMigrations(cfg.DatabaseURL)
+	}
 
 	// Initialize repository with retry
 	var repository account.Repository
@@ -48,8 +74,21 @@ func main() {
 
 	log.Println("Successfully connected to database")
 
-	// Create service
+	// Relay domain events from the outbox
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	startRelay(relayCtx, cfg.DatabaseURL, cfg.Config)
+
+	// Wishlists live in the account database
+	wishlistRepository, err := account.NewPostgresWishlistRepository(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to create wishlist repository: %v", err)
+	}
+	defer wishlistRepository.Close()
+
+	// Create services
 	service := account.NewService(repository)
+	wishlists := account.NewWishlistService(wishlistRepository)
 
 	// Handle graceful shutdown
 	done := make(chan bool)
@@ -59,16 +98,87 @@ func main() {
 	go func() {
 		<-quit
 		log.Println("Service is shutting down...")
+		stopRelay()
 		repository.Close()
+		wishlistRepository.Close()
 		close(done)
 	}()
 
+	limiter, err := ratelimit.NewServerInterceptor(ratelimit.NewMemoryStore(), cfg.RateLimits, cfg.RateLimitDefault)
+	if err != nil {
+		log.Fatalf("Failed to configure rate limits: %v", err)
+	}
+
 	// Start gRPC server
 	log.Printf("Starting gRPC server on port %d...", cfg.Port)
-	if err := account.ListenGRPC(service, cfg.Port); err != nil {
+	if err := account.ListenGRPC(service, wishlists, cfg.Port, grpc.UnaryInterceptor(limiter)); err != nil {
 		log.Fatalf("Failed to start gRPC server: %v", err)
 	}
 
 	<-done
 	log.Println("Service stopped")
 }
+
+func startRelay(ctx context.Context, databaseURL string, cfg outbox.Config) {
+	publisher, err := outbox.NewPublisher(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create event publisher: %v", err)
+	}
+
+	var store outbox.Store
+	retry.ForeverSleep(2*time.Second, func(_ int) error {
+		store, err = outbox.NewPostgresStore(databaseURL)
+		if err != nil {
+			log.Printf("Failed to connect to outbox: %v", err)
+			return err
+		}
+		return nil
+	})
+
+	go func() {
+		defer store.Close()
+		defer publisher.Close()
+		outbox.NewRelay(store, publisher, cfg.PollInterval).Run(ctx)
+	}()
+}
+
+func runMigrate(args []string) {
+	var cfg MigrateConfig
+	if err := envconfig.Process("", &cfg); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	m, err := migrate.Open(cfg.DatabaseURL, account.Migrations())
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer m.Close()
+
+	if err := migrate.Run(context.Background(), m, args, os.Stdout); err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
+
+func applyMigrations(databaseURL string) {
+	var m *migrate.Migrator
+	var err error
+
+	log.Println("Applying database migrations...")
+	retry.ForeverSleep(2*time.Second, func(_ int) error {
+		m, err = migrate.Open(databaseURL, account.Migrations())
+		if err != nil {
+			log.Printf("Failed to connect to database: %v", err)
+			return err
+		}
+		return nil
+	})
+	defer m.Close()
+
+	applied, err := m.Up(context.Background())
+	for _, mig := range applied {
+		log.Printf("Applied migration %04d_%s", mig.Version, mig.Name)
+	}
+	if err != nil {
+		log.Fatalf("Failed to apply migrations: %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS addresses (
+    id VARCHAR PRIMARY KEY,
+    account_id VARCHAR NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    name VARCHAR NOT NULL,
+    line1 VARCHAR NOT NULL,
+    line2 VARCHAR NOT NULL DEFAULT '',
+    city VARCHAR NOT NULL,
+    region VARCHAR NOT NULL DEFAULT '',
+    postal_code VARCHAR NOT NULL DEFAULT '',
+    country CHAR(2) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS addresses_account_id_idx ON addresses(account_id, created_at);
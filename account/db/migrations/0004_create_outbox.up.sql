@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id VARCHAR PRIMARY KEY,
+    type VARCHAR NOT NULL,
+    aggregate_id VARCHAR NOT NULL,
+    payload JSONB NOT NULL,
+    occurred_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS outbox_occurred_at_idx ON outbox(occurred_at, id);
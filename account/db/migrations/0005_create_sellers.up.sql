@@ -0,0 +1,9 @@
+-- An account becomes a seller by registering a store name. The name is
+-- unique so that buyers can tell sellers apart.
+CREATE TABLE IF NOT EXISTS sellers (
+    account_id VARCHAR PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+    name VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS sellers_name_idx ON sellers(LOWER(name));
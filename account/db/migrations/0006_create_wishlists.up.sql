@@ -0,0 +1,22 @@
+-- Named product lists of an account, such as a wishlist or products saved
+-- for later. Anyone with a list's share token can read it.
+CREATE TABLE IF NOT EXISTS wishlists (
+    id VARCHAR PRIMARY KEY,
+    account_id VARCHAR NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    name VARCHAR NOT NULL,
+    share_token VARCHAR UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS wishlists_name_idx ON wishlists(account_id, LOWER(name));
+
+-- saved_price is the price of the product, or of its variant, when it was
+-- saved, so that price drops can be told.
+CREATE TABLE IF NOT EXISTS wishlist_items (
+    wishlist_id VARCHAR NOT NULL REFERENCES wishlists(id) ON DELETE CASCADE,
+    product_id VARCHAR NOT NULL,
+    variant_id VARCHAR NOT NULL DEFAULT '',
+    saved_price DECIMAL(10,2) NOT NULL CHECK (saved_price >= 0),
+    added_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (wishlist_id, product_id, variant_id)
+);
@@ -0,0 +1,7 @@
+-- Keys of different callers may clash once they are no longer scoped.
+DELETE FROM idempotency_keys WHERE caller_id <> '';
+
+ALTER TABLE idempotency_keys
+    DROP CONSTRAINT IF EXISTS idempotency_keys_pkey,
+    ADD PRIMARY KEY (key);
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS caller_id;
@@ -0,0 +1,7 @@
+-- Keys are scoped to the account that asked for the new account, so that
+-- one caller cannot replay or block another's. Anonymous callers share the
+-- empty scope, which keys recorded before had.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS caller_id VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE idempotency_keys
+    DROP CONSTRAINT IF EXISTS idempotency_keys_pkey,
+    ADD PRIMARY KEY (caller_id, key);
@@ -3,16 +3,31 @@ package account
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 
+	"github.com/donaldnash/go-marketplace/outbox"
 	"github.com/lib/pq"
 )
 
 type Repository interface {
 	Close()
 	PutAccount(ctx context.Context, a Account) error
+	// PutAccountWithKey creates a under the idempotency key of callerID, the
+	// account that asked for it, or "" for anonymous callers.
+	PutAccountWithKey(ctx context.Context, a Account, callerID string, key string, requestHash string) (*Account, error)
 	GetAccountByID(ctx context.Context, id string) (*Account, error)
 	ListAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error)
+	// StreamAccounts calls fn with every account until fn returns an error.
+	StreamAccounts(ctx context.Context, fn func(Account) error) error
+	PutAddress(ctx context.Context, a Address) error
+	UpdateAddress(ctx context.Context, a Address) error
+	DeleteAddress(ctx context.Context, accountID string, id string) error
+	GetAddress(ctx context.Context, accountID string, id string) (*Address, error)
+	ListAddresses(ctx context.Context, accountID string) ([]Address, error)
+	PutSeller(ctx context.Context, s Seller) error
+	GetSeller(ctx context.Context, accountID string) (*Seller, error)
+	ListSellers(ctx context.Context, skip uint64, take uint64) ([]Seller, error)
 }
 
 type postgresRepository struct {
@@ -45,7 +60,98 @@ func (r *postgresRepository) PutAccount(ctx context.Context, a Account) error {
 		return fmt.Errorf("account name is required")
 	}
 
-	_, err := r.db.ExecContext(ctx, "INSERT INTO accounts(id, name) VALUES($1, $2)", a.ID, a.Name)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err = insertAccount(ctx, tx, a); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// PutAccountWithKey inserts a and records it under callerID's idempotency key
+// in the same transaction. If the key was used before, the account stored with it is
+// returned instead; concurrent calls with the same key wait for the first one
+// to commit.
+func (r *postgresRepository) PutAccountWithKey(ctx context.Context, a Account, callerID string, key string, requestHash string) (*Account, error) {
+	if a.ID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	if a.Name == "" {
+		return nil, fmt.Errorf("account name is required")
+	}
+	if key == "" {
+		return nil, fmt.Errorf("idempotency key is required")
+	}
+
+	response, err := json.Marshal(a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal account: %v", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO idempotency_keys(caller_id, key, request_hash, response) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+		callerID,
+		key,
+		requestHash,
+		response,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record idempotency key: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to record idempotency key: %v", err)
+	} else if n == 0 {
+		tx.Rollback()
+		return r.replayAccount(ctx, callerID, key, requestHash)
+	}
+
+	if err = insertAccount(ctx, tx, a); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return &a, nil
+}
+
+func (r *postgresRepository) replayAccount(ctx context.Context, callerID string, key string, requestHash string) (*Account, error) {
+	var storedHash string
+	var response []byte
+	row := r.db.QueryRowContext(ctx, "SELECT request_hash, response FROM idempotency_keys WHERE caller_id = $1 AND key = $2", callerID, key)
+	if err := row.Scan(&storedHash, &response); err != nil {
+		return nil, fmt.Errorf("failed to load idempotency key: %v", err)
+	}
+	if storedHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	a := &Account{}
+	if err := json.Unmarshal(response, a); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal stored account: %v", err)
+	}
+	return a, nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertAccount(ctx context.Context, db execer, a Account) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO accounts(id, name) VALUES($1, $2)", a.ID, a.Name)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			switch pqErr.Code.Name() {
@@ -55,7 +161,12 @@ func (r *postgresRepository) PutAccount(ctx context.Context, a Account) error {
 		}
 		return fmt.Errorf("failed to insert account: %v", err)
 	}
-	return nil
+
+	e, err := outbox.NewEvent(EventAccountCreated, a.ID, a)
+	if err != nil {
+		return err
+	}
+	return outbox.Insert(ctx, db, e)
 }
 
 func (r *postgresRepository) GetAccountByID(ctx context.Context, id string) (*Account, error) {
@@ -108,3 +219,247 @@ func (r *postgresRepository) ListAccounts(ctx context.Context, skip uint64, take
 
 	return accounts, nil
 }
+
+const addressColumns = "id, account_id, name, line1, line2, city, region, postal_code, country, created_at"
+
+func (r *postgresRepository) PutAddress(ctx context.Context, a Address) error {
+	if a.ID == "" {
+		return fmt.Errorf("address ID is required")
+	}
+
+	_, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO addresses("+addressColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		a.ID,
+		a.AccountID,
+		a.Name,
+		a.Line1,
+		a.Line2,
+		a.City,
+		a.Region,
+		a.PostalCode,
+		a.Country,
+		a.CreatedAt,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
+			return fmt.Errorf("account with ID %s not found", a.AccountID)
+		}
+		return fmt.Errorf("failed to insert address: %v", err)
+	}
+	return nil
+}
+
+// UpdateAddress replaces the fields of an existing address. Addresses can
+// only be changed through the account that owns them.
+func (r *postgresRepository) UpdateAddress(ctx context.Context, a Address) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		`UPDATE addresses SET
+			name = $3,
+			line1 = $4,
+			line2 = $5,
+			city = $6,
+			region = $7,
+			postal_code = $8,
+			country = $9
+		WHERE id = $1 AND account_id = $2`,
+		a.ID,
+		a.AccountID,
+		a.Name,
+		a.Line1,
+		a.Line2,
+		a.City,
+		a.Region,
+		a.PostalCode,
+		a.Country,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update address: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrAddressNotFound
+	}
+	return nil
+}
+
+func (r *postgresRepository) DeleteAddress(ctx context.Context, accountID string, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM addresses WHERE id = $1 AND account_id = $2", id, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to delete address: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrAddressNotFound
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetAddress(ctx context.Context, accountID string, id string) (*Address, error) {
+	row := r.db.QueryRowContext(
+		ctx,
+		"SELECT "+addressColumns+" FROM addresses WHERE id = $1 AND account_id = $2",
+		id,
+		accountID,
+	)
+	a, err := scanAddress(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrAddressNotFound
+	}
+	return a, err
+}
+
+func (r *postgresRepository) ListAddresses(ctx context.Context, accountID string) ([]Address, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT "+addressColumns+" FROM addresses WHERE account_id = $1 ORDER BY created_at, id",
+		accountID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query addresses: %v", err)
+	}
+	defer rows.Close()
+
+	addresses := []Address{}
+	for rows.Next() {
+		a, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, *a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over address rows: %v", err)
+	}
+	return addresses, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAddress(row scanner) (*Address, error) {
+	a := &Address{}
+	err := row.Scan(
+		&a.ID,
+		&a.AccountID,
+		&a.Name,
+		&a.Line1,
+		&a.Line2,
+		&a.City,
+		&a.Region,
+		&a.PostalCode,
+		&a.Country,
+		&a.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan address row: %v", err)
+	}
+	return a, nil
+}
+
+func (r *postgresRepository) StreamAccounts(ctx context.Context, fn func(Account) error) error {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, name FROM accounts ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("failed to query accounts: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a := Account{}
+		if err := rows.Scan(&a.ID, &a.Name); err != nil {
+			return fmt.Errorf("failed to scan account row: %v", err)
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over account rows: %v", err)
+	}
+	return nil
+}
+
+// PutSeller stores s and records a SellerRegistered event in the same
+// transaction.
+func (r *postgresRepository) PutSeller(ctx context.Context, s Seller) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO sellers(account_id, name, created_at) VALUES ($1, $2, $3)",
+		s.AccountID,
+		s.Name,
+		s.CreatedAt,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				if pqErr.Constraint == "sellers_name_idx" {
+					return ErrSellerNameTaken
+				}
+				return ErrSellerExists
+			case "foreign_key_violation":
+				return fmt.Errorf("account with ID %s not found", s.AccountID)
+			}
+		}
+		return fmt.Errorf("failed to insert seller: %v", err)
+	}
+
+	e, err := outbox.NewEvent(EventSellerRegistered, s.AccountID, s)
+	if err != nil {
+		return err
+	}
+	if err := outbox.Insert(ctx, tx, e); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetSeller(ctx context.Context, accountID string) (*Seller, error) {
+	s := &Seller{}
+	row := r.db.QueryRowContext(ctx, "SELECT account_id, name, created_at FROM sellers WHERE account_id = $1", accountID)
+	if err := row.Scan(&s.AccountID, &s.Name, &s.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSellerNotFound
+		}
+		return nil, fmt.Errorf("failed to scan seller row: %v", err)
+	}
+	return s, nil
+}
+
+func (r *postgresRepository) ListSellers(ctx context.Context, skip uint64, take uint64) ([]Seller, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT account_id, name, created_at FROM sellers ORDER BY created_at, account_id OFFSET $1 LIMIT $2",
+		skip,
+		take,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sellers: %v", err)
+	}
+	defer rows.Close()
+
+	sellers := []Seller{}
+	for rows.Next() {
+		s := Seller{}
+		if err := rows.Scan(&s.AccountID, &s.Name, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan seller row: %v", err)
+		}
+		sellers = append(sellers, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over seller rows: %v", err)
+	}
+	return sellers, nil
+}
@@ -0,0 +1,118 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/donaldnash/go-marketplace/migrate"
+	"github.com/segmentio/ksuid"
+)
+
+// openTestDatabase migrates the database in ACCOUNT_TEST_DATABASE_URL and
+// returns its URL. Tests using it are skipped without one.
+func openTestDatabase(t *testing.T) string {
+	t.Helper()
+
+	url := os.Getenv("ACCOUNT_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("ACCOUNT_TEST_DATABASE_URL is not set")
+	}
+
+	m, err := migrate.Open(url, Migrations())
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer m.Close()
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return url
+}
+
+func openTestRepository(t *testing.T) Repository {
+	t.Helper()
+	r, err := NewPostgresRepository(openTestDatabase(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	return r
+}
+
+func TestPutAccountWithKeyConcurrent(t *testing.T) {
+	r := openTestRepository(t)
+	ctx := context.Background()
+	key := ksuid.New().String()
+	name := "account " + key
+
+	const calls = 20
+	ids := make([]string, calls)
+	errs := make([]error, calls)
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			a := Account{ID: ksuid.New().String(), Name: name}
+			stored, err := r.PutAccountWithKey(ctx, a, "", key, "hash-1")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			ids[i] = stored.ID
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if ids[i] != ids[0] {
+			t.Errorf("call %d returned account %s, want %s", i, ids[i], ids[0])
+		}
+	}
+	if _, err := r.GetAccountByID(ctx, ids[0]); err != nil {
+		t.Errorf("GetAccountByID(%s): %v", ids[0], err)
+	}
+}
+
+func TestPutAccountWithKeyReused(t *testing.T) {
+	r := openTestRepository(t)
+	ctx := context.Background()
+	key := ksuid.New().String()
+
+	a := Account{ID: ksuid.New().String(), Name: "account " + key}
+	if _, err := r.PutAccountWithKey(ctx, a, "", key, "hash-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Account{ID: ksuid.New().String(), Name: "other " + key}
+	if _, err := r.PutAccountWithKey(ctx, b, "", key, "hash-2"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("PutAccountWithKey with another request = %v, want %v", err, ErrIdempotencyKeyReused)
+	}
+}
+
+func TestPutAccountWithKeyScopedToCaller(t *testing.T) {
+	r := openTestRepository(t)
+	ctx := context.Background()
+	key := ksuid.New().String()
+
+	a := Account{ID: ksuid.New().String(), Name: "account " + key}
+	if _, err := r.PutAccountWithKey(ctx, a, "alice", key, "hash-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another caller's key of the same name is its own.
+	b := Account{ID: ksuid.New().String(), Name: "other " + key}
+	stored, err := r.PutAccountWithKey(ctx, b, "bob", key, "hash-2")
+	if err != nil {
+		t.Fatalf("PutAccountWithKey for another caller: %v", err)
+	}
+	if stored.ID != b.ID {
+		t.Errorf("PutAccountWithKey for another caller returned account %s, want %s", stored.ID, b.ID)
+	}
+}
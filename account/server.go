@@ -11,23 +11,24 @@ import (
 )
 
 type grpcServer struct {
-	service Service
+	service   Service
+	wishlists WishlistService
 	pb.UnimplementedAccountServiceServer
 }
 
-func ListenGRPC(s Service, port int) error {
+func ListenGRPC(s Service, wishlists WishlistService, port int, opts ...grpc.ServerOption) error {
 	list, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return err
 	}
-	serv := grpc.NewServer()
-	pb.RegisterAccountServiceServer(serv, &grpcServer{service: s})
+	serv := grpc.NewServer(opts...)
+	pb.RegisterAccountServiceServer(serv, &grpcServer{service: s, wishlists: wishlists})
 	reflection.Register(serv)
 	return serv.Serve(list)
 }
 
 func (s *grpcServer) PostAccount(ctx context.Context, r *pb.PostAccountRequest) (*pb.PostAccountResponse, error) {
-	a, err := s.service.PostAccount(ctx, r.Name)
+	a, err := s.service.PostAccount(ctx, r.Name, r.CallerId, r.IdempotencyKey)
 	if err != nil {
 		return nil, err
 	}
@@ -66,3 +67,259 @@ func (s *grpcServer) GetAccounts(ctx context.Context, r *pb.GetAccountsRequest)
 
 	return &pb.GetAccountsResponse{Accounts: pbAccounts}, nil
 }
+
+func (s *grpcServer) StreamAccounts(r *pb.StreamAccountsRequest, stream pb.AccountService_StreamAccountsServer) error {
+	return s.service.StreamAccounts(stream.Context(), func(a Account) error {
+		return stream.Send(&pb.Account{
+			Id:   a.ID,
+			Name: a.Name,
+		})
+	})
+}
+
+func (s *grpcServer) PostAddress(ctx context.Context, r *pb.PostAddressRequest) (*pb.PostAddressResponse, error) {
+	a, err := s.service.PostAddress(ctx, addressFromProto(r.Address))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PostAddressResponse{Address: addressToProto(*a)}, nil
+}
+
+func (s *grpcServer) UpdateAddress(ctx context.Context, r *pb.UpdateAddressRequest) (*pb.UpdateAddressResponse, error) {
+	a, err := s.service.UpdateAddress(ctx, addressFromProto(r.Address))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UpdateAddressResponse{Address: addressToProto(*a)}, nil
+}
+
+func (s *grpcServer) DeleteAddress(ctx context.Context, r *pb.DeleteAddressRequest) (*pb.DeleteAddressResponse, error) {
+	if err := s.service.DeleteAddress(ctx, r.AccountId, r.Id); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteAddressResponse{}, nil
+}
+
+func (s *grpcServer) GetAddress(ctx context.Context, r *pb.GetAddressRequest) (*pb.GetAddressResponse, error) {
+	a, err := s.service.GetAddress(ctx, r.AccountId, r.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetAddressResponse{Address: addressToProto(*a)}, nil
+}
+
+func (s *grpcServer) GetAddresses(ctx context.Context, r *pb.GetAddressesRequest) (*pb.GetAddressesResponse, error) {
+	addresses, err := s.service.GetAddresses(ctx, r.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	pbAddresses := make([]*pb.Address, len(addresses))
+	for i, a := range addresses {
+		pbAddresses[i] = addressToProto(a)
+	}
+	return &pb.GetAddressesResponse{Addresses: pbAddresses}, nil
+}
+
+func (s *grpcServer) PostSeller(ctx context.Context, r *pb.PostSellerRequest) (*pb.PostSellerResponse, error) {
+	seller, err := s.service.PostSeller(ctx, Seller{AccountID: r.AccountId, Name: r.Name})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PostSellerResponse{Seller: sellerToProto(*seller)}, nil
+}
+
+func (s *grpcServer) GetSeller(ctx context.Context, r *pb.GetSellerRequest) (*pb.GetSellerResponse, error) {
+	seller, err := s.service.GetSeller(ctx, r.AccountId)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetSellerResponse{Seller: sellerToProto(*seller)}, nil
+}
+
+func (s *grpcServer) GetSellers(ctx context.Context, r *pb.GetSellersRequest) (*pb.GetSellersResponse, error) {
+	sellers, err := s.service.GetSellers(ctx, r.Skip, r.Take)
+	if err != nil {
+		return nil, err
+	}
+
+	pbSellers := make([]*pb.Seller, len(sellers))
+	for i, seller := range sellers {
+		pbSellers[i] = sellerToProto(seller)
+	}
+	return &pb.GetSellersResponse{Sellers: pbSellers}, nil
+}
+
+func (s *grpcServer) CreateWishlist(ctx context.Context, r *pb.CreateWishlistRequest) (*pb.WishlistResponse, error) {
+	w, err := s.wishlists.CreateWishlist(ctx, r.AccountId, r.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.WishlistResponse{Wishlist: wishlistToProto(*w)}, nil
+}
+
+func (s *grpcServer) DeleteWishlist(ctx context.Context, r *pb.DeleteWishlistRequest) (*pb.DeleteWishlistResponse, error) {
+	if err := s.wishlists.DeleteWishlist(ctx, r.AccountId, r.Id); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteWishlistResponse{}, nil
+}
+
+func (s *grpcServer) GetWishlist(ctx context.Context, r *pb.GetWishlistRequest) (*pb.WishlistResponse, error) {
+	w, err := s.wishlists.GetWishlist(ctx, r.AccountId, r.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.WishlistResponse{Wishlist: wishlistToProto(*w)}, nil
+}
+
+func (s *grpcServer) GetWishlists(ctx context.Context, r *pb.GetWishlistsRequest) (*pb.GetWishlistsResponse, error) {
+	wishlists, err := s.wishlists.GetWishlists(ctx, r.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	pbWishlists := make([]*pb.Wishlist, len(wishlists))
+	for i, w := range wishlists {
+		pbWishlists[i] = wishlistToProto(w)
+	}
+	return &pb.GetWishlistsResponse{Wishlists: pbWishlists}, nil
+}
+
+func (s *grpcServer) AddWishlistItem(ctx context.Context, r *pb.AddWishlistItemRequest) (*pb.WishlistResponse, error) {
+	w, err := s.wishlists.AddWishlistItem(ctx, r.AccountId, r.WishlistId, wishlistItemFromProto(r.Item))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.WishlistResponse{Wishlist: wishlistToProto(*w)}, nil
+}
+
+func (s *grpcServer) RemoveWishlistItem(ctx context.Context, r *pb.RemoveWishlistItemRequest) (*pb.WishlistResponse, error) {
+	w, err := s.wishlists.RemoveWishlistItem(ctx, r.AccountId, r.WishlistId, r.ProductId, r.VariantId)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.WishlistResponse{Wishlist: wishlistToProto(*w)}, nil
+}
+
+func (s *grpcServer) ShareWishlist(ctx context.Context, r *pb.ShareWishlistRequest) (*pb.WishlistResponse, error) {
+	w, err := s.wishlists.ShareWishlist(ctx, r.AccountId, r.Id, r.Shared)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.WishlistResponse{Wishlist: wishlistToProto(*w)}, nil
+}
+
+func (s *grpcServer) GetSharedWishlist(ctx context.Context, r *pb.GetSharedWishlistRequest) (*pb.WishlistResponse, error) {
+	w, err := s.wishlists.GetSharedWishlist(ctx, r.Token)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.WishlistResponse{Wishlist: wishlistToProto(*w)}, nil
+}
+
+func addressToProto(a Address) *pb.Address {
+	pa := &pb.Address{
+		Id:         a.ID,
+		AccountId:  a.AccountID,
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+	pa.CreatedAt, _ = a.CreatedAt.MarshalBinary()
+	return pa
+}
+
+func addressFromProto(pa *pb.Address) Address {
+	if pa == nil {
+		return Address{}
+	}
+	a := Address{
+		ID:         pa.Id,
+		AccountID:  pa.AccountId,
+		Name:       pa.Name,
+		Line1:      pa.Line1,
+		Line2:      pa.Line2,
+		City:       pa.City,
+		Region:     pa.Region,
+		PostalCode: pa.PostalCode,
+		Country:    pa.Country,
+	}
+	a.CreatedAt.UnmarshalBinary(pa.CreatedAt)
+	return a
+}
+
+func sellerToProto(s Seller) *pb.Seller {
+	ps := &pb.Seller{AccountId: s.AccountID, Name: s.Name}
+	ps.CreatedAt, _ = s.CreatedAt.MarshalBinary()
+	return ps
+}
+
+func sellerFromProto(ps *pb.Seller) Seller {
+	if ps == nil {
+		return Seller{}
+	}
+	s := Seller{AccountID: ps.AccountId, Name: ps.Name}
+	s.CreatedAt.UnmarshalBinary(ps.CreatedAt)
+	return s
+}
+
+func wishlistToProto(w Wishlist) *pb.Wishlist {
+	pw := &pb.Wishlist{
+		Id:         w.ID,
+		AccountId:  w.AccountID,
+		Name:       w.Name,
+		ShareToken: w.ShareToken,
+		Items:      make([]*pb.WishlistItem, len(w.Items)),
+	}
+	for i, item := range w.Items {
+		pw.Items[i] = wishlistItemToProto(item)
+	}
+	pw.CreatedAt, _ = w.CreatedAt.MarshalBinary()
+	return pw
+}
+
+func wishlistFromProto(pw *pb.Wishlist) Wishlist {
+	if pw == nil {
+		return Wishlist{}
+	}
+	w := Wishlist{
+		ID:         pw.Id,
+		AccountID:  pw.AccountId,
+		Name:       pw.Name,
+		ShareToken: pw.ShareToken,
+		Items:      make([]WishlistItem, len(pw.Items)),
+	}
+	for i, item := range pw.Items {
+		w.Items[i] = wishlistItemFromProto(item)
+	}
+	w.CreatedAt.UnmarshalBinary(pw.CreatedAt)
+	return w
+}
+
+func wishlistItemToProto(item WishlistItem) *pb.WishlistItem {
+	pi := &pb.WishlistItem{
+		ProductId:  item.ProductID,
+		VariantId:  item.VariantID,
+		SavedPrice: item.SavedPrice,
+	}
+	pi.AddedAt, _ = item.AddedAt.MarshalBinary()
+	return pi
+}
+
+func wishlistItemFromProto(pi *pb.WishlistItem) WishlistItem {
+	if pi == nil {
+		return WishlistItem{}
+	}
+	item := WishlistItem{
+		ProductID:  pi.ProductId,
+		VariantID:  pi.VariantId,
+		SavedPrice: pi.SavedPrice,
+	}
+	item.AddedAt.UnmarshalBinary(pi.AddedAt)
+	return item
+}
@@ -2,15 +2,54 @@ package account
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/segmentio/ksuid"
 )
 
+var (
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+	ErrAddressNotFound      = errors.New("address not found")
+	ErrSellerNotFound       = errors.New("seller not found")
+	ErrSellerExists         = errors.New("account is already a seller")
+	ErrSellerNameTaken      = errors.New("seller name is already taken")
+)
+
+const (
+	// EventAccountCreated is recorded in the outbox when an account is
+	// created.
+	EventAccountCreated = "AccountCreated"
+	// EventSellerRegistered is recorded in the outbox when an account
+	// becomes a seller.
+	EventSellerRegistered = "SellerRegistered"
+)
+
+// maxAddressesPerAccount bounds the address book of an account.
+const maxAddressesPerAccount = 20
+
 type Service interface {
-	PostAccount(ctx context.Context, name string) (*Account, error)
+	// PostAccount creates an account. An idempotency key is scoped to
+	// callerID, the account asking for the new one, or "" for anonymous
+	// callers.
+	PostAccount(ctx context.Context, name string, callerID string, idempotencyKey string) (*Account, error)
 	GetAccount(ctx context.Context, id string) (*Account, error)
 	GetAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error)
+	// StreamAccounts calls fn with every account until fn returns an error.
+	StreamAccounts(ctx context.Context, fn func(Account) error) error
+	PostAddress(ctx context.Context, a Address) (*Address, error)
+	UpdateAddress(ctx context.Context, a Address) (*Address, error)
+	DeleteAddress(ctx context.Context, accountID string, id string) error
+	GetAddress(ctx context.Context, accountID string, id string) (*Address, error)
+	GetAddresses(ctx context.Context, accountID string) ([]Address, error)
+	// PostSeller registers the account of s as a seller under s.Name.
+	PostSeller(ctx context.Context, s Seller) (*Seller, error)
+	GetSeller(ctx context.Context, accountID string) (*Seller, error)
+	GetSellers(ctx context.Context, skip uint64, take uint64) ([]Seller, error)
 }
 
 type Account struct {
@@ -18,6 +57,53 @@ type Account struct {
 	Name string `json:"name"`
 }
 
+// Seller is an account that sells products on the marketplace, under a
+// store name of its own.
+type Seller struct {
+	AccountID string    `json:"account_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Address is an entry in an account's address book. Country is an ISO 3166-1
+// alpha-2 code.
+type Address struct {
+	ID         string    `json:"id"`
+	AccountID  string    `json:"account_id"`
+	Name       string    `json:"name"`
+	Line1      string    `json:"line1"`
+	Line2      string    `json:"line2"`
+	City       string    `json:"city"`
+	Region     string    `json:"region"`
+	PostalCode string    `json:"postal_code"`
+	Country    string    `json:"country"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (a *Address) normalize() error {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Line1 = strings.TrimSpace(a.Line1)
+	a.Line2 = strings.TrimSpace(a.Line2)
+	a.City = strings.TrimSpace(a.City)
+	a.Region = strings.ToUpper(strings.TrimSpace(a.Region))
+	a.PostalCode = strings.TrimSpace(a.PostalCode)
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+
+	switch {
+	case a.AccountID == "":
+		return fmt.Errorf("account ID is required")
+	case a.Name == "":
+		return fmt.Errorf("address name is required")
+	case a.Line1 == "":
+		return fmt.Errorf("address line 1 is required")
+	case a.City == "":
+		return fmt.Errorf("address city is required")
+	case len(a.Country) != 2:
+		return fmt.Errorf("address country must be a two-letter country code")
+	}
+	return nil
+}
+
 type accountService struct {
 	repository Repository
 }
@@ -29,7 +115,7 @@ func NewService(r Repository) Service {
 	return &accountService{r}
 }
 
-func (s *accountService) PostAccount(ctx context.Context, name string) (*Account, error) {
+func (s *accountService) PostAccount(ctx context.Context, name string, callerID string, idempotencyKey string) (*Account, error) {
 	if ctx == nil {
 		return nil, fmt.Errorf("context is required")
 	}
@@ -41,6 +127,19 @@ func (s *accountService) PostAccount(ctx context.Context, name string) (*Account
 		Name: name,
 		ID:   ksuid.New().String(),
 	}
+
+	if idempotencyKey != "" {
+		hash := sha256.Sum256([]byte(name))
+		stored, err := s.repository.PutAccountWithKey(ctx, *a, callerID, idempotencyKey, hex.EncodeToString(hash[:]))
+		if err != nil {
+			if errors.Is(err, ErrIdempotencyKeyReused) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to create account: %v", err)
+		}
+		return stored, nil
+	}
+
 	if err := s.repository.PutAccount(ctx, *a); err != nil {
 		return nil, fmt.Errorf("failed to create account: %v", err)
 	}
@@ -78,3 +177,149 @@ func (s *accountService) GetAccounts(ctx context.Context, skip uint64, take uint
 	}
 	return accounts, nil
 }
+
+func (s *accountService) StreamAccounts(ctx context.Context, fn func(Account) error) error {
+	if ctx == nil {
+		return fmt.Errorf("context is required")
+	}
+	return s.repository.StreamAccounts(ctx, fn)
+}
+
+func (s *accountService) PostAddress(ctx context.Context, a Address) (*Address, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if err := a.normalize(); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repository.GetAccountByID(ctx, a.AccountID); err != nil {
+		return nil, fmt.Errorf("failed to get account: %v", err)
+	}
+	existing, err := s.repository.ListAddresses(ctx, a.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses: %v", err)
+	}
+	if len(existing) >= maxAddressesPerAccount {
+		return nil, fmt.Errorf("an account cannot have more than %d addresses", maxAddressesPerAccount)
+	}
+
+	a.ID = ksuid.New().String()
+	a.CreatedAt = time.Now().UTC()
+	if err := s.repository.PutAddress(ctx, a); err != nil {
+		return nil, fmt.Errorf("failed to create address: %v", err)
+	}
+	return &a, nil
+}
+
+func (s *accountService) UpdateAddress(ctx context.Context, a Address) (*Address, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if a.ID == "" {
+		return nil, fmt.Errorf("address ID is required")
+	}
+	if err := a.normalize(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.UpdateAddress(ctx, a); err != nil {
+		if err == ErrAddressNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update address: %v", err)
+	}
+	return s.repository.GetAddress(ctx, a.AccountID, a.ID)
+}
+
+func (s *accountService) DeleteAddress(ctx context.Context, accountID string, id string) error {
+	if ctx == nil {
+		return fmt.Errorf("context is required")
+	}
+	if accountID == "" {
+		return fmt.Errorf("account ID is required")
+	}
+	if id == "" {
+		return fmt.Errorf("address ID is required")
+	}
+	return s.repository.DeleteAddress(ctx, accountID, id)
+}
+
+func (s *accountService) GetAddress(ctx context.Context, accountID string, id string) (*Address, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	if id == "" {
+		return nil, fmt.Errorf("address ID is required")
+	}
+	return s.repository.GetAddress(ctx, accountID, id)
+}
+
+func (s *accountService) GetAddresses(ctx context.Context, accountID string) ([]Address, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+
+	addresses, err := s.repository.ListAddresses(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses: %v", err)
+	}
+	return addresses, nil
+}
+
+func (s *accountService) PostSeller(ctx context.Context, seller Seller) (*Seller, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	seller.Name = strings.TrimSpace(seller.Name)
+	if seller.AccountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	if seller.Name == "" {
+		return nil, fmt.Errorf("seller name is required")
+	}
+
+	if _, err := s.repository.GetAccountByID(ctx, seller.AccountID); err != nil {
+		return nil, fmt.Errorf("failed to get account: %v", err)
+	}
+
+	seller.CreatedAt = time.Now().UTC()
+	if err := s.repository.PutSeller(ctx, seller); err != nil {
+		if errors.Is(err, ErrSellerExists) || errors.Is(err, ErrSellerNameTaken) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to register seller: %v", err)
+	}
+	return &seller, nil
+}
+
+func (s *accountService) GetSeller(ctx context.Context, accountID string) (*Seller, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	return s.repository.GetSeller(ctx, accountID)
+}
+
+func (s *accountService) GetSellers(ctx context.Context, skip uint64, take uint64) ([]Seller, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if take > 100 || (skip == 0 && take == 0) {
+		take = 100
+	}
+
+	sellers, err := s.repository.ListSellers(ctx, skip, take)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sellers: %v", err)
+	}
+	return sellers, nil
+}
@@ -0,0 +1,248 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// WishlistRepository stores wishlists in the account database, next to the
+// accounts that own them.
+type WishlistRepository interface {
+	Close()
+	PutWishlist(ctx context.Context, w Wishlist) error
+	DeleteWishlist(ctx context.Context, accountID string, id string) error
+	// GetWishlist returns a list of the account with its items, oldest
+	// first.
+	GetWishlist(ctx context.Context, accountID string, id string) (*Wishlist, error)
+	GetWishlistByShareToken(ctx context.Context, token string) (*Wishlist, error)
+	ListWishlists(ctx context.Context, accountID string) ([]Wishlist, error)
+	// PutWishlistItem adds item to a list of the account, unless the list
+	// has it already.
+	PutWishlistItem(ctx context.Context, accountID string, wishlistID string, item WishlistItem) error
+	DeleteWishlistItem(ctx context.Context, accountID string, wishlistID string, productID string, variantID string) error
+	// SetShareToken replaces the share token of a list; an empty token
+	// stops sharing it.
+	SetShareToken(ctx context.Context, accountID string, id string, token string) error
+}
+
+type postgresWishlistRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresWishlistRepository(url string) (WishlistRepository, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	err = db.Ping()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	return &postgresWishlistRepository{db}, nil
+}
+
+func (r *postgresWishlistRepository) Close() {
+	if r.db != nil {
+		r.db.Close()
+	}
+}
+
+const wishlistColumns = "id, account_id, name, COALESCE(share_token, ''), created_at"
+
+func (r *postgresWishlistRepository) PutWishlist(ctx context.Context, w Wishlist) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO wishlists(id, account_id, name, created_at) VALUES ($1, $2, $3, $4)",
+		w.ID,
+		w.AccountID,
+		w.Name,
+		w.CreatedAt,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				return ErrWishlistNameTaken
+			case "foreign_key_violation":
+				return fmt.Errorf("account with ID %s not found", w.AccountID)
+			}
+		}
+		return fmt.Errorf("failed to insert wishlist: %v", err)
+	}
+	return nil
+}
+
+func (r *postgresWishlistRepository) DeleteWishlist(ctx context.Context, accountID string, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM wishlists WHERE id = $1 AND account_id = $2", id, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to delete wishlist: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrWishlistNotFound
+	}
+	return nil
+}
+
+func (r *postgresWishlistRepository) GetWishlist(ctx context.Context, accountID string, id string) (*Wishlist, error) {
+	return r.getWishlist(ctx, "SELECT "+wishlistColumns+" FROM wishlists WHERE id = $1 AND account_id = $2", id, accountID)
+}
+
+func (r *postgresWishlistRepository) GetWishlistByShareToken(ctx context.Context, token string) (*Wishlist, error) {
+	return r.getWishlist(ctx, "SELECT "+wishlistColumns+" FROM wishlists WHERE share_token = $1", token)
+}
+
+func (r *postgresWishlistRepository) getWishlist(ctx context.Context, query string, args ...interface{}) (*Wishlist, error) {
+	w := Wishlist{}
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&w.ID, &w.AccountID, &w.Name, &w.ShareToken, &w.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWishlistNotFound
+		}
+		return nil, fmt.Errorf("failed to scan wishlist row: %v", err)
+	}
+
+	wishlists := []Wishlist{w}
+	if err := r.loadItems(ctx, wishlists); err != nil {
+		return nil, err
+	}
+	return &wishlists[0], nil
+}
+
+func (r *postgresWishlistRepository) ListWishlists(ctx context.Context, accountID string) ([]Wishlist, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT "+wishlistColumns+" FROM wishlists WHERE account_id = $1 ORDER BY created_at, id",
+		accountID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query wishlists: %v", err)
+	}
+	defer rows.Close()
+
+	wishlists := []Wishlist{}
+	for rows.Next() {
+		w := Wishlist{}
+		if err := rows.Scan(&w.ID, &w.AccountID, &w.Name, &w.ShareToken, &w.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan wishlist row: %v", err)
+		}
+		wishlists = append(wishlists, w)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over wishlist rows: %v", err)
+	}
+
+	if err := r.loadItems(ctx, wishlists); err != nil {
+		return nil, err
+	}
+	return wishlists, nil
+}
+
+// loadItems fills in the items of wishlists.
+func (r *postgresWishlistRepository) loadItems(ctx context.Context, wishlists []Wishlist) error {
+	if len(wishlists) == 0 {
+		return nil
+	}
+	ids := make([]string, len(wishlists))
+	byID := make(map[string]*Wishlist, len(wishlists))
+	for i := range wishlists {
+		ids[i] = wishlists[i].ID
+		wishlists[i].Items = []WishlistItem{}
+		byID[wishlists[i].ID] = &wishlists[i]
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT wishlist_id, product_id, variant_id, saved_price, added_at FROM wishlist_items
+		WHERE wishlist_id = ANY($1)
+		ORDER BY added_at, product_id, variant_id`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query wishlist items: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wishlistID string
+		item := WishlistItem{}
+		if err := rows.Scan(&wishlistID, &item.ProductID, &item.VariantID, &item.SavedPrice, &item.AddedAt); err != nil {
+			return fmt.Errorf("failed to scan wishlist item row: %v", err)
+		}
+		if w, ok := byID[wishlistID]; ok {
+			w.Items = append(w.Items, item)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over wishlist item rows: %v", err)
+	}
+	return nil
+}
+
+func (r *postgresWishlistRepository) PutWishlistItem(ctx context.Context, accountID string, wishlistID string, item WishlistItem) error {
+	// Selecting the list makes sure it belongs to the account.
+	res, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO wishlist_items(wishlist_id, product_id, variant_id, saved_price, added_at)
+		SELECT id, $3, $4, $5, $6 FROM wishlists WHERE id = $1 AND account_id = $2
+		ON CONFLICT DO NOTHING`,
+		wishlistID,
+		accountID,
+		item.ProductID,
+		item.VariantID,
+		item.SavedPrice,
+		item.AddedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert wishlist item: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		// Either the list is gone or it has the item already.
+		if _, err := r.GetWishlist(ctx, accountID, wishlistID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *postgresWishlistRepository) DeleteWishlistItem(ctx context.Context, accountID string, wishlistID string, productID string, variantID string) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		`DELETE FROM wishlist_items i USING wishlists w
+		WHERE i.wishlist_id = w.id AND w.id = $1 AND w.account_id = $2 AND i.product_id = $3 AND i.variant_id = $4`,
+		wishlistID,
+		accountID,
+		productID,
+		variantID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete wishlist item: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		// Removing a product the list does not have is not an error, but
+		// removing it from a list that does not exist is.
+		if _, err := r.GetWishlist(ctx, accountID, wishlistID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *postgresWishlistRepository) SetShareToken(ctx context.Context, accountID string, id string, token string) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		"UPDATE wishlists SET share_token = NULLIF($3, '') WHERE id = $1 AND account_id = $2",
+		id,
+		accountID,
+		token,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update wishlist: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrWishlistNotFound
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+var (
+	ErrWishlistNotFound  = errors.New("wishlist not found")
+	ErrWishlistNameTaken = errors.New("account already has a wishlist with this name")
+	// ErrWishlistFull is returned when an account has too many wishlists or
+	// a wishlist too many products.
+	ErrWishlistFull = errors.New("wishlist limit reached")
+)
+
+const (
+	maxWishlistsPerAccount = 20
+	maxWishlistItems       = 100
+)
+
+// Wishlist is a named list of products an account saved, such as a wishlist
+// or products saved for later. ShareToken is set while the list is shared.
+type Wishlist struct {
+	ID         string         `json:"id"`
+	AccountID  string         `json:"account_id"`
+	Name       string         `json:"name"`
+	ShareToken string         `json:"share_token,omitempty"`
+	Items      []WishlistItem `json:"items"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// WishlistItem is a saved product, or a variant of it. SavedPrice is what it
+// cost when it was saved.
+type WishlistItem struct {
+	ProductID  string    `json:"product_id"`
+	VariantID  string    `json:"variant_id,omitempty"`
+	SavedPrice float64   `json:"saved_price"`
+	AddedAt    time.Time `json:"added_at"`
+}
+
+type WishlistService interface {
+	CreateWishlist(ctx context.Context, accountID string, name string) (*Wishlist, error)
+	DeleteWishlist(ctx context.Context, accountID string, id string) error
+	GetWishlist(ctx context.Context, accountID string, id string) (*Wishlist, error)
+	GetWishlists(ctx context.Context, accountID string) ([]Wishlist, error)
+	// AddWishlistItem saves a product to a list. Saving it again keeps the
+	// price it was first saved at.
+	AddWishlistItem(ctx context.Context, accountID string, wishlistID string, item WishlistItem) (*Wishlist, error)
+	RemoveWishlistItem(ctx context.Context, accountID string, wishlistID string, productID string, variantID string) (*Wishlist, error)
+	// ShareWishlist gives a list a new share token, or takes its token away
+	// when shared is false.
+	ShareWishlist(ctx context.Context, accountID string, id string, shared bool) (*Wishlist, error)
+	GetSharedWishlist(ctx context.Context, token string) (*Wishlist, error)
+}
+
+type wishlistService struct {
+	repository WishlistRepository
+}
+
+func NewWishlistService(r WishlistRepository) WishlistService {
+	if r == nil {
+		panic("wishlist repository cannot be nil")
+	}
+	return &wishlistService{r}
+}
+
+func (s *wishlistService) CreateWishlist(ctx context.Context, accountID string, name string) (*Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	name = strings.TrimSpace(name)
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("wishlist name is required")
+	}
+
+	existing, err := s.repository.ListWishlists(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wishlists: %v", err)
+	}
+	if len(existing) >= maxWishlistsPerAccount {
+		return nil, fmt.Errorf("%w: an account cannot have more than %d wishlists", ErrWishlistFull, maxWishlistsPerAccount)
+	}
+
+	w := Wishlist{
+		ID:        ksuid.New().String(),
+		AccountID: accountID,
+		Name:      name,
+		Items:     []WishlistItem{},
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.repository.PutWishlist(ctx, w); err != nil {
+		if errors.Is(err, ErrWishlistNameTaken) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create wishlist: %v", err)
+	}
+	return &w, nil
+}
+
+func (s *wishlistService) DeleteWishlist(ctx context.Context, accountID string, id string) error {
+	if ctx == nil {
+		return fmt.Errorf("context is required")
+	}
+	if accountID == "" {
+		return fmt.Errorf("account ID is required")
+	}
+	if id == "" {
+		return fmt.Errorf("wishlist ID is required")
+	}
+	return s.repository.DeleteWishlist(ctx, accountID, id)
+}
+
+func (s *wishlistService) GetWishlist(ctx context.Context, accountID string, id string) (*Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	if id == "" {
+		return nil, fmt.Errorf("wishlist ID is required")
+	}
+	return s.repository.GetWishlist(ctx, accountID, id)
+}
+
+func (s *wishlistService) GetWishlists(ctx context.Context, accountID string) ([]Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+
+	wishlists, err := s.repository.ListWishlists(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wishlists: %v", err)
+	}
+	return wishlists, nil
+}
+
+func (s *wishlistService) AddWishlistItem(ctx context.Context, accountID string, wishlistID string, item WishlistItem) (*Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	if wishlistID == "" {
+		return nil, fmt.Errorf("wishlist ID is required")
+	}
+	if item.ProductID == "" {
+		return nil, fmt.Errorf("product ID is required")
+	}
+	if item.SavedPrice < 0 {
+		return nil, fmt.Errorf("saved price cannot be negative")
+	}
+
+	w, err := s.repository.GetWishlist(ctx, accountID, wishlistID)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range w.Items {
+		if existing.ProductID == item.ProductID && existing.VariantID == item.VariantID {
+			return w, nil
+		}
+	}
+	if len(w.Items) >= maxWishlistItems {
+		return nil, fmt.Errorf("%w: a wishlist cannot have more than %d products", ErrWishlistFull, maxWishlistItems)
+	}
+
+	item.AddedAt = time.Now().UTC()
+	if err := s.repository.PutWishlistItem(ctx, accountID, wishlistID, item); err != nil {
+		if errors.Is(err, ErrWishlistNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to save product: %v", err)
+	}
+	return s.repository.GetWishlist(ctx, accountID, wishlistID)
+}
+
+func (s *wishlistService) RemoveWishlistItem(ctx context.Context, accountID string, wishlistID string, productID string, variantID string) (*Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	if wishlistID == "" {
+		return nil, fmt.Errorf("wishlist ID is required")
+	}
+	if productID == "" {
+		return nil, fmt.Errorf("product ID is required")
+	}
+
+	if err := s.repository.DeleteWishlistItem(ctx, accountID, wishlistID, productID, variantID); err != nil {
+		if errors.Is(err, ErrWishlistNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to remove product: %v", err)
+	}
+	return s.repository.GetWishlist(ctx, accountID, wishlistID)
+}
+
+func (s *wishlistService) ShareWishlist(ctx context.Context, accountID string, id string, shared bool) (*Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	if id == "" {
+		return nil, fmt.Errorf("wishlist ID is required")
+	}
+
+	token := ""
+	if shared {
+		var err error
+		if token, err = newShareToken(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repository.SetShareToken(ctx, accountID, id, token); err != nil {
+		if errors.Is(err, ErrWishlistNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to share wishlist: %v", err)
+	}
+	return s.repository.GetWishlist(ctx, accountID, id)
+}
+
+func (s *wishlistService) GetSharedWishlist(ctx context.Context, token string) (*Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("share token is required")
+	}
+	return s.repository.GetWishlistByShareToken(ctx, token)
+}
+
+// newShareToken returns a token that cannot be guessed, fit for URLs.
+func newShareToken() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
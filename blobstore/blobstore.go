@@ -0,0 +1,65 @@
+// Package blobstore keeps files, such as product images, in a local directory
+// or an S3-compatible bucket, and tells where clients can fetch them.
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// BlobStore keeps files under slash-separated keys such as
+// "products/42/image". Implementations must be safe for concurrent use.
+type BlobStore interface {
+	// Put stores what r reads under key, replacing what was there.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL is where clients fetch key from.
+	URL(key string) string
+}
+
+// Options selects where a service keeps its files.
+type Options struct {
+	// Store is "local" or "s3".
+	Store string `envconfig:"BLOB_STORE" default:"local"`
+	// PublicURL is the base of the URLs files are served at. The S3 store
+	// defaults to the bucket's own URL.
+	PublicURL string `envconfig:"BLOB_PUBLIC_URL"`
+	// LocalDir is the directory of the local store.
+	LocalDir string `envconfig:"BLOB_LOCAL_DIR" default:"media"`
+	// S3Endpoint is the S3 API, or that of a compatible store such as MinIO.
+	S3Endpoint  string `envconfig:"BLOB_S3_ENDPOINT" default:"https://s3.amazonaws.com"`
+	S3Region    string `envconfig:"BLOB_S3_REGION" default:"us-east-1"`
+	S3Bucket    string `envconfig:"BLOB_S3_BUCKET"`
+	S3AccessKey string `envconfig:"BLOB_S3_ACCESS_KEY"`
+	S3SecretKey string `envconfig:"BLOB_S3_SECRET_KEY"`
+	// S3PathStyle addresses the bucket in the path rather than the host
+	// name, as most S3-compatible stores expect.
+	S3PathStyle bool `envconfig:"BLOB_S3_PATH_STYLE"`
+}
+
+func New(o Options) (BlobStore, error) {
+	switch o.Store {
+	case "local":
+		return NewLocalStore(o.LocalDir, o.PublicURL)
+	case "s3":
+		return NewS3Store(o)
+	}
+	return nil, fmt.Errorf("unknown blob store %q", o.Store)
+}
+
+// validKey reports whether key is a clean relative path, so that it cannot
+// name anything outside the store.
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+func joinURL(base string, key string) string {
+	return strings.TrimSuffix(base, "/") + "/" + key
+}
@@ -0,0 +1,97 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps files in a directory, for running without object storage.
+type LocalStore struct {
+	dir       string
+	publicURL string
+}
+
+// NewLocalStore keeps files in dir, creating it if needed. They are fetched
+// from publicURL, which should serve Handler.
+func NewLocalStore(dir string, publicURL string) (*LocalStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("blob directory is required")
+	}
+	if publicURL == "" {
+		return nil, fmt.Errorf("public URL of the local blob store is required")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %v", err)
+	}
+	return &LocalStore{dir: dir, publicURL: publicURL}, nil
+}
+
+// Put writes to a temporary file first, so a file is never seen half
+// written.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	name := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %v", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write blob: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write blob: %v", err)
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write blob: %v", err)
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return fmt.Errorf("failed to write blob: %v", err)
+	}
+	return nil
+}
+
+// Delete also removes the directories the file leaves empty.
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	name := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob: %v", err)
+	}
+	for dir := filepath.Dir(name); dir != filepath.Clean(s.dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return joinURL(s.publicURL, key)
+}
+
+// Handler serves the files of the store by key. Directories are not listed.
+func (s *LocalStore) Handler() http.Handler {
+	files := http.FileServer(http.Dir(s.dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") || strings.Contains(r.URL.Path, "/.") {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,196 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Store keeps files in a bucket of Amazon S3 or a compatible store,
+// signing its requests with AWS Signature Version 4.
+type S3Store struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	publicURL string
+	client    *http.Client
+}
+
+func NewS3Store(o Options) (*S3Store, error) {
+	endpoint, err := url.Parse(o.S3Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", o.S3Endpoint)
+	}
+	if o.S3Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket is required")
+	}
+	if o.S3Region == "" {
+		return nil, fmt.Errorf("S3 region is required")
+	}
+	if o.S3AccessKey == "" || o.S3SecretKey == "" {
+		return nil, fmt.Errorf("S3 access key and secret key are required")
+	}
+
+	s := &S3Store{
+		endpoint:  endpoint,
+		region:    o.S3Region,
+		bucket:    o.S3Bucket,
+		accessKey: o.S3AccessKey,
+		secretKey: o.S3SecretKey,
+		pathStyle: o.S3PathStyle,
+		publicURL: o.PublicURL,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if s.publicURL == "" {
+		s.publicURL = s.bucketURL().String()
+	}
+	return s, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	// The payload is hashed into the signature, so it is read up front.
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read blob: %v", err)
+	}
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	res, err := s.do(ctx, http.MethodPut, key, header, body)
+	if err != nil {
+		return fmt.Errorf("failed to upload blob: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to upload blob: %s", s3Error(res))
+	}
+	return nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	res, err := s.do(ctx, http.MethodDelete, key, http.Header{}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete blob: %v", err)
+	}
+	defer res.Body.Close()
+	// S3 answers 204 whether or not the key existed; some compatible stores
+	// answer 404 for a missing key.
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to delete blob: %s", s3Error(res))
+	}
+	return nil
+}
+
+func (s *S3Store) URL(key string) string {
+	return joinURL(s.publicURL, escapeKey(key))
+}
+
+func (s *S3Store) bucketURL() *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	return &u
+}
+
+func (s *S3Store) do(ctx context.Context, method string, key string, header http.Header, body []byte) (*http.Response, error) {
+	u := s.bucketURL()
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/" + escapeKey(key)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, body, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// sign adds the headers of AWS Signature Version 4 to req.
+func (s *S3Store) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		strings.Join(signed, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, strings.Join(signed, ";"), signature))
+}
+
+// escapeKey percent-encodes key the way Signature Version 4 expects: every
+// byte but unreserved characters and the slashes between segments.
+func escapeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func s3Error(res *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Sprintf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,294 @@
+package catalog
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache holds products by ID for a limited time. Implementations must be
+// safe for concurrent use.
+type Cache interface {
+	// Get returns the cached products among ids, by ID.
+	Get(ctx context.Context, ids []string) (map[string]Product, error)
+	Set(ctx context.Context, products []Product) error
+	Delete(ctx context.Context, ids []string) error
+	Stats() CacheStats
+	Close()
+}
+
+// CacheStats counts the lookups of a cache since it was created.
+type CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Invalidations uint64
+}
+
+// HitRatio is the share of lookups that found a product, or 0 before the
+// first lookup.
+func (s CacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type memoryCache struct {
+	size int
+	ttl  time.Duration
+
+	mu            sync.Mutex
+	entries       map[string]*list.Element
+	recent        *list.List
+	hits          uint64
+	misses        uint64
+	invalidations uint64
+}
+
+type memoryEntry struct {
+	product   Product
+	expiresAt time.Time
+}
+
+// NewMemoryCache keeps up to size products in process for ttl each, and
+// evicts the least recently used product when it is full.
+func NewMemoryCache(size int, ttl time.Duration) Cache {
+	if size <= 0 {
+		panic("cache size must be positive")
+	}
+	return &memoryCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		recent:  list.New(),
+	}
+}
+
+func (c *memoryCache) Get(ctx context.Context, ids []string) (map[string]Product, error) {
+	now := time.Now()
+	products := map[string]Product{}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		el, ok := c.entries[id]
+		if !ok {
+			c.misses++
+			continue
+		}
+		e := el.Value.(*memoryEntry)
+		if !now.Before(e.expiresAt) {
+			c.recent.Remove(el)
+			delete(c.entries, id)
+			c.misses++
+			continue
+		}
+		c.recent.MoveToFront(el)
+		products[id] = e.product
+		c.hits++
+	}
+	return products, nil
+}
+
+func (c *memoryCache) Set(ctx context.Context, products []Product) error {
+	expiresAt := time.Now().Add(c.ttl)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range products {
+		if el, ok := c.entries[p.ID]; ok {
+			el.Value = &memoryEntry{product: p, expiresAt: expiresAt}
+			c.recent.MoveToFront(el)
+			continue
+		}
+		c.entries[p.ID] = c.recent.PushFront(&memoryEntry{product: p, expiresAt: expiresAt})
+		if c.recent.Len() > c.size {
+			oldest := c.recent.Back()
+			c.recent.Remove(oldest)
+			delete(c.entries, oldest.Value.(*memoryEntry).product.ID)
+		}
+	}
+	return nil
+}
+
+func (c *memoryCache) Delete(ctx context.Context, ids []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		if el, ok := c.entries[id]; ok {
+			c.recent.Remove(el)
+			delete(c.entries, id)
+		}
+		c.invalidations++
+	}
+	return nil
+}
+
+func (c *memoryCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Invalidations: c.invalidations}
+}
+
+func (c *memoryCache) Close() {}
+
+// readThrough looks products up in a cache before fetching them, and caches
+// what it fetched.
+type readThrough struct {
+	cache Cache
+	// writes changes with every invalidation. Products fetched while it
+	// changed may predate the write and are not cached.
+	writes atomic.Uint64
+}
+
+// get returns the products with ids in the order of ids, leaving out the ones
+// fetch does not find. The cache being unavailable only makes it slower.
+func (t *readThrough) get(ctx context.Context, ids []string, fetch func(ctx context.Context, ids []string) ([]Product, error)) ([]Product, error) {
+	cached, err := t.cache.Get(ctx, ids)
+	if err != nil {
+		log.Printf("Error reading product cache: %v", err)
+		cached = map[string]Product{}
+	}
+
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if _, ok := cached[id]; !ok && !seen[id] {
+			missing = append(missing, id)
+			seen[id] = true
+		}
+	}
+
+	if len(missing) > 0 {
+		writes := t.writes.Load()
+		fetched, err := fetch(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range fetched {
+			cached[p.ID] = p
+		}
+		if len(fetched) > 0 && t.writes.Load() == writes {
+			if err := t.cache.Set(ctx, fetched); err != nil {
+				log.Printf("Error writing product cache: %v", err)
+			}
+		}
+	}
+
+	products := make([]Product, 0, len(ids))
+	for _, id := range ids {
+		if p, ok := cached[id]; ok {
+			products = append(products, p)
+		}
+	}
+	return products, nil
+}
+
+// invalidate drops products that were written. It is called whether or not
+// the write succeeded, since a failed write may still have been applied.
+func (t *readThrough) invalidate(ctx context.Context, ids ...string) {
+	t.writes.Add(1)
+	// The write is done even if the caller gave up on it.
+	ctx = context.WithoutCancel(ctx)
+	if err := t.cache.Delete(ctx, ids); err != nil {
+		log.Printf("Error invalidating cached products %v: %v", ids, err)
+	}
+}
+
+// CachedRepository serves product lookups by ID from a cache and sends
+// everything else to the repository it wraps. Products are dropped from the
+// cache when they are written through it; writes made elsewhere, such as by
+// another instance with its own in-process cache, show once the cached
+// products expire.
+type CachedRepository struct {
+	Repository
+	cache *readThrough
+}
+
+func NewCachedRepository(r Repository, c Cache) *CachedRepository {
+	if r == nil {
+		panic("repository cannot be nil")
+	}
+	if c == nil {
+		panic("cache cannot be nil")
+	}
+	return &CachedRepository{Repository: r, cache: &readThrough{cache: c}}
+}
+
+func (r *CachedRepository) Close() {
+	r.Repository.Close()
+	r.cache.cache.Close()
+}
+
+// Stats returns the hit and miss counts of the cache.
+func (r *CachedRepository) Stats() CacheStats {
+	return r.cache.cache.Stats()
+}
+
+func (r *CachedRepository) GetProductByID(ctx context.Context, id string) (*Product, error) {
+	products, err := r.cache.get(ctx, []string{id}, func(ctx context.Context, ids []string) ([]Product, error) {
+		p, err := r.Repository.GetProductByID(ctx, ids[0])
+		if err != nil {
+			return nil, err
+		}
+		return []Product{*p}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &products[0], nil
+}
+
+func (r *CachedRepository) ListProductsWithIDs(ctx context.Context, ids []string) ([]Product, error) {
+	if len(ids) == 0 {
+		return []Product{}, nil
+	}
+	return r.cache.get(ctx, ids, r.Repository.ListProductsWithIDs)
+}
+
+func (r *CachedRepository) PutProduct(ctx context.Context, p Product) error {
+	defer r.cache.invalidate(ctx, p.ID)
+	return r.Repository.PutProduct(ctx, p)
+}
+
+func (r *CachedRepository) PutProductWithKey(ctx context.Context, p Product, key string, requestHash string) (*Product, error) {
+	defer r.cache.invalidate(ctx, p.ID)
+	return r.Repository.PutProductWithKey(ctx, p, key, requestHash)
+}
+
+func (r *CachedRepository) UpdateProduct(ctx context.Context, p Product) error {
+	defer r.cache.invalidate(ctx, p.ID)
+	return r.Repository.UpdateProduct(ctx, p)
+}
+
+func (r *CachedRepository) BulkPutProducts(ctx context.Context, products []Product) []error {
+	ids := make([]string, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+	defer r.cache.invalidate(ctx, ids...)
+	return r.Repository.BulkPutProducts(ctx, products)
+}
+
+func (r *CachedRepository) SetProductRating(ctx context.Context, id string, rating Rating) error {
+	defer r.cache.invalidate(ctx, id)
+	return r.Repository.SetProductRating(ctx, id, rating)
+}
+
+func (r *CachedRepository) AdjustStock(ctx context.Context, productID string, variantID string, delta int) error {
+	defer r.cache.invalidate(ctx, productID)
+	return r.Repository.AdjustStock(ctx, productID, variantID, delta)
+}
+
+func (r *CachedRepository) UpdateProductImages(ctx context.Context, id string, update func([]Image) ([]Image, error)) (*Product, error) {
+	defer r.cache.invalidate(ctx, id)
+	return r.Repository.UpdateProductImages(ctx, id, update)
+}
+
+func (r *CachedRepository) DeleteProduct(ctx context.Context, id string) (*Product, error) {
+	defer r.cache.invalidate(ctx, id)
+	return r.Repository.DeleteProduct(ctx, id)
+}
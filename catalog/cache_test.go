@@ -0,0 +1,134 @@
+package catalog
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryRepository stores products in memory and counts the lookups that
+// reach it. Methods the tests do not use are left to the nil Repository.
+type memoryRepository struct {
+	Repository
+
+	mu       sync.Mutex
+	products map[string]Product
+	lookups  int
+}
+
+func (r *memoryRepository) GetProductByID(ctx context.Context, id string) (*Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	p, ok := r.products[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &p, nil
+}
+
+func (r *memoryRepository) ListProductsWithIDs(ctx context.Context, ids []string) ([]Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups += len(ids)
+	products := []Product{}
+	for _, id := range ids {
+		if p, ok := r.products[id]; ok {
+			products = append(products, p)
+		}
+	}
+	return products, nil
+}
+
+func (r *memoryRepository) UpdateProduct(ctx context.Context, p Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.products[p.ID]; !ok {
+		return ErrNotFound
+	}
+	r.products[p.ID] = p
+	return nil
+}
+
+func (r *memoryRepository) lookupCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookups
+}
+
+func TestCachedRepository(t *testing.T) {
+	caches := map[string]func(t *testing.T) Cache{
+		"memory": func(t *testing.T) Cache {
+			return NewMemoryCache(10, time.Minute)
+		},
+		"redis": func(t *testing.T) Cache {
+			c, err := NewRedisCache("redis://"+newFakeRedis(t, "").addr, time.Minute)
+			if err != nil {
+				t.Fatalf("NewRedisCache: %v", err)
+			}
+			return c
+		},
+	}
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := &memoryRepository{products: map[string]Product{
+				"p1": {ID: "p1", Name: "Lamp", Price: 20},
+				"p2": {ID: "p2", Name: "Book", Price: 7.5},
+			}}
+			r := NewCachedRepository(repo, newCache(t))
+			defer r.cache.cache.Close()
+
+			// A miss reads through to the repository.
+			p, err := r.GetProductByID(ctx, "p1")
+			if err != nil || p.Name != "Lamp" {
+				t.Fatalf("GetProductByID = %v, %v, want the lamp", p, err)
+			}
+			if n := repo.lookupCount(); n != 1 {
+				t.Fatalf("repository got %d lookups, want 1", n)
+			}
+
+			// A hit does not.
+			if p, err := r.GetProductByID(ctx, "p1"); err != nil || p.Name != "Lamp" {
+				t.Fatalf("cached GetProductByID = %v, %v, want the lamp", p, err)
+			}
+			if n := repo.lookupCount(); n != 1 {
+				t.Errorf("repository got %d lookups after a hit, want 1", n)
+			}
+
+			// Only the missing products of a list are looked up.
+			products, err := r.ListProductsWithIDs(ctx, []string{"p2", "p1", "gone"})
+			if err != nil {
+				t.Fatalf("ListProductsWithIDs: %v", err)
+			}
+			if len(products) != 2 || products[0].ID != "p2" || products[1].ID != "p1" {
+				t.Errorf("ListProductsWithIDs = %v, want p2 and p1 in that order", products)
+			}
+			if n := repo.lookupCount(); n != 3 {
+				t.Errorf("repository got %d lookups, want 3", n)
+			}
+
+			// A write through the cache invalidates the product.
+			if err := r.UpdateProduct(ctx, Product{ID: "p1", Name: "Desk lamp", Price: 25}); err != nil {
+				t.Fatalf("UpdateProduct: %v", err)
+			}
+			if p, err := r.GetProductByID(ctx, "p1"); err != nil || p.Name != "Desk lamp" {
+				t.Errorf("GetProductByID after an update = %v, %v, want the desk lamp", p, err)
+			}
+			if n := repo.lookupCount(); n != 4 {
+				t.Errorf("repository got %d lookups, want 4", n)
+			}
+
+			// Products that are not found are not cached.
+			if _, err := r.GetProductByID(ctx, "gone"); err != ErrNotFound {
+				t.Errorf("GetProductByID of a missing product = %v, want %v", err, ErrNotFound)
+			}
+
+			want := CacheStats{Hits: 2, Misses: 5, Invalidations: 1}
+			if s := r.Stats(); s != want {
+				t.Errorf("Stats = %+v, want %+v", s, want)
+			}
+		})
+	}
+}
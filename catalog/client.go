@@ -3,74 +3,153 @@ package catalog
 import (
 	"context"
 	"fmt"
-	"time"
+	"io"
+	"log"
 
 	"github.com/donaldnash/go-marketplace/catalog/pb"
+	"github.com/donaldnash/go-marketplace/grpcclient"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 type Client struct {
 	conn    *grpc.ClientConn
 	service pb.CatalogServiceClient
+	// cache is nil unless the client was created with one.
+	cache *readThrough
 }
 
+// readMethods are the methods retried while the catalog service is unavailable.
+var readMethods = []string{
+	"GetProduct",
+	"GetProducts",
+}
+
+// NewClient returns a client of the catalog service at url with the default
+// options. It does not wait for the service to be up.
 func NewClient(url string) (*Client, error) {
+	return NewClientWithOptions(url, grpcclient.DefaultOptions())
+}
+
+func NewClientWithOptions(url string, o grpcclient.Options) (*Client, error) {
+	return NewClientWithCache(url, o, nil)
+}
+
+// NewClientWithCache returns a client that looks products up by ID in cache
+// before calling the service, or in no cache if it is nil. Only updates made
+// through this client drop products from the cache; the others show once the
+// cached products expire. The client closes cache when it is closed.
+func NewClientWithCache(url string, o grpcclient.Options, cache Cache) (*Client, error) {
 	if url == "" {
 		return nil, fmt.Errorf("catalog service URL cannot be empty")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	conn, err := grpc.DialContext(ctx, url,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock(),
-	)
+	conn, err := grpcclient.Dial(url, pb.CatalogService_ServiceDesc.ServiceName, readMethods, o)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to catalog service: %v", err)
+		return nil, fmt.Errorf("failed to create catalog service client: %v", err)
+	}
+	client := &Client{conn: conn, service: pb.NewCatalogServiceClient(conn)}
+	if cache != nil {
+		client.cache = &readThrough{cache: cache}
 	}
-	c := pb.NewCatalogServiceClient(conn)
-	return &Client{conn, c}, nil
+	return client, nil
 }
 
 func (c *Client) Close() {
 	c.conn.Close()
+	if c.cache != nil {
+		c.cache.cache.Close()
+	}
 }
 
-func (c *Client) PostProduct(ctx context.Context, name string, description string, price float64) (*Product, error) {
+// CacheStats returns the hit and miss counts of the client's cache, which are
+// zero if it has none.
+func (c *Client) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return c.cache.cache.Stats()
+}
+
+func (c *Client) PostProduct(ctx context.Context, p Product, idempotencyKey string) (*Product, error) {
 	r, err := c.service.PostProduct(ctx, &pb.PostProductRequest{
-		Name:        name,
-		Description: description,
-		Price:       price,
+		Name:           p.Name,
+		Description:    p.Description,
+		Price:          p.Price,
+		IdempotencyKey: idempotencyKey,
+		TaxCategory:    p.TaxCategory,
+		Category:       p.Category,
+		Weight:         p.Weight,
+		SellerId:       p.SellerID,
+		Options:        optionsToProto(p.Options),
+		Variants:       variantsToProto(p.Variants),
+	})
+	if err != nil {
+		return nil, err
+	}
+	product := productFromProto(r.Product)
+	return &product, nil
+}
+
+func (c *Client) UpdateProduct(ctx context.Context, p Product) (*Product, error) {
+	if c.cache != nil {
+		defer c.cache.invalidate(ctx, p.ID)
+	}
+	r, err := c.service.UpdateProduct(ctx, &pb.UpdateProductRequest{
+		Id:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		TaxCategory: p.TaxCategory,
+		Category:    p.Category,
+		Weight:      p.Weight,
+		Options:     optionsToProto(p.Options),
+		Variants:    variantsToProto(p.Variants),
 	})
 	if err != nil {
 		return nil, err
 	}
-	return &Product{
-		ID:          r.Product.Id,
-		Name:        r.Product.Name,
-		Description: r.Product.Description,
-		Price:       r.Product.Price,
-	}, nil
+	product := productFromProto(r.Product)
+	return &product, nil
 }
 
 func (c *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
+	if c.cache != nil && id != "" {
+		products, err := c.cache.get(ctx, []string{id}, func(ctx context.Context, ids []string) ([]Product, error) {
+			p, err := c.getProduct(ctx, ids[0])
+			if err != nil {
+				return nil, err
+			}
+			return []Product{*p}, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &products[0], nil
+	}
+	return c.getProduct(ctx, id)
+}
+
+func (c *Client) getProduct(ctx context.Context, id string) (*Product, error) {
 	r, err := c.service.GetProduct(ctx, &pb.GetProductRequest{
 		Id: id,
 	})
 	if err != nil {
 		return nil, err
 	}
-	return &Product{
-		ID:          r.Product.Id,
-		Name:        r.Product.Name,
-		Description: r.Product.Description,
-		Price:       r.Product.Price,
-	}, nil
+	product := productFromProto(r.Product)
+	return &product, nil
 }
 
 func (c *Client) GetProducts(ctx context.Context, skip uint64, take uint64, ids []string, query string) ([]Product, error) {
+	if c.cache != nil && query == "" && len(ids) > 0 {
+		return c.cache.get(ctx, ids, func(ctx context.Context, ids []string) ([]Product, error) {
+			return c.getProducts(ctx, 0, 0, ids, "")
+		})
+	}
+	return c.getProducts(ctx, skip, take, ids, query)
+}
+
+func (c *Client) getProducts(ctx context.Context, skip uint64, take uint64, ids []string, query string) ([]Product, error) {
 	r, err := c.service.GetProducts(ctx, &pb.GetProductsRequest{
 		Ids:   ids,
 		Skip:  skip,
@@ -82,12 +161,236 @@ func (c *Client) GetProducts(ctx context.Context, skip uint64, take uint64, ids
 	}
 	products := []Product{}
 	for _, p := range r.Products {
-		products = append(products, Product{
-			ID:          p.Id,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		})
+		products = append(products, productFromProto(p))
+	}
+	return products, nil
+}
+
+// GetSellerProducts lists the products of the seller with the account ID
+// sellerID.
+func (c *Client) GetSellerProducts(ctx context.Context, sellerID string, skip uint64, take uint64) ([]Product, error) {
+	if sellerID == "" {
+		return nil, fmt.Errorf("seller ID is required")
+	}
+	r, err := c.service.GetProducts(ctx, &pb.GetProductsRequest{
+		SellerId: sellerID,
+		Skip:     skip,
+		Take:     take,
+	})
+	if err != nil {
+		return nil, err
+	}
+	products := []Product{}
+	for _, p := range r.Products {
+		products = append(products, productFromProto(p))
+	}
+	return products, nil
+}
+
+// FilterProducts lists or searches products, narrowed down and ordered by
+// their rating as f asks.
+func (c *Client) FilterProducts(ctx context.Context, f ProductFilter, skip uint64, take uint64) ([]Product, error) {
+	sort := pb.GetProductsRequest_RELEVANCE
+	if f.SortByRating {
+		sort = pb.GetProductsRequest_RATING
+	}
+	r, err := c.service.GetProducts(ctx, &pb.GetProductsRequest{
+		Query:     f.Query,
+		MinRating: f.MinRating,
+		Sort:      sort,
+		Skip:      skip,
+		Take:      take,
+	})
+	if err != nil {
+		return nil, err
+	}
+	products := []Product{}
+	for _, p := range r.Products {
+		products = append(products, productFromProto(p))
+	}
+	return products, nil
+}
+
+// SetProductRating records the rating of a product worked out from its
+// reviews.
+func (c *Client) SetProductRating(ctx context.Context, productID string, rating Rating) error {
+	if c.cache != nil {
+		defer c.cache.invalidate(ctx, productID)
+	}
+	_, err := c.service.SetProductRating(ctx, &pb.SetProductRatingRequest{
+		ProductId: productID,
+		Rating:    ratingToProto(rating),
+	})
+	return err
+}
+
+// ReserveStock takes the quantities of lines out of the stock of their
+// variants, all of them or none. The error names ErrInsufficientStock when a
+// variant has too little stock.
+func (c *Client) ReserveStock(ctx context.Context, lines []StockLine) error {
+	if c.cache != nil {
+		defer c.cache.invalidate(ctx, stockProductIDs(lines)...)
+	}
+	_, err := c.service.ReserveStock(ctx, &pb.ReserveStockRequest{Lines: stockLinesToProto(lines)})
+	return err
+}
+
+// ReleaseStock puts the quantities of lines back into the stock of their
+// variants.
+func (c *Client) ReleaseStock(ctx context.Context, lines []StockLine) error {
+	if c.cache != nil {
+		defer c.cache.invalidate(ctx, stockProductIDs(lines)...)
+	}
+	_, err := c.service.ReleaseStock(ctx, &pb.ReleaseStockRequest{Lines: stockLinesToProto(lines)})
+	return err
+}
+
+func stockProductIDs(lines []StockLine) []string {
+	ids := make([]string, len(lines))
+	for i, l := range lines {
+		ids[i] = l.ProductID
+	}
+	return ids
+}
+
+// AddProductImage uploads an image of a product and inserts it at position,
+// or after the other images if position is negative.
+func (c *Client) AddProductImage(ctx context.Context, productID string, data []byte, alt string, position int) (*Product, error) {
+	if c.cache != nil {
+		defer c.cache.invalidate(ctx, productID)
+	}
+	r, err := c.service.AddProductImage(ctx, &pb.AddProductImageRequest{
+		ProductId: productID,
+		Data:      data,
+		Alt:       alt,
+		Position:  int32(position),
+	}, grpc.MaxCallSendMsgSize(maxImageMessageSize))
+	if err != nil {
+		return nil, err
+	}
+	product := productFromProto(r.Product)
+	return &product, nil
+}
+
+func (c *Client) RemoveProductImage(ctx context.Context, productID string, imageID string) (*Product, error) {
+	if c.cache != nil {
+		defer c.cache.invalidate(ctx, productID)
+	}
+	r, err := c.service.RemoveProductImage(ctx, &pb.RemoveProductImageRequest{
+		ProductId: productID,
+		ImageId:   imageID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	product := productFromProto(r.Product)
+	return &product, nil
+}
+
+func (c *Client) DeleteProduct(ctx context.Context, id string) error {
+	if c.cache != nil {
+		defer c.cache.invalidate(ctx, id)
 	}
+	_, err := c.service.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: id})
+	return err
+}
+
+// WatchProducts streams products created in category, or in any category if
+// it is empty. The channel is closed when ctx is done or the stream breaks.
+func (c *Client) WatchProducts(ctx context.Context, category string) (<-chan Product, error) {
+	stream, err := c.service.WatchProducts(ctx, &pb.WatchProductsRequest{
+		Category: category,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	products := make(chan Product)
+	go func() {
+		defer close(products)
+		for {
+			p, err := stream.Recv()
+			if err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					log.Printf("Error watching products: %v", err)
+				}
+				return
+			}
+			select {
+			case products <- productFromProto(p):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 	return products, nil
 }
+
+// StreamProducts calls fn with every product in the catalog until fn returns
+// an error.
+func (c *Client) StreamProducts(ctx context.Context, fn func(Product) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.service.StreamProducts(ctx, &pb.StreamProductsRequest{})
+	if err != nil {
+		return err
+	}
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(productFromProto(p)); err != nil {
+			return err
+		}
+	}
+}
+
+// BulkError is why the product at Index of a bulk request was not created.
+type BulkError struct {
+	Index uint64
+	Error string
+}
+
+// BulkPostProducts streams the products returned by next, until it returns
+// io.EOF, and creates them in bulk. It returns how many were created and why
+// the others were not.
+func (c *Client) BulkPostProducts(ctx context.Context, next func() (Product, error)) (uint64, []BulkError, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.service.BulkPostProducts(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	for {
+		p, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if err := stream.Send(productToProto(p)); err != nil {
+			// The server ended the call; CloseAndRecv returns why.
+			if err == io.EOF {
+				break
+			}
+			return 0, nil, err
+		}
+	}
+
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		return 0, nil, err
+	}
+	errs := make([]BulkError, len(res.Errors))
+	for i, e := range res.Errors {
+		errs[i] = BulkError{Index: e.Index, Error: e.Error}
+	}
+	return res.Created, errs, nil
+}
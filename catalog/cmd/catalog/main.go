@@ -1,25 +1,59 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/donaldnash/go-marketplace/blobstore"
 	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/migrate"
+	"github.com/donaldnash/go-marketplace/outbox"
+	"github.com/donaldnash/go-marketplace/ratelimit"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tinrab/retry"
+	"google.golang.org/grpc"
 )
 
+type MigrateConfig struct {
+	ElasticsearchURL string `envconfig:"ELASTICSEARCH_URL" required:"true"`
+}
+
 type Config struct {
 	ElasticsearchURL string `envconfig:"ELASTICSEARCH_URL" required:"true"`
 	Port             int    `envconfig:"PORT" default:"8082"`
+	AutoMigrate      bool   `envconfig:"AUTO_MIGRATE" default:"false"`
+	// Per-method gRPC quotas such as "PostProduct=10/s:20"; other methods get
+	// RATE_LIMIT_DEFAULT, or no limit when it is empty
+	RateLimits       string `envconfig:"RATE_LIMITS"`
+	RateLimitDefault string `envconfig:"RATE_LIMIT_DEFAULT"`
+	// Product lookups by ID are cached for CACHE_TTL, in process unless
+	// CACHE_REDIS_URL is set; CACHE_SIZE 0 turns the in-process cache off
+	CacheSize          int           `envconfig:"CACHE_SIZE" default:"10000"`
+	CacheTTL           time.Duration `envconfig:"CACHE_TTL" default:"30s"`
+	CacheRedisURL      string        `envconfig:"CACHE_REDIS_URL"`
+	CacheStatsInterval time.Duration `envconfig:"CACHE_STATS_INTERVAL" default:"5m"`
+	// Product images are kept in the blob store; the local store is served
+	// on MEDIA_PORT
+	MediaPort int `envconfig:"MEDIA_PORT" default:"8084"`
+	outbox.Config
+	blobstore.Options
 }
 
 func main() {
 	// Initialize logger
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	log.Println("Starting Catalog service...")
 
 	// Load configuration
@@ -28,8 +62,13 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	log.Printf("Configuration loaded:\n  Elasticsearch URL: %s\n  Port: %d",
-		cfg.ElasticsearchURL, cfg.Port)
+	log.Printf("Configuration loaded:\n  Elasticsearch URL: %s\n  Port: %d\n  Auto migrate: %t\n  Event publisher: %s",
+		cfg.ElasticsearchURL, cfg.Port, cfg.AutoMigrate, cfg.Publisher)
+
+	// Apply pending index template versions
+	if cfg.AutoMigrate {
+		applyMigrations(cfg.ElasticsearchURL)
+	}
 
 	// Initialize repository with retry
 	var repository catalog.Repository
@@ -44,12 +83,20 @@ func main() {
 		}
 		return nil
 	})
+	log.Println("Successfully connected to Elasticsearch")
+
+	repository = newCachedRepository(repository, cfg)
 	defer repository.Close()
 
-	log.Println("Successfully connected to Elasticsearch")
+	// Relay domain events queued in product documents
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	startRelay(relayCtx, cfg.ElasticsearchURL, cfg.Config)
+
+	blobs := newBlobStore(cfg)
 
 	// Create service
-	service := catalog.NewService(repository)
+	service := catalog.NewService(repository, blobs)
 
 	// Handle graceful shutdown
 	done := make(chan bool)
@@ -59,16 +106,141 @@ func main() {
 	go func() {
 		<-quit
 		log.Println("Service is shutting down...")
+		stopRelay()
 		repository.Close()
 		close(done)
 	}()
 
+	limiter, err := ratelimit.NewServerInterceptor(ratelimit.NewMemoryStore(), cfg.RateLimits, cfg.RateLimitDefault)
+	if err != nil {
+		log.Fatalf("Failed to configure rate limits: %v", err)
+	}
+
 	// Start gRPC server
 	log.Printf("Starting gRPC server on port %d...", cfg.Port)
-	if err := catalog.ListenGRPC(service, cfg.Port); err != nil {
+	if err := catalog.ListenGRPC(service, cfg.Port, grpc.UnaryInterceptor(limiter)); err != nil {
 		log.Fatalf("Failed to start gRPC server: %v", err)
 	}
 
 	<-done
 	log.Println("Service stopped")
 }
+
+// newBlobStore creates the configured blob store, and serves the files of a
+// local store on MediaPort.
+func newBlobStore(cfg Config) blobstore.BlobStore {
+	if cfg.Store == "local" && cfg.PublicURL == "" {
+		cfg.PublicURL = fmt.Sprintf("http://localhost:%d", cfg.MediaPort)
+	}
+	blobs, err := blobstore.New(cfg.Options)
+	if err != nil {
+		log.Fatalf("Failed to create blob store: %v", err)
+	}
+	log.Printf("Serving product images from %s", cfg.PublicURL)
+
+	if local, ok := blobs.(*blobstore.LocalStore); ok {
+		go func() {
+			log.Printf("Starting media server on port %d...", cfg.MediaPort)
+			if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.MediaPort), local.Handler()); err != nil {
+				log.Fatalf("Failed to start media server: %v", err)
+			}
+		}()
+	}
+	return blobs
+}
+
+// newCachedRepository puts the configured product cache in front of r, and
+// logs its statistics every CacheStatsInterval.
+func newCachedRepository(r catalog.Repository, cfg Config) catalog.Repository {
+	var cache catalog.Cache
+	switch {
+	case cfg.CacheRedisURL != "":
+		var err error
+		if cache, err = catalog.NewRedisCache(cfg.CacheRedisURL, cfg.CacheTTL); err != nil {
+			log.Fatalf("Failed to create product cache: %v", err)
+		}
+		log.Printf("Caching products in Redis for %s", cfg.CacheTTL)
+	case cfg.CacheSize > 0:
+		cache = catalog.NewMemoryCache(cfg.CacheSize, cfg.CacheTTL)
+		log.Printf("Caching up to %d products for %s", cfg.CacheSize, cfg.CacheTTL)
+	default:
+		log.Println("Product cache is disabled")
+		return r
+	}
+
+	cached := catalog.NewCachedRepository(r, cache)
+	if cfg.CacheStatsInterval > 0 {
+		go func() {
+			for range time.Tick(cfg.CacheStatsInterval) {
+				stats := cached.Stats()
+				log.Printf("Product cache: %d hits, %d misses (%.1f%% hit ratio), %d invalidations",
+					stats.Hits, stats.Misses, 100*stats.HitRatio(), stats.Invalidations)
+			}
+		}()
+	}
+	return cached
+}
+
+func startRelay(ctx context.Context, elasticsearchURL string, cfg outbox.Config) {
+	publisher, err := outbox.NewPublisher(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create event publisher: %v", err)
+	}
+
+	var store outbox.Store
+	retry.ForeverSleep(2*time.Second, func(_ int) error {
+		store, err = catalog.NewOutboxStore(elasticsearchURL)
+		if err != nil {
+			log.Printf("Failed to connect to outbox: %v", err)
+			return err
+		}
+		return nil
+	})
+
+	go func() {
+		defer store.Close()
+		defer publisher.Close()
+		outbox.NewRelay(store, publisher, cfg.PollInterval).Run(ctx)
+	}()
+}
+
+func runMigrate(args []string) {
+	var cfg MigrateConfig
+	if err := envconfig.Process("", &cfg); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	m, err := catalog.NewIndexMigrator(cfg.ElasticsearchURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to Elasticsearch: %v", err)
+	}
+	defer m.Close()
+
+	if err := migrate.Run(context.Background(), m, args, os.Stdout); err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
+
+func applyMigrations(elasticsearchURL string) {
+	var m *catalog.IndexMigrator
+	var err error
+
+	log.Println("Applying index template versions...")
+	retry.ForeverSleep(2*time.Second, func(_ int) error {
+		m, err = catalog.NewIndexMigrator(elasticsearchURL)
+		if err != nil {
+			log.Printf("Failed to connect to Elasticsearch: %v", err)
+			return err
+		}
+		return nil
+	})
+	defer m.Close()
+
+	applied, err := m.Up(context.Background())
+	for _, mig := range applied {
+		log.Printf("Applied index template %04d_%s", mig.Version, mig.Name)
+	}
+	if err != nil {
+		log.Fatalf("Failed to apply index templates: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package catalog
+
+import (
+	"log"
+	"sync"
+)
+
+// feedBuffer is how many products a watcher may lag behind before it is
+// dropped.
+const feedBuffer = 16
+
+// productFeed fans new products out to the clients watching a category. It
+// only sees products created through this process.
+type productFeed struct {
+	mu       sync.Mutex
+	watchers map[chan Product]string
+}
+
+func newProductFeed() *productFeed {
+	return &productFeed{watchers: map[chan Product]string{}}
+}
+
+// subscribe returns a channel that receives products created in category,
+// or in any category if it is empty. The channel is closed by cancel, or
+// when the watcher stops keeping up.
+func (f *productFeed) subscribe(category string) (<-chan Product, func()) {
+	ch := make(chan Product, feedBuffer)
+
+	f.mu.Lock()
+	f.watchers[ch] = category
+	f.mu.Unlock()
+
+	cancel := func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.watchers[ch]; ok {
+			delete(f.watchers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+func (f *productFeed) publish(p Product) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch, category := range f.watchers {
+		if category != "" && category != p.Category {
+			continue
+		}
+		select {
+		case ch <- p:
+		default:
+			log.Printf("Dropping product watcher of category %q that fell behind", category)
+			delete(f.watchers, ch)
+			close(ch)
+		}
+	}
+}
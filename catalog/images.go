@@ -0,0 +1,112 @@
+package catalog
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	// Formats product images may be uploaded in
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	// MaxImageSize is the largest image file a product may have, in bytes.
+	MaxImageSize = 10 << 20
+	// MaxProductImages is how many images a product may have.
+	MaxProductImages = 20
+	// ThumbnailSize is the longest side of image thumbnails, in pixels.
+	ThumbnailSize = 256
+	// maxImagePixels refuses images that are small files but would take a lot
+	// of memory to decode.
+	maxImagePixels = 25_000_000
+	// maxImageMessageSize leaves room for the rest of an upload request
+	// beside the image.
+	maxImageMessageSize = MaxImageSize + 1<<20
+)
+
+var imageContentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+}
+
+// decodeImage decodes a JPEG, PNG or GIF file and returns its content type.
+func decodeImage(data []byte) (image.Image, string, error) {
+	if len(data) == 0 {
+		return nil, "", fmt.Errorf("image is empty")
+	}
+	if len(data) > MaxImageSize {
+		return nil, "", fmt.Errorf("image is larger than %d bytes", MaxImageSize)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("image must be a JPEG, PNG or GIF file: %v", err)
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, "", fmt.Errorf("image has more than %d pixels", maxImagePixels)
+	}
+	contentType, ok := imageContentTypes[format]
+	if !ok {
+		return nil, "", fmt.Errorf("image must be a JPEG, PNG or GIF file, not %s", format)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("image could not be decoded: %v", err)
+	}
+	return img, contentType, nil
+}
+
+// thumbnail scales img down to fit in a size by size square, averaging the
+// pixels each thumbnail pixel covers, and encodes it as a JPEG. Transparent
+// parts become white. Images that already fit keep their size.
+func thumbnail(img image.Image, size int) ([]byte, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/h)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/w)
+
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// Colors are premultiplied by alpha; adding the missing
+					// alpha lays them over white.
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					bl += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %v", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,240 @@
+package catalog
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/donaldnash/go-marketplace/migrate"
+	"github.com/olivere/elastic/v7"
+)
+
+// The catalog is served through the "catalog" alias. Each template version N
+// is materialized as a concrete index named catalog_vN, and the alias is moved
+// to the newest one once its documents have been reindexed.
+const (
+	indexAlias    = "catalog"
+	indexTemplate = "catalog"
+	indexPrefix   = "catalog_v"
+)
+
+//go:embed db/templates/*.json
+var templateFiles embed.FS
+
+type indexVersion struct {
+	Version int
+	Name    string
+	Body    json.RawMessage
+}
+
+type IndexMigrator struct {
+	client   *elastic.Client
+	versions []indexVersion
+}
+
+func NewIndexMigrator(url string) (*IndexMigrator, error) {
+	client, err := elastic.NewClient(
+		elastic.SetURL(url),
+		elastic.SetSniff(false),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Elasticsearch client: %v", err)
+	}
+	if _, err = client.ClusterHealth().Do(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to connect to Elasticsearch: %v", err)
+	}
+
+	versions, err := loadIndexVersions()
+	if err != nil {
+		return nil, err
+	}
+	return &IndexMigrator{client, versions}, nil
+}
+
+func (m *IndexMigrator) Close() {
+	// No explicit close needed for Elasticsearch client
+}
+
+// Up installs the newest index template and, if the alias points at an older
+// version, reindexes into a fresh index and swaps the alias over to it.
+// Writes that land on the old index while the reindex runs are not copied.
+func (m *IndexMigrator) Up(ctx context.Context) ([]migrate.Migration, error) {
+	if len(m.versions) == 0 {
+		return []migrate.Migration{}, nil
+	}
+
+	current, source, err := m.currentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	latest := m.versions[len(m.versions)-1]
+	if current >= latest.Version {
+		return []migrate.Migration{}, nil
+	}
+
+	_, err = m.client.IndexPutIndexTemplate(indexTemplate).
+		BodyJson(map[string]interface{}{
+			"index_patterns": []string{indexPrefix + "*"},
+			"version":        latest.Version,
+			"template":       latest.Body,
+		}).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to put index template: %v", err)
+	}
+
+	target := indexName(latest.Version)
+	if _, err = m.client.CreateIndex(target).Do(ctx); err != nil && !isAlreadyExists(err) {
+		return nil, fmt.Errorf("failed to create index %s: %v", target, err)
+	}
+
+	if source != "" {
+		_, err = m.client.Reindex().
+			SourceIndex(source).
+			DestinationIndex(target).
+			WaitForCompletion(true).
+			Refresh("true").
+			Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reindex %s into %s: %v", source, target, err)
+		}
+	}
+
+	if err = m.swapAlias(ctx, source, target, current == 0); err != nil {
+		return nil, err
+	}
+
+	applied := []migrate.Migration{}
+	for _, v := range m.versions {
+		if v.Version > current {
+			applied = append(applied, migrate.Migration{Version: v.Version, Name: v.Name})
+		}
+	}
+	return applied, nil
+}
+
+func (m *IndexMigrator) Down(ctx context.Context, steps int) ([]migrate.Migration, error) {
+	return nil, fmt.Errorf("the catalog index cannot be migrated down; add a new template version instead")
+}
+
+func (m *IndexMigrator) Status(ctx context.Context) ([]migrate.Status, error) {
+	current, _, err := m.currentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]migrate.Status, len(m.versions))
+	for i, v := range m.versions {
+		statuses[i] = migrate.Status{
+			Migration: migrate.Migration{Version: v.Version, Name: v.Name},
+			Applied:   v.Version <= current,
+		}
+	}
+	return statuses, nil
+}
+
+// currentVersion returns the template version the alias points at and the
+// index backing it. An index named "catalog" created before versioning
+// existed is reported as version 0.
+func (m *IndexMigrator) currentVersion(ctx context.Context) (int, string, error) {
+	res, err := m.client.Aliases().Alias(indexAlias).Do(ctx)
+	if err != nil && !elastic.IsNotFound(err) {
+		return 0, "", fmt.Errorf("failed to get aliases: %v", err)
+	}
+	if err == nil {
+		for _, index := range res.IndicesByAlias(indexAlias) {
+			version, err := strconv.Atoi(strings.TrimPrefix(index, indexPrefix))
+			if err != nil || !strings.HasPrefix(index, indexPrefix) {
+				return 0, "", fmt.Errorf("alias %s points at unversioned index %s", indexAlias, index)
+			}
+			return version, index, nil
+		}
+	}
+
+	exists, err := m.client.IndexExists(indexAlias).Do(ctx)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to check for legacy index: %v", err)
+	}
+	if exists {
+		return 0, indexAlias, nil
+	}
+	return 0, "", nil
+}
+
+func (m *IndexMigrator) swapAlias(ctx context.Context, source string, target string, legacy bool) error {
+	if legacy && source != "" {
+		// The legacy index has the alias's name, so it must go before the
+		// alias can be created.
+		if _, err := m.client.DeleteIndex(source).Do(ctx); err != nil {
+			return fmt.Errorf("failed to delete legacy index %s: %v", source, err)
+		}
+		source = ""
+	}
+
+	alias := m.client.Alias().Add(target, indexAlias)
+	if source != "" {
+		alias = alias.Remove(source, indexAlias)
+	}
+	if _, err := alias.Do(ctx); err != nil {
+		return fmt.Errorf("failed to point alias %s at %s: %v", indexAlias, target, err)
+	}
+
+	if source != "" {
+		if _, err := m.client.DeleteIndex(source).Do(ctx); err != nil {
+			return fmt.Errorf("failed to delete old index %s: %v", source, err)
+		}
+	}
+	return nil
+}
+
+func loadIndexVersions() ([]indexVersion, error) {
+	entries, err := fs.ReadDir(templateFiles, "db/templates")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index templates: %v", err)
+	}
+
+	versions := []indexVersion{}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".json" {
+			continue
+		}
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".json"), "_")
+		if !ok {
+			return nil, fmt.Errorf("index template %s must be named <version>_<name>.json", e.Name())
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("index template %s has an invalid version", e.Name())
+		}
+
+		body, err := templateFiles.ReadFile(path.Join("db/templates", e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index template %s: %v", e.Name(), err)
+		}
+		if !json.Valid(body) {
+			return nil, fmt.Errorf("index template %s is not valid JSON", e.Name())
+		}
+		versions = append(versions, indexVersion{version, name, body})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+	return versions, nil
+}
+
+func indexName(version int) string {
+	return fmt.Sprintf("%s%d", indexPrefix, version)
+}
+
+func isAlreadyExists(err error) bool {
+	if e, ok := err.(*elastic.Error); ok && e.Details != nil {
+		return e.Details.Type == "resource_already_exists_exception"
+	}
+	return false
+}
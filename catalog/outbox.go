@@ -0,0 +1,119 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/donaldnash/go-marketplace/outbox"
+	"github.com/olivere/elastic/v7"
+)
+
+// removeEventsScript drops published events from a product document.
+const removeEventsScript = `
+if (ctx._source.pending_events != null) {
+	ctx._source.pending_events.removeIf(e -> params.ids.contains(e.id));
+	if (ctx._source.pending_events.isEmpty()) {
+		ctx._source.remove('pending_events');
+	}
+}
+`
+
+// outboxStore reads the events queued in product documents.
+type outboxStore struct {
+	client *elastic.Client
+}
+
+func NewOutboxStore(url string) (outbox.Store, error) {
+	client, err := elastic.NewClient(
+		elastic.SetURL(url),
+		elastic.SetSniff(false),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Elasticsearch client: %v", err)
+	}
+	if _, err = client.ClusterHealth().Do(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to connect to Elasticsearch: %v", err)
+	}
+	return &outboxStore{client}, nil
+}
+
+func (s *outboxStore) Close() {
+	// No explicit close needed for Elasticsearch client
+}
+
+// Pending returns the oldest events of the limit products that waited
+// longest. Documents only become searchable after the next index refresh,
+// so new events show up with a delay of about a second.
+func (s *outboxStore) Pending(ctx context.Context, limit int) ([]outbox.Event, error) {
+	res, err := s.client.Search().
+		Index("catalog").
+		Query(elastic.NewExistsQuery("pending_events.id")).
+		FetchSourceContext(elastic.NewFetchSourceContext(true).Include("pending_events")).
+		SortBy(elastic.NewFieldSort("pending_events.occurred_at").Asc().SortMode("min")).
+		Size(limit).
+		Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search pending events: %v", err)
+	}
+
+	events := []outbox.Event{}
+	for _, hit := range res.Hits.Hits {
+		d := indexedProduct{}
+		if err := json.Unmarshal(hit.Source, &d); err != nil {
+			log.Printf("Warning: failed to unmarshal events of product %s: %v", hit.Id, err)
+			continue
+		}
+		events = append(events, d.PendingEvents...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].OccurredAt.Equal(events[j].OccurredAt) {
+			return events[i].OccurredAt.Before(events[j].OccurredAt)
+		}
+		return events[i].ID < events[j].ID
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (s *outboxStore) MarkPublished(ctx context.Context, events []outbox.Event) error {
+	ids := map[string][]string{}
+	for _, e := range events {
+		ids[e.AggregateID] = append(ids[e.AggregateID], e.ID)
+	}
+
+	bulk := s.client.Bulk()
+	for productID, eventIDs := range ids {
+		script := elastic.NewScript(removeEventsScript).
+			Lang("painless").
+			Param("ids", eventIDs)
+		bulk.Add(elastic.NewBulkUpdateRequest().
+			Index("catalog").
+			Id(productID).
+			Script(script).
+			RetryOnConflict(3))
+	}
+
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to remove published events: %v", err)
+	}
+	for _, item := range res.Failed() {
+		// A deleted product has no events left to remove.
+		if item.Status == http.StatusNotFound {
+			continue
+		}
+		reason := ""
+		if item.Error != nil {
+			reason = item.Error.Reason
+		}
+		return fmt.Errorf("failed to remove published events of product %s: %s", item.Id, reason)
+	}
+	return nil
+}
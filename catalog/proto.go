@@ -0,0 +1,136 @@
+package catalog
+
+import "github.com/donaldnash/go-marketplace/catalog/pb"
+
+func productToProto(p Product) *pb.Product {
+	images := make([]*pb.Image, len(p.Images))
+	for i, image := range p.Images {
+		images[i] = &pb.Image{
+			Id:           image.ID,
+			Url:          image.URL,
+			ThumbnailUrl: image.ThumbnailURL,
+			Alt:          image.Alt,
+			Position:     int32(image.Position),
+		}
+	}
+	return &pb.Product{
+		Id:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		TaxCategory: p.TaxCategory,
+		Category:    p.Category,
+		Weight:      p.Weight,
+		SellerId:    p.SellerID,
+		Images:      images,
+		Options:     optionsToProto(p.Options),
+		Variants:    variantsToProto(p.Variants),
+		Rating:      ratingToProto(p.Rating),
+	}
+}
+
+func ratingToProto(r Rating) *pb.Rating {
+	return &pb.Rating{Average: r.Average, Count: uint32(r.Count)}
+}
+
+func ratingFromProto(r *pb.Rating) Rating {
+	if r == nil {
+		return Rating{}
+	}
+	return Rating{Average: r.Average, Count: int(r.Count)}
+}
+
+func productFromProto(p *pb.Product) Product {
+	var images []Image
+	for _, image := range p.Images {
+		images = append(images, Image{
+			ID:           image.Id,
+			URL:          image.Url,
+			ThumbnailURL: image.ThumbnailUrl,
+			Alt:          image.Alt,
+			Position:     int(image.Position),
+		})
+	}
+	return Product{
+		ID:          p.Id,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		TaxCategory: p.TaxCategory,
+		Category:    p.Category,
+		Weight:      p.Weight,
+		SellerID:    p.SellerId,
+		Images:      images,
+		Options:     optionsFromProto(p.Options),
+		Variants:    variantsFromProto(p.Variants),
+		Rating:      ratingFromProto(p.Rating),
+	}
+}
+
+func optionsToProto(options []Option) []*pb.Option {
+	res := make([]*pb.Option, len(options))
+	for i, o := range options {
+		res[i] = &pb.Option{Name: o.Name, Values: o.Values}
+	}
+	return res
+}
+
+func optionsFromProto(options []*pb.Option) []Option {
+	var res []Option
+	for _, o := range options {
+		res = append(res, Option{Name: o.Name, Values: o.Values})
+	}
+	return res
+}
+
+func variantsToProto(variants []Variant) []*pb.Variant {
+	res := make([]*pb.Variant, len(variants))
+	for i, v := range variants {
+		attributes := make([]*pb.Attribute, len(v.Attributes))
+		for j, a := range v.Attributes {
+			attributes[j] = &pb.Attribute{Name: a.Name, Value: a.Value}
+		}
+		res[i] = &pb.Variant{
+			Id:         v.ID,
+			Sku:        v.SKU,
+			Price:      v.Price,
+			Stock:      int32(v.Stock),
+			Attributes: attributes,
+		}
+	}
+	return res
+}
+
+func variantsFromProto(variants []*pb.Variant) []Variant {
+	var res []Variant
+	for _, v := range variants {
+		attributes := make([]Attribute, len(v.Attributes))
+		for j, a := range v.Attributes {
+			attributes[j] = Attribute{Name: a.Name, Value: a.Value}
+		}
+		res = append(res, Variant{
+			ID:         v.Id,
+			SKU:        v.Sku,
+			Price:      v.Price,
+			Stock:      int(v.Stock),
+			Attributes: attributes,
+		})
+	}
+	return res
+}
+
+func stockLinesToProto(lines []StockLine) []*pb.StockLine {
+	result := make([]*pb.StockLine, len(lines))
+	for i, l := range lines {
+		result[i] = &pb.StockLine{ProductId: l.ProductID, VariantId: l.VariantID, Quantity: l.Quantity}
+	}
+	return result
+}
+
+func stockLinesFromProto(lines []*pb.StockLine) []StockLine {
+	result := make([]StockLine, len(lines))
+	for i, l := range lines {
+		result[i] = StockLine{ProductID: l.ProductId, VariantID: l.VariantId, Quantity: l.Quantity}
+	}
+	return result
+}
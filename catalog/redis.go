@@ -0,0 +1,330 @@
+package catalog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// redisKeyPrefix namespaces the product keys in a Redis database that may be
+// shared with other services.
+const redisKeyPrefix = "catalog:product:"
+
+const (
+	redisMaxIdle     = 8
+	redisDialTimeout = 2 * time.Second
+	// redisTimeout bounds commands whose context has no deadline.
+	redisTimeout = time.Second
+)
+
+type redisCache struct {
+	addr     string
+	password string
+	db       int
+	ttl      time.Duration
+	idle     chan *redisConn
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	invalidations atomic.Uint64
+}
+
+// NewRedisCache keeps products in the Redis server at rawURL, such as
+// "redis://:password@redis:6379/0", for ttl each. Instances of the catalog
+// sharing it see each other's invalidations.
+func NewRedisCache(rawURL string, ttl time.Duration) (Cache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %v", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("invalid Redis URL: unsupported scheme %q", u.Scheme)
+	}
+	if ttl < time.Millisecond {
+		return nil, fmt.Errorf("cache TTL must be at least 1ms")
+	}
+
+	c := &redisCache{
+		addr: u.Host,
+		ttl:  ttl,
+		idle: make(chan *redisConn, redisMaxIdle),
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if password, ok := u.User.Password(); ok {
+		c.password = password
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+
+	// Fail early when the server cannot be reached
+	if _, err := c.do(context.Background(), []string{"PING"}); err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %v", err)
+	}
+	return c, nil
+}
+
+func (c *redisCache) Get(ctx context.Context, ids []string) (map[string]Product, error) {
+	products := map[string]Product{}
+	if len(ids) == 0 {
+		return products, nil
+	}
+
+	cmd := []string{"MGET"}
+	for _, id := range ids {
+		cmd = append(cmd, redisKeyPrefix+id)
+	}
+	replies, err := c.do(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	values, ok := replies[0].([]interface{})
+	if !ok || len(values) != len(ids) {
+		return nil, fmt.Errorf("unexpected reply to MGET: %v", replies[0])
+	}
+
+	for i, v := range values {
+		data, ok := v.([]byte)
+		if !ok {
+			c.misses.Add(1)
+			continue
+		}
+		p := Product{}
+		if err := json.Unmarshal(data, &p); err != nil {
+			log.Printf("Warning: failed to unmarshal cached product %s: %v", ids[i], err)
+			c.misses.Add(1)
+			continue
+		}
+		products[ids[i]] = p
+		c.hits.Add(1)
+	}
+	return products, nil
+}
+
+func (c *redisCache) Set(ctx context.Context, products []Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	ttl := strconv.FormatInt(c.ttl.Milliseconds(), 10)
+	cmds := make([][]string, len(products))
+	for i, p := range products {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return fmt.Errorf("failed to marshal product: %v", err)
+		}
+		cmds[i] = []string{"SET", redisKeyPrefix + p.ID, string(data), "PX", ttl}
+	}
+	_, err := c.do(ctx, cmds...)
+	return err
+}
+
+func (c *redisCache) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	cmd := []string{"DEL"}
+	for _, id := range ids {
+		cmd = append(cmd, redisKeyPrefix+id)
+	}
+	if _, err := c.do(ctx, cmd); err != nil {
+		return err
+	}
+	c.invalidations.Add(uint64(len(ids)))
+	return nil
+}
+
+func (c *redisCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Invalidations: c.invalidations.Load(),
+	}
+}
+
+func (c *redisCache) Close() {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// do sends cmds in one round trip and returns their replies. A connection
+// that fails is dropped rather than reused.
+func (c *redisCache) do(ctx context.Context, cmds ...[]string) ([]interface{}, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	replies, err := conn.do(deadline, cmds...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+
+	for _, r := range replies {
+		if err, ok := r.(redisError); ok {
+			return nil, err
+		}
+	}
+	return replies, nil
+}
+
+func (c *redisCache) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: redisDialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	setup := [][]string{}
+	if c.password != "" {
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	if len(setup) > 0 {
+		replies, err := conn.do(time.Now().Add(redisTimeout), setup...)
+		if err == nil {
+			for _, r := range replies {
+				if rerr, ok := r.(redisError); ok {
+					err = rerr
+				}
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisError is an error reply of the Redis server.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisConn speaks the Redis serialization protocol (RESP) over one
+// connection.
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (c *redisConn) do(deadline time.Time, cmds ...[]string) ([]interface{}, error) {
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	for _, cmd := range cmds {
+		fmt.Fprintf(c.w, "*%d\r\n", len(cmd))
+		for _, arg := range cmd {
+			fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(cmds))
+	for i := range cmds {
+		r, err := c.readReply()
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = r
+	}
+	return replies, nil
+}
+
+// readReply reads one reply: a string, a redisError, an int64, a []byte, nil
+// for a missing value, or a []interface{} of replies.
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed Redis reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return redisError(payload), nil
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed Redis bulk length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("malformed Redis array length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unknown Redis reply type %q", kind)
+}
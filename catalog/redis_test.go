@@ -0,0 +1,251 @@
+package catalog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		want    interface{}
+		wantErr bool
+	}{
+		{"simple string", "+OK\r\n", "OK", false},
+		{"error", "-ERR unknown command\r\n", redisError("ERR unknown command"), false},
+		{"integer", ":42\r\n", int64(42), false},
+		{"negative integer", ":-1\r\n", int64(-1), false},
+		{"bulk string", "$5\r\nhello\r\n", []byte("hello"), false},
+		{"bulk string with CRLF", "$7\r\nhi\r\nyou\r\n", []byte("hi\r\nyou"), false},
+		{"empty bulk string", "$0\r\n\r\n", []byte{}, false},
+		{"missing value", "$-1\r\n", nil, false},
+		{"array", "*3\r\n$1\r\na\r\n$-1\r\n:7\r\n", []interface{}{[]byte("a"), nil, int64(7)}, false},
+		{"nested array", "*2\r\n*1\r\n+x\r\n*0\r\n", []interface{}{[]interface{}{"x"}, []interface{}{}}, false},
+		{"null array", "*-1\r\n", nil, false},
+		{"unknown type", "!oops\r\n", nil, true},
+		{"missing CR", "+OK\n", nil, true},
+		{"empty line", "\r\n", nil, true},
+		{"malformed integer", ":4x\r\n", nil, true},
+		{"malformed bulk length", "$x\r\nhello\r\n", nil, true},
+		{"malformed array length", "*x\r\n", nil, true},
+		{"truncated bulk string", "$5\r\nhel", nil, true},
+		{"truncated array", "*2\r\n:1\r\n", nil, true},
+		{"end of stream", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &redisConn{r: bufio.NewReader(strings.NewReader(tt.stream))}
+			got, err := c.readReply()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readReply = %#v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readReply: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readReply = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadReplyPipelined(t *testing.T) {
+	c := &redisConn{r: bufio.NewReader(strings.NewReader("+OK\r\n$-1\r\n:3\r\n"))}
+	want := []interface{}{"OK", nil, int64(3)}
+	for i, w := range want {
+		got, err := c.readReply()
+		if err != nil {
+			t.Fatalf("reply %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("reply %d = %#v, want %#v", i, got, w)
+		}
+	}
+	if _, err := c.readReply(); err != io.EOF {
+		t.Errorf("readReply after the last reply = %v, want %v", err, io.EOF)
+	}
+}
+
+// fakeRedis serves the few commands the cache sends, keeping values in
+// memory, and records every command it gets.
+type fakeRedis struct {
+	addr     string
+	password string
+
+	mu       sync.Mutex
+	values   map[string]string
+	commands [][]string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	s := &fakeRedis{addr: lis.Addr().String(), password: password, values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) serve(nc net.Conn) {
+	defer nc.Close()
+	// Commands are arrays of bulk strings, so they read like replies.
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	authenticated := s.password == ""
+	for {
+		v, err := c.readReply()
+		if err != nil {
+			return
+		}
+		args := []string{}
+		for _, arg := range v.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+		switch {
+		case args[0] == "AUTH":
+			authenticated = args[1] == s.password
+			if authenticated {
+				fmt.Fprint(c.w, "+OK\r\n")
+			} else {
+				fmt.Fprint(c.w, "-WRONGPASS invalid password\r\n")
+			}
+		case !authenticated:
+			fmt.Fprint(c.w, "-NOAUTH Authentication required.\r\n")
+		case args[0] == "PING":
+			fmt.Fprint(c.w, "+PONG\r\n")
+		case args[0] == "SELECT":
+			fmt.Fprint(c.w, "+OK\r\n")
+		case args[0] == "SET":
+			s.values[args[1]] = args[2]
+			fmt.Fprint(c.w, "+OK\r\n")
+		case args[0] == "MGET":
+			fmt.Fprintf(c.w, "*%d\r\n", len(args)-1)
+			for _, key := range args[1:] {
+				if value, ok := s.values[key]; ok {
+					fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(value), value)
+				} else {
+					fmt.Fprint(c.w, "$-1\r\n")
+				}
+			}
+		case args[0] == "DEL":
+			n := 0
+			for _, key := range args[1:] {
+				if _, ok := s.values[key]; ok {
+					delete(s.values, key)
+					n++
+				}
+			}
+			fmt.Fprintf(c.w, ":%d\r\n", n)
+		default:
+			fmt.Fprintf(c.w, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		s.mu.Unlock()
+		if err := c.w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// sent returns the commands named name the server got.
+func (s *fakeRedis) sent(name string) [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	commands := [][]string{}
+	for _, cmd := range s.commands {
+		if cmd[0] == name {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeRedis(t, "secret")
+	c, err := NewRedisCache("redis://:secret@"+server.addr+"/2", time.Minute)
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	defer c.Close()
+
+	if auth := server.sent("AUTH"); len(auth) != 1 || auth[0][1] != "secret" {
+		t.Errorf("AUTH commands = %v, want one with the password", auth)
+	}
+	if sel := server.sent("SELECT"); len(sel) != 1 || sel[0][1] != "2" {
+		t.Errorf("SELECT commands = %v, want one of database 2", sel)
+	}
+
+	p := Product{ID: "p1", Name: "Lamp", Price: 20}
+	if err := c.Set(ctx, []Product{p}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	set := server.sent("SET")
+	if len(set) != 1 || set[0][1] != redisKeyPrefix+"p1" || set[0][3] != "PX" || set[0][4] != strconv.Itoa(60000) {
+		t.Errorf("SET commands = %v, want p1 with a TTL of 60000ms", set)
+	}
+
+	got, err := c.Get(ctx, []string{"p1", "p2"})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got["p1"], p) {
+		t.Errorf("Get = %v, want only p1", got)
+	}
+
+	if err := c.Delete(ctx, []string{"p1"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got, err := c.Get(ctx, []string{"p1"}); err != nil || len(got) != 0 {
+		t.Errorf("Get after Delete = %v, %v, want nothing", got, err)
+	}
+
+	if s := c.Stats(); s != (CacheStats{Hits: 1, Misses: 2, Invalidations: 1}) {
+		t.Errorf("Stats = %+v, want 1 hit, 2 misses and 1 invalidation", s)
+	}
+}
+
+func TestNewRedisCacheErrors(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"unsupported scheme", "http://" + server.addr},
+		{"invalid database", "redis://:secret@" + server.addr + "/db"},
+		{"wrong password", "redis://:wrong@" + server.addr},
+		{"no password", "redis://" + server.addr},
+	}
+	for _, tt := range tests {
+		if c, err := NewRedisCache(tt.url, time.Minute); err == nil {
+			c.Close()
+			t.Errorf("%s: NewRedisCache succeeded, want an error", tt.name)
+		}
+	}
+}
@@ -4,32 +4,144 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/donaldnash/go-marketplace/outbox"
 	"github.com/olivere/elastic/v7"
 )
 
 var (
-	ErrNotFound = fmt.Errorf("product not found")
+	ErrNotFound             = fmt.Errorf("product not found")
+	ErrVariantNotFound      = fmt.Errorf("product variant not found")
+	ErrInsufficientStock    = fmt.Errorf("insufficient stock")
+	ErrIdempotencyKeyReused = fmt.Errorf("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInUse  = fmt.Errorf("a request with this idempotency key is still in progress")
 )
 
+// idempotencyIndex holds one document per idempotency key, created with
+// op_type=create so that only the first request claiming a key wins.
+const idempotencyIndex = "catalog_idempotency"
+
+// idempotencyID is the document ID of a key in idempotencyIndex. Keys are
+// scoped to the seller of the product, so that sellers cannot replay or
+// block each other's requests. Keys of products without a seller keep their
+// bare ID, as before products had sellers, unless they have a colon: only
+// escaped IDs have one, so IDs of different scopes never clash.
+func idempotencyID(sellerID string, key string) string {
+	if sellerID != "" {
+		return "seller:" + url.QueryEscape(sellerID) + ":" + url.QueryEscape(key)
+	}
+	if strings.Contains(key, ":") {
+		return "marketplace:" + url.QueryEscape(key)
+	}
+	return key
+}
+
 type Repository interface {
 	Close()
 	PutProduct(ctx context.Context, p Product) error
+	PutProductWithKey(ctx context.Context, p Product, key string, requestHash string) (*Product, error)
+	// UpdateProduct replaces the fields of a product but its images, seller
+	// and rating.
+	UpdateProduct(ctx context.Context, p Product) error
 	GetProductByID(ctx context.Context, id string) (*Product, error)
 	ListProducts(ctx context.Context, skip uint64, take uint64) ([]Product, error)
+	ListProductsBySeller(ctx context.Context, sellerID string, skip uint64, take uint64) ([]Product, error)
 	ListProductsWithIDs(ctx context.Context, ids []string) ([]Product, error)
 	SearchProducts(ctx context.Context, query string, skip uint64, take uint64) ([]Product, error)
+	FilterProducts(ctx context.Context, f ProductFilter, skip uint64, take uint64) ([]Product, error)
+	// SetProductRating replaces the rating of a product, leaving the rest of
+	// it as it is.
+	SetProductRating(ctx context.Context, id string, r Rating) error
+	// AdjustStock adds delta to the stock of a variant of a product in one
+	// conditional write. It fails with ErrInsufficientStock, writing
+	// nothing, when that would take the stock below zero.
+	AdjustStock(ctx context.Context, productID string, variantID string, delta int) error
+	// StreamProducts calls fn with every product until fn returns an error.
+	StreamProducts(ctx context.Context, fn func(Product) error) error
+	// BulkPutProducts creates products in one request. The returned errors
+	// line up with products; nil means the product was created.
+	BulkPutProducts(ctx context.Context, products []Product) []error
+	// UpdateProductImages replaces the images of a product with what update
+	// returns for its current ones. update is called again if the product
+	// changes in the meantime.
+	UpdateProductImages(ctx context.Context, id string, update func([]Image) ([]Image, error)) (*Product, error)
+	// DeleteProduct deletes a product and returns it as it was.
+	DeleteProduct(ctx context.Context, id string) (*Product, error)
 }
 
 type elasticRepository struct {
 	client *elastic.Client
 }
 
+type idempotencyDocument struct {
+	RequestHash string `json:"request_hash"`
+	ProductID   string `json:"product_id"`
+}
+
 type productDocument struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Price       float64   `json:"price"`
+	TaxCategory string    `json:"tax_category,omitempty"`
+	Category    string    `json:"category,omitempty"`
+	Weight      float64   `json:"weight,omitempty"`
+	SellerID    string    `json:"seller_id,omitempty"`
+	Images      []Image   `json:"images,omitempty"`
+	Options     []Option  `json:"options,omitempty"`
+	Variants    []Variant `json:"variants,omitempty"`
+	// The rating is only written by SetProductRating.
+	RatingAverage float64 `json:"rating_average,omitempty"`
+	RatingCount   int     `json:"rating_count,omitempty"`
+}
+
+// indexedProduct is a product document with the events about the product
+// that were not published yet. Events are written with the document they
+// describe, which is the only atomic write Elasticsearch offers.
+type indexedProduct struct {
+	productDocument
+	PendingEvents []outbox.Event `json:"pending_events,omitempty"`
+}
+
+func newProductDocument(p Product) productDocument {
+	return productDocument{
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		TaxCategory: p.TaxCategory,
+		Category:    p.Category,
+		Weight:      p.Weight,
+		SellerID:    p.SellerID,
+		Images:      p.Images,
+		Options:     p.Options,
+		Variants:    p.Variants,
+	}
+}
+
+func (d productDocument) product(id string) Product {
+	// Products indexed before tax categories existed have none.
+	taxCategory := d.TaxCategory
+	if taxCategory == "" {
+		taxCategory = DefaultTaxCategory
+	}
+	return Product{
+		ID:          id,
+		Name:        d.Name,
+		Description: d.Description,
+		Price:       d.Price,
+		TaxCategory: taxCategory,
+		Category:    d.Category,
+		Weight:      d.Weight,
+		SellerID:    d.SellerID,
+		Images:      d.Images,
+		Options:     d.Options,
+		Variants:    d.Variants,
+		Rating:      Rating{Average: d.RatingAverage, Count: d.RatingCount},
+	}
 }
 
 func NewElasticRepository(url string) (Repository, error) {
@@ -65,13 +177,17 @@ func (r *elasticRepository) PutProduct(ctx context.Context, p Product) error {
 		return fmt.Errorf("product price cannot be negative")
 	}
 
-	_, err := r.client.Index().
+	e, err := outbox.NewEvent(EventProductCreated, p.ID, p)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.Index().
 		Index("catalog").
 		Id(p.ID).
-		BodyJson(productDocument{
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
+		BodyJson(indexedProduct{
+			productDocument: newProductDocument(p),
+			PendingEvents:   []outbox.Event{e},
 		}).Do(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to index product: %v", err)
@@ -79,6 +195,243 @@ func (r *elasticRepository) PutProduct(ctx context.Context, p Product) error {
 	return nil
 }
 
+// updateProductScript replaces the product fields of a document and queues
+// the event about the change in the same write.
+const updateProductScript = `
+ctx._source.name = params.product.name;
+ctx._source.description = params.product.description;
+ctx._source.price = params.product.price;
+ctx._source.tax_category = params.product.tax_category;
+ctx._source.category = params.product.category;
+ctx._source.weight = params.product.weight;
+ctx._source.options = params.product.options;
+ctx._source.variants = params.product.variants;
+if (ctx._source.pending_events == null) {
+	ctx._source.pending_events = [];
+}
+ctx._source.pending_events.add(params.event);
+`
+
+func (r *elasticRepository) UpdateProduct(ctx context.Context, p Product) error {
+	if p.ID == "" {
+		return fmt.Errorf("product ID is required")
+	}
+	if p.Name == "" {
+		return fmt.Errorf("product name is required")
+	}
+	if p.Price < 0 {
+		return fmt.Errorf("product price cannot be negative")
+	}
+
+	e, err := outbox.NewEvent(EventProductUpdated, p.ID, p)
+	if err != nil {
+		return err
+	}
+
+	script := elastic.NewScript(updateProductScript).
+		Lang("painless").
+		Params(map[string]interface{}{
+			"product": newProductDocument(p),
+			"event":   e,
+		})
+	_, err = r.client.Update().
+		Index("catalog").
+		Id(p.ID).
+		Script(script).
+		RetryOnConflict(3).
+		Do(ctx)
+	if err != nil {
+		if elastic.IsNotFound(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to update product: %v", err)
+	}
+	return nil
+}
+
+// setImagesScript replaces the images of a document and queues the event
+// about the change in the same write.
+const setImagesScript = `
+ctx._source.images = params.images;
+if (ctx._source.pending_events == null) {
+	ctx._source.pending_events = [];
+}
+ctx._source.pending_events.add(params.event);
+`
+
+// maxConflictRetries is how many times a read-modify-write of a product is
+// tried again when the product changed in between.
+const maxConflictRetries = 3
+
+func (r *elasticRepository) UpdateProductImages(ctx context.Context, id string, update func([]Image) ([]Image, error)) (*Product, error) {
+	if id == "" {
+		return nil, fmt.Errorf("product ID is required")
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := r.client.Get().
+			Index("catalog").
+			Id(id).
+			Do(ctx)
+		if err != nil {
+			if elastic.IsNotFound(err) {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("failed to get product: %v", err)
+		}
+		if !res.Found {
+			return nil, ErrNotFound
+		}
+		d := productDocument{}
+		if err := json.Unmarshal(res.Source, &d); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal product data: %v", err)
+		}
+
+		images, err := update(d.Images)
+		if err != nil {
+			return nil, err
+		}
+		p := d.product(id)
+		p.Images = images
+
+		e, err := outbox.NewEvent(EventProductUpdated, id, p)
+		if err != nil {
+			return nil, err
+		}
+		script := elastic.NewScript(setImagesScript).
+			Lang("painless").
+			Params(map[string]interface{}{
+				"images": images,
+				"event":  e,
+			})
+		_, err = r.client.Update().
+			Index("catalog").
+			Id(id).
+			IfSeqNo(*res.SeqNo).
+			IfPrimaryTerm(*res.PrimaryTerm).
+			Script(script).
+			Do(ctx)
+		if err != nil {
+			if elastic.IsConflict(err) && attempt < maxConflictRetries {
+				continue
+			}
+			if elastic.IsNotFound(err) {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("failed to update product images: %v", err)
+		}
+		return &p, nil
+	}
+}
+
+// DeleteProduct only deletes the product as it was read, so that images
+// added in the meantime are returned too.
+func (r *elasticRepository) DeleteProduct(ctx context.Context, id string) (*Product, error) {
+	if id == "" {
+		return nil, fmt.Errorf("product ID is required")
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := r.client.Get().
+			Index("catalog").
+			Id(id).
+			Do(ctx)
+		if err != nil {
+			if elastic.IsNotFound(err) {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("failed to get product: %v", err)
+		}
+		if !res.Found {
+			return nil, ErrNotFound
+		}
+		d := productDocument{}
+		if err := json.Unmarshal(res.Source, &d); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal product data: %v", err)
+		}
+
+		_, err = r.client.Delete().
+			Index("catalog").
+			Id(id).
+			IfSeqNo(*res.SeqNo).
+			IfPrimaryTerm(*res.PrimaryTerm).
+			Do(ctx)
+		if err != nil {
+			if elastic.IsConflict(err) && attempt < maxConflictRetries {
+				continue
+			}
+			if elastic.IsNotFound(err) {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("failed to delete product: %v", err)
+		}
+		p := d.product(id)
+		return &p, nil
+	}
+}
+
+// PutProductWithKey claims the idempotency key of p's seller for p before
+// indexing it. If the key was claimed before, the product stored with it is
+// returned instead.
+// A claim is released again when indexing fails, so the request can be retried.
+func (r *elasticRepository) PutProductWithKey(ctx context.Context, p Product, key string, requestHash string) (*Product, error) {
+	if key == "" {
+		return nil, fmt.Errorf("idempotency key is required")
+	}
+
+	id := idempotencyID(p.SellerID, key)
+	_, err := r.client.Index().
+		Index(idempotencyIndex).
+		Id(id).
+		OpType("create").
+		BodyJson(idempotencyDocument{
+			RequestHash: requestHash,
+			ProductID:   p.ID,
+		}).Do(ctx)
+	if err != nil {
+		if elastic.IsConflict(err) {
+			return r.replayProduct(ctx, id, requestHash)
+		}
+		return nil, fmt.Errorf("failed to record idempotency key: %v", err)
+	}
+
+	if err := r.PutProduct(ctx, p); err != nil {
+		if _, delErr := r.client.Delete().Index(idempotencyIndex).Id(id).Do(ctx); delErr != nil {
+			log.Printf("Warning: failed to release idempotency key %s: %v", key, delErr)
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *elasticRepository) replayProduct(ctx context.Context, id string, requestHash string) (*Product, error) {
+	res, err := r.client.Get().
+		Index(idempotencyIndex).
+		Id(id).
+		Do(ctx)
+	if err != nil {
+		if elastic.IsNotFound(err) {
+			// The claim was released by a failed request in the meantime
+			return nil, ErrIdempotencyKeyInUse
+		}
+		return nil, fmt.Errorf("failed to load idempotency key: %v", err)
+	}
+
+	d := idempotencyDocument{}
+	if err = json.Unmarshal(res.Source, &d); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal idempotency key: %v", err)
+	}
+	if d.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	p, err := r.GetProductByID(ctx, d.ProductID)
+	if err == ErrNotFound {
+		return nil, ErrIdempotencyKeyInUse
+	}
+	return p, err
+}
+
 func (r *elasticRepository) GetProductByID(ctx context.Context, id string) (*Product, error) {
 	if id == "" {
 		return nil, fmt.Errorf("product ID is required")
@@ -103,12 +456,8 @@ func (r *elasticRepository) GetProductByID(ctx context.Context, id string) (*Pro
 		return nil, fmt.Errorf("failed to unmarshal product data: %v", err)
 	}
 
-	return &Product{
-		ID:          id,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}, nil
+	product := p.product(id)
+	return &product, nil
 }
 
 func (r *elasticRepository) ListProducts(ctx context.Context, skip uint64, take uint64) ([]Product, error) {
@@ -133,6 +482,27 @@ func (r *elasticRepository) ListProducts(ctx context.Context, skip uint64, take
 	return r.extractProducts(res)
 }
 
+func (r *elasticRepository) ListProductsBySeller(ctx context.Context, sellerID string, skip uint64, take uint64) ([]Product, error) {
+	if take > 100 {
+		take = 100
+	}
+	if take == 0 {
+		take = 10
+	}
+
+	res, err := r.client.Search().
+		Index("catalog").
+		Query(elastic.NewTermQuery("seller_id", sellerID)).
+		From(int(skip)).
+		Size(int(take)).
+		Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products of seller: %v", err)
+	}
+
+	return r.extractProducts(res)
+}
+
 func (r *elasticRepository) ListProductsWithIDs(ctx context.Context, ids []string) ([]Product, error) {
 	if len(ids) == 0 {
 		return []Product{}, nil
@@ -167,12 +537,7 @@ func (r *elasticRepository) ListProductsWithIDs(ctx context.Context, ids []strin
 			continue
 		}
 
-		products = append(products, Product{
-			ID:          doc.Id,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		})
+		products = append(products, p.product(doc.Id))
 	}
 
 	return products, nil
@@ -187,7 +552,11 @@ func (r *elasticRepository) SearchProducts(ctx context.Context, query string, sk
 		take = 10 // Default limit
 	}
 
-	searchQuery := elastic.NewMultiMatchQuery(query, "name", "description")
+	// A query can also be the SKU of one of a product's variants.
+	searchQuery := elastic.NewBoolQuery().Should(
+		elastic.NewMultiMatchQuery(query, "name", "description"),
+		elastic.NewNestedQuery("variants", elastic.NewTermQuery("variants.sku", query)).IgnoreUnmapped(true),
+	)
 	res, err := r.client.Search().
 		Index("catalog").
 		Query(searchQuery).
@@ -201,6 +570,218 @@ func (r *elasticRepository) SearchProducts(ctx context.Context, query string, sk
 	return r.extractProducts(res)
 }
 
+func (r *elasticRepository) FilterProducts(ctx context.Context, f ProductFilter, skip uint64, take uint64) ([]Product, error) {
+	if take > 100 {
+		take = 100
+	}
+	if take == 0 {
+		take = 10
+	}
+
+	query := elastic.NewBoolQuery()
+	if f.Query != "" {
+		query.Must(elastic.NewBoolQuery().Should(
+			elastic.NewMultiMatchQuery(f.Query, "name", "description"),
+			elastic.NewNestedQuery("variants", elastic.NewTermQuery("variants.sku", f.Query)).IgnoreUnmapped(true),
+		))
+	}
+	if f.MinRating > 0 {
+		query.Filter(elastic.NewRangeQuery("rating_average").Gte(f.MinRating))
+	}
+
+	search := r.client.Search().
+		Index("catalog").
+		Query(query).
+		From(int(skip)).
+		Size(int(take))
+	if f.SortByRating {
+		// Products without a rating come last.
+		search = search.
+			SortBy(
+				elastic.NewFieldSort("rating_average").Desc().Missing("_last").UnmappedType("float"),
+				elastic.NewFieldSort("rating_count").Desc().Missing("_last").UnmappedType("integer"),
+				elastic.NewScoreSort(),
+			)
+	}
+	res, err := search.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter products: %v", err)
+	}
+
+	return r.extractProducts(res)
+}
+
+func (r *elasticRepository) SetProductRating(ctx context.Context, id string, rating Rating) error {
+	// Ratings change with every moderated review and are not edits of the
+	// product, so no event is queued for them.
+	_, err := r.client.Update().
+		Index("catalog").
+		Id(id).
+		Doc(map[string]interface{}{
+			"rating_average": rating.Average,
+			"rating_count":   rating.Count,
+		}).
+		RetryOnConflict(3).
+		Do(ctx)
+	if err != nil {
+		if elastic.IsNotFound(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to update product rating: %v", err)
+	}
+	return nil
+}
+
+// adjustStockScript adds params.delta to the stock of the variant with the
+// ID params.variant_id unless that would take it below zero, in which case
+// the write is skipped and reported as a noop.
+const adjustStockScript = `
+boolean adjusted = false;
+if (ctx._source.variants != null) {
+	for (def v : ctx._source.variants) {
+		if (v.id == params.variant_id) {
+			long stock = v.stock == null ? 0 : v.stock;
+			if (stock + params.delta >= 0) {
+				v.stock = stock + params.delta;
+				adjusted = true;
+			}
+		}
+	}
+}
+if (!adjusted) {
+	ctx.op = 'noop';
+}
+`
+
+// stockConflictRetries is how many times a stock update is tried again when
+// the product changed in between, which concurrent orders of it often do.
+const stockConflictRetries = 10
+
+func (r *elasticRepository) AdjustStock(ctx context.Context, productID string, variantID string, delta int) error {
+	if productID == "" || variantID == "" {
+		return fmt.Errorf("product and variant IDs are required")
+	}
+
+	// Like ratings, stock changes with every order and is not an edit of
+	// the product, so no event is queued for it.
+	script := elastic.NewScript(adjustStockScript).
+		Lang("painless").
+		Params(map[string]interface{}{
+			"variant_id": variantID,
+			"delta":      delta,
+		})
+	res, err := r.client.Update().
+		Index("catalog").
+		Id(productID).
+		Script(script).
+		RetryOnConflict(stockConflictRetries).
+		Do(ctx)
+	if err != nil {
+		if elastic.IsNotFound(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to update product stock: %v", err)
+	}
+	if res.Result != "noop" {
+		return nil
+	}
+
+	// Nothing was written: either the variant is gone or it has too little
+	// stock.
+	p, err := r.GetProductByID(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if _, ok := p.Variant(variantID); !ok {
+		return ErrVariantNotFound
+	}
+	return ErrInsufficientStock
+}
+
+func (r *elasticRepository) StreamProducts(ctx context.Context, fn func(Product) error) error {
+	scroll := r.client.Scroll("catalog").
+		Size(500).
+		Sort("_doc", true).
+		FetchSourceContext(elastic.NewFetchSourceContext(true).Exclude("pending_events"))
+	defer func() {
+		if err := scroll.Clear(context.Background()); err != nil {
+			log.Printf("Warning: failed to clear product scroll: %v", err)
+		}
+	}()
+
+	for {
+		res, err := scroll.Do(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to scroll products: %v", err)
+		}
+
+		products, err := r.extractProducts(res)
+		if err != nil {
+			return err
+		}
+		for _, p := range products {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// BulkPutProducts creates each product only if its ID is unused, so imports
+// never overwrite existing products.
+func (r *elasticRepository) BulkPutProducts(ctx context.Context, products []Product) []error {
+	errs := make([]error, len(products))
+	if len(products) == 0 {
+		return errs
+	}
+
+	bulk := r.client.Bulk()
+	for _, p := range products {
+		e, err := outbox.NewEvent(EventProductCreated, p.ID, p)
+		if err != nil {
+			return fillErrors(errs, err)
+		}
+		bulk.Add(elastic.NewBulkIndexRequest().
+			Index("catalog").
+			Id(p.ID).
+			OpType("create").
+			Doc(indexedProduct{
+				productDocument: newProductDocument(p),
+				PendingEvents:   []outbox.Event{e},
+			}))
+	}
+
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		return fillErrors(errs, fmt.Errorf("failed to index products: %v", err))
+	}
+	if len(res.Items) != len(products) {
+		return fillErrors(errs, fmt.Errorf("bulk response has %d items for %d products", len(res.Items), len(products)))
+	}
+
+	for i, item := range res.Items {
+		for _, result := range item {
+			switch {
+			case result.Status == http.StatusConflict:
+				errs[i] = fmt.Errorf("product with ID %s already exists", products[i].ID)
+			case result.Error != nil:
+				errs[i] = fmt.Errorf("failed to index product: %s", result.Error.Reason)
+			}
+		}
+	}
+	return errs
+}
+
+func fillErrors(errs []error, err error) []error {
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
 // Helper function to extract products from search results
 func (r *elasticRepository) extractProducts(res *elastic.SearchResult) ([]Product, error) {
 	products := make([]Product, 0, len(res.Hits.Hits))
@@ -211,12 +792,7 @@ func (r *elasticRepository) extractProducts(res *elastic.SearchResult) ([]Produc
 			continue
 		}
 
-		products = append(products, Product{
-			ID:          hit.Id,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		})
+		products = append(products, p.product(hit.Id))
 	}
 	return products, nil
 }
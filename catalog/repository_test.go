@@ -0,0 +1,33 @@
+package catalog
+
+import "testing"
+
+func TestIdempotencyID(t *testing.T) {
+	tests := []struct {
+		name     string
+		sellerID string
+		key      string
+		want     string
+	}{
+		{"marketplace key", "", "key-1", "key-1"},
+		{"marketplace key with a colon", "", "seller:s1:key-1", "marketplace:seller%3As1%3Akey-1"},
+		{"seller key", "s1", "key-1", "seller:s1:key-1"},
+		{"seller key with a colon", "s1", "a:b", "seller:s1:a%3Ab"},
+	}
+	ids := map[string]string{}
+	for _, tt := range tests {
+		got := idempotencyID(tt.sellerID, tt.key)
+		if got != tt.want {
+			t.Errorf("%s: idempotencyID(%q, %q) = %q, want %q", tt.name, tt.sellerID, tt.key, got, tt.want)
+		}
+		if other, ok := ids[got]; ok {
+			t.Errorf("%s: idempotencyID clashes with %s", tt.name, other)
+		}
+		ids[got] = tt.name
+	}
+
+	// The same key of two sellers is two keys.
+	if idempotencyID("s1", "key-1") == idempotencyID("s2", "key-1") {
+		t.Error("sellers s1 and s2 share key-1")
+	}
+}
@@ -2,7 +2,9 @@ package catalog
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 
@@ -11,34 +13,62 @@ import (
 	"google.golang.org/grpc/reflection"
 )
 
+// ErrWatchLagging ends a watch whose client did not keep up.
+var ErrWatchLagging = errors.New("product watcher fell behind")
+
 type grpcServer struct {
 	service Service
 	pb.UnimplementedCatalogServiceServer
 }
 
-func ListenGRPC(s Service, port int) error {
+func ListenGRPC(s Service, port int, opts ...grpc.ServerOption) error {
 	list, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return err
 	}
-	serv := grpc.NewServer()
+	opts = append([]grpc.ServerOption{grpc.MaxRecvMsgSize(maxImageMessageSize)}, opts...)
+	serv := grpc.NewServer(opts...)
 	pb.RegisterCatalogServiceServer(serv, &grpcServer{service: s})
 	reflection.Register(serv)
 	return serv.Serve(list)
 }
 
 func (s *grpcServer) PostProduct(ctx context.Context, r *pb.PostProductRequest) (*pb.PostProductResponse, error) {
-	p, err := s.service.PostProduct(ctx, r.Name, r.Description, r.Price)
+	p, err := s.service.PostProduct(ctx, Product{
+		Name:        r.Name,
+		Description: r.Description,
+		Price:       r.Price,
+		TaxCategory: r.TaxCategory,
+		Category:    r.Category,
+		Weight:      r.Weight,
+		SellerID:    r.SellerId,
+		Options:     optionsFromProto(r.Options),
+		Variants:    variantsFromProto(r.Variants),
+	}, r.IdempotencyKey)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.PostProductResponse{Product: productToProto(*p)}, nil
+}
+
+func (s *grpcServer) UpdateProduct(ctx context.Context, r *pb.UpdateProductRequest) (*pb.UpdateProductResponse, error) {
+	p, err := s.service.UpdateProduct(ctx, Product{
+		ID:          r.Id,
+		Name:        r.Name,
+		Description: r.Description,
+		Price:       r.Price,
+		TaxCategory: r.TaxCategory,
+		Category:    r.Category,
+		Weight:      r.Weight,
+		Options:     optionsFromProto(r.Options),
+		Variants:    variantsFromProto(r.Variants),
+	})
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
-	return &pb.PostProductResponse{Product: &pb.Product{
-		Id:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}}, nil
+	return &pb.UpdateProductResponse{Product: productToProto(*p)}, nil
 }
 
 func (s *grpcServer) GetProduct(ctx context.Context, r *pb.GetProductRequest) (*pb.GetProductResponse, error) {
@@ -47,21 +77,24 @@ func (s *grpcServer) GetProduct(ctx context.Context, r *pb.GetProductRequest) (*
 		log.Println(err)
 		return nil, err
 	}
-	return &pb.GetProductResponse{Product: &pb.Product{
-		Id:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}}, nil
+	return &pb.GetProductResponse{Product: productToProto(*p)}, nil
 }
 
 func (s *grpcServer) GetProducts(ctx context.Context, r *pb.GetProductsRequest) (*pb.GetProductsResponse, error) {
 	var res []Product
 	var err error
-	if r.Query != "" {
+	if r.MinRating > 0 || r.Sort == pb.GetProductsRequest_RATING {
+		res, err = s.service.FilterProducts(ctx, ProductFilter{
+			Query:        r.Query,
+			MinRating:    r.MinRating,
+			SortByRating: r.Sort == pb.GetProductsRequest_RATING,
+		}, r.Skip, r.Take)
+	} else if r.Query != "" {
 		res, err = s.service.SearchProducts(ctx, r.Query, r.Skip, r.Take)
 	} else if len(r.Ids) != 0 {
 		res, err = s.service.GetProductByID(ctx, r.Ids)
+	} else if r.SellerId != "" {
+		res, err = s.service.GetSellerProducts(ctx, r.SellerId, r.Skip, r.Take)
 	} else {
 		res, err = s.service.GetProducts(ctx, r.Skip, r.Take)
 	}
@@ -71,12 +104,136 @@ func (s *grpcServer) GetProducts(ctx context.Context, r *pb.GetProductsRequest)
 	}
 	products := []*pb.Product{}
 	for _, p := range res {
-		products = append(products, &pb.Product{
-			Id:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		})
+		products = append(products, productToProto(p))
 	}
 	return &pb.GetProductsResponse{Products: products}, nil
 }
+
+func (s *grpcServer) SetProductRating(ctx context.Context, r *pb.SetProductRatingRequest) (*pb.SetProductRatingResponse, error) {
+	if err := s.service.SetProductRating(ctx, r.ProductId, ratingFromProto(r.Rating)); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.SetProductRatingResponse{}, nil
+}
+
+func (s *grpcServer) ReserveStock(ctx context.Context, r *pb.ReserveStockRequest) (*pb.ReserveStockResponse, error) {
+	if err := s.service.ReserveStock(ctx, stockLinesFromProto(r.Lines)); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.ReserveStockResponse{}, nil
+}
+
+func (s *grpcServer) ReleaseStock(ctx context.Context, r *pb.ReleaseStockRequest) (*pb.ReleaseStockResponse, error) {
+	if err := s.service.ReleaseStock(ctx, stockLinesFromProto(r.Lines)); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.ReleaseStockResponse{}, nil
+}
+
+func (s *grpcServer) AddProductImage(ctx context.Context, r *pb.AddProductImageRequest) (*pb.AddProductImageResponse, error) {
+	p, err := s.service.AddProductImage(ctx, r.ProductId, r.Data, r.Alt, int(r.Position))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.AddProductImageResponse{Product: productToProto(*p)}, nil
+}
+
+func (s *grpcServer) RemoveProductImage(ctx context.Context, r *pb.RemoveProductImageRequest) (*pb.RemoveProductImageResponse, error) {
+	p, err := s.service.RemoveProductImage(ctx, r.ProductId, r.ImageId)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.RemoveProductImageResponse{Product: productToProto(*p)}, nil
+}
+
+func (s *grpcServer) DeleteProduct(ctx context.Context, r *pb.DeleteProductRequest) (*pb.DeleteProductResponse, error) {
+	if err := s.service.DeleteProduct(ctx, r.Id); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.DeleteProductResponse{}, nil
+}
+
+func (s *grpcServer) WatchProducts(r *pb.WatchProductsRequest, stream pb.CatalogService_WatchProductsServer) error {
+	products, err := s.service.WatchProducts(stream.Context(), r.Category)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	for p := range products {
+		if err := stream.Send(productToProto(p)); err != nil {
+			return err
+		}
+	}
+	if err := stream.Context().Err(); err != nil {
+		return err
+	}
+	return ErrWatchLagging
+}
+
+func (s *grpcServer) StreamProducts(r *pb.StreamProductsRequest, stream pb.CatalogService_StreamProductsServer) error {
+	err := s.service.StreamProducts(stream.Context(), func(p Product) error {
+		return stream.Send(productToProto(p))
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
+
+func (s *grpcServer) BulkPostProducts(stream pb.CatalogService_BulkPostProductsServer) error {
+	res := &pb.BulkPostProductsResponse{Errors: []*pb.BulkPostProductsError{}}
+	batch := make([]Product, 0, MaxBulkProducts)
+	var offset uint64
+
+	flush := func() error {
+		results, err := s.service.BulkPostProducts(stream.Context(), batch)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		for i, r := range results {
+			if r.Err != nil {
+				res.Errors = append(res.Errors, &pb.BulkPostProductsError{
+					Index: offset + uint64(i),
+					Error: r.Err.Error(),
+				})
+				continue
+			}
+			res.Created++
+		}
+		offset += uint64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		batch = append(batch, productFromProto(p))
+		if len(batch) == MaxBulkProducts {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	return stream.SendAndClose(res)
+}
@@ -1,62 +1,380 @@
 package catalog
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"log"
+	"strings"
 
+	"github.com/donaldnash/go-marketplace/blobstore"
 	"github.com/segmentio/ksuid"
 )
 
 type Service interface {
-	PostProduct(ctx context.Context, name string, description string, price float64) (*Product, error)
+	// PostProduct creates a product from p. Its ID is assigned by the service.
+	PostProduct(ctx context.Context, p Product, idempotencyKey string) (*Product, error)
+	// UpdateProduct replaces the fields of the product with p's ID. The
+	// seller of a product never changes.
+	UpdateProduct(ctx context.Context, p Product) (*Product, error)
 	GetProduct(ctx context.Context, id string) (*Product, error)
 	GetProducts(ctx context.Context, skip uint64, take uint64) ([]Product, error)
+	// GetSellerProducts lists the products of the seller with the account ID
+	// sellerID.
+	GetSellerProducts(ctx context.Context, sellerID string, skip uint64, take uint64) ([]Product, error)
 	GetProductByID(ctx context.Context, ids []string) ([]Product, error)
 	SearchProducts(ctx context.Context, query string, skip uint64, take uint64) ([]Product, error)
+	// FilterProducts lists or searches products, narrowed down and ordered
+	// by their rating as f asks.
+	FilterProducts(ctx context.Context, f ProductFilter, skip uint64, take uint64) ([]Product, error)
+	// SetProductRating records the rating the review service worked out for
+	// a product.
+	SetProductRating(ctx context.Context, id string, r Rating) error
+	// ReserveStock takes the quantities of lines out of the stock of their
+	// variants, all of them or none. It fails with ErrInsufficientStock when
+	// a variant has less stock than its line asks for.
+	ReserveStock(ctx context.Context, lines []StockLine) error
+	// ReleaseStock puts the quantities of lines back into the stock of their
+	// variants.
+	ReleaseStock(ctx context.Context, lines []StockLine) error
+	// WatchProducts streams products created in category, or in any category
+	// if it is empty, until ctx is done.
+	WatchProducts(ctx context.Context, category string) (<-chan Product, error)
+	// StreamProducts calls fn with every product until fn returns an error.
+	StreamProducts(ctx context.Context, fn func(Product) error) error
+	// BulkPostProducts creates up to MaxBulkProducts products. Products keep
+	// the ID they come with, if any.
+	BulkPostProducts(ctx context.Context, products []Product) ([]BulkResult, error)
+	// AddProductImage stores a JPEG, PNG or GIF file with a thumbnail and
+	// inserts it among the product's images at position, or after them if
+	// position is negative or past the end.
+	AddProductImage(ctx context.Context, productID string, data []byte, alt string, position int) (*Product, error)
+	RemoveProductImage(ctx context.Context, productID string, imageID string) (*Product, error)
+	// DeleteProduct deletes a product along with its images.
+	DeleteProduct(ctx context.Context, id string) error
 }
 
+// MaxBulkProducts is the most products one BulkPostProducts call creates.
+const MaxBulkProducts = 500
+
+// BulkResult is the outcome of creating one product of a bulk request.
+type BulkResult struct {
+	Product Product
+	// Err is nil when the product was created.
+	Err error
+}
+
+// Events recorded in the outbox when products change.
+const (
+	EventProductCreated = "ProductCreated"
+	EventProductUpdated = "ProductUpdated"
+)
+
+// DefaultTaxCategory is the tax category of products created without one.
+const DefaultTaxCategory = "standard"
+
 type Product struct {
 	ID          string  `json:"id"`
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
+	TaxCategory string  `json:"tax_category"`
+	// Category groups products for browsing, e.g. "books"; it may be empty.
+	Category string `json:"category"`
+	// Weight is the shipping weight in kilograms; 0 means unknown.
+	Weight float64 `json:"weight"`
+	// SellerID is the account ID of the seller who owns the product, or
+	// empty for products the marketplace sells itself.
+	SellerID string `json:"seller_id,omitempty"`
+	// Images are ordered by Position.
+	Images []Image `json:"images,omitempty"`
+	// Options are the ways the product varies, such as size and color. A
+	// product with options is sold as one of its Variants.
+	Options  []Option  `json:"options,omitempty"`
+	Variants []Variant `json:"variants,omitempty"`
+	// Rating is set by the review service, never by product writes.
+	Rating Rating `json:"rating"`
+}
+
+// Rating sums up the approved reviews of a product. Average is 0 while
+// Count is.
+type Rating struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+// MaxRating is the most stars a review gives.
+const MaxRating = 5
+
+// ProductFilter narrows down and orders a listing or search of products.
+type ProductFilter struct {
+	// Query searches products like SearchProducts when it is not empty.
+	Query string
+	// MinRating leaves out products rated lower on average, and products
+	// without a rating, when it is positive.
+	MinRating float64
+	// SortByRating lists the best rated products first rather than the best
+	// matches.
+	SortByRating bool
+}
+
+// Variant returns the variant of p with the given ID.
+func (p Product) Variant(id string) (Variant, bool) {
+	for _, v := range p.Variants {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// PriceOf is what v of p sells for.
+func (p Product) PriceOf(v Variant) float64 {
+	if v.Price > 0 {
+		return v.Price
+	}
+	return p.Price
+}
+
+// Option is a way a product varies, such as "Size" with the values "S", "M"
+// and "L".
+type Option struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// Variant is a version of a product with one value of each of its options,
+// such as a size M in red.
+type Variant struct {
+	ID  string `json:"id"`
+	SKU string `json:"sku"`
+	// Price overrides the product's price when it is positive.
+	Price float64 `json:"price,omitempty"`
+	Stock int     `json:"stock"`
+	// Attributes hold the variant's value of each option, in the order of
+	// the product's options.
+	Attributes []Attribute `json:"attributes"`
+}
+
+// StockLine is a quantity of a product variant taken out of or put back into
+// stock.
+type StockLine struct {
+	ProductID string
+	VariantID string
+	Quantity  uint32
+}
+
+type Attribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Image is a picture of a product. Position numbers the images of a product
+// from 0.
+type Image struct {
+	ID           string `json:"id"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	Alt          string `json:"alt"`
+	Position     int    `json:"position"`
 }
 
+var (
+	ErrImageNotFound = fmt.Errorf("image not found")
+	ErrTooManyImages = fmt.Errorf("a product cannot have more than %d images", MaxProductImages)
+)
+
 type catalogService struct {
 	repository Repository
+	blobs      blobstore.BlobStore
+	feed       *productFeed
 }
 
-func NewService(r Repository) Service {
+// NewService returns a service that keeps products in r and their images in
+// blobs.
+func NewService(r Repository, blobs blobstore.BlobStore) Service {
 	if r == nil {
 		panic("repository cannot be nil")
 	}
-	return &catalogService{r}
+	if blobs == nil {
+		panic("blob store cannot be nil")
+	}
+	return &catalogService{r, blobs, newProductFeed()}
 }
 
-func (s *catalogService) PostProduct(ctx context.Context, name string, description string, price float64) (*Product, error) {
+func (s *catalogService) PostProduct(ctx context.Context, p Product, idempotencyKey string) (*Product, error) {
 	if ctx == nil {
 		return nil, fmt.Errorf("context is required")
 	}
-	if name == "" {
-		return nil, fmt.Errorf("product name is required")
+	if err := validateProduct(p); err != nil {
+		return nil, err
 	}
-	if description == "" {
-		return nil, fmt.Errorf("product description is required")
-	}
-	if price < 0 {
-		return nil, fmt.Errorf("product price cannot be negative")
+	p, err := normalizeVariants(p)
+	if err != nil {
+		return nil, err
 	}
 
-	p := &Product{
-		ID:          ksuid.New().String(),
-		Name:        name,
-		Description: description,
-		Price:       price,
+	p.ID = ksuid.New().String()
+	p.TaxCategory = normalizeTaxCategory(p.TaxCategory)
+	p.Category = normalizeCategory(p.Category)
+
+	if idempotencyKey != "" {
+		request := fmt.Sprintf("%s\x00%s\x00%g\x00%s\x00%g", p.Name, p.Description, p.Price, p.TaxCategory, p.Weight)
+		// Keys recorded before products had categories hashed no category.
+		if p.Category != "" {
+			request += "\x00" + p.Category
+		}
+		// Nor did they hash variants, whose generated IDs are left out.
+		if len(p.Options) > 0 {
+			request += "\x00" + variantsRequest(p)
+		}
+		if p.SellerID != "" {
+			request += "\x00seller:" + p.SellerID
+		}
+		hash := sha256.Sum256([]byte(request))
+		stored, err := s.repository.PutProductWithKey(ctx, p, idempotencyKey, hex.EncodeToString(hash[:]))
+		if err != nil {
+			if err == ErrIdempotencyKeyReused || err == ErrIdempotencyKeyInUse {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to create product: %v", err)
+		}
+		// A replayed request returns the product created the first time.
+		if stored.ID == p.ID {
+			s.feed.publish(*stored)
+		}
+		return stored, nil
 	}
-	if err := s.repository.PutProduct(ctx, *p); err != nil {
+
+	if err := s.repository.PutProduct(ctx, p); err != nil {
 		return nil, fmt.Errorf("failed to create product: %v", err)
 	}
-	return p, nil
+	s.feed.publish(p)
+	return &p, nil
+}
+
+func (s *catalogService) BulkPostProducts(ctx context.Context, products []Product) ([]BulkResult, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if len(products) > MaxBulkProducts {
+		return nil, fmt.Errorf("cannot create more than %d products at once", MaxBulkProducts)
+	}
+
+	results := make([]BulkResult, len(products))
+	valid := []Product{}
+	positions := []int{}
+	for i, p := range products {
+		if err := validateProduct(p); err != nil {
+			results[i] = BulkResult{Product: p, Err: err}
+			continue
+		}
+		p, err := normalizeVariants(p)
+		if err != nil {
+			results[i] = BulkResult{Product: p, Err: err}
+			continue
+		}
+		if p.ID == "" {
+			p.ID = ksuid.New().String()
+		}
+		p.TaxCategory = normalizeTaxCategory(p.TaxCategory)
+		p.Category = normalizeCategory(p.Category)
+
+		results[i] = BulkResult{Product: p}
+		valid = append(valid, p)
+		positions = append(positions, i)
+	}
+
+	errs := s.repository.BulkPutProducts(ctx, valid)
+	for j, err := range errs {
+		i := positions[j]
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		s.feed.publish(results[i].Product)
+	}
+	return results, nil
+}
+
+func (s *catalogService) StreamProducts(ctx context.Context, fn func(Product) error) error {
+	if ctx == nil {
+		return fmt.Errorf("context is required")
+	}
+	return s.repository.StreamProducts(ctx, fn)
+}
+
+func (s *catalogService) UpdateProduct(ctx context.Context, p Product) (*Product, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if p.ID == "" {
+		return nil, fmt.Errorf("product ID is required")
+	}
+	if err := validateProduct(p); err != nil {
+		return nil, err
+	}
+	p, err := normalizeVariants(p)
+	if err != nil {
+		return nil, err
+	}
+	p.TaxCategory = normalizeTaxCategory(p.TaxCategory)
+	p.Category = normalizeCategory(p.Category)
+
+	if err := s.repository.UpdateProduct(ctx, p); err != nil {
+		if err == ErrNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update product: %v", err)
+	}
+	// The update leaves the images, the seller and the rating as they are.
+	if updated, err := s.repository.GetProductByID(ctx, p.ID); err == nil {
+		return updated, nil
+	}
+	return &p, nil
+}
+
+func validateProduct(p Product) error {
+	if p.Name == "" {
+		return fmt.Errorf("product name is required")
+	}
+	if p.Description == "" {
+		return fmt.Errorf("product description is required")
+	}
+	if p.Price < 0 {
+		return fmt.Errorf("product price cannot be negative")
+	}
+	if p.Weight < 0 {
+		return fmt.Errorf("product weight cannot be negative")
+	}
+	return nil
+}
+
+func normalizeTaxCategory(category string) string {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if category == "" {
+		return DefaultTaxCategory
+	}
+	return category
+}
+
+func normalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
+
+func (s *catalogService) WatchProducts(ctx context.Context, category string) (<-chan Product, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+
+	products, cancel := s.feed.subscribe(normalizeCategory(category))
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+	return products, nil
 }
 
 func (s *catalogService) GetProduct(ctx context.Context, id string) (*Product, error) {
@@ -94,6 +412,26 @@ func (s *catalogService) GetProducts(ctx context.Context, skip uint64, take uint
 	return products, nil
 }
 
+func (s *catalogService) GetSellerProducts(ctx context.Context, sellerID string, skip uint64, take uint64) ([]Product, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if sellerID == "" {
+		return nil, fmt.Errorf("seller ID is required")
+	}
+
+	// Enforce pagination limits
+	if take > 100 || (skip == 0 && take == 0) {
+		take = 100
+	}
+
+	products, err := s.repository.ListProductsBySeller(ctx, sellerID, skip, take)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products of seller: %v", err)
+	}
+	return products, nil
+}
+
 func (s *catalogService) GetProductByID(ctx context.Context, ids []string) ([]Product, error) {
 	if ctx == nil {
 		return nil, fmt.Errorf("context is required")
@@ -128,3 +466,228 @@ func (s *catalogService) SearchProducts(ctx context.Context, query string, skip
 	}
 	return products, nil
 }
+
+func (s *catalogService) FilterProducts(ctx context.Context, f ProductFilter, skip uint64, take uint64) ([]Product, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if f.MinRating < 0 || f.MinRating > MaxRating {
+		return nil, fmt.Errorf("minimum rating must be between 0 and %d", MaxRating)
+	}
+
+	// Enforce pagination limits
+	if take > 100 || (skip == 0 && take == 0) {
+		take = 100
+	}
+
+	products, err := s.repository.FilterProducts(ctx, f, skip, take)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter products: %v", err)
+	}
+	return products, nil
+}
+
+func (s *catalogService) SetProductRating(ctx context.Context, id string, r Rating) error {
+	if ctx == nil {
+		return fmt.Errorf("context is required")
+	}
+	if id == "" {
+		return fmt.Errorf("product ID is required")
+	}
+	if r.Count < 0 || r.Average < 0 || r.Average > MaxRating || (r.Count == 0 && r.Average != 0) {
+		return fmt.Errorf("invalid rating %.2f of %d reviews", r.Average, r.Count)
+	}
+
+	if err := s.repository.SetProductRating(ctx, id, r); err != nil {
+		if err == ErrNotFound {
+			return err
+		}
+		return fmt.Errorf("failed to set product rating: %v", err)
+	}
+	return nil
+}
+
+func (s *catalogService) ReserveStock(ctx context.Context, lines []StockLine) error {
+	if ctx == nil {
+		return fmt.Errorf("context is required")
+	}
+	if err := validateStockLines(lines); err != nil {
+		return err
+	}
+
+	for i, l := range lines {
+		err := s.repository.AdjustStock(ctx, l.ProductID, l.VariantID, -int(l.Quantity))
+		if err == nil {
+			continue
+		}
+		// Put back what the lines before took, so that none stay reserved.
+		if releaseErr := s.ReleaseStock(context.WithoutCancel(ctx), lines[:i]); releaseErr != nil {
+			log.Printf("Error releasing stock of a failed reservation: %v", releaseErr)
+		}
+		switch err {
+		case ErrNotFound, ErrVariantNotFound, ErrInsufficientStock:
+			return fmt.Errorf("%w: product %s, variant %s", err, l.ProductID, l.VariantID)
+		}
+		return fmt.Errorf("failed to reserve stock: %v", err)
+	}
+	return nil
+}
+
+func (s *catalogService) ReleaseStock(ctx context.Context, lines []StockLine) error {
+	if ctx == nil {
+		return fmt.Errorf("context is required")
+	}
+	if err := validateStockLines(lines); err != nil {
+		return err
+	}
+
+	// Every line is released even if one fails, so that as little stock as
+	// possible is lost.
+	failed := 0
+	for _, l := range lines {
+		if err := s.repository.AdjustStock(ctx, l.ProductID, l.VariantID, int(l.Quantity)); err != nil {
+			log.Printf("Error releasing %d of product %s, variant %s: %v", l.Quantity, l.ProductID, l.VariantID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to release stock of %d of %d lines", failed, len(lines))
+	}
+	return nil
+}
+
+func validateStockLines(lines []StockLine) error {
+	for _, l := range lines {
+		if l.ProductID == "" || l.VariantID == "" {
+			return fmt.Errorf("product and variant IDs are required")
+		}
+		if l.Quantity == 0 {
+			return fmt.Errorf("quantity must be greater than 0")
+		}
+	}
+	return nil
+}
+
+func (s *catalogService) AddProductImage(ctx context.Context, productID string, data []byte, alt string, position int) (*Product, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if productID == "" {
+		return nil, fmt.Errorf("product ID is required")
+	}
+	img, contentType, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	thumb, err := thumbnail(img, ThumbnailSize)
+	if err != nil {
+		return nil, err
+	}
+
+	image := Image{
+		ID:  ksuid.New().String(),
+		Alt: strings.TrimSpace(alt),
+	}
+	key, thumbKey := imageKeys(productID, image.ID)
+	if err := s.blobs.Put(ctx, key, bytes.NewReader(data), contentType); err != nil {
+		return nil, fmt.Errorf("failed to store image: %v", err)
+	}
+	if err := s.blobs.Put(ctx, thumbKey, bytes.NewReader(thumb), "image/jpeg"); err != nil {
+		s.deleteImageFiles(ctx, productID, image)
+		return nil, fmt.Errorf("failed to store thumbnail: %v", err)
+	}
+	image.URL = s.blobs.URL(key)
+	image.ThumbnailURL = s.blobs.URL(thumbKey)
+
+	p, err := s.repository.UpdateProductImages(ctx, productID, func(images []Image) ([]Image, error) {
+		if len(images) >= MaxProductImages {
+			return nil, ErrTooManyImages
+		}
+		at := position
+		if at < 0 || at > len(images) {
+			at = len(images)
+		}
+		images = append(images[:at], append([]Image{image}, images[at:]...)...)
+		return numberImages(images), nil
+	})
+	if err != nil {
+		s.deleteImageFiles(ctx, productID, image)
+		if err == ErrNotFound || err == ErrTooManyImages {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to add image: %v", err)
+	}
+	return p, nil
+}
+
+func (s *catalogService) RemoveProductImage(ctx context.Context, productID string, imageID string) (*Product, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if productID == "" || imageID == "" {
+		return nil, fmt.Errorf("product ID and image ID are required")
+	}
+
+	var removed Image
+	p, err := s.repository.UpdateProductImages(ctx, productID, func(images []Image) ([]Image, error) {
+		for i, image := range images {
+			if image.ID == imageID {
+				removed = image
+				return numberImages(append(images[:i], images[i+1:]...)), nil
+			}
+		}
+		return nil, ErrImageNotFound
+	})
+	if err != nil {
+		if err == ErrNotFound || err == ErrImageNotFound {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to remove image: %v", err)
+	}
+	s.deleteImageFiles(ctx, productID, removed)
+	return p, nil
+}
+
+func (s *catalogService) DeleteProduct(ctx context.Context, id string) error {
+	if ctx == nil {
+		return fmt.Errorf("context is required")
+	}
+	if id == "" {
+		return fmt.Errorf("product ID is required")
+	}
+
+	p, err := s.repository.DeleteProduct(ctx, id)
+	if err != nil {
+		if err == ErrNotFound {
+			return err
+		}
+		return fmt.Errorf("failed to delete product: %v", err)
+	}
+	for _, image := range p.Images {
+		s.deleteImageFiles(ctx, id, image)
+	}
+	return nil
+}
+
+// deleteImageFiles deletes an image and its thumbnail. Files that cannot be
+// deleted are only logged: nothing refers to them anymore.
+func (s *catalogService) deleteImageFiles(ctx context.Context, productID string, image Image) {
+	key, thumbKey := imageKeys(productID, image.ID)
+	for _, k := range []string{key, thumbKey} {
+		if err := s.blobs.Delete(ctx, k); err != nil {
+			log.Printf("Warning: failed to delete image file %s: %v", k, err)
+		}
+	}
+}
+
+func imageKeys(productID string, imageID string) (string, string) {
+	key := "products/" + productID + "/" + imageID
+	return key, key + "-thumbnail"
+}
+
+func numberImages(images []Image) []Image {
+	for i := range images {
+		images[i].Position = i
+	}
+	return images
+}
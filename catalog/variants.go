@@ -0,0 +1,174 @@
+package catalog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/segmentio/ksuid"
+)
+
+// ErrInvalidVariants wraps why the options or variants of a product were
+// refused.
+var ErrInvalidVariants = fmt.Errorf("invalid product variants")
+
+const (
+	// MaxProductOptions is how many options a product may have.
+	MaxProductOptions = 3
+	// MaxProductVariants is how many variants a product may have.
+	MaxProductVariants = 100
+)
+
+// normalizeVariants checks the options and variants of p, trims their names
+// and values, puts each variant's attributes in the order of the options and
+// gives new variants an ID. Variants that come with an ID keep it, so that
+// orders of them still find them after the product is updated.
+func normalizeVariants(p Product) (Product, error) {
+	if len(p.Options) == 0 && len(p.Variants) == 0 {
+		p.Options, p.Variants = nil, nil
+		return p, nil
+	}
+	if len(p.Options) > MaxProductOptions {
+		return p, fmt.Errorf("%w: a product cannot have more than %d options", ErrInvalidVariants, MaxProductOptions)
+	}
+	if len(p.Options) == 0 {
+		return p, fmt.Errorf("%w: product variants need options", ErrInvalidVariants)
+	}
+	if len(p.Variants) == 0 {
+		return p, fmt.Errorf("%w: a product with options needs at least one variant", ErrInvalidVariants)
+	}
+	if len(p.Variants) > MaxProductVariants {
+		return p, fmt.Errorf("%w: a product cannot have more than %d variants", ErrInvalidVariants, MaxProductVariants)
+	}
+
+	options := make([]Option, len(p.Options))
+	optionNames := map[string]bool{}
+	for i, o := range p.Options {
+		name := strings.TrimSpace(o.Name)
+		if name == "" {
+			return p, fmt.Errorf("%w: option name is required", ErrInvalidVariants)
+		}
+		if optionNames[strings.ToLower(name)] {
+			return p, fmt.Errorf("%w: option %q is given twice", ErrInvalidVariants, name)
+		}
+		optionNames[strings.ToLower(name)] = true
+		if len(o.Values) == 0 {
+			return p, fmt.Errorf("%w: option %q needs at least one value", ErrInvalidVariants, name)
+		}
+
+		values := make([]string, len(o.Values))
+		seen := map[string]bool{}
+		for j, v := range o.Values {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				return p, fmt.Errorf("%w: values of option %q cannot be empty", ErrInvalidVariants, name)
+			}
+			if seen[v] {
+				return p, fmt.Errorf("%w: option %q has the value %q twice", ErrInvalidVariants, name, v)
+			}
+			seen[v] = true
+			values[j] = v
+		}
+		options[i] = Option{Name: name, Values: values}
+	}
+
+	variants := make([]Variant, len(p.Variants))
+	ids := map[string]bool{}
+	skus := map[string]bool{}
+	combinations := map[string]bool{}
+	for i, v := range p.Variants {
+		v.ID = strings.TrimSpace(v.ID)
+		v.SKU = strings.TrimSpace(v.SKU)
+		if v.SKU == "" {
+			return p, fmt.Errorf("%w: variant SKU is required", ErrInvalidVariants)
+		}
+		if skus[v.SKU] {
+			return p, fmt.Errorf("%w: SKU %q is given to more than one variant", ErrInvalidVariants, v.SKU)
+		}
+		skus[v.SKU] = true
+		if v.Price < 0 {
+			return p, fmt.Errorf("%w: price of variant %s cannot be negative", ErrInvalidVariants, v.SKU)
+		}
+		if v.Stock < 0 {
+			return p, fmt.Errorf("%w: stock of variant %s cannot be negative", ErrInvalidVariants, v.SKU)
+		}
+		if v.ID == "" {
+			v.ID = ksuid.New().String()
+		}
+		if ids[v.ID] {
+			return p, fmt.Errorf("%w: variant ID %s is given twice", ErrInvalidVariants, v.ID)
+		}
+		ids[v.ID] = true
+
+		attributes, err := variantAttributes(options, v)
+		if err != nil {
+			return p, err
+		}
+		v.Attributes = attributes
+
+		key := ""
+		for _, a := range attributes {
+			key += a.Value + "\x00"
+		}
+		if combinations[key] {
+			return p, fmt.Errorf("%w: variant %s has the same option values as another variant", ErrInvalidVariants, v.SKU)
+		}
+		combinations[key] = true
+		variants[i] = v
+	}
+
+	p.Options, p.Variants = options, variants
+	return p, nil
+}
+
+// variantAttributes returns the attributes of v in the order of options, and
+// fails unless v has exactly one valid value of each option.
+func variantAttributes(options []Option, v Variant) ([]Attribute, error) {
+	values := map[string]string{}
+	for _, a := range v.Attributes {
+		name := strings.ToLower(strings.TrimSpace(a.Name))
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("%w: variant %s has option %q twice", ErrInvalidVariants, v.SKU, a.Name)
+		}
+		values[name] = strings.TrimSpace(a.Value)
+	}
+	if len(values) != len(options) {
+		return nil, fmt.Errorf("%w: variant %s needs exactly one value of each option", ErrInvalidVariants, v.SKU)
+	}
+
+	attributes := make([]Attribute, len(options))
+	for i, o := range options {
+		value, ok := values[strings.ToLower(o.Name)]
+		if !ok {
+			return nil, fmt.Errorf("%w: variant %s has no value of option %q", ErrInvalidVariants, v.SKU, o.Name)
+		}
+		valid := false
+		for _, allowed := range o.Values {
+			if value == allowed {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: variant %s has %q, which is not a value of option %q", ErrInvalidVariants, v.SKU, value, o.Name)
+		}
+		attributes[i] = Attribute{Name: o.Name, Value: value}
+	}
+	return attributes, nil
+}
+
+// variantsRequest describes the options and variants of p for the hash of an
+// idempotent request, leaving out the IDs given to new variants.
+func variantsRequest(p Product) string {
+	var b strings.Builder
+	for _, o := range p.Options {
+		fmt.Fprintf(&b, "%s=%s\x00", o.Name, strings.Join(o.Values, ","))
+	}
+	for _, v := range p.Variants {
+		fmt.Fprintf(&b, "%s:%g:%d", v.SKU, v.Price, v.Stock)
+		for _, a := range v.Attributes {
+			fmt.Fprintf(&b, ":%s", a.Value)
+		}
+		b.WriteString("\x00")
+	}
+	return b.String()
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/account"
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/order"
+)
+
+// runCommand runs the create, list, get and search commands, which write
+// their results to w.
+func runCommand(ctx context.Context, cfg Config, w io.Writer, command string, resource string, args []string) error {
+	switch command + " " + resource {
+	case "create account":
+		return createAccount(ctx, cfg, w, args)
+	case "create seller":
+		return createSeller(ctx, cfg, w, args)
+	case "create product":
+		return createProduct(ctx, cfg, w, args)
+	case "create order":
+		return createOrder(ctx, cfg, w, args)
+	case "list accounts":
+		return listAccounts(ctx, cfg, w, args)
+	case "list products":
+		return listProducts(ctx, cfg, w, args, false)
+	case "list sellers":
+		return listSellers(ctx, cfg, w, args)
+	case "list orders":
+		return listOrders(ctx, cfg, w, args)
+	case "get account":
+		return getAccount(ctx, cfg, w, args)
+	case "get product":
+		return getProduct(ctx, cfg, w, args)
+	case "get order":
+		return getOrder(ctx, cfg, w, args)
+	case "get report":
+		return getSalesReport(ctx, cfg, w, args)
+	case "search products":
+		return listProducts(ctx, cfg, w, args, true)
+	}
+	return fmt.Errorf("unknown command %q", command+" "+resource)
+}
+
+// parseID parses the flags of a get command, which take a single ID.
+func parseID(name string, args []string) (string, error) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 1 || flags.Arg(0) == "" {
+		return "", fmt.Errorf("%s needs exactly one ID", name)
+	}
+	return flags.Arg(0), nil
+}
+
+func createAccount(ctx context.Context, cfg Config, w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("create account", flag.ExitOnError)
+	name := flags.String("name", "", "account name")
+	idempotencyKey := flags.String("idempotency-key", "", "key that makes retrying the command safe")
+	flags.Parse(args)
+
+	client, err := account.NewClientWithOptions(cfg.AccountURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	a, err := client.PostAccount(ctx, *name, "", *idempotencyKey)
+	if err != nil {
+		return fmt.Errorf("failed to create account: %v", err)
+	}
+	return render(w, cfg.Output, a, accountTable(*a))
+}
+
+func listAccounts(ctx context.Context, cfg Config, w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("list accounts", flag.ExitOnError)
+	skip := flags.Uint64("skip", 0, "number of accounts to skip")
+	take := flags.Uint64("take", 20, "number of accounts to list, at most 100")
+	flags.Parse(args)
+
+	client, err := account.NewClientWithOptions(cfg.AccountURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	accounts, err := client.GetAccounts(ctx, *skip, *take)
+	if err != nil {
+		return fmt.Errorf("failed to list accounts: %v", err)
+	}
+	return render(w, cfg.Output, accounts, accountTable(accounts...))
+}
+
+func getAccount(ctx context.Context, cfg Config, w io.Writer, args []string) error {
+	id, err := parseID("get account", args)
+	if err != nil {
+		return err
+	}
+
+	client, err := account.NewClientWithOptions(cfg.AccountURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	a, err := client.GetAccount(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get account: %v", err)
+	}
+	return render(w, cfg.Output, a, accountTable(*a))
+}
+
+func accountTable(accounts ...account.Account) table {
+	t := table{columns: []string{"ID", "NAME"}}
+	for _, a := range accounts {
+		t.rows = append(t.rows, []string{a.ID, a.Name})
+	}
+	return t
+}
+
+func createSeller(ctx context.Context, cfg Config, w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("create seller", flag.ExitOnError)
+	accountID := flags.String("account", "", "ID of the account that becomes a seller")
+	name := flags.String("name", "", "name the seller sells under")
+	flags.Parse(args)
+
+	client, err := account.NewClientWithOptions(cfg.AccountURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	s, err := client.PostSeller(ctx, *accountID, *name)
+	if err != nil {
+		return fmt.Errorf("failed to create seller: %v", err)
+	}
+	return render(w, cfg.Output, s, sellerTable(*s))
+}
+
+func listSellers(ctx context.Context, cfg Config, w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("list sellers", flag.ExitOnError)
+	skip := flags.Uint64("skip", 0, "number of sellers to skip")
+	take := flags.Uint64("take", 20, "number of sellers to list, at most 100")
+	flags.Parse(args)
+
+	client, err := account.NewClientWithOptions(cfg.AccountURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	sellers, err := client.GetSellers(ctx, *skip, *take)
+	if err != nil {
+		return fmt.Errorf("failed to list sellers: %v", err)
+	}
+	return render(w, cfg.Output, sellers, sellerTable(sellers...))
+}
+
+func sellerTable(sellers ...account.Seller) table {
+	t := table{columns: []string{"ID", "NAME", "CREATED"}}
+	for _, s := range sellers {
+		t.rows = append(t.rows, []string{s.AccountID, s.Name, s.CreatedAt.Format("2006-01-02 15:04:05")})
+	}
+	return t
+}
+
+func createProduct(ctx context.Context, cfg Config, w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("create product", flag.ExitOnError)
+	var p catalog.Product
+	flags.StringVar(&p.Name, "name", "", "product name")
+	flags.StringVar(&p.Description, "description", "", "product description")
+	flags.Float64Var(&p.Price, "price", 0, "product price")
+	flags.StringVar(&p.TaxCategory, "tax-category", "", "tax category, e.g. books")
+	flags.StringVar(&p.Category, "category", "", "category the product is browsed under")
+	flags.Float64Var(&p.Weight, "weight", 0, "shipping weight in kilograms")
+	flags.StringVar(&p.SellerID, "seller", "", "ID of the seller that sells the product")
+	idempotencyKey := flags.String("idempotency-key", "", "key that makes retrying the command safe")
+	flags.Parse(args)
+
+	client, err := catalog.NewClientWithOptions(cfg.CatalogURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	created, err := client.PostProduct(ctx, p, *idempotencyKey)
+	if err != nil {
+		return fmt.Errorf("failed to create product: %v", err)
+	}
+	return render(w, cfg.Output, created, productTable(*created))
+}
+
+// listProducts lists the catalog page by page or, for search, the products
+// that match the query given as the only argument.
+func listProducts(ctx context.Context, cfg Config, w io.Writer, args []string, search bool) error {
+	name := "list products"
+	if search {
+		name = "search products"
+	}
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	skip := flags.Uint64("skip", 0, "number of products to skip")
+	take := flags.Uint64("take", 20, "number of products to list, at most 100")
+	minRating := flags.Float64("min-rating", 0, "leave out products rated lower on average")
+	sortBy := flags.String("sort", "relevance", "order of the products: relevance or rating")
+	flags.Parse(args)
+
+	if *sortBy != "relevance" && *sortBy != "rating" {
+		return fmt.Errorf("unknown sort %q; use relevance or rating", *sortBy)
+	}
+
+	query := ""
+	if search {
+		query = strings.Join(flags.Args(), " ")
+		if query == "" {
+			return fmt.Errorf("search products needs a query")
+		}
+	} else if flags.NArg() > 0 {
+		return fmt.Errorf("list products takes no arguments; use search products to search")
+	}
+
+	client, err := catalog.NewClientWithOptions(cfg.CatalogURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var products []catalog.Product
+	if *minRating > 0 || *sortBy == "rating" {
+		products, err = client.FilterProducts(ctx, catalog.ProductFilter{
+			Query:        query,
+			MinRating:    *minRating,
+			SortByRating: *sortBy == "rating",
+		}, *skip, *take)
+	} else {
+		products, err = client.GetProducts(ctx, *skip, *take, nil, query)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list products: %v", err)
+	}
+	return render(w, cfg.Output, products, productTable(products...))
+}
+
+func getProduct(ctx context.Context, cfg Config, w io.Writer, args []string) error {
+	id, err := parseID("get product", args)
+	if err != nil {
+		return err
+	}
+
+	client, err := catalog.NewClientWithOptions(cfg.CatalogURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	p, err := client.GetProduct(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get product: %v", err)
+	}
+	return render(w, cfg.Output, p, productTable(*p))
+}
+
+func productTable(products ...catalog.Product) table {
+	t := table{columns: []string{"ID", "NAME", "PRICE", "CATEGORY", "TAX CATEGORY", "WEIGHT", "RATING"}}
+	for _, p := range products {
+		rating := ""
+		if p.Rating.Count > 0 {
+			rating = fmt.Sprintf("%.1f (%d)", p.Rating.Average, p.Rating.Count)
+		}
+		t.rows = append(t.rows, []string{
+			p.ID,
+			p.Name,
+			formatPrice(p.Price),
+			p.Category,
+			p.TaxCategory,
+			strconv.FormatFloat(p.Weight, 'f', -1, 64),
+			rating,
+		})
+	}
+	return t
+}
+
+// orderLines collects repeated -product flags.
+type orderLines []order.OrderedProduct
+
+func (l *orderLines) String() string {
+	lines := []string{}
+	for _, p := range *l {
+		id := p.ID
+		if p.VariantID != "" {
+			id += "/" + p.VariantID
+		}
+		lines = append(lines, fmt.Sprintf("%s:%d", id, p.Quantity))
+	}
+	return strings.Join(lines, ",")
+}
+
+func (l *orderLines) Set(value string) error {
+	id, quantity, found := strings.Cut(value, ":")
+	id, variantID, _ := strings.Cut(id, "/")
+	p := order.OrderedProduct{ID: id, VariantID: variantID, Quantity: 1}
+	if found {
+		n, err := strconv.ParseUint(quantity, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid quantity %q", quantity)
+		}
+		p.Quantity = uint32(n)
+	}
+	if p.ID == "" {
+		return fmt.Errorf("product ID is required")
+	}
+	*l = append(*l, p)
+	return nil
+}
+
+func createOrder(ctx context.Context, cfg Config, w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("create order", flag.ExitOnError)
+	var r order.OrderRequest
+	var lines orderLines
+	flags.StringVar(&r.AccountID, "account", "", "ID of the account placing the order")
+	flags.Var(&lines, "product", "product to order as <id>[/<variant id>][:<quantity>]; repeat for more products")
+	flags.StringVar(&r.CouponCode, "coupon", "", "coupon code")
+	flags.StringVar(&r.ShippingAddressID, "address", "", "ID of the address in the account's address book to ship to")
+	flags.StringVar(&r.ShippingMethod, "shipping", "", "shipping method: standard or express")
+	flags.StringVar(&r.TaxLocation.Country, "country", "", "country the order is taxed in, when it is not shipped")
+	flags.StringVar(&r.TaxLocation.Region, "region", "", "region the order is taxed in, when it is not shipped")
+	flags.StringVar(&r.IdempotencyKey, "idempotency-key", "", "key that makes retrying the command safe")
+	flags.Parse(args)
+	r.Products = lines
+
+	client, err := order.NewClientWithOptions(cfg.OrderURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	res, err := client.PostOrder(ctx, r)
+	if err != nil {
+		return fmt.Errorf("failed to create order: %v", err)
+	}
+	if len(res.RejectedLines) > 0 {
+		if err := render(w, cfg.Output, rejectedLinesView(res.RejectedLines), rejectedLinesTable(res.RejectedLines)); err != nil {
+			return err
+		}
+		return fmt.Errorf("order was not placed: %d products were rejected", len(res.RejectedLines))
+	}
+	return render(w, cfg.Output, newOrderView(*res.Order), orderTable(*res.Order), orderLinesTable(*res.Order))
+}
+
+func listOrders(ctx context.Context, cfg Config, w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("list orders", flag.ExitOnError)
+	accountID := flags.String("account", "", "ID of the account whose orders to list")
+	flags.Parse(args)
+	if *accountID == "" {
+		return fmt.Errorf("list orders needs -account")
+	}
+
+	client, err := order.NewClientWithOptions(cfg.OrderURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	orders, err := client.GetOrdersForAccount(ctx, *accountID)
+	if err != nil {
+		return fmt.Errorf("failed to list orders: %v", err)
+	}
+	views := []orderView{}
+	for _, o := range orders {
+		views = append(views, newOrderView(o))
+	}
+	return render(w, cfg.Output, views, orderTable(orders...))
+}
+
+func getOrder(ctx context.Context, cfg Config, w io.Writer, args []string) error {
+	id, err := parseID("get order", args)
+	if err != nil {
+		return err
+	}
+
+	client, err := order.NewClientWithOptions(cfg.OrderURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	o, err := client.GetOrder(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get order: %v", err)
+	}
+	return render(w, cfg.Output, newOrderView(*o), orderTable(*o), orderLinesTable(*o))
+}
+
+// getSalesReport reports on the seller's orders placed from -from until -to,
+// which default to the last 30 days.
+func getSalesReport(ctx context.Context, cfg Config, w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("get report", flag.ExitOnError)
+	sellerID := flags.String("seller", "", "ID of the seller to report on")
+	from := flags.String("from", "", "first day of the report, as YYYY-MM-DD")
+	to := flags.String("to", "", "day after the report, as YYYY-MM-DD")
+	flags.Parse(args)
+	if *sellerID == "" {
+		return fmt.Errorf("get report needs -seller")
+	}
+
+	end := time.Now().UTC()
+	if *to != "" {
+		t, err := time.Parse("2006-01-02", *to)
+		if err != nil {
+			return fmt.Errorf("invalid -to %q: %v", *to, err)
+		}
+		end = t
+	}
+	start := end.AddDate(0, 0, -30)
+	if *from != "" {
+		t, err := time.Parse("2006-01-02", *from)
+		if err != nil {
+			return fmt.Errorf("invalid -from %q: %v", *from, err)
+		}
+		start = t
+	}
+
+	client, err := order.NewClientWithOptions(cfg.OrderURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	r, err := client.GetSalesReport(ctx, *sellerID, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to get sales report: %v", err)
+	}
+	return render(w, cfg.Output, newSalesReportView(*r), salesReportTable(*r))
+}
+
+func salesReportTable(r order.SalesReport) table {
+	return table{
+		columns: []string{"SELLER", "FROM", "TO", "ORDERS", "UNITS", "SUBTOTAL", "DISCOUNT", "COMMISSION", "PAYOUT"},
+		rows: [][]string{{
+			r.SellerID,
+			r.From.Format("2006-01-02 15:04:05"),
+			r.To.Format("2006-01-02 15:04:05"),
+			strconv.Itoa(r.Orders),
+			strconv.Itoa(r.Units),
+			formatPrice(r.Subtotal),
+			formatPrice(r.DiscountTotal),
+			formatPrice(r.Commission),
+			formatPrice(r.Payout),
+		}},
+	}
+}
+
+func orderTable(orders ...order.Order) table {
+	t := table{columns: []string{"ID", "CREATED", "ACCOUNT", "STATUS", "ITEMS", "TOTAL"}}
+	for _, o := range orders {
+		items := uint32(0)
+		for _, p := range o.Products {
+			items += p.Quantity
+		}
+		t.rows = append(t.rows, []string{
+			o.ID,
+			o.CreatedAt.Format("2006-01-02 15:04:05"),
+			o.AccountID,
+			string(o.Status),
+			strconv.FormatUint(uint64(items), 10),
+			formatPrice(o.TotalPrice),
+		})
+	}
+	return t
+}
+
+func orderLinesTable(o order.Order) table {
+	t := table{columns: []string{"PRODUCT", "SKU", "NAME", "QUANTITY", "PRICE", "TAX"}}
+	for _, p := range o.Products {
+		t.rows = append(t.rows, []string{
+			p.ID,
+			p.SKU,
+			p.Name,
+			strconv.FormatUint(uint64(p.Quantity), 10),
+			formatPrice(p.Price),
+			formatPrice(p.Tax),
+		})
+	}
+	return t
+}
+
+func rejectedLinesTable(lines []order.RejectedLine) table {
+	t := table{columns: []string{"LINE", "PRODUCT", "VARIANT", "QUANTITY", "REASON"}}
+	for _, l := range lines {
+		t.rows = append(t.rows, []string{
+			strconv.Itoa(l.Index + 1),
+			l.ProductID,
+			l.VariantID,
+			strconv.FormatUint(uint64(l.Quantity), 10),
+			string(l.Reason),
+		})
+	}
+	return t
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/donaldnash/go-marketplace/account"
+	"github.com/donaldnash/go-marketplace/catalog"
+)
+
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+)
+
+var (
+	productColumns = []string{"id", "name", "description", "price", "tax_category", "category", "weight"}
+	accountColumns = []string{"id", "name"}
+)
+
+// detectFormat returns format, or the format the file name suggests when it
+// is empty.
+func detectFormat(format string, name string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".csv":
+			format = formatCSV
+		case ".jsonl", ".ndjson":
+			format = formatJSONL
+		default:
+			return "", fmt.Errorf("cannot tell the format of %q; pass -format csv or -format jsonl", name)
+		}
+	}
+	if format != formatCSV && format != formatJSONL {
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+	return format, nil
+}
+
+// encoder writes records as CSV rows under a header, or as JSON lines.
+type encoder struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newEncoder(w io.Writer, format string, columns []string) (*encoder, error) {
+	if format == formatJSONL {
+		return &encoder{json: json.NewEncoder(w)}, nil
+	}
+	e := &encoder{csv: csv.NewWriter(w)}
+	if err := e.csv.Write(columns); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// encode writes v as a JSON line, or record as a CSV row.
+func (e *encoder) encode(v interface{}, record []string) error {
+	if e.json != nil {
+		return e.json.Encode(v)
+	}
+	return e.csv.Write(record)
+}
+
+func (e *encoder) flush() error {
+	if e.csv == nil {
+		return nil
+	}
+	e.csv.Flush()
+	return e.csv.Error()
+}
+
+func productRecord(p catalog.Product) []string {
+	return []string{
+		p.ID,
+		p.Name,
+		p.Description,
+		strconv.FormatFloat(p.Price, 'f', -1, 64),
+		p.TaxCategory,
+		p.Category,
+		strconv.FormatFloat(p.Weight, 'f', -1, 64),
+	}
+}
+
+func accountRecord(a account.Account) []string {
+	return []string{a.ID, a.Name}
+}
+
+// rowError is a record of an import file that could not be read. Reading
+// continues with the next record.
+type rowError struct {
+	line int
+	err  error
+}
+
+func (e *rowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+// productDecoder reads products from CSV with a header row, or from JSON
+// lines.
+type productDecoder struct {
+	csv     *csv.Reader
+	columns map[string]int
+	json    *bufio.Reader
+	line    int
+}
+
+func newProductDecoder(r io.Reader, format string) (*productDecoder, error) {
+	if format == formatJSONL {
+		return &productDecoder{json: bufio.NewReader(r)}, nil
+	}
+
+	d := &productDecoder{csv: csv.NewReader(r), columns: map[string]int{}}
+	header, err := d.csv.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+	for i, column := range header {
+		d.columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, required := range []string{"name", "description", "price"} {
+		if _, ok := d.columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header has no %q column", required)
+		}
+	}
+	return d, nil
+}
+
+// next returns the next product and the line it starts on, io.EOF at the
+// end, or a *rowError for a record that cannot be read.
+func (d *productDecoder) next() (catalog.Product, int, error) {
+	if d.json != nil {
+		return d.nextJSON()
+	}
+	return d.nextCSV()
+}
+
+func (d *productDecoder) nextJSON() (catalog.Product, int, error) {
+	for {
+		data, err := d.json.ReadBytes('\n')
+		if len(data) == 0 && err != nil {
+			return catalog.Product{}, d.line, err
+		}
+		d.line++
+		if err != nil && err != io.EOF {
+			return catalog.Product{}, d.line, err
+		}
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		var p catalog.Product
+		if err := json.Unmarshal(data, &p); err != nil {
+			return catalog.Product{}, d.line, &rowError{d.line, err}
+		}
+		return p, d.line, nil
+	}
+}
+
+func (d *productDecoder) nextCSV() (catalog.Product, int, error) {
+	record, err := d.csv.Read()
+	if err == io.EOF {
+		return catalog.Product{}, 0, err
+	}
+	line, _ := d.csv.FieldPos(0)
+	if err != nil {
+		if _, ok := err.(*csv.ParseError); ok {
+			return catalog.Product{}, line, &rowError{line, err}
+		}
+		return catalog.Product{}, line, err
+	}
+
+	field := func(name string) string {
+		if i, ok := d.columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	p := catalog.Product{
+		ID:          field("id"),
+		Name:        field("name"),
+		Description: field("description"),
+		TaxCategory: field("tax_category"),
+		Category:    field("category"),
+	}
+	if p.Price, err = strconv.ParseFloat(field("price"), 64); err != nil {
+		return catalog.Product{}, line, &rowError{line, fmt.Errorf("invalid price %q", field("price"))}
+	}
+	if weight := field("weight"); weight != "" {
+		if p.Weight, err = strconv.ParseFloat(weight, 64); err != nil {
+			return catalog.Product{}, line, &rowError{line, fmt.Errorf("invalid weight %q", weight)}
+		}
+	}
+	return p, line, nil
+}
@@ -0,0 +1,114 @@
+// Command marketctl operates the marketplace through the services' gRPC
+// APIs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/grpcclient"
+	"github.com/kelseyhightower/envconfig"
+)
+
+type Config struct {
+	AccountURL string        `envconfig:"ACCOUNT_SERVICE_URL" default:"localhost:8081"`
+	CatalogURL string        `envconfig:"CATALOG_SERVICE_URL" default:"localhost:8082"`
+	OrderURL   string        `envconfig:"ORDER_SERVICE_URL" default:"localhost:8083"`
+	Output     string        `envconfig:"MARKETCTL_OUTPUT" default:"table"`
+	Timeout    time.Duration `envconfig:"MARKETCTL_TIMEOUT" default:"30s"`
+	grpcclient.Options
+}
+
+const usage = `Usage: marketctl [flags] <command> <resource> [arguments]
+
+Commands:
+  create account -name <name> [-idempotency-key <key>]
+  create seller -account <id> -name <name>
+  create product -name <name> -description <text> -price <price> [-tax-category <c>] [-category <c>] [-weight <kg>] [-seller <id>]
+  create order -account <id> -product <id>[/<variant id>][:<quantity>]... [-coupon <code>] [-address <id> [-shipping standard|express]] [-country <cc> [-region <r>]]
+  list accounts|sellers [-skip <n>] [-take <n>]
+  list products [-skip <n>] [-take <n>] [-min-rating <stars>] [-sort relevance|rating]
+  list orders -account <id>
+  get account|product|order <id>
+  get report -seller <id> [-from <YYYY-MM-DD>] [-to <YYYY-MM-DD>]
+  search products [-skip <n>] [-take <n>] [-min-rating <stars>] [-sort relevance|rating] <query>
+  export products|accounts [-format csv|jsonl] [-o file]
+  import products [-format csv|jsonl] <file>
+
+Flags:
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("marketctl: ")
+
+	var cfg Config
+	if err := envconfig.Process("", &cfg); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, cfg, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run runs the command in args with the flags before it overriding cfg. It
+// returns the exit code: 1 when the command fails and 2 when it is misused.
+func run(ctx context.Context, cfg Config, args []string, stdout io.Writer, stderr io.Writer) int {
+	logger := log.New(stderr, "marketctl: ", 0)
+
+	flags := flag.NewFlagSet("marketctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&cfg.AccountURL, "account-url", cfg.AccountURL, "account service address (ACCOUNT_SERVICE_URL)")
+	flags.StringVar(&cfg.CatalogURL, "catalog-url", cfg.CatalogURL, "catalog service address (CATALOG_SERVICE_URL)")
+	flags.StringVar(&cfg.OrderURL, "order-url", cfg.OrderURL, "order service address (ORDER_SERVICE_URL)")
+	flags.StringVar(&cfg.Output, "output", cfg.Output, "output of create, list, get and search: table, json or yaml (MARKETCTL_OUTPUT)")
+	flags.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "timeout of create, list, get and search (MARKETCTL_TIMEOUT)")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return 2
+	}
+	if err := checkOutput(cfg.Output); err != nil {
+		logger.Print(err)
+		return 1
+	}
+
+	var err error
+	switch command, resource, args := flags.Arg(0), flags.Arg(1), flags.Args()[2:]; command {
+	case "create", "list", "get", "search":
+		ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+		err = runCommand(ctx, cfg, stdout, command, resource, args)
+		cancel()
+	case "export":
+		err = runExport(ctx, cfg, stdout, resource, args)
+	case "import":
+		err = runImport(ctx, cfg, resource, args)
+	default:
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		logger.Print(err)
+		return 1
+	}
+	return 0
+}
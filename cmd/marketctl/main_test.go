@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	accountpb "github.com/donaldnash/go-marketplace/account/pb"
+	catalogpb "github.com/donaldnash/go-marketplace/catalog/pb"
+	"github.com/donaldnash/go-marketplace/grpcclient"
+	orderpb "github.com/donaldnash/go-marketplace/order/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type accountServer struct {
+	accountpb.UnimplementedAccountServiceServer
+}
+
+func (accountServer) GetAccount(ctx context.Context, r *accountpb.GetAccountRequest) (*accountpb.GetAccountResponse, error) {
+	if r.Id != "alice" {
+		return nil, status.Error(codes.NotFound, "account not found")
+	}
+	return &accountpb.GetAccountResponse{Account: &accountpb.Account{Id: "alice", Name: "Alice: the first"}}, nil
+}
+
+type catalogServer struct {
+	catalogpb.UnimplementedCatalogServiceServer
+}
+
+func (catalogServer) GetProducts(ctx context.Context, r *catalogpb.GetProductsRequest) (*catalogpb.GetProductsResponse, error) {
+	products := []*catalogpb.Product{
+		{Id: "p1", Name: "Lamp", Price: 20, Category: "home", TaxCategory: "standard", Weight: 1.5},
+		{Id: "p2", Name: "Book", Price: 7.5, Category: "books", TaxCategory: "books"},
+	}
+	return &catalogpb.GetProductsResponse{Products: products[r.Skip:]}, nil
+}
+
+type orderServer struct {
+	orderpb.UnimplementedOrderServiceServer
+}
+
+func (orderServer) GetOrder(ctx context.Context, r *orderpb.GetOrderRequest) (*orderpb.GetOrderResponse, error) {
+	return nil, status.Error(codes.NotFound, "order not found")
+}
+
+// testConfig serves the account, catalog and order services in process and
+// returns the configuration of marketctl that calls them.
+func testConfig(t *testing.T) Config {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	accountpb.RegisterAccountServiceServer(s, accountServer{})
+	catalogpb.RegisterCatalogServiceServer(s, catalogServer{})
+	orderpb.RegisterOrderServiceServer(s, orderServer{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	options := grpcclient.DefaultOptions()
+	options.Dialer = func(ctx context.Context, addr string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	return Config{
+		AccountURL: "passthrough:///account",
+		CatalogURL: "passthrough:///catalog",
+		OrderURL:   "passthrough:///order",
+		Output:     outputTable,
+		Timeout:    5 * time.Second,
+		Options:    options,
+	}
+}
+
+func runTest(t *testing.T, cfg Config, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), cfg, args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunOutput(t *testing.T) {
+	cfg := testConfig(t)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "table",
+			args: []string{"get", "account", "alice"},
+			want: "ID     NAME\n" +
+				"alice  Alice: the first\n",
+		},
+		{
+			name: "json",
+			args: []string{"-output", "json", "get", "account", "alice"},
+			want: "{\n" +
+				"  \"id\": \"alice\",\n" +
+				"  \"name\": \"Alice: the first\"\n" +
+				"}\n",
+		},
+		{
+			name: "yaml",
+			args: []string{"-output", "yaml", "get", "account", "alice"},
+			want: "id: alice\n" +
+				"name: \"Alice: the first\"\n",
+		},
+		{
+			name: "table of products",
+			args: []string{"list", "products"},
+			want: "ID  NAME  PRICE  CATEGORY  TAX CATEGORY  WEIGHT  RATING\n" +
+				"p1  Lamp  20.00  home      standard      1.5     \n" +
+				"p2  Book  7.50   books     books         0       \n",
+		},
+		{
+			name: "yaml of products",
+			args: []string{"-output", "yaml", "list", "products", "-skip", "1"},
+			want: "- id: p2\n" +
+				"  name: Book\n" +
+				"  description: \"\"\n" +
+				"  price: 7.5\n" +
+				"  tax_category: books\n" +
+				"  category: books\n" +
+				"  weight: 0\n" +
+				"  rating:\n" +
+				"    average: 0\n" +
+				"    count: 0\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runTest(t, cfg, tt.args...)
+			if code != 0 {
+				t.Fatalf("exit code = %d, want 0; stderr: %s", code, stderr)
+			}
+			if stdout != tt.want {
+				t.Errorf("output =\n%s\nwant\n%s", stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunExitCode(t *testing.T) {
+	cfg := testConfig(t)
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{"not found", []string{"get", "order", "o1"}, 1, "failed to get order: rpc error: code = NotFound desc = order not found"},
+		{"unknown account", []string{"get", "account", "bob"}, 1, "failed to get account"},
+		{"unknown output", []string{"-output", "xml", "get", "account", "alice"}, 1, `unknown output "xml"`},
+		{"unknown command", []string{"get", "sellers"}, 1, `unknown command "get sellers"`},
+		{"missing resource", []string{"get"}, 2, "Usage: marketctl"},
+		{"unknown verb", []string{"delete", "account", "alice"}, 2, "Usage: marketctl"},
+		{"unknown flag", []string{"-verbose", "get", "account", "alice"}, 2, "flag provided but not defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runTest(t, cfg, tt.args...)
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+			if stdout != "" {
+				t.Errorf("output = %q, want none", stdout)
+			}
+			if !strings.Contains(stderr, tt.stderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr, tt.stderr)
+			}
+		})
+	}
+}
+
+func TestRunUnavailable(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Timeout = 200 * time.Millisecond
+	cfg.Options.Dialer = func(ctx context.Context, addr string) (net.Conn, error) {
+		return nil, &net.OpError{Op: "dial", Net: "bufconn", Err: net.ErrClosed}
+	}
+
+	code, _, stderr := runTest(t, cfg, "get", "account", "alice")
+	if code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if !strings.Contains(stderr, "failed to get account") {
+		t.Errorf("stderr = %q, want the failure", stderr)
+	}
+}
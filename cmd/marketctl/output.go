@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+func checkOutput(output string) error {
+	switch output {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	}
+	return fmt.Errorf("unknown output %q; choose table, json or yaml", output)
+}
+
+// table is a result as it is shown in table output.
+type table struct {
+	columns []string
+	rows    [][]string
+}
+
+// render writes v to w as JSON or YAML, or writes tables to w one after the
+// other.
+func render(w io.Writer, output string, v interface{}, tables ...table) error {
+	switch output {
+	case outputJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(v)
+	case outputYAML:
+		return writeYAML(w, v)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, t := range tables {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintln(tw, strings.Join(t.columns, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+	}
+	return tw.Flush()
+}
+
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', 2, 64)
+}
+
+// yamlObject is a JSON object that keeps the order of its fields, so YAML
+// output lists them in the order the JSON tags declare.
+type yamlObject []yamlField
+
+type yamlField struct {
+	key   string
+	value interface{}
+}
+
+// writeYAML writes v as a YAML block document. v goes through
+// encoding/json first, so its JSON tags decide the keys.
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	value, err := decodeOrdered(d)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	switch value.(type) {
+	case yamlObject, []interface{}:
+		writeYAMLBlock(&b, value, 0)
+	default:
+		b.WriteString(yamlScalar(value) + "\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func decodeOrdered(d *json.Decoder) (interface{}, error) {
+	token, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		object := yamlObject{}
+		for d.More() {
+			key, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(d)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, yamlField{key.(string), value})
+		}
+		_, err := d.Token()
+		return object, err
+	case json.Delim('['):
+		array := []interface{}{}
+		for d.More() {
+			value, err := decodeOrdered(d)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err := d.Token()
+		return array, err
+	}
+	return token, nil
+}
+
+// writeYAMLBlock writes a non-empty object or array, each line indented by
+// indent spaces.
+func writeYAMLBlock(b *strings.Builder, value interface{}, indent int) {
+	prefix := strings.Repeat(" ", indent)
+	switch value := value.(type) {
+	case yamlObject:
+		for _, f := range value {
+			b.WriteString(prefix + yamlScalar(f.key) + ":")
+			writeYAMLValue(b, f.value, indent+2)
+		}
+	case []interface{}:
+		for _, item := range value {
+			if !isYAMLBlock(item) {
+				b.WriteString(prefix + "- " + yamlInline(item) + "\n")
+				continue
+			}
+			// The item is written as if it were nested one level deeper,
+			// then its first line is moved up next to the dash.
+			var nested strings.Builder
+			writeYAMLBlock(&nested, item, indent+2)
+			b.WriteString(prefix + "- " + strings.TrimPrefix(nested.String(), prefix+"  "))
+		}
+	}
+}
+
+func writeYAMLValue(b *strings.Builder, value interface{}, indent int) {
+	if !isYAMLBlock(value) {
+		b.WriteString(" " + yamlInline(value) + "\n")
+		return
+	}
+	b.WriteString("\n")
+	writeYAMLBlock(b, value, indent)
+}
+
+// isYAMLBlock reports whether value is written on lines of its own.
+func isYAMLBlock(value interface{}) bool {
+	switch value := value.(type) {
+	case yamlObject:
+		return len(value) > 0
+	case []interface{}:
+		return len(value) > 0
+	}
+	return false
+}
+
+// yamlInline writes a scalar or an empty collection.
+func yamlInline(value interface{}) string {
+	switch value.(type) {
+	case yamlObject:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	}
+	return yamlScalar(value)
+}
+
+func yamlScalar(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(value)
+	case json.Number:
+		return value.String()
+	case string:
+		if yamlNeedsQuotes(value) {
+			return strconv.Quote(value)
+		}
+		return value
+	}
+	return fmt.Sprint(value)
+}
+
+// yamlNeedsQuotes reports whether s would not read back as the same string
+// if it were written plain.
+func yamlNeedsQuotes(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return true
+	}
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			return true
+		}
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null", "~":
+		return true
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
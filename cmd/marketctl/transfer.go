@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/donaldnash/go-marketplace/account"
+	"github.com/donaldnash/go-marketplace/catalog"
+)
+
+func runExport(ctx context.Context, cfg Config, stdout io.Writer, resource string, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "", "output format: csv or jsonl (default: from -o, else jsonl)")
+	output := flags.String("o", "-", "output file, - for standard output")
+	flags.Parse(args)
+
+	if *output == "-" && *format == "" {
+		*format = formatJSONL
+	}
+	f, err := detectFormat(*format, *output)
+	if err != nil {
+		return err
+	}
+
+	out := stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	buffered := bufio.NewWriter(out)
+
+	var count int
+	switch resource {
+	case "products":
+		count, err = exportProducts(ctx, cfg, buffered, f)
+	case "accounts":
+		count, err = exportAccounts(ctx, cfg, buffered, f)
+	default:
+		return fmt.Errorf("cannot export %q; choose products or accounts", resource)
+	}
+	if err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d %s\n", count, resource)
+	return nil
+}
+
+func exportProducts(ctx context.Context, cfg Config, w io.Writer, format string) (int, error) {
+	client, err := catalog.NewClientWithOptions(cfg.CatalogURL, cfg.Options)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	e, err := newEncoder(w, format, productColumns)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = client.StreamProducts(ctx, func(p catalog.Product) error {
+		count++
+		return e.encode(p, productRecord(p))
+	})
+	if err != nil {
+		return count, fmt.Errorf("failed to export products: %v", err)
+	}
+	return count, e.flush()
+}
+
+func exportAccounts(ctx context.Context, cfg Config, w io.Writer, format string) (int, error) {
+	client, err := account.NewClientWithOptions(cfg.AccountURL, cfg.Options)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	e, err := newEncoder(w, format, accountColumns)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = client.StreamAccounts(ctx, func(a account.Account) error {
+		count++
+		return e.encode(a, accountRecord(a))
+	})
+	if err != nil {
+		return count, fmt.Errorf("failed to export accounts: %v", err)
+	}
+	return count, e.flush()
+}
+
+// importFailure is a record that was not imported.
+type importFailure struct {
+	line   int
+	reason string
+}
+
+func runImport(ctx context.Context, cfg Config, resource string, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "input format: csv or jsonl (default: from the file name)")
+	flags.Parse(args)
+
+	if resource != "products" {
+		return fmt.Errorf("cannot import %q; only products can be imported", resource)
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("import products needs exactly one file, - for standard input")
+	}
+	name := flags.Arg(0)
+
+	f, err := detectFormat(*format, name)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	decoder, err := newProductDecoder(bufio.NewReader(in), f)
+	if err != nil {
+		return err
+	}
+
+	client, err := catalog.NewClientWithOptions(cfg.CatalogURL, cfg.Options)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// lines maps the position of each product sent to the line it came from.
+	lines := []int{}
+	failures := []importFailure{}
+	next := func() (catalog.Product, error) {
+		for {
+			p, line, err := decoder.next()
+			var re *rowError
+			if errors.As(err, &re) {
+				failures = append(failures, importFailure{re.line, re.err.Error()})
+				continue
+			}
+			if err != nil {
+				return p, err
+			}
+			lines = append(lines, line)
+			return p, nil
+		}
+	}
+
+	created, errs, err := client.BulkPostProducts(ctx, next)
+	if err != nil {
+		return fmt.Errorf("failed to import products: %v", err)
+	}
+	for _, e := range errs {
+		line := 0
+		if e.Index < uint64(len(lines)) {
+			line = lines[e.Index]
+		}
+		failures = append(failures, importFailure{line, e.Error})
+	}
+
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].line < failures[j].line
+	})
+	for _, f := range failures {
+		fmt.Fprintf(os.Stderr, "line %d: %s\n", f.line, f.reason)
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d products, %d failed\n", created, len(failures))
+	if len(failures) > 0 {
+		return fmt.Errorf("%d products were not imported", len(failures))
+	}
+	return nil
+}
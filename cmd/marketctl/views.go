@@ -0,0 +1,176 @@
+package main
+
+import (
+	"time"
+
+	"github.com/donaldnash/go-marketplace/order"
+)
+
+// orderView is an order as it is shown in JSON and YAML output. Accounts and
+// products are shown as they are, because they already have JSON tags.
+type orderView struct {
+	ID              string               `json:"id"`
+	CreatedAt       time.Time            `json:"created_at"`
+	AccountID       string               `json:"account_id"`
+	Status          string               `json:"status"`
+	Subtotal        float64              `json:"subtotal"`
+	DiscountTotal   float64              `json:"discount_total"`
+	TaxTotal        float64              `json:"tax_total"`
+	ShippingTotal   float64              `json:"shipping_total"`
+	TotalPrice      float64              `json:"total_price"`
+	TaxCountry      string               `json:"tax_country,omitempty"`
+	TaxRegion       string               `json:"tax_region,omitempty"`
+	ShippingMethod  string               `json:"shipping_method,omitempty"`
+	ShippingAddress *shippingAddressView `json:"shipping_address,omitempty"`
+	Products        []orderedProductView `json:"products"`
+	Discounts       []discountView       `json:"discounts,omitempty"`
+}
+
+type shippingAddressView struct {
+	AddressID  string `json:"address_id"`
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country"`
+}
+
+type orderedProductView struct {
+	ID          string          `json:"id"`
+	VariantID   string          `json:"variant_id,omitempty"`
+	SKU         string          `json:"sku,omitempty"`
+	Attributes  []attributeView `json:"attributes,omitempty"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Price       float64         `json:"price"`
+	Quantity    uint32          `json:"quantity"`
+	TaxCategory string          `json:"tax_category,omitempty"`
+	Tax         float64         `json:"tax"`
+	Weight      float64         `json:"weight,omitempty"`
+	SellerID    string          `json:"seller_id,omitempty"`
+}
+
+type attributeView struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type discountView struct {
+	PromotionID string  `json:"promotion_id"`
+	Code        string  `json:"code,omitempty"`
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+}
+
+type rejectedLineView struct {
+	Line      int    `json:"line"`
+	ProductID string `json:"product_id"`
+	VariantID string `json:"variant_id,omitempty"`
+	Quantity  uint32 `json:"quantity"`
+	Reason    string `json:"reason"`
+}
+
+type salesReportView struct {
+	SellerID      string    `json:"seller_id"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	Orders        int       `json:"orders"`
+	Units         int       `json:"units"`
+	Subtotal      float64   `json:"subtotal"`
+	DiscountTotal float64   `json:"discount_total"`
+	TaxTotal      float64   `json:"tax_total"`
+	Commission    float64   `json:"commission"`
+	Payout        float64   `json:"payout"`
+}
+
+func newOrderView(o order.Order) orderView {
+	v := orderView{
+		ID:             o.ID,
+		CreatedAt:      o.CreatedAt,
+		AccountID:      o.AccountID,
+		Status:         string(o.Status),
+		Subtotal:       o.Subtotal,
+		DiscountTotal:  o.DiscountTotal,
+		TaxTotal:       o.TaxTotal,
+		ShippingTotal:  o.ShippingTotal,
+		TotalPrice:     o.TotalPrice,
+		TaxCountry:     o.TaxLocation.Country,
+		TaxRegion:      o.TaxLocation.Region,
+		ShippingMethod: o.ShippingMethod,
+		Products:       []orderedProductView{},
+	}
+	if a := o.ShippingAddress; a != nil {
+		v.ShippingAddress = &shippingAddressView{
+			AddressID:  a.AddressID,
+			Name:       a.Name,
+			Line1:      a.Line1,
+			Line2:      a.Line2,
+			City:       a.City,
+			Region:     a.Region,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		}
+	}
+	for _, p := range o.Products {
+		var attributes []attributeView
+		for _, a := range p.Attributes {
+			attributes = append(attributes, attributeView{Name: a.Name, Value: a.Value})
+		}
+		v.Products = append(v.Products, orderedProductView{
+			ID:          p.ID,
+			VariantID:   p.VariantID,
+			SKU:         p.SKU,
+			Attributes:  attributes,
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Quantity:    p.Quantity,
+			TaxCategory: p.TaxCategory,
+			Tax:         p.Tax,
+			Weight:      p.Weight,
+			SellerID:    p.SellerID,
+		})
+	}
+	for _, d := range o.Discounts {
+		v.Discounts = append(v.Discounts, discountView{
+			PromotionID: d.PromotionID,
+			Code:        d.Code,
+			Description: d.Description,
+			Amount:      d.Amount,
+		})
+	}
+	return v
+}
+
+// rejectedLinesView numbers lines from 1, like the -product flags they came
+// from.
+func rejectedLinesView(lines []order.RejectedLine) map[string][]rejectedLineView {
+	views := []rejectedLineView{}
+	for _, l := range lines {
+		views = append(views, rejectedLineView{
+			Line:      l.Index + 1,
+			ProductID: l.ProductID,
+			VariantID: l.VariantID,
+			Quantity:  l.Quantity,
+			Reason:    string(l.Reason),
+		})
+	}
+	return map[string][]rejectedLineView{"rejected_lines": views}
+}
+
+func newSalesReportView(r order.SalesReport) salesReportView {
+	return salesReportView{
+		SellerID:      r.SellerID,
+		From:          r.From,
+		To:            r.To,
+		Orders:        r.Orders,
+		Units:         r.Units,
+		Subtotal:      r.Subtotal,
+		DiscountTotal: r.DiscountTotal,
+		TaxTotal:      r.TaxTotal,
+		Commission:    r.Commission,
+		Payout:        r.Payout,
+	}
+}
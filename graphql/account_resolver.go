@@ -22,6 +22,9 @@ func (r *accountResolver) Orders(ctx context.Context, obj *Account) ([]*Order, e
 	if obj.ID == "" {
 		return nil, fmt.Errorf("account ID is required")
 	}
+	if err := r.server.authorizeAccount(ctx, obj.ID); err != nil {
+		return nil, err
+	}
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
@@ -41,24 +44,63 @@ func (r *accountResolver) Orders(ctx context.Context, obj *Account) ([]*Order, e
 
 	orders := make([]*Order, len(orderList))
 	for i, o := range orderList {
-		products := make([]*OrderedProduct, len(o.Products))
-		for j, p := range o.Products {
-			products[j] = &OrderedProduct{
-				ID:          p.ID,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-				Quantity:    int(p.Quantity),
-			}
-		}
-
-		orders[i] = &Order{
-			ID:         o.ID,
-			CreatedAt:  o.CreatedAt,
-			TotalPrice: o.TotalPrice,
-			Products:   products,
-		}
+		orders[i] = newOrder(o)
 	}
 
 	return orders, nil
 }
+
+func (r *accountResolver) Addresses(ctx context.Context, obj *Account) ([]*Address, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("account object is required")
+	}
+	if err := r.server.authorizeAccount(ctx, obj.ID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	addressList, err := r.server.accountClient.GetAddresses(ctx, obj.ID)
+	if err != nil {
+		log.Printf("Error fetching addresses for account %s: %v", obj.ID, err)
+		return nil, fmt.Errorf("failed to fetch addresses for account: %v", err)
+	}
+
+	addresses := make([]*Address, len(addressList))
+	for i, a := range addressList {
+		addresses[i] = newAddress(a)
+	}
+	return addresses, nil
+}
+
+func (r *accountResolver) Wishlists(ctx context.Context, obj *Account) ([]*Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("account object is required")
+	}
+	if err := r.server.authorizeAccount(ctx, obj.ID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	wishlistList, err := r.server.accountClient.GetWishlists(ctx, obj.ID)
+	if err != nil {
+		log.Printf("Error fetching wishlists for account %s: %v", obj.ID, err)
+		return nil, fmt.Errorf("failed to fetch wishlists for account: %v", err)
+	}
+
+	wishlists, err := r.server.newWishlists(ctx, wishlistList)
+	if err != nil {
+		log.Printf("Error pricing wishlists for account %s: %v", obj.ID, err)
+		return nil, err
+	}
+	return wishlists, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+)
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+	ErrInvalidToken    = errors.New("invalid authorization token")
+)
+
+// Roles a token may grant on top of acting for its own account. Admins may
+// do everything, moderators may moderate reviews.
+const (
+	roleAdmin     = "admin"
+	roleModerator = "moderator"
+)
+
+type principalKey struct{}
+
+// principal is who an authenticated request acts as.
+type principal struct {
+	AccountID string
+	Role      string
+}
+
+func principalFromContext(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(principal)
+	return p, ok
+}
+
+// authenticator verifies bearer tokens: JSON Web Tokens signed with HS256
+// whose subject is the ID of the account they act for, and whose optional
+// role claim grants staff access.
+type authenticator struct {
+	secret []byte
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+}
+
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+	Role      string `json:"role"`
+}
+
+func newAuthenticator(secret string) *authenticator {
+	if secret == "" {
+		panic("auth secret cannot be empty")
+	}
+	return &authenticator{[]byte(secret)}
+}
+
+// verify returns the principal the token in an Authorization header value
+// was issued to.
+func (a *authenticator) verify(authorization string, now time.Time) (principal, error) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return principal{}, ErrInvalidToken
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return principal{}, ErrInvalidToken
+	}
+
+	var header tokenHeader
+	if err := decodeTokenPart(parts[0], &header); err != nil || header.Algorithm != "HS256" {
+		return principal{}, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return principal{}, ErrInvalidToken
+	}
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return principal{}, ErrInvalidToken
+	}
+
+	var claims tokenClaims
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return principal{}, ErrInvalidToken
+	}
+	if claims.Subject == "" || claims.ExpiresAt == 0 {
+		return principal{}, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return principal{}, fmt.Errorf("%w: token has expired", ErrInvalidToken)
+	}
+	if claims.NotBefore != 0 && now.Unix() < claims.NotBefore {
+		return principal{}, fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	}
+	switch claims.Role {
+	case "", roleAdmin, roleModerator:
+	default:
+		return principal{}, fmt.Errorf("%w: unknown role %q", ErrInvalidToken, claims.Role)
+	}
+	return principal{AccountID: claims.Subject, Role: claims.Role}, nil
+}
+
+func decodeTokenPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// middleware authenticates requests that carry an Authorization header and
+// turns away those whose token is invalid. Requests without one go through
+// anonymously.
+func (a *authenticator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p, err := a.verify(authorization, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+// websocketInit authenticates subscriptions. Browsers cannot set headers on
+// websocket requests, so the token is sent as "Authorization" in the
+// connection_init payload instead.
+func (a *authenticator) websocketInit(ctx context.Context, payload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+	authorization := payload.Authorization()
+	if authorization == "" {
+		return ctx, nil, nil
+	}
+
+	p, err := a.verify(authorization, time.Now())
+	if err != nil {
+		return ctx, nil, err
+	}
+	return context.WithValue(ctx, principalKey{}, p), nil, nil
+}
+
+// authorizeAccount checks that the request may act for accountID: it must
+// come from that account or from an admin. Without AUTH_SECRET, every
+// request may.
+func (s *Server) authorizeAccount(ctx context.Context, accountID string) error {
+	if s.auth == nil {
+		return nil
+	}
+
+	p, ok := principalFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("%w: a bearer token is required", ErrUnauthenticated)
+	}
+	if p.AccountID != accountID && p.Role != roleAdmin {
+		return fmt.Errorf("%w: the token does not grant access to account %s", ErrForbidden, accountID)
+	}
+	return nil
+}
+
+// authorizeRole checks that the request comes from a token with one of roles.
+// Admins hold every role. Without AUTH_SECRET, every request does.
+func (s *Server) authorizeRole(ctx context.Context, roles ...string) error {
+	if s.auth == nil {
+		return nil
+	}
+
+	p, ok := principalFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("%w: a bearer token is required", ErrUnauthenticated)
+	}
+	if p.Role == roleAdmin {
+		return nil
+	}
+	for _, role := range roles {
+		if p.Role == role {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: the token does not grant the %s role", ErrForbidden, strings.Join(roles, " or "))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func signToken(t *testing.T, secret string, claims tokenClaims) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := encode(tokenHeader{Algorithm: "HS256"}) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return "Bearer " + unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyRole(t *testing.T) {
+	a := newAuthenticator("secret")
+	now := time.Now()
+	exp := now.Add(time.Hour).Unix()
+
+	tests := []struct {
+		role    string
+		wantErr bool
+	}{
+		{"", false},
+		{roleAdmin, false},
+		{roleModerator, false},
+		{"root", true},
+	}
+	for _, tt := range tests {
+		p, err := a.verify(signToken(t, "secret", tokenClaims{Subject: "alice", ExpiresAt: exp, Role: tt.role}), now)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("role %q: verify = %v, want %v", tt.role, err, ErrInvalidToken)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("role %q: verify: %v", tt.role, err)
+			continue
+		}
+		if want := (principal{AccountID: "alice", Role: tt.role}); p != want {
+			t.Errorf("role %q: verify = %+v, want %+v", tt.role, p, want)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	s := &Server{auth: newAuthenticator("secret")}
+	as := func(accountID string, role string) context.Context {
+		return context.WithValue(context.Background(), principalKey{}, principal{accountID, role})
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		account error
+		admin   error
+		review  error
+	}{
+		{"anonymous", context.Background(), ErrUnauthenticated, ErrUnauthenticated, ErrUnauthenticated},
+		{"owner", as("alice", ""), nil, ErrForbidden, ErrForbidden},
+		{"other account", as("bob", ""), ErrForbidden, ErrForbidden, ErrForbidden},
+		{"moderator", as("bob", roleModerator), ErrForbidden, ErrForbidden, nil},
+		{"admin", as("bob", roleAdmin), nil, nil, nil},
+	}
+	for _, tt := range tests {
+		if err := s.authorizeAccount(tt.ctx, "alice"); !errors.Is(err, tt.account) {
+			t.Errorf("%s: authorizeAccount = %v, want %v", tt.name, err, tt.account)
+		}
+		if err := s.authorizeRole(tt.ctx, roleAdmin); !errors.Is(err, tt.admin) {
+			t.Errorf("%s: authorizeRole(admin) = %v, want %v", tt.name, err, tt.admin)
+		}
+		if err := s.authorizeRole(tt.ctx, roleModerator); !errors.Is(err, tt.review) {
+			t.Errorf("%s: authorizeRole(moderator) = %v, want %v", tt.name, err, tt.review)
+		}
+	}
+
+	open := &Server{}
+	if err := open.authorizeRole(context.Background(), roleAdmin); err != nil {
+		t.Errorf("authorizeRole without AUTH_SECRET = %v, want nil", err)
+	}
+}
+
+func TestAccountFieldsNeedOwner(t *testing.T) {
+	s := &Server{auth: newAuthenticator("secret")}
+	r := s.Account()
+	ctx := context.WithValue(context.Background(), principalKey{}, principal{"bob", ""})
+	a := &Account{ID: "alice"}
+
+	// The services are never called: the server has no clients.
+	if _, err := r.Orders(ctx, a); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Orders = %v, want %v", err, ErrForbidden)
+	}
+	if _, err := r.Addresses(ctx, a); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Addresses = %v, want %v", err, ErrForbidden)
+	}
+	if _, err := r.Wishlists(ctx, a); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Wishlists = %v, want %v", err, ErrForbidden)
+	}
+}
+
+func TestReviewsNeedModeratorUnlessApproved(t *testing.T) {
+	s := &Server{auth: newAuthenticator("secret")}
+	r := s.Query()
+	ctx := context.WithValue(context.Background(), principalKey{}, principal{"bob", ""})
+
+	// The review service is never called: the server has no clients.
+	if _, err := r.Reviews(ctx, nil, nil, nil); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Reviews of the default status = %v, want %v", err, ErrForbidden)
+	}
+	for _, status := range []ReviewStatus{ReviewStatusPending, ReviewStatusRejected} {
+		if _, err := r.Reviews(ctx, nil, nil, &status); !errors.Is(err, ErrForbidden) {
+			t.Errorf("Reviews of status %s = %v, want %v", status, err, ErrForbidden)
+		}
+	}
+}
+
+func TestPromotionAccess(t *testing.T) {
+	s := &Server{auth: newAuthenticator("secret")}
+	ctx := context.WithValue(context.Background(), principalKey{}, principal{"bob", roleModerator})
+
+	// The order service is never called: the server has no clients.
+	if _, err := s.Query().Promotions(ctx, nil, nil); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Promotions = %v, want %v", err, ErrForbidden)
+	}
+	if _, err := s.Mutation().ApplyCoupon(ctx, OrderInput{AccountID: "alice"}, "SAVE10"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("ApplyCoupon for another account = %v, want %v", err, ErrForbidden)
+	}
+}
@@ -7,16 +7,21 @@ import (
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/donaldnash/go-marketplace/account"
 	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/grpcclient"
 	"github.com/donaldnash/go-marketplace/order"
+	"github.com/donaldnash/go-marketplace/review"
 )
 
 type Server struct {
 	accountClient *account.Client
 	catalogClient *catalog.Client
 	orderClient   *order.Client
+	reviewClient  *review.Client
+	// auth is nil when requests are not authenticated.
+	auth *authenticator
 }
 
-func NewGraphQLServer(accountUrl, catalogUrl, orderUrl string) (*Server, error) {
+func NewGraphQLServer(accountUrl, catalogUrl, orderUrl, reviewUrl string, rpc grpcclient.Options, catalogCache catalog.Cache, auth *authenticator) (*Server, error) {
 	if accountUrl == "" {
 		return nil, fmt.Errorf("%w: account service URL is required", ErrInvalidParameter)
 	}
@@ -26,35 +31,45 @@ func NewGraphQLServer(accountUrl, catalogUrl, orderUrl string) (*Server, error)
 	if orderUrl == "" {
 		return nil, fmt.Errorf("%w: order service URL is required", ErrInvalidParameter)
 	}
+	if reviewUrl == "" {
+		return nil, fmt.Errorf("%w: review service URL is required", ErrInvalidParameter)
+	}
+
+	// The clients connect on first use, so the gateway can start before the
+	// services.
+	accountClient, err := account.NewClientWithOptions(accountUrl, rpc)
+	if err != nil {
+		return nil, err
+	}
 
-	log.Printf("Connecting to account service at %s...", accountUrl)
-	accountClient, err := account.NewClient(accountUrl)
+	catalogClient, err := catalog.NewClientWithCache(catalogUrl, rpc, catalogCache)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to account service: %v", err)
+		accountClient.Close()
+		return nil, err
 	}
-	log.Println("Successfully connected to account service")
 
-	log.Printf("Connecting to catalog service at %s...", catalogUrl)
-	catalogClient, err := catalog.NewClient(catalogUrl)
+	orderClient, err := order.NewClientWithOptions(orderUrl, rpc)
 	if err != nil {
 		accountClient.Close()
-		return nil, fmt.Errorf("failed to connect to catalog service: %v", err)
+		catalogClient.Close()
+		return nil, err
 	}
-	log.Println("Successfully connected to catalog service")
 
-	log.Printf("Connecting to order service at %s...", orderUrl)
-	orderClient, err := order.NewClient(orderUrl)
+	reviewClient, err := review.NewClientWithOptions(reviewUrl, rpc)
 	if err != nil {
 		accountClient.Close()
 		catalogClient.Close()
-		return nil, fmt.Errorf("failed to connect to order service: %v", err)
+		orderClient.Close()
+		return nil, err
 	}
-	log.Println("Successfully connected to order service")
+	log.Printf("Created clients of the account service at %s, the catalog service at %s, the order service at %s and the review service at %s", accountUrl, catalogUrl, orderUrl, reviewUrl)
 
 	return &Server{
 		accountClient: accountClient,
 		catalogClient: catalogClient,
 		orderClient:   orderClient,
+		reviewClient:  reviewClient,
+		auth:          auth,
 	}, nil
 }
 
@@ -68,6 +83,9 @@ func (s *Server) Close() {
 	if s.orderClient != nil {
 		s.orderClient.Close()
 	}
+	if s.reviewClient != nil {
+		s.reviewClient.Close()
+	}
 }
 
 func (s *Server) Mutation() MutationResolver {
@@ -88,6 +106,15 @@ func (s *Server) Query() QueryResolver {
 	}
 }
 
+func (s *Server) Subscription() SubscriptionResolver {
+	if s == nil {
+		panic("server cannot be nil")
+	}
+	return &subscriptionResolver{
+		server: s,
+	}
+}
+
 func (s *Server) Account() AccountResolver {
 	if s == nil {
 		panic("server cannot be nil")
@@ -97,11 +124,48 @@ func (s *Server) Account() AccountResolver {
 	}
 }
 
-func (s *Server) ToExecutableSchema() graphql.ExecutableSchema {
+func (s *Server) Order() OrderResolver {
+	if s == nil {
+		panic("server cannot be nil")
+	}
+	return &orderResolver{
+		server: s,
+	}
+}
+
+func (s *Server) OrderedProduct() OrderedProductResolver {
+	if s == nil {
+		panic("server cannot be nil")
+	}
+	return &orderedProductResolver{
+		server: s,
+	}
+}
+
+func (s *Server) Product() ProductResolver {
+	if s == nil {
+		panic("server cannot be nil")
+	}
+	return &productResolver{
+		server: s,
+	}
+}
+
+func (s *Server) Seller() SellerResolver {
+	if s == nil {
+		panic("server cannot be nil")
+	}
+	return &sellerResolver{
+		server: s,
+	}
+}
+
+func (s *Server) ToExecutableSchema(complexity ComplexityRoot) graphql.ExecutableSchema {
 	if s == nil {
 		panic("server cannot be nil")
 	}
 	return NewExecutableSchema(Config{
-		Resolvers: s,
+		Resolvers:  s,
+		Complexity: complexity,
 	})
 }
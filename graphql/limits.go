@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	errDepthLimit           = "DEPTH_LIMIT_EXCEEDED"
+	errPersistedQueryDenied = "PERSISTED_QUERY_NOT_ALLOWED"
+)
+
+// lookupComplexity is what a field costs on top of what it selects when it
+// is looked up in the catalog for every item of the list it is in.
+const lookupComplexity = 10
+
+// QueryLimits bounds the work a single operation can ask of the services
+// behind the gateway.
+type QueryLimits struct {
+	// MaxComplexity is the highest complexity score an operation may have;
+	// 0 disables the limit.
+	MaxComplexity int `envconfig:"GRAPHQL_MAX_COMPLEXITY" default:"1000"`
+	// MaxDepth is how deeply selections may nest; 0 disables the limit.
+	MaxDepth int `envconfig:"GRAPHQL_MAX_DEPTH" default:"10"`
+	// ListSize is how many items lists that cannot be paginated, such as an
+	// account's orders, are scored as.
+	ListSize int `envconfig:"GRAPHQL_LIST_SIZE" default:"10"`
+	// APQCacheSize is how many automatic persisted queries are remembered.
+	APQCacheSize int `envconfig:"GRAPHQL_APQ_CACHE_SIZE" default:"1000"`
+	// PersistedQueriesFile is a JSON object of queries keyed by the hex
+	// SHA-256 of their text, known to the gateway from the start.
+	PersistedQueriesFile string `envconfig:"GRAPHQL_PERSISTED_QUERIES"`
+	// AllowListOnly refuses every query that is not in
+	// PersistedQueriesFile.
+	AllowListOnly bool `envconfig:"GRAPHQL_ALLOW_LIST_ONLY"`
+}
+
+// queryComplexity scores every field 1 plus what it selects, and list fields
+// that many times the number of items they can return: the page size asked
+// for, or listSize for lists that cannot be paginated. Fields looked up item
+// by item score lookupComplexity more. The score grows with the number of
+// RPCs an operation fans out to.
+func queryComplexity(listSize int) ComplexityRoot {
+	list := func(childComplexity int) int {
+		return 1 + listSize*childComplexity
+	}
+
+	var c ComplexityRoot
+	c.Query.Accounts = func(childComplexity int, pagination *PaginationInput, id *string) int {
+		if id != nil {
+			return 1 + childComplexity
+		}
+		return 1 + pageSize(pagination)*childComplexity
+	}
+	c.Query.Products = func(childComplexity int, pagination *PaginationInput, query *string, id *string, ids []string, minRating *float64, sort *ProductSort) int {
+		switch {
+		case id != nil:
+			return 1 + childComplexity
+		case len(ids) > 0:
+			return 1 + len(ids)*childComplexity
+		}
+		return 1 + pageSize(pagination)*childComplexity
+	}
+	c.Query.Promotions = func(childComplexity int, pagination *PaginationInput, id *string) int {
+		if id != nil {
+			return 1 + childComplexity
+		}
+		return 1 + pageSize(pagination)*childComplexity
+	}
+	c.Query.Reviews = func(childComplexity int, pagination *PaginationInput, id *string, status *ReviewStatus) int {
+		if id != nil {
+			return 1 + childComplexity
+		}
+		return 1 + pageSize(pagination)*childComplexity
+	}
+	c.Query.Sellers = func(childComplexity int, pagination *PaginationInput, id *string) int {
+		if id != nil {
+			return 1 + childComplexity
+		}
+		return 1 + pageSize(pagination)*childComplexity
+	}
+	c.Product.Reviews = func(childComplexity int, pagination *PaginationInput) int {
+		return 1 + pageSize(pagination)*childComplexity
+	}
+	c.Seller.Products = func(childComplexity int, pagination *PaginationInput) int {
+		return 1 + pageSize(pagination)*childComplexity
+	}
+	c.Seller.Orders = func(childComplexity int, pagination *PaginationInput) int {
+		return 1 + pageSize(pagination)*childComplexity
+	}
+	c.Account.Orders = list
+	c.Account.Addresses = list
+	c.Account.Wishlists = list
+	c.Wishlist.Items = list
+	c.Order.Products = list
+	c.Order.Discounts = list
+	c.Order.Returns = list
+	c.Order.SellerOrders = list
+	c.SellerOrder.Products = list
+	c.OrderQuote.Products = list
+	c.OrderQuote.Discounts = list
+	c.Return.Lines = list
+	lookup := func(childComplexity int) int {
+		return lookupComplexity + childComplexity
+	}
+	c.OrderedProduct.CurrentProduct = lookup
+	c.WishlistItem.Product = lookup
+	return c
+}
+
+// pageSize is the number of items a paginated list returns at most, which is
+// 100 when take is not given.
+func pageSize(pagination *PaginationInput) int {
+	if pagination == nil || pagination.Take == nil || *pagination.Take <= 0 || *pagination.Take > 100 {
+		return 100
+	}
+	return *pagination.Take
+}
+
+// depthLimit refuses operations whose selections nest deeper than max.
+// Introspection fields are not counted, so tools can still load the schema.
+type depthLimit struct {
+	max int
+}
+
+var _ interface {
+	graphql.OperationContextMutator
+	graphql.HandlerExtension
+} = depthLimit{}
+
+func (d depthLimit) ExtensionName() string {
+	return "DepthLimit"
+}
+
+func (d depthLimit) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (d depthLimit) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	if depth := selectionDepth(opCtx.Operation.SelectionSet); depth > d.max {
+		err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", depth, d.max)
+		errcode.Set(err, errDepthLimit)
+		return err
+	}
+	return nil
+}
+
+func selectionDepth(selections ast.SelectionSet) int {
+	depth := 0
+	for _, selection := range selections {
+		d := 0
+		switch s := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name, "__") {
+				continue
+			}
+			d = 1 + selectionDepth(s.SelectionSet)
+		case *ast.InlineFragment:
+			d = selectionDepth(s.SelectionSet)
+		case *ast.FragmentSpread:
+			if s.Definition != nil {
+				d = selectionDepth(s.Definition.SelectionSet)
+			}
+		}
+		depth = max(depth, d)
+	}
+	return depth
+}
+
+// persistedQueries serves queries known in advance by their hash, the way
+// automatic persisted queries are asked for. With allowListOnly, it also
+// refuses any other query, whether it is sent in full or by hash.
+type persistedQueries struct {
+	queries       map[string]string
+	allowListOnly bool
+}
+
+var _ interface {
+	graphql.OperationParameterMutator
+	graphql.HandlerExtension
+} = persistedQueries{}
+
+// loadPersistedQueries reads a JSON object of queries keyed by their hash.
+func loadPersistedQueries(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read persisted queries: %v", err)
+	}
+	file := map[string]string{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse persisted queries: %v", err)
+	}
+	queries := map[string]string{}
+	for hash, query := range file {
+		if queryHash(query) != strings.ToLower(hash) {
+			return nil, fmt.Errorf("persisted query %s does not match its hash", hash)
+		}
+		queries[strings.ToLower(hash)] = query
+	}
+	return queries, nil
+}
+
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p persistedQueries) ExtensionName() string {
+	return "PersistedQueries"
+}
+
+func (p persistedQueries) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (p persistedQueries) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	hash := ""
+	if ext, ok := rawParams.Extensions["persistedQuery"].(map[string]interface{}); ok {
+		hash, _ = ext["sha256Hash"].(string)
+		hash = strings.ToLower(hash)
+	}
+	if rawParams.Query != "" {
+		hash = queryHash(rawParams.Query)
+	}
+	query, ok := p.queries[hash]
+	if !ok {
+		if p.allowListOnly {
+			err := gqlerror.Errorf("query is not on the allow-list of persisted queries")
+			errcode.Set(err, errPersistedQueryDenied)
+			return err
+		}
+		return nil
+	}
+	// The AutomaticPersistedQuery extension runs next and checks the hash
+	// the request names, if any, against the query.
+	rawParams.Query = query
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/complexity"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2"
+)
+
+func TestQueryComplexity(t *testing.T) {
+	es := (&Server{}).ToExecutableSchema(queryComplexity(10))
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{
+			name:  "one seller",
+			query: `{ sellers(id: "s1") { id } }`,
+			want:  2,
+		},
+		{
+			name:  "page of sellers",
+			query: `{ sellers(pagination: {take: 5}) { id } }`,
+			want:  6,
+		},
+		{
+			name:  "sellers without a page size",
+			query: `{ sellers { id } }`,
+			want:  101,
+		},
+		{
+			name:  "seller products",
+			query: `{ sellers(id: "s1") { products(pagination: {take: 20}) { id name } } }`,
+			want:  1 + (1 + 20*2),
+		},
+		{
+			name:  "seller orders and their products",
+			query: `{ sellers(id: "s1") { orders(pagination: {take: 5}) { orderId products { id } } } }`,
+			want:  1 + (1 + 5*(1+(1+10*1))),
+		},
+		{
+			name:  "every seller's products and orders",
+			query: `{ sellers { products { id } orders { products { id } } } }`,
+			want:  1 + 100*((1+100*1)+(1+100*(1+10*1))),
+		},
+		{
+			name:  "order seller orders",
+			query: `{ accounts(id: "a1") { orders { sellerOrders { products { id } } } } }`,
+			want:  1 + (1 + 10*(1+10*(1+10*1))),
+		},
+		{
+			name:  "current products of orders",
+			query: `{ accounts(id: "a1") { orders { products { currentProduct { id name } } } } }`,
+			want:  1 + (1 + 10*(1+10*(10+2))),
+		},
+		{
+			name:  "products of wishlists",
+			query: `{ accounts(id: "a1") { wishlists { items { product { id } currentPrice } } } }`,
+			want:  1 + (1 + 10*(1+10*((10+1)+1))),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := gqlparser.LoadQuery(es.Schema(), tt.query)
+			if err != nil {
+				t.Fatalf("LoadQuery: %v", err)
+			}
+			if got := complexity.Calculate(es, doc.Operations[0], nil); got != tt.want {
+				t.Errorf("complexity = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDepthLimit(t *testing.T) {
+	es := (&Server{}).ToExecutableSchema(queryComplexity(10))
+	d := depthLimit{max: 3}
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{
+			name:  "within the limit",
+			query: `{ accounts { orders { id } } }`,
+		},
+		{
+			name:    "too deep",
+			query:   `{ accounts { orders { products { id } } } }`,
+			wantErr: true,
+		},
+		{
+			name:  "fragment within the limit",
+			query: `query { accounts { ...orders } } fragment orders on Account { orders { id } }`,
+		},
+		{
+			name:    "too deep through a fragment",
+			query:   `query { accounts { ...orders } } fragment orders on Account { orders { products { id } } }`,
+			wantErr: true,
+		},
+		{
+			name:  "inline fragment within the limit",
+			query: `{ accounts { ... on Account { orders { id } } } }`,
+		},
+		{
+			name:    "too deep through an inline fragment",
+			query:   `{ accounts { ... on Account { orders { products { id } } } } }`,
+			wantErr: true,
+		},
+		{
+			name:  "introspection is not counted",
+			query: `{ __schema { types { fields { type { ofType { ofType { name } } } } } } }`,
+		},
+		{
+			name:    "introspection does not hide the rest",
+			query:   `{ __typename accounts { orders { products { id } } } }`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := gqlparser.LoadQuery(es.Schema(), tt.query)
+			if err != nil {
+				t.Fatalf("LoadQuery: %v", err)
+			}
+			opCtx := &graphql.OperationContext{Operation: doc.Operations[0]}
+			gerr := d.MutateOperationContext(context.Background(), opCtx)
+			if !tt.wantErr {
+				if gerr != nil {
+					t.Errorf("MutateOperationContext: %v", gerr)
+				}
+				return
+			}
+			if gerr == nil || gerr.Extensions["code"] != errDepthLimit {
+				t.Errorf("MutateOperationContext = %v, want a %s error", gerr, errDepthLimit)
+			}
+		})
+	}
+}
+
+func TestPersistedQueries(t *testing.T) {
+	known := `{ products { id } }`
+	hash := queryHash(known)
+	other := `{ sellers { id } }`
+	apq := func(hash string) map[string]interface{} {
+		return map[string]interface{}{"persistedQuery": map[string]interface{}{"version": float64(1), "sha256Hash": hash}}
+	}
+
+	tests := []struct {
+		name          string
+		allowListOnly bool
+		params        graphql.RawParams
+		wantQuery     string
+		wantErr       bool
+	}{
+		{"known hash", true, graphql.RawParams{Extensions: apq(hash)}, known, false},
+		{"known hash in upper case", true, graphql.RawParams{Extensions: apq(strings.ToUpper(hash))}, known, false},
+		{"known query in full", true, graphql.RawParams{Query: known}, known, false},
+		{"unknown hash", true, graphql.RawParams{Extensions: apq(queryHash(other))}, "", true},
+		{"unknown query in full", true, graphql.RawParams{Query: other}, "", true},
+		{"no query", true, graphql.RawParams{}, "", true},
+		{"unknown query without the allow-list", false, graphql.RawParams{Query: other}, other, false},
+		{"unknown hash without the allow-list", false, graphql.RawParams{Extensions: apq(queryHash(other))}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := persistedQueries{queries: map[string]string{hash: known}, allowListOnly: tt.allowListOnly}
+			params := tt.params
+			gerr := p.MutateOperationParameters(context.Background(), &params)
+			if tt.wantErr {
+				if gerr == nil || gerr.Extensions["code"] != errPersistedQueryDenied {
+					t.Errorf("MutateOperationParameters = %v, want a %s error", gerr, errPersistedQueryDenied)
+				}
+				return
+			}
+			if gerr != nil {
+				t.Fatalf("MutateOperationParameters: %v", gerr)
+			}
+			if params.Query != tt.wantQuery {
+				t.Errorf("query = %q, want %q", params.Query, tt.wantQuery)
+			}
+		})
+	}
+}
@@ -11,16 +11,88 @@ import (
 	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/grpcclient"
+	"github.com/donaldnash/go-marketplace/ratelimit"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/rs/cors"
+	"github.com/vektah/gqlparser/v2/ast"
 )
 
 type AppConfig struct {
 	AccountURL string `envconfig:"ACCOUNT_SERVICE_URL" required:"true"`
 	CatalogURL string `envconfig:"CATALOG_SERVICE_URL" required:"true"`
 	OrderURL   string `envconfig:"ORDER_SERVICE_URL" required:"true"`
+	ReviewURL  string `envconfig:"REVIEW_SERVICE_URL" required:"true"`
 	Port       string `envconfig:"PORT" default:"8080"`
+	// PaymentWebhookSecret signs payment provider callbacks. The webhook is
+	// not served without it.
+	PaymentWebhookSecret string `envconfig:"PAYMENT_WEBHOOK_SECRET"`
+	// AuthSecret verifies the bearer tokens that requests acting for an
+	// account must carry. Requests are not authenticated without it.
+	AuthSecret string `envconfig:"AUTH_SECRET"`
+	// CatalogCacheSize is how many products the gateway caches for
+	// CatalogCacheTTL; 0 turns the cache off.
+	CatalogCacheSize int           `envconfig:"CATALOG_CACHE_SIZE" default:"0"`
+	CatalogCacheTTL  time.Duration `envconfig:"CATALOG_CACHE_TTL" default:"10s"`
+	// ResponseCacheSize is how many query results the gateway keeps for as
+	// long as their @cacheControl hints allow; 0 keeps none.
+	ResponseCacheSize int `envconfig:"GRAPHQL_RESPONSE_CACHE_SIZE" default:"1000"`
+	QueryLimits
+	RateLimits
+	grpcclient.Options
+}
+
+// newGraphQLHandler serves queries and mutations over HTTP and subscriptions
+// over websockets.
+func newGraphQLHandler(s *Server, auth *authenticator, limits QueryLimits, limiter *rateLimiter, cache *responseCache) (*handler.Server, error) {
+	ws := transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+	}
+	if auth != nil {
+		ws.InitFunc = auth.websocketInit
+	}
+
+	srv := handler.New(s.ToExecutableSchema(queryComplexity(limits.ListSize)))
+	srv.AddTransport(ws)
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{
+		MaxUploadSize: catalog.MaxImageSize + 1<<20,
+	})
+
+	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
+
+	srv.Use(extension.Introspection{})
+
+	if limits.PersistedQueriesFile != "" {
+		queries, err := loadPersistedQueries(limits.PersistedQueriesFile)
+		if err != nil {
+			return nil, err
+		}
+		srv.Use(persistedQueries{queries: queries, allowListOnly: limits.AllowListOnly})
+		log.Printf("Loaded %d persisted queries", len(queries))
+	} else if limits.AllowListOnly {
+		return nil, fmt.Errorf("GRAPHQL_ALLOW_LIST_ONLY needs GRAPHQL_PERSISTED_QUERIES")
+	}
+	srv.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New[string](limits.APQCacheSize),
+	})
+
+	if limits.MaxComplexity > 0 {
+		srv.Use(extension.FixedComplexityLimit(limits.MaxComplexity))
+	}
+	if limits.MaxDepth > 0 {
+		srv.Use(depthLimit{max: limits.MaxDepth})
+	}
+	srv.Use(limiter)
+	srv.Use(cache)
+	return srv, nil
 }
 
 func main() {
@@ -34,11 +106,24 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	log.Printf("Configuration loaded:\n  Account URL: %s\n  Catalog URL: %s\n  Order URL: %s\n  Port: %s",
-		cfg.AccountURL, cfg.CatalogURL, cfg.OrderURL, cfg.Port)
+	log.Printf("Configuration loaded:\n  Account URL: %s\n  Catalog URL: %s\n  Order URL: %s\n  Review URL: %s\n  Port: %s",
+		cfg.AccountURL, cfg.CatalogURL, cfg.OrderURL, cfg.ReviewURL, cfg.Port)
+
+	var auth *authenticator
+	if cfg.AuthSecret != "" {
+		auth = newAuthenticator(cfg.AuthSecret)
+	} else {
+		log.Println("AUTH_SECRET is not set; requests are not authenticated")
+	}
+
+	var catalogCache catalog.Cache
+	if cfg.CatalogCacheSize > 0 {
+		catalogCache = catalog.NewMemoryCache(cfg.CatalogCacheSize, cfg.CatalogCacheTTL)
+		log.Printf("Caching up to %d catalog products for %s", cfg.CatalogCacheSize, cfg.CatalogCacheTTL)
+	}
 
 	// Create GraphQL server
-	s, err := NewGraphQLServer(cfg.AccountURL, cfg.CatalogURL, cfg.OrderURL)
+	s, err := NewGraphQLServer(cfg.AccountURL, cfg.CatalogURL, cfg.OrderURL, cfg.ReviewURL, cfg.Options, catalogCache, auth)
 	if err != nil {
 		log.Fatalf("Failed to create GraphQL server: %v", err)
 	}
@@ -51,7 +136,8 @@ func main() {
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"}, // In production, replace with specific origins
 		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "If-None-Match"},
+		ExposedHeaders:   []string{"ETag", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any major browser
 		Debug:            false,
@@ -59,8 +145,26 @@ func main() {
 
 	// Create HTTP server with timeouts
 	mux := http.NewServeMux()
-	mux.Handle("/graphql", c.Handler(handler.NewDefaultServer(s.ToExecutableSchema())))
+	limiter, err := newRateLimiter(ratelimit.NewMemoryStore(), cfg.RateLimits)
+	if err != nil {
+		log.Fatalf("Failed to configure rate limits: %v", err)
+	}
+	cache := newResponseCache(cfg.ResponseCacheSize)
+	graphQLHandler, err := newGraphQLHandler(s, auth, cfg.QueryLimits, limiter, cache)
+	if err != nil {
+		log.Fatalf("Failed to create GraphQL handler: %v", err)
+	}
+	api := limiter.middleware(cache.middleware(graphQLHandler))
+	if auth != nil {
+		api = auth.middleware(api)
+	}
+	mux.Handle("/graphql", c.Handler(api))
 	mux.Handle("/playground", playground.Handler("GraphQL Playground", "/graphql"))
+	if cfg.PaymentWebhookSecret != "" {
+		mux.Handle("/webhooks/payments", newPaymentWebhook(s.orderClient, cfg.PaymentWebhookSecret))
+	} else {
+		log.Println("PAYMENT_WEBHOOK_SECRET is not set; payment webhooks are disabled")
+	}
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%s", cfg.Port),
@@ -1,7 +1,326 @@
 package main
 
+import (
+	"time"
+
+	"github.com/donaldnash/go-marketplace/account"
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/order"
+	"github.com/donaldnash/go-marketplace/payment"
+	"github.com/donaldnash/go-marketplace/promotion"
+	"github.com/donaldnash/go-marketplace/review"
+)
+
 type Account struct {
 	ID     string  `json:"id"`
 	Name   string  `json:"name"`
 	Orders []Order `json:"orders"`
 }
+
+func newProduct(p catalog.Product) *Product {
+	var category *string
+	if p.Category != "" {
+		category = &p.Category
+	}
+	images := make([]*Image, len(p.Images))
+	for i, img := range p.Images {
+		images[i] = &Image{
+			ID:           img.ID,
+			URL:          img.URL,
+			ThumbnailURL: img.ThumbnailURL,
+			Alt:          img.Alt,
+			Position:     img.Position,
+		}
+	}
+	options := make([]*ProductOption, len(p.Options))
+	for i, o := range p.Options {
+		options[i] = &ProductOption{Name: o.Name, Values: o.Values}
+	}
+	variants := make([]*Variant, len(p.Variants))
+	for i, v := range p.Variants {
+		attributes := make([]*Attribute, len(v.Attributes))
+		for j, a := range v.Attributes {
+			attributes[j] = &Attribute{Name: a.Name, Value: a.Value}
+		}
+		variants[i] = &Variant{
+			ID:         v.ID,
+			Sku:        v.SKU,
+			Price:      p.PriceOf(v),
+			Stock:      v.Stock,
+			Attributes: attributes,
+		}
+	}
+	return &Product{
+		ID:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		TaxCategory: p.TaxCategory,
+		Category:    category,
+		Weight:      weightOrNil(p.Weight),
+		Images:      images,
+		Options:     options,
+		Variants:    variants,
+		SellerID:    stringOrNil(p.SellerID),
+		Rating:      &Rating{Average: p.Rating.Average, Count: p.Rating.Count},
+	}
+}
+
+func newOrder(o order.Order) *Order {
+	discounts := make([]*OrderDiscount, len(o.Discounts))
+	for i, d := range o.Discounts {
+		discounts[i] = &OrderDiscount{
+			PromotionID: d.PromotionID,
+			Code:        d.Code,
+			Description: d.Description,
+			Amount:      d.Amount,
+		}
+	}
+
+	sellerOrders := make([]*SellerOrder, len(o.SellerOrders))
+	for i, so := range o.SellerOrders {
+		sellerOrders[i] = newSellerOrder(so, false)
+	}
+
+	return &Order{
+		ID:              o.ID,
+		CreatedAt:       o.CreatedAt,
+		Status:          orderStatus(o.Status),
+		Subtotal:        o.Subtotal,
+		DiscountTotal:   o.DiscountTotal,
+		TaxTotal:        o.TaxTotal,
+		ShippingTotal:   o.ShippingTotal,
+		GrandTotal:      o.TotalPrice,
+		TotalPrice:      o.TotalPrice,
+		Products:        newOrderedProducts(o.Products),
+		Discounts:       discounts,
+		ShippingAddress: newShippingAddress(o.ShippingAddress),
+		ShippingMethod:  stringOrNil(o.ShippingMethod),
+		SellerOrders:    sellerOrders,
+	}
+}
+
+// newSellerOrder leaves out the commission and payout unless withPayout, as
+// they are only shown to the seller.
+func newSellerOrder(so order.SellerOrder, withPayout bool) *SellerOrder {
+	res := &SellerOrder{
+		OrderID:         so.OrderID,
+		SellerID:        so.SellerID,
+		CreatedAt:       so.CreatedAt,
+		Status:          orderStatus(so.Status),
+		Products:        newOrderedProducts(so.Products),
+		ShippingAddress: newShippingAddress(so.ShippingAddress),
+		ShippingMethod:  stringOrNil(so.ShippingMethod),
+		Subtotal:        so.Subtotal,
+		DiscountTotal:   so.DiscountTotal,
+		TaxTotal:        so.TaxTotal,
+	}
+	if withPayout {
+		res.CommissionRate = &so.CommissionRate
+		res.Commission = &so.Commission
+		res.Payout = &so.Payout
+	}
+	return res
+}
+
+func newOrderedProducts(ops []order.OrderedProduct) []*OrderedProduct {
+	products := make([]*OrderedProduct, len(ops))
+	for i, p := range ops {
+		attributes := make([]*Attribute, len(p.Attributes))
+		for j, a := range p.Attributes {
+			attributes[j] = &Attribute{Name: a.Name, Value: a.Value}
+		}
+		products[i] = &OrderedProduct{
+			ID:          p.ID,
+			VariantID:   stringOrNil(p.VariantID),
+			Sku:         stringOrNil(p.SKU),
+			Attributes:  attributes,
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Quantity:    int(p.Quantity),
+			TaxCategory: p.TaxCategory,
+			Tax:         p.Tax,
+			SellerID:    stringOrNil(p.SellerID),
+		}
+	}
+	return products
+}
+
+func newShippingAddress(a *order.ShippingAddress) *ShippingAddress {
+	if a == nil {
+		return nil
+	}
+	return &ShippingAddress{
+		AddressID:  a.AddressID,
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+func orderStatus(s order.Status) OrderStatus {
+	status := OrderStatus(s)
+	if !status.IsValid() {
+		status = OrderStatusPending
+	}
+	return status
+}
+
+func newSeller(s account.Seller) *Seller {
+	return &Seller{
+		ID:        s.AccountID,
+		Name:      s.Name,
+		CreatedAt: s.CreatedAt,
+	}
+}
+
+func newReview(r review.Review) *Review {
+	return &Review{
+		ID:             r.ID,
+		ProductID:      r.ProductID,
+		AccountID:      r.AccountID,
+		Rating:         r.Rating,
+		Title:          r.Title,
+		Body:           r.Body,
+		Status:         ReviewStatus(r.Status),
+		ModerationNote: stringOrNil(r.ModerationNote),
+		HelpfulVotes:   r.HelpfulVotes,
+		CreatedAt:      r.CreatedAt,
+		UpdatedAt:      r.UpdatedAt,
+	}
+}
+
+func newReviews(reviews []review.Review) []*Review {
+	result := make([]*Review, len(reviews))
+	for i, r := range reviews {
+		result[i] = newReview(r)
+	}
+	return result
+}
+
+func newSalesReport(r order.SalesReport) *SalesReport {
+	return &SalesReport{
+		SellerID:      r.SellerID,
+		From:          r.From,
+		To:            r.To,
+		Orders:        r.Orders,
+		Units:         r.Units,
+		Subtotal:      r.Subtotal,
+		DiscountTotal: r.DiscountTotal,
+		TaxTotal:      r.TaxTotal,
+		Commission:    r.Commission,
+		Payout:        r.Payout,
+	}
+}
+
+func newPayment(p payment.Payment) *Payment {
+	var failureReason *string
+	if p.FailureReason != "" {
+		failureReason = &p.FailureReason
+	}
+	return &Payment{
+		ID:             p.ID,
+		OrderID:        p.OrderID,
+		Provider:       p.Provider,
+		Amount:         p.Amount,
+		RefundedAmount: p.RefundedAmount,
+		Status:         PaymentStatus(p.Status),
+		FailureReason:  failureReason,
+		CreatedAt:      p.CreatedAt,
+	}
+}
+
+func newReturn(r order.Return) *Return {
+	lines := make([]*ReturnLine, len(r.Lines))
+	for i, l := range r.Lines {
+		lines[i] = &ReturnLine{
+			ProductID: l.ProductID,
+			VariantID: stringOrNil(l.VariantID),
+			Quantity:  int(l.Quantity),
+			Amount:    l.Amount,
+		}
+	}
+
+	var rejectionReason *string
+	if r.RejectionReason != "" {
+		rejectionReason = &r.RejectionReason
+	}
+
+	return &Return{
+		ID:               r.ID,
+		OrderID:          r.OrderID,
+		Status:           ReturnStatus(r.Status),
+		Reason:           r.Reason,
+		RejectionReason:  rejectionReason,
+		Lines:            lines,
+		RefundableAmount: r.RefundableAmount,
+		RefundAmount:     r.RefundAmount,
+		CreatedAt:        r.CreatedAt,
+		UpdatedAt:        r.UpdatedAt,
+	}
+}
+
+func newAddress(a account.Address) *Address {
+	return &Address{
+		ID:         a.ID,
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+		CreatedAt:  a.CreatedAt,
+	}
+}
+
+func newPromotion(p promotion.Promotion) *Promotion {
+	productIDs := p.ProductIDs
+	if productIDs == nil {
+		productIDs = []string{}
+	}
+	return &Promotion{
+		ID:                   p.ID,
+		Code:                 p.Code,
+		Description:          p.Description,
+		Kind:                 PromotionKind(p.Kind),
+		Value:                p.Value,
+		BuyQuantity:          int(p.BuyQuantity),
+		GetQuantity:          int(p.GetQuantity),
+		ProductIds:           productIDs,
+		MinSpend:             p.MinSpend,
+		UsageLimitPerAccount: int(p.UsageLimitPerAccount),
+		ValidFrom:            timeOrNil(p.ValidFrom),
+		ValidUntil:           timeOrNil(p.ValidUntil),
+		Active:               p.Active,
+		CreatedAt:            p.CreatedAt,
+	}
+}
+
+// stringOrNil reports an empty string as null.
+func stringOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// weightOrNil reports an unknown weight as null.
+func weightOrNil(w float64) *float64 {
+	if w <= 0 {
+		return nil
+	}
+	return &w
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -3,6 +3,9 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"strconv"
 	"time"
 )
 
@@ -10,32 +13,116 @@ type AccountInput struct {
 	Name string `json:"name"`
 }
 
+type Address struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Line1      string    `json:"line1"`
+	Line2      string    `json:"line2"`
+	City       string    `json:"city"`
+	Region     string    `json:"region"`
+	PostalCode string    `json:"postalCode"`
+	Country    string    `json:"country"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type AddressInput struct {
+	Name       string  `json:"name"`
+	Line1      string  `json:"line1"`
+	Line2      *string `json:"line2,omitempty"`
+	City       string  `json:"city"`
+	Region     *string `json:"region,omitempty"`
+	PostalCode *string `json:"postalCode,omitempty"`
+	Country    string  `json:"country"`
+}
+
+type Attribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type AttributeInput struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Image struct {
+	ID           string `json:"id"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnailUrl"`
+	Alt          string `json:"alt"`
+	Position     int    `json:"position"`
+}
+
 type Mutation struct {
 }
 
 type Order struct {
-	ID         string            `json:"id"`
-	CreatedAt  time.Time         `json:"createdAt"`
-	TotalPrice float64           `json:"totalPrice"`
-	Products   []*OrderedProduct `json:"products"`
+	ID              string            `json:"id"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	Status          OrderStatus       `json:"status"`
+	Subtotal        float64           `json:"subtotal"`
+	DiscountTotal   float64           `json:"discountTotal"`
+	TaxTotal        float64           `json:"taxTotal"`
+	ShippingTotal   float64           `json:"shippingTotal"`
+	GrandTotal      float64           `json:"grandTotal"`
+	TotalPrice      float64           `json:"totalPrice"`
+	Products        []*OrderedProduct `json:"products"`
+	Discounts       []*OrderDiscount  `json:"discounts"`
+	ShippingAddress *ShippingAddress  `json:"shippingAddress,omitempty"`
+	ShippingMethod  *string           `json:"shippingMethod,omitempty"`
+	Returns         []*Return         `json:"returns"`
+	SellerOrders    []*SellerOrder    `json:"sellerOrders"`
+}
+
+type OrderDiscount struct {
+	PromotionID string  `json:"promotionId"`
+	Code        string  `json:"code"`
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
 }
 
 type OrderInput struct {
-	AccountID string               `json:"accountId"`
-	Products  []*OrderProductInput `json:"products"`
+	AccountID         string               `json:"accountId"`
+	Products          []*OrderProductInput `json:"products"`
+	CouponCode        *string              `json:"couponCode,omitempty"`
+	Country           *string              `json:"country,omitempty"`
+	Region            *string              `json:"region,omitempty"`
+	ShippingAddressID *string              `json:"shippingAddressId,omitempty"`
+	ShippingMethod    *string              `json:"shippingMethod,omitempty"`
 }
 
 type OrderProductInput struct {
-	ID       string `json:"id"`
-	Quantity int    `json:"quantity"`
+	ID        string  `json:"id"`
+	VariantID *string `json:"variantId,omitempty"`
+	Quantity  int     `json:"quantity"`
+}
+
+type OrderQuote struct {
+	Subtotal        float64           `json:"subtotal"`
+	DiscountTotal   float64           `json:"discountTotal"`
+	TaxTotal        float64           `json:"taxTotal"`
+	ShippingTotal   float64           `json:"shippingTotal"`
+	GrandTotal      float64           `json:"grandTotal"`
+	TotalPrice      float64           `json:"totalPrice"`
+	Products        []*OrderedProduct `json:"products"`
+	Discounts       []*OrderDiscount  `json:"discounts"`
+	ShippingAddress *ShippingAddress  `json:"shippingAddress,omitempty"`
+	ShippingMethod  *string           `json:"shippingMethod,omitempty"`
 }
 
 type OrderedProduct struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Quantity    int     `json:"quantity"`
+	ID             string       `json:"id"`
+	VariantID      *string      `json:"variantId,omitempty"`
+	Sku            *string      `json:"sku,omitempty"`
+	Attributes     []*Attribute `json:"attributes"`
+	Name           string       `json:"name"`
+	Description    string       `json:"description"`
+	Price          float64      `json:"price"`
+	Quantity       int          `json:"quantity"`
+	TaxCategory    string       `json:"taxCategory"`
+	Tax            float64      `json:"tax"`
+	SellerID       *string      `json:"sellerId,omitempty"`
+	CurrentProduct *Product     `json:"currentProduct,omitempty"`
 }
 
 type PaginationInput struct {
@@ -43,18 +130,545 @@ type PaginationInput struct {
 	Take *int `json:"take,omitempty"`
 }
 
+type Payment struct {
+	ID             string        `json:"id"`
+	OrderID        string        `json:"orderId"`
+	Provider       string        `json:"provider"`
+	Amount         float64       `json:"amount"`
+	RefundedAmount float64       `json:"refundedAmount"`
+	Status         PaymentStatus `json:"status"`
+	FailureReason  *string       `json:"failureReason,omitempty"`
+	CreatedAt      time.Time     `json:"createdAt"`
+}
+
 type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Price       float64          `json:"price"`
+	TaxCategory string           `json:"taxCategory"`
+	Category    *string          `json:"category,omitempty"`
+	Weight      *float64         `json:"weight,omitempty"`
+	Images      []*Image         `json:"images"`
+	Options     []*ProductOption `json:"options"`
+	Variants    []*Variant       `json:"variants"`
+	SellerID    *string          `json:"sellerId,omitempty"`
+	Rating      *Rating          `json:"rating"`
+	Reviews     []*Review        `json:"reviews"`
 }
 
 type ProductInput struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	Price       float64               `json:"price"`
+	TaxCategory *string               `json:"taxCategory,omitempty"`
+	Category    *string               `json:"category,omitempty"`
+	Weight      *float64              `json:"weight,omitempty"`
+	Options     []*ProductOptionInput `json:"options,omitempty"`
+	Variants    []*VariantInput       `json:"variants,omitempty"`
+	SellerID    *string               `json:"sellerId,omitempty"`
+}
+
+type ProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+type ProductOptionInput struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+type Promotion struct {
+	ID                   string        `json:"id"`
+	Code                 string        `json:"code"`
+	Description          string        `json:"description"`
+	Kind                 PromotionKind `json:"kind"`
+	Value                float64       `json:"value"`
+	BuyQuantity          int           `json:"buyQuantity"`
+	GetQuantity          int           `json:"getQuantity"`
+	ProductIds           []string      `json:"productIds"`
+	MinSpend             float64       `json:"minSpend"`
+	UsageLimitPerAccount int           `json:"usageLimitPerAccount"`
+	ValidFrom            *time.Time    `json:"validFrom,omitempty"`
+	ValidUntil           *time.Time    `json:"validUntil,omitempty"`
+	Active               bool          `json:"active"`
+	CreatedAt            time.Time     `json:"createdAt"`
+}
+
+type PromotionInput struct {
+	Code                 string        `json:"code"`
+	Description          *string       `json:"description,omitempty"`
+	Kind                 PromotionKind `json:"kind"`
+	Value                *float64      `json:"value,omitempty"`
+	BuyQuantity          *int          `json:"buyQuantity,omitempty"`
+	GetQuantity          *int          `json:"getQuantity,omitempty"`
+	ProductIds           []string      `json:"productIds,omitempty"`
+	MinSpend             *float64      `json:"minSpend,omitempty"`
+	UsageLimitPerAccount *int          `json:"usageLimitPerAccount,omitempty"`
+	ValidFrom            *time.Time    `json:"validFrom,omitempty"`
+	ValidUntil           *time.Time    `json:"validUntil,omitempty"`
+	Active               *bool         `json:"active,omitempty"`
 }
 
 type Query struct {
 }
+
+type Rating struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+type Return struct {
+	ID               string        `json:"id"`
+	OrderID          string        `json:"orderId"`
+	Status           ReturnStatus  `json:"status"`
+	Reason           string        `json:"reason"`
+	RejectionReason  *string       `json:"rejectionReason,omitempty"`
+	Lines            []*ReturnLine `json:"lines"`
+	RefundableAmount float64       `json:"refundableAmount"`
+	RefundAmount     float64       `json:"refundAmount"`
+	CreatedAt        time.Time     `json:"createdAt"`
+	UpdatedAt        time.Time     `json:"updatedAt"`
+}
+
+type ReturnInput struct {
+	OrderID   string             `json:"orderId"`
+	AccountID string             `json:"accountId"`
+	Reason    *string            `json:"reason,omitempty"`
+	Lines     []*ReturnLineInput `json:"lines"`
+}
+
+type ReturnLine struct {
+	ProductID string  `json:"productId"`
+	VariantID *string `json:"variantId,omitempty"`
+	Quantity  int     `json:"quantity"`
+	Amount    float64 `json:"amount"`
+}
+
+type ReturnLineInput struct {
+	ProductID string  `json:"productId"`
+	VariantID *string `json:"variantId,omitempty"`
+	Quantity  int     `json:"quantity"`
+}
+
+type Review struct {
+	ID             string       `json:"id"`
+	ProductID      string       `json:"productId"`
+	AccountID      string       `json:"accountId"`
+	Rating         int          `json:"rating"`
+	Title          string       `json:"title"`
+	Body           string       `json:"body"`
+	Status         ReviewStatus `json:"status"`
+	ModerationNote *string      `json:"moderationNote,omitempty"`
+	HelpfulVotes   int          `json:"helpfulVotes"`
+	CreatedAt      time.Time    `json:"createdAt"`
+	UpdatedAt      time.Time    `json:"updatedAt"`
+}
+
+type ReviewInput struct {
+	AccountID string  `json:"accountId"`
+	ProductID string  `json:"productId"`
+	Rating    int     `json:"rating"`
+	Title     string  `json:"title"`
+	Body      *string `json:"body,omitempty"`
+}
+
+type SalesReport struct {
+	SellerID      string    `json:"sellerId"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	Orders        int       `json:"orders"`
+	Units         int       `json:"units"`
+	Subtotal      float64   `json:"subtotal"`
+	DiscountTotal float64   `json:"discountTotal"`
+	TaxTotal      float64   `json:"taxTotal"`
+	Commission    float64   `json:"commission"`
+	Payout        float64   `json:"payout"`
+}
+
+type Seller struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	Products    []*Product     `json:"products"`
+	Orders      []*SellerOrder `json:"orders"`
+	SalesReport *SalesReport   `json:"salesReport"`
+}
+
+type SellerOrder struct {
+	OrderID         string            `json:"orderId"`
+	SellerID        string            `json:"sellerId"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	Status          OrderStatus       `json:"status"`
+	Products        []*OrderedProduct `json:"products"`
+	ShippingAddress *ShippingAddress  `json:"shippingAddress,omitempty"`
+	ShippingMethod  *string           `json:"shippingMethod,omitempty"`
+	Subtotal        float64           `json:"subtotal"`
+	DiscountTotal   float64           `json:"discountTotal"`
+	TaxTotal        float64           `json:"taxTotal"`
+	CommissionRate  *float64          `json:"commissionRate,omitempty"`
+	Commission      *float64          `json:"commission,omitempty"`
+	Payout          *float64          `json:"payout,omitempty"`
+}
+
+type ShippingAddress struct {
+	AddressID  string `json:"addressId"`
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postalCode"`
+	Country    string `json:"country"`
+}
+
+type Subscription struct {
+}
+
+type Variant struct {
+	ID         string       `json:"id"`
+	Sku        string       `json:"sku"`
+	Price      float64      `json:"price"`
+	Stock      int          `json:"stock"`
+	Attributes []*Attribute `json:"attributes"`
+}
+
+type VariantInput struct {
+	ID         *string           `json:"id,omitempty"`
+	Sku        string            `json:"sku"`
+	Price      *float64          `json:"price,omitempty"`
+	Stock      int               `json:"stock"`
+	Attributes []*AttributeInput `json:"attributes"`
+}
+
+type Wishlist struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	ShareToken *string         `json:"shareToken,omitempty"`
+	Items      []*WishlistItem `json:"items"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+type WishlistItem struct {
+	ProductID    string    `json:"productId"`
+	VariantID    *string   `json:"variantId,omitempty"`
+	SavedPrice   float64   `json:"savedPrice"`
+	AddedAt      time.Time `json:"addedAt"`
+	Product      *Product  `json:"product,omitempty"`
+	CurrentPrice *float64  `json:"currentPrice,omitempty"`
+	PriceDrop    float64   `json:"priceDrop"`
+}
+
+type CacheControlScope string
+
+const (
+	CacheControlScopePublic  CacheControlScope = "PUBLIC"
+	CacheControlScopePrivate CacheControlScope = "PRIVATE"
+)
+
+var AllCacheControlScope = []CacheControlScope{
+	CacheControlScopePublic,
+	CacheControlScopePrivate,
+}
+
+func (e CacheControlScope) IsValid() bool {
+	switch e {
+	case CacheControlScopePublic, CacheControlScopePrivate:
+		return true
+	}
+	return false
+}
+
+func (e CacheControlScope) String() string {
+	return string(e)
+}
+
+func (e *CacheControlScope) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CacheControlScope(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CacheControlScope", str)
+	}
+	return nil
+}
+
+func (e CacheControlScope) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OrderStatus string
+
+const (
+	OrderStatusPending           OrderStatus = "PENDING"
+	OrderStatusPaid              OrderStatus = "PAID"
+	OrderStatusPartiallyRefunded OrderStatus = "PARTIALLY_REFUNDED"
+	OrderStatusRefunded          OrderStatus = "REFUNDED"
+	OrderStatusCancelled         OrderStatus = "CANCELLED"
+)
+
+var AllOrderStatus = []OrderStatus{
+	OrderStatusPending,
+	OrderStatusPaid,
+	OrderStatusPartiallyRefunded,
+	OrderStatusRefunded,
+	OrderStatusCancelled,
+}
+
+func (e OrderStatus) IsValid() bool {
+	switch e {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusPartiallyRefunded, OrderStatusRefunded, OrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (e OrderStatus) String() string {
+	return string(e)
+}
+
+func (e *OrderStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderStatus", str)
+	}
+	return nil
+}
+
+func (e OrderStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PaymentStatus string
+
+const (
+	PaymentStatusPending    PaymentStatus = "PENDING"
+	PaymentStatusAuthorized PaymentStatus = "AUTHORIZED"
+	PaymentStatusCaptured   PaymentStatus = "CAPTURED"
+	PaymentStatusFailed     PaymentStatus = "FAILED"
+	PaymentStatusVoided     PaymentStatus = "VOIDED"
+	PaymentStatusRefunded   PaymentStatus = "REFUNDED"
+)
+
+var AllPaymentStatus = []PaymentStatus{
+	PaymentStatusPending,
+	PaymentStatusAuthorized,
+	PaymentStatusCaptured,
+	PaymentStatusFailed,
+	PaymentStatusVoided,
+	PaymentStatusRefunded,
+}
+
+func (e PaymentStatus) IsValid() bool {
+	switch e {
+	case PaymentStatusPending, PaymentStatusAuthorized, PaymentStatusCaptured, PaymentStatusFailed, PaymentStatusVoided, PaymentStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (e PaymentStatus) String() string {
+	return string(e)
+}
+
+func (e *PaymentStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PaymentStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PaymentStatus", str)
+	}
+	return nil
+}
+
+func (e PaymentStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ProductSort string
+
+const (
+	ProductSortRelevance ProductSort = "RELEVANCE"
+	ProductSortRating    ProductSort = "RATING"
+)
+
+var AllProductSort = []ProductSort{
+	ProductSortRelevance,
+	ProductSortRating,
+}
+
+func (e ProductSort) IsValid() bool {
+	switch e {
+	case ProductSortRelevance, ProductSortRating:
+		return true
+	}
+	return false
+}
+
+func (e ProductSort) String() string {
+	return string(e)
+}
+
+func (e *ProductSort) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProductSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductSort", str)
+	}
+	return nil
+}
+
+func (e ProductSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PromotionKind string
+
+const (
+	PromotionKindPercentage  PromotionKind = "PERCENTAGE"
+	PromotionKindFixedAmount PromotionKind = "FIXED_AMOUNT"
+	PromotionKindBuyXGetY    PromotionKind = "BUY_X_GET_Y"
+)
+
+var AllPromotionKind = []PromotionKind{
+	PromotionKindPercentage,
+	PromotionKindFixedAmount,
+	PromotionKindBuyXGetY,
+}
+
+func (e PromotionKind) IsValid() bool {
+	switch e {
+	case PromotionKindPercentage, PromotionKindFixedAmount, PromotionKindBuyXGetY:
+		return true
+	}
+	return false
+}
+
+func (e PromotionKind) String() string {
+	return string(e)
+}
+
+func (e *PromotionKind) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PromotionKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PromotionKind", str)
+	}
+	return nil
+}
+
+func (e PromotionKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ReturnStatus string
+
+const (
+	ReturnStatusRequested ReturnStatus = "REQUESTED"
+	ReturnStatusApproved  ReturnStatus = "APPROVED"
+	ReturnStatusRejected  ReturnStatus = "REJECTED"
+	ReturnStatusReceived  ReturnStatus = "RECEIVED"
+	ReturnStatusRefunding ReturnStatus = "REFUNDING"
+	ReturnStatusRefunded  ReturnStatus = "REFUNDED"
+)
+
+var AllReturnStatus = []ReturnStatus{
+	ReturnStatusRequested,
+	ReturnStatusApproved,
+	ReturnStatusRejected,
+	ReturnStatusReceived,
+	ReturnStatusRefunding,
+	ReturnStatusRefunded,
+}
+
+func (e ReturnStatus) IsValid() bool {
+	switch e {
+	case ReturnStatusRequested, ReturnStatusApproved, ReturnStatusRejected, ReturnStatusReceived, ReturnStatusRefunding, ReturnStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (e ReturnStatus) String() string {
+	return string(e)
+}
+
+func (e *ReturnStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReturnStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReturnStatus", str)
+	}
+	return nil
+}
+
+func (e ReturnStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ReviewStatus string
+
+const (
+	ReviewStatusPending  ReviewStatus = "PENDING"
+	ReviewStatusApproved ReviewStatus = "APPROVED"
+	ReviewStatusRejected ReviewStatus = "REJECTED"
+)
+
+var AllReviewStatus = []ReviewStatus{
+	ReviewStatusPending,
+	ReviewStatusApproved,
+	ReviewStatusRejected,
+}
+
+func (e ReviewStatus) IsValid() bool {
+	switch e {
+	case ReviewStatusPending, ReviewStatusApproved, ReviewStatusRejected:
+		return true
+	}
+	return false
+}
+
+func (e ReviewStatus) String() string {
+	return string(e)
+}
+
+func (e *ReviewStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReviewStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReviewStatus", str)
+	}
+	return nil
+}
+
+func (e ReviewStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
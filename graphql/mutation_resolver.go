@@ -4,12 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"strings"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/donaldnash/go-marketplace/account"
 	"github.com/donaldnash/go-marketplace/catalog"
 	"github.com/donaldnash/go-marketplace/order"
+	"github.com/donaldnash/go-marketplace/promotion"
+	"github.com/donaldnash/go-marketplace/review"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 var (
@@ -17,13 +23,14 @@ var (
 	ErrInvalidContext   = errors.New("invalid context")
 	ErrNotFound         = errors.New("not found")
 	ErrAlreadyExists    = errors.New("already exists")
+	ErrConflict         = errors.New("conflict")
 )
 
 type mutationResolver struct {
 	server *Server
 }
 
-func (r *mutationResolver) CreateAccount(ctx context.Context, in AccountInput) (*Account, error) {
+func (r *mutationResolver) CreateAccount(ctx context.Context, in AccountInput, idempotencyKey *string) (*Account, error) {
 	if ctx == nil {
 		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
 	}
@@ -35,9 +42,15 @@ func (r *mutationResolver) CreateAccount(ctx context.Context, in AccountInput) (
 		return nil, fmt.Errorf("%w: name is required", ErrInvalidParameter)
 	}
 
-	acc, err := r.server.accountClient.PostAccount(ctx, in.Name)
+	// Keys are scoped to the caller's account; anonymous callers share one
+	// scope.
+	caller, _ := principalFromContext(ctx)
+	acc, err := r.server.accountClient.PostAccount(ctx, in.Name, caller.AccountID, stringValue(idempotencyKey))
 	if err != nil {
 		log.Printf("Error creating account: %v", err)
+		if strings.Contains(err.Error(), "idempotency key") {
+			return nil, fmt.Errorf("%w: %s", ErrConflict, idempotencyMessage(err))
+		}
 		if strings.Contains(err.Error(), "already exists") {
 			return nil, fmt.Errorf("%w: an account with this name already exists", ErrAlreadyExists)
 		}
@@ -54,7 +67,7 @@ func (r *mutationResolver) CreateAccount(ctx context.Context, in AccountInput) (
 	}, nil
 }
 
-func (r *mutationResolver) CreateProduct(ctx context.Context, in ProductInput) (*Product, error) {
+func (r *mutationResolver) CreateProduct(ctx context.Context, in ProductInput, idempotencyKey *string) (*Product, error) {
 	if ctx == nil {
 		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
 	}
@@ -62,22 +75,39 @@ func (r *mutationResolver) CreateProduct(ctx context.Context, in ProductInput) (
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	if in.Name == "" {
-		return nil, fmt.Errorf("%w: name is required", ErrInvalidParameter)
-	}
-	if in.Description == "" {
-		return nil, fmt.Errorf("%w: description is required", ErrInvalidParameter)
+	product, err := productFromInput(in)
+	if err != nil {
+		return nil, err
 	}
-	if in.Price < 0 {
-		return nil, fmt.Errorf("%w: price cannot be negative", ErrInvalidParameter)
+	if in.SellerID != nil {
+		if *in.SellerID == "" {
+			return nil, fmt.Errorf("%w: sellerId cannot be empty when provided", ErrInvalidParameter)
+		}
+		if err := r.server.authorizeAccount(ctx, *in.SellerID); err != nil {
+			return nil, err
+		}
+		if _, err := r.server.accountClient.GetSeller(ctx, *in.SellerID); err != nil {
+			log.Printf("Error fetching seller %s: %v", *in.SellerID, err)
+			if strings.Contains(err.Error(), account.ErrSellerNotFound.Error()) {
+				return nil, fmt.Errorf("%w: seller with ID %s does not exist", ErrNotFound, *in.SellerID)
+			}
+			return nil, fmt.Errorf("failed to fetch seller: %v", err)
+		}
+		product.SellerID = *in.SellerID
 	}
 
-	p, err := r.server.catalogClient.PostProduct(ctx, in.Name, in.Description, in.Price)
+	p, err := r.server.catalogClient.PostProduct(ctx, product, stringValue(idempotencyKey))
 	if err != nil {
 		log.Printf("Error creating product: %v", err)
+		if strings.Contains(err.Error(), "idempotency key") {
+			return nil, fmt.Errorf("%w: %s", ErrConflict, idempotencyMessage(err))
+		}
 		if strings.Contains(err.Error(), "already exists") {
 			return nil, fmt.Errorf("%w: a product with this name already exists", ErrAlreadyExists)
 		}
+		if strings.Contains(err.Error(), catalog.ErrInvalidVariants.Error()) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidParameter, rpcMessage(err))
+		}
 		return nil, fmt.Errorf("failed to create product: %v", err)
 	}
 
@@ -85,15 +115,10 @@ func (r *mutationResolver) CreateProduct(ctx context.Context, in ProductInput) (
 		return nil, fmt.Errorf("unexpected error: product creation succeeded but returned nil")
 	}
 
-	return &Product{
-		ID:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}, nil
+	return newProduct(*p), nil
 }
 
-func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput) (*Order, error) {
+func (r *mutationResolver) UpdateProduct(ctx context.Context, id string, in ProductInput) (*Product, error) {
 	if ctx == nil {
 		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
 	}
@@ -101,74 +126,157 @@ func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput) (*Ord
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	if in.AccountID == "" {
-		return nil, fmt.Errorf("%w: accountId is required", ErrInvalidParameter)
+	if id == "" {
+		return nil, fmt.Errorf("%w: id is required", ErrInvalidParameter)
 	}
 
-	if len(in.Products) == 0 {
-		return nil, fmt.Errorf("%w: order must contain at least one product", ErrInvalidParameter)
+	product, err := productFromInput(in)
+	if err != nil {
+		return nil, err
 	}
-
-	if len(in.Products) > 100 {
-		return nil, fmt.Errorf("%w: order cannot contain more than 100 products", ErrInvalidParameter)
+	product.ID = id
+	if err := r.authorizeProductSeller(ctx, id); err != nil {
+		return nil, err
 	}
 
-	// Filter out products with quantity <= 0
-	var validProducts []order.OrderedProduct
-	for i, p := range in.Products {
-		if p == nil {
-			return nil, fmt.Errorf("%w: product at index %d is nil", ErrInvalidParameter, i)
+	p, err := r.server.catalogClient.UpdateProduct(ctx, product)
+	if err != nil {
+		log.Printf("Error updating product %s: %v", id, err)
+		if strings.Contains(err.Error(), catalog.ErrNotFound.Error()) {
+			return nil, fmt.Errorf("%w: product does not exist", ErrNotFound)
 		}
-		if p.ID == "" {
-			return nil, fmt.Errorf("%w: product ID is required at index %d", ErrInvalidParameter, i)
+		if strings.Contains(err.Error(), catalog.ErrInvalidVariants.Error()) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidParameter, rpcMessage(err))
 		}
-		if p.Quantity > 0 {
-			validProducts = append(validProducts, order.OrderedProduct{
-				ID:       p.ID,
-				Quantity: uint32(p.Quantity),
-			})
+		return nil, fmt.Errorf("failed to update product: %v", err)
+	}
+	return newProduct(*p), nil
+}
+
+func (r *mutationResolver) DeleteProduct(ctx context.Context, id string) (bool, error) {
+	if ctx == nil {
+		return false, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if id == "" {
+		return false, fmt.Errorf("%w: id is required", ErrInvalidParameter)
+	}
+	if err := r.authorizeProductSeller(ctx, id); err != nil {
+		return false, err
+	}
+
+	if err := r.server.catalogClient.DeleteProduct(ctx, id); err != nil {
+		log.Printf("Error deleting product %s: %v", id, err)
+		return false, productImageError(err, "failed to delete product")
+	}
+	return true, nil
+}
+
+func (r *mutationResolver) AddProductImage(ctx context.Context, productID string, file graphql.Upload, alt *string, position *int) (*Product, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	// Uploads to object storage take longer than other writes.
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if productID == "" {
+		return nil, fmt.Errorf("%w: productId is required", ErrInvalidParameter)
+	}
+	at := -1
+	if position != nil {
+		if *position < 0 {
+			return nil, fmt.Errorf("%w: position cannot be negative", ErrInvalidParameter)
 		}
+		at = *position
+	}
+	if err := r.authorizeProductSeller(ctx, productID); err != nil {
+		return nil, err
 	}
 
-	// Check if there are any valid products after filtering
-	if len(validProducts) == 0 {
-		return nil, fmt.Errorf("%w: order must contain at least one product with quantity greater than 0", ErrInvalidParameter)
+	data, err := io.ReadAll(io.LimitReader(file.File, catalog.MaxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %v", err)
+	}
+	if len(data) > catalog.MaxImageSize {
+		return nil, fmt.Errorf("%w: image is larger than %d bytes", ErrInvalidParameter, catalog.MaxImageSize)
 	}
 
-	// Get product details from catalog service
-	productIDs := make([]string, len(validProducts))
-	for i, p := range validProducts {
-		productIDs[i] = p.ID
+	p, err := r.server.catalogClient.AddProductImage(ctx, productID, data, stringValue(alt), at)
+	if err != nil {
+		log.Printf("Error adding image to product %s: %v", productID, err)
+		return nil, productImageError(err, "failed to add image")
 	}
+	return newProduct(*p), nil
+}
 
-	catalogProducts, err := r.server.catalogClient.GetProducts(ctx, 0, 0, productIDs, "")
+func (r *mutationResolver) RemoveProductImage(ctx context.Context, productID string, imageID string) (*Product, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if productID == "" || imageID == "" {
+		return nil, fmt.Errorf("%w: productId and imageId are required", ErrInvalidParameter)
+	}
+	if err := r.authorizeProductSeller(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	p, err := r.server.catalogClient.RemoveProductImage(ctx, productID, imageID)
 	if err != nil {
-		log.Printf("Error getting product details: %v", err)
-		return nil, fmt.Errorf("failed to get product details: %v", err)
+		log.Printf("Error removing image %s of product %s: %v", imageID, productID, err)
+		return nil, productImageError(err, "failed to remove image")
 	}
+	return newProduct(*p), nil
+}
 
-	// Update product details
-	productMap := make(map[string]*catalog.Product)
-	for _, p := range catalogProducts {
-		productMap[p.ID] = &p
+func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput, idempotencyKey *string) (*Order, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
 	}
 
-	for i := range validProducts {
-		if p, ok := productMap[validProducts[i].ID]; ok {
-			validProducts[i].Name = p.Name
-			validProducts[i].Description = p.Description
-			validProducts[i].Price = p.Price
-		}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if err := r.server.authorizeAccount(ctx, in.AccountID); err != nil {
+		return nil, err
+	}
+	products, err := orderLines(in)
+	if err != nil {
+		return nil, err
 	}
 
-	o, err := r.server.orderClient.PostOrder(ctx, in.AccountID, validProducts)
+	res, err := r.server.orderClient.PostOrder(ctx, order.OrderRequest{
+		AccountID:         in.AccountID,
+		Products:          products,
+		CouponCode:        stringValue(in.CouponCode),
+		TaxLocation:       taxLocation(in),
+		ShippingAddressID: stringValue(in.ShippingAddressID),
+		ShippingMethod:    stringValue(in.ShippingMethod),
+		IdempotencyKey:    stringValue(idempotencyKey),
+	})
 	if err != nil {
 		log.Printf("Error creating order: %v", err)
 		switch {
-		case strings.Contains(err.Error(), "account with ID"):
+		case strings.Contains(err.Error(), "idempotency key"):
+			return nil, fmt.Errorf("%w: %s", ErrConflict, idempotencyMessage(err))
+		case strings.Contains(err.Error(), "account not found"):
 			return nil, fmt.Errorf("%w: account with ID %s does not exist", ErrNotFound, in.AccountID)
-		case strings.Contains(err.Error(), "one or more products in your order could not be found"):
-			return nil, fmt.Errorf("%w: one or more products in your order could not be found", ErrNotFound)
+		case strings.Contains(err.Error(), "coupon cannot be applied"):
+			return nil, fmt.Errorf("%w: %s", ErrInvalidParameter, couponMessage(err))
+		case isShippingError(err):
+			return nil, shippingError(err, in)
+		case strings.Contains(err.Error(), order.ErrOutOfStock.Error()):
+			return nil, fmt.Errorf("%w: %s", ErrConflict, rpcMessage(err))
+		case strings.Contains(err.Error(), order.ErrCatalogUnavailable.Error()):
+			return nil, fmt.Errorf("failed to create order: %s, try again later", rpcMessage(err))
 		case strings.Contains(err.Error(), "failed to create order"):
 			return nil, fmt.Errorf("failed to create order: %v", err)
 		default:
@@ -176,25 +284,982 @@ func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput) (*Ord
 		}
 	}
 
+	if len(res.RejectedLines) > 0 {
+		return nil, rejectedLinesError(res.RejectedLines)
+	}
+
+	o := res.Order
 	if o == nil {
 		return nil, fmt.Errorf("unexpected error: order creation succeeded but returned nil")
 	}
 
-	op := make([]*OrderedProduct, len(o.Products))
-	for i, p := range o.Products {
-		op[i] = &OrderedProduct{
-			ID:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-			Quantity:    int(p.Quantity),
+	return newOrder(*o), nil
+}
+
+// ApplyCoupon prices the order with the coupon applied, without placing it.
+func (r *mutationResolver) ApplyCoupon(ctx context.Context, in OrderInput, couponCode string) (*OrderQuote, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if err := r.server.authorizeAccount(ctx, in.AccountID); err != nil {
+		return nil, err
+	}
+	if couponCode == "" {
+		return nil, fmt.Errorf("%w: coupon code is required", ErrInvalidParameter)
+	}
+
+	products, err := orderLines(in)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.server.orderClient.QuoteOrder(ctx, order.OrderRequest{
+		AccountID:         in.AccountID,
+		Products:          products,
+		CouponCode:        couponCode,
+		TaxLocation:       taxLocation(in),
+		ShippingAddressID: stringValue(in.ShippingAddressID),
+		ShippingMethod:    stringValue(in.ShippingMethod),
+	})
+	if err != nil {
+		log.Printf("Error applying coupon: %v", err)
+		switch {
+		case strings.Contains(err.Error(), "account not found"):
+			return nil, fmt.Errorf("%w: account with ID %s does not exist", ErrNotFound, in.AccountID)
+		case strings.Contains(err.Error(), "coupon cannot be applied"):
+			return nil, fmt.Errorf("%w: %s", ErrInvalidParameter, couponMessage(err))
+		case isShippingError(err):
+			return nil, shippingError(err, in)
+		case strings.Contains(err.Error(), order.ErrCatalogUnavailable.Error()):
+			return nil, fmt.Errorf("failed to apply coupon: %s, try again later", rpcMessage(err))
+		default:
+			return nil, fmt.Errorf("failed to apply coupon: %v", err)
+		}
+	}
+
+	if len(res.RejectedLines) > 0 {
+		return nil, rejectedLinesError(res.RejectedLines)
+	}
+
+	o := newOrder(*res.Order)
+	return &OrderQuote{
+		Subtotal:        o.Subtotal,
+		DiscountTotal:   o.DiscountTotal,
+		TaxTotal:        o.TaxTotal,
+		ShippingTotal:   o.ShippingTotal,
+		GrandTotal:      o.GrandTotal,
+		TotalPrice:      o.TotalPrice,
+		Products:        o.Products,
+		Discounts:       o.Discounts,
+		ShippingAddress: o.ShippingAddress,
+		ShippingMethod:  o.ShippingMethod,
+	}, nil
+}
+
+func (r *mutationResolver) CreatePromotion(ctx context.Context, in PromotionInput) (*Promotion, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	p, err := promotionFromInput(in)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.server.authorizeRole(ctx, roleAdmin); err != nil {
+		return nil, err
+	}
+
+	created, err := r.server.orderClient.PostPromotion(ctx, p)
+	if err != nil {
+		log.Printf("Error creating promotion: %v", err)
+		return nil, promotionError(err)
+	}
+	return newPromotion(*created), nil
+}
+
+func (r *mutationResolver) UpdatePromotion(ctx context.Context, id string, in PromotionInput) (*Promotion, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if id == "" {
+		return nil, fmt.Errorf("%w: id is required", ErrInvalidParameter)
+	}
+
+	p, err := promotionFromInput(in)
+	if err != nil {
+		return nil, err
+	}
+	p.ID = id
+	if err := r.server.authorizeRole(ctx, roleAdmin); err != nil {
+		return nil, err
+	}
+
+	updated, err := r.server.orderClient.UpdatePromotion(ctx, p)
+	if err != nil {
+		log.Printf("Error updating promotion %s: %v", id, err)
+		return nil, promotionError(err)
+	}
+	return newPromotion(*updated), nil
+}
+
+func (r *mutationResolver) DeletePromotion(ctx context.Context, id string) (bool, error) {
+	if ctx == nil {
+		return false, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if id == "" {
+		return false, fmt.Errorf("%w: id is required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeRole(ctx, roleAdmin); err != nil {
+		return false, err
+	}
+
+	if err := r.server.orderClient.DeletePromotion(ctx, id); err != nil {
+		log.Printf("Error deleting promotion %s: %v", id, err)
+		return false, promotionError(err)
+	}
+	return true, nil
+}
+
+// orderLines converts the requested lines without validating them; the order
+// service does that, so rejected lines can be reported back by their index.
+func orderLines(in OrderInput) ([]order.OrderedProduct, error) {
+	products := make([]order.OrderedProduct, len(in.Products))
+	for i, p := range in.Products {
+		if p == nil {
+			return nil, fmt.Errorf("%w: product at index %d is nil", ErrInvalidParameter, i)
+		}
+		if p.Quantity < 0 {
+			return nil, fmt.Errorf("%w: quantity cannot be negative at index %d", ErrInvalidParameter, i)
+		}
+		products[i] = order.OrderedProduct{
+			ID:        p.ID,
+			VariantID: stringValue(p.VariantID),
+			Quantity:  uint32(p.Quantity),
+		}
+	}
+	return products, nil
+}
+
+func (r *mutationResolver) PayOrder(ctx context.Context, accountID string, orderID string, paymentToken string) (*Payment, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if accountID == "" || orderID == "" {
+		return nil, fmt.Errorf("%w: accountId and orderId are required", ErrInvalidParameter)
+	}
+	if paymentToken == "" {
+		return nil, fmt.Errorf("%w: paymentToken is required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	p, err := r.server.orderClient.PayOrder(ctx, orderID, accountID, paymentToken)
+	if err != nil {
+		log.Printf("Error paying order %s: %v", orderID, err)
+		switch {
+		case strings.Contains(err.Error(), order.ErrOrderNotFound.Error()):
+			return nil, fmt.Errorf("%w: order with ID %s does not exist for this account", ErrNotFound, orderID)
+		case strings.Contains(err.Error(), order.ErrOrderNotPayable.Error()),
+			strings.Contains(err.Error(), order.ErrPaymentInProgress.Error()):
+			return nil, fmt.Errorf("%w: %s", ErrConflict, rpcMessage(err))
+		case strings.Contains(err.Error(), order.ErrPaymentDeclined.Error()):
+			return nil, fmt.Errorf("%w: %s", ErrInvalidParameter, rpcMessage(err))
+		default:
+			return nil, fmt.Errorf("failed to pay order, please try again")
+		}
+	}
+	return newPayment(*p), nil
+}
+
+func (r *mutationResolver) CancelOrder(ctx context.Context, accountID string, orderID string) (*Order, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if accountID == "" || orderID == "" {
+		return nil, fmt.Errorf("%w: accountId and orderId are required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	o, err := r.server.orderClient.CancelOrder(ctx, orderID, accountID)
+	if err != nil {
+		log.Printf("Error cancelling order %s: %v", orderID, err)
+		switch {
+		case strings.Contains(err.Error(), order.ErrOrderNotFound.Error()):
+			return nil, fmt.Errorf("%w: order with ID %s does not exist for this account", ErrNotFound, orderID)
+		case strings.Contains(err.Error(), order.ErrOrderNotCancellable.Error()):
+			return nil, fmt.Errorf("%w: %s", ErrConflict, rpcMessage(err))
+		default:
+			return nil, fmt.Errorf("failed to cancel order, please try again")
+		}
+	}
+	return newOrder(*o), nil
+}
+
+func (r *mutationResolver) RequestReturn(ctx context.Context, in ReturnInput) (*Return, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if in.OrderID == "" || in.AccountID == "" {
+		return nil, fmt.Errorf("%w: orderId and accountId are required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, in.AccountID); err != nil {
+		return nil, err
+	}
+	lines := make([]order.ReturnLine, len(in.Lines))
+	for i, l := range in.Lines {
+		if l.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be positive at index %d", ErrInvalidParameter, i)
+		}
+		lines[i] = order.ReturnLine{
+			ProductID: l.ProductID,
+			VariantID: stringValue(l.VariantID),
+			Quantity:  uint32(l.Quantity),
+		}
+	}
+
+	ret, err := r.server.orderClient.RequestReturn(ctx, order.ReturnRequest{
+		OrderID:   in.OrderID,
+		AccountID: in.AccountID,
+		Reason:    stringValue(in.Reason),
+		Lines:     lines,
+	})
+	if err != nil {
+		log.Printf("Error requesting return for order %s: %v", in.OrderID, err)
+		return nil, returnError(err)
+	}
+	return newReturn(*ret), nil
+}
+
+func (r *mutationResolver) ApproveReturn(ctx context.Context, id string) (*Return, error) {
+	return r.updateReturn(ctx, id, func(ctx context.Context) (*order.Return, error) {
+		return r.server.orderClient.ApproveReturn(ctx, id)
+	})
+}
+
+func (r *mutationResolver) RejectReturn(ctx context.Context, id string, reason string) (*Return, error) {
+	if reason == "" {
+		return nil, fmt.Errorf("%w: reason is required", ErrInvalidParameter)
+	}
+	return r.updateReturn(ctx, id, func(ctx context.Context) (*order.Return, error) {
+		return r.server.orderClient.RejectReturn(ctx, id, reason)
+	})
+}
+
+func (r *mutationResolver) ReceiveReturn(ctx context.Context, id string) (*Return, error) {
+	return r.updateReturn(ctx, id, func(ctx context.Context) (*order.Return, error) {
+		return r.server.orderClient.ReceiveReturn(ctx, id)
+	})
+}
+
+func (r *mutationResolver) RefundReturn(ctx context.Context, id string, amount *float64) (*Return, error) {
+	if amount != nil && *amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidParameter)
+	}
+	return r.updateReturn(ctx, id, func(ctx context.Context) (*order.Return, error) {
+		return r.server.orderClient.RefundReturn(ctx, id, floatValue(amount))
+	})
+}
+
+func (r *mutationResolver) updateReturn(ctx context.Context, id string, update func(ctx context.Context) (*order.Return, error)) (*Return, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if id == "" {
+		return nil, fmt.Errorf("%w: id is required", ErrInvalidParameter)
+	}
+	// Only staff move returns along; customers just request them.
+	if err := r.server.authorizeRole(ctx, roleAdmin); err != nil {
+		return nil, err
+	}
+
+	ret, err := update(ctx)
+	if err != nil {
+		log.Printf("Error updating return %s: %v", id, err)
+		return nil, returnError(err)
+	}
+	return newReturn(*ret), nil
+}
+
+func returnError(err error) error {
+	switch {
+	case strings.Contains(err.Error(), order.ErrOrderNotFound.Error()):
+		return fmt.Errorf("%w: order does not exist for this account", ErrNotFound)
+	case strings.Contains(err.Error(), order.ErrReturnNotFound.Error()):
+		return fmt.Errorf("%w: return does not exist", ErrNotFound)
+	case strings.Contains(err.Error(), order.ErrReturnStatus.Error()):
+		return fmt.Errorf("%w: %s", ErrConflict, rpcMessage(err))
+	case strings.Contains(err.Error(), order.ErrInvalidReturn.Error()),
+		strings.Contains(err.Error(), order.ErrInvalidRefund.Error()):
+		return fmt.Errorf("%w: %s", ErrInvalidParameter, rpcMessage(err))
+	}
+	return fmt.Errorf("failed to process return, please try again")
+}
+
+func (r *mutationResolver) RegisterSeller(ctx context.Context, accountID string, name string) (*Seller, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if accountID == "" {
+		return nil, fmt.Errorf("%w: accountId is required", ErrInvalidParameter)
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	seller, err := r.server.accountClient.PostSeller(ctx, accountID, name)
+	if err != nil {
+		log.Printf("Error registering seller %s: %v", accountID, err)
+		switch {
+		case strings.Contains(err.Error(), account.ErrSellerExists.Error()):
+			return nil, fmt.Errorf("%w: account %s is already a seller", ErrAlreadyExists, accountID)
+		case strings.Contains(err.Error(), account.ErrSellerNameTaken.Error()):
+			return nil, fmt.Errorf("%w: a seller with this name already exists", ErrAlreadyExists)
+		case strings.Contains(err.Error(), "not found"):
+			return nil, fmt.Errorf("%w: account with ID %s does not exist", ErrNotFound, accountID)
+		}
+		return nil, fmt.Errorf("failed to register seller: %v", err)
+	}
+	return newSeller(*seller), nil
+}
+
+func (r *mutationResolver) PostReview(ctx context.Context, in ReviewInput) (*Review, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if in.AccountID == "" {
+		return nil, fmt.Errorf("%w: accountId is required", ErrInvalidParameter)
+	}
+	if in.ProductID == "" {
+		return nil, fmt.Errorf("%w: productId is required", ErrInvalidParameter)
+	}
+	if in.Rating < 1 || in.Rating > catalog.MaxRating {
+		return nil, fmt.Errorf("%w: rating must be between 1 and %d", ErrInvalidParameter, catalog.MaxRating)
+	}
+	if err := r.server.authorizeAccount(ctx, in.AccountID); err != nil {
+		return nil, err
+	}
+
+	rv, err := r.server.reviewClient.PostReview(ctx, review.Review{
+		AccountID: in.AccountID,
+		ProductID: in.ProductID,
+		Rating:    in.Rating,
+		Title:     in.Title,
+		Body:      stringValue(in.Body),
+	})
+	if err != nil {
+		log.Printf("Error posting review of product %s by %s: %v", in.ProductID, in.AccountID, err)
+		return nil, reviewError(err, "failed to post review")
+	}
+	return newReview(*rv), nil
+}
+
+func (r *mutationResolver) ModerateReview(ctx context.Context, id string, status ReviewStatus, note *string) (*Review, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if id == "" {
+		return nil, fmt.Errorf("%w: id is required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeRole(ctx, roleModerator); err != nil {
+		return nil, err
+	}
+
+	rv, err := r.server.reviewClient.ModerateReview(ctx, id, review.Status(status), stringValue(note))
+	if err != nil {
+		log.Printf("Error moderating review %s: %v", id, err)
+		return nil, reviewError(err, "failed to moderate review")
+	}
+	return newReview(*rv), nil
+}
+
+func (r *mutationResolver) VoteReviewHelpful(ctx context.Context, reviewID string, accountID string) (*Review, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if reviewID == "" {
+		return nil, fmt.Errorf("%w: reviewId is required", ErrInvalidParameter)
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("%w: accountId is required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	rv, err := r.server.reviewClient.VoteHelpful(ctx, reviewID, accountID)
+	if err != nil {
+		log.Printf("Error voting for review %s by %s: %v", reviewID, accountID, err)
+		return nil, reviewError(err, "failed to vote for review")
+	}
+	return newReview(*rv), nil
+}
+
+func reviewError(err error, message string) error {
+	switch {
+	case strings.Contains(err.Error(), review.ErrReviewNotFound.Error()):
+		return fmt.Errorf("%w: review does not exist", ErrNotFound)
+	case strings.Contains(err.Error(), review.ErrNotPurchased.Error()),
+		strings.Contains(err.Error(), review.ErrOwnReview.Error()):
+		return fmt.Errorf("%w: %s", ErrForbidden, rpcMessage(err))
+	case strings.Contains(err.Error(), review.ErrAlreadyReviewed.Error()):
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, rpcMessage(err))
+	case strings.Contains(err.Error(), review.ErrNotApproved.Error()):
+		return fmt.Errorf("%w: %s", ErrConflict, rpcMessage(err))
+	case strings.Contains(err.Error(), review.ErrInvalidReview.Error()):
+		return fmt.Errorf("%w: %s", ErrInvalidParameter, rpcMessage(err))
+	}
+	return fmt.Errorf("%s: %v", message, err)
+}
+
+func (r *mutationResolver) CreateWishlist(ctx context.Context, accountID string, name string) (*Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if accountID == "" {
+		return nil, fmt.Errorf("%w: accountId is required", ErrInvalidParameter)
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	w, err := r.server.accountClient.CreateWishlist(ctx, accountID, name)
+	if err != nil {
+		log.Printf("Error creating wishlist for account %s: %v", accountID, err)
+		return nil, wishlistError(err, accountID)
+	}
+	return r.server.newWishlist(ctx, *w)
+}
+
+func (r *mutationResolver) DeleteWishlist(ctx context.Context, accountID string, id string) (bool, error) {
+	if ctx == nil {
+		return false, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if accountID == "" {
+		return false, fmt.Errorf("%w: accountId is required", ErrInvalidParameter)
+	}
+	if id == "" {
+		return false, fmt.Errorf("%w: id is required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return false, err
+	}
+
+	if err := r.server.accountClient.DeleteWishlist(ctx, accountID, id); err != nil {
+		log.Printf("Error deleting wishlist %s: %v", id, err)
+		return false, wishlistError(err, accountID)
+	}
+	return true, nil
+}
+
+func (r *mutationResolver) AddToWishlist(ctx context.Context, accountID string, wishlistID string, productID string, variantID *string) (*Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if accountID == "" {
+		return nil, fmt.Errorf("%w: accountId is required", ErrInvalidParameter)
+	}
+	if wishlistID == "" {
+		return nil, fmt.Errorf("%w: wishlistId is required", ErrInvalidParameter)
+	}
+	if productID == "" {
+		return nil, fmt.Errorf("%w: productId is required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	// The price is saved as it is now, so that later drops can be told.
+	p, err := r.server.catalogClient.GetProduct(ctx, productID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, fmt.Errorf("%w: product with ID %s does not exist", ErrNotFound, productID)
 		}
+		log.Printf("Error fetching product %s: %v", productID, err)
+		return nil, fmt.Errorf("failed to fetch product: %v", err)
+	}
+	price, ok := wishlistPrice(*p, stringValue(variantID))
+	if !ok {
+		return nil, fmt.Errorf("%w: product %s has no variant with ID %s", ErrNotFound, productID, stringValue(variantID))
+	}
+
+	w, err := r.server.accountClient.AddWishlistItem(ctx, accountID, wishlistID, account.WishlistItem{
+		ProductID:  productID,
+		VariantID:  stringValue(variantID),
+		SavedPrice: price,
+	})
+	if err != nil {
+		log.Printf("Error adding product %s to wishlist %s: %v", productID, wishlistID, err)
+		return nil, wishlistError(err, accountID)
+	}
+	return r.server.newWishlist(ctx, *w)
+}
+
+func (r *mutationResolver) RemoveFromWishlist(ctx context.Context, accountID string, wishlistID string, productID string, variantID *string) (*Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if accountID == "" {
+		return nil, fmt.Errorf("%w: accountId is required", ErrInvalidParameter)
+	}
+	if wishlistID == "" {
+		return nil, fmt.Errorf("%w: wishlistId is required", ErrInvalidParameter)
+	}
+	if productID == "" {
+		return nil, fmt.Errorf("%w: productId is required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
 	}
 
-	return &Order{
-		ID:         o.ID,
-		CreatedAt:  o.CreatedAt,
-		TotalPrice: o.TotalPrice,
-		Products:   op,
+	w, err := r.server.accountClient.RemoveWishlistItem(ctx, accountID, wishlistID, productID, stringValue(variantID))
+	if err != nil {
+		log.Printf("Error removing product %s from wishlist %s: %v", productID, wishlistID, err)
+		return nil, wishlistError(err, accountID)
+	}
+	return r.server.newWishlist(ctx, *w)
+}
+
+func (r *mutationResolver) ShareWishlist(ctx context.Context, accountID string, id string, shared bool) (*Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if accountID == "" {
+		return nil, fmt.Errorf("%w: accountId is required", ErrInvalidParameter)
+	}
+	if id == "" {
+		return nil, fmt.Errorf("%w: id is required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	w, err := r.server.accountClient.ShareWishlist(ctx, accountID, id, shared)
+	if err != nil {
+		log.Printf("Error sharing wishlist %s: %v", id, err)
+		return nil, wishlistError(err, accountID)
+	}
+	return r.server.newWishlist(ctx, *w)
+}
+
+func (r *mutationResolver) CreateAddress(ctx context.Context, accountID string, in AddressInput) (*Address, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	a, err := addressFromInput(accountID, in)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	created, err := r.server.accountClient.PostAddress(ctx, a)
+	if err != nil {
+		log.Printf("Error creating address for account %s: %v", accountID, err)
+		return nil, addressError(err, accountID)
+	}
+	return newAddress(*created), nil
+}
+
+func (r *mutationResolver) UpdateAddress(ctx context.Context, accountID string, id string, in AddressInput) (*Address, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if id == "" {
+		return nil, fmt.Errorf("%w: id is required", ErrInvalidParameter)
+	}
+
+	a, err := addressFromInput(accountID, in)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+	a.ID = id
+
+	updated, err := r.server.accountClient.UpdateAddress(ctx, a)
+	if err != nil {
+		log.Printf("Error updating address %s: %v", id, err)
+		return nil, addressError(err, accountID)
+	}
+	return newAddress(*updated), nil
+}
+
+func (r *mutationResolver) DeleteAddress(ctx context.Context, accountID string, id string) (bool, error) {
+	if ctx == nil {
+		return false, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if accountID == "" {
+		return false, fmt.Errorf("%w: accountId is required", ErrInvalidParameter)
+	}
+	if id == "" {
+		return false, fmt.Errorf("%w: id is required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return false, err
+	}
+
+	if err := r.server.accountClient.DeleteAddress(ctx, accountID, id); err != nil {
+		log.Printf("Error deleting address %s: %v", id, err)
+		return false, addressError(err, accountID)
+	}
+	return true, nil
+}
+
+func productFromInput(in ProductInput) (catalog.Product, error) {
+	if in.Name == "" {
+		return catalog.Product{}, fmt.Errorf("%w: name is required", ErrInvalidParameter)
+	}
+	if in.Description == "" {
+		return catalog.Product{}, fmt.Errorf("%w: description is required", ErrInvalidParameter)
+	}
+	if in.Price < 0 {
+		return catalog.Product{}, fmt.Errorf("%w: price cannot be negative", ErrInvalidParameter)
+	}
+	if in.Weight != nil && *in.Weight < 0 {
+		return catalog.Product{}, fmt.Errorf("%w: weight cannot be negative", ErrInvalidParameter)
+	}
+	options := make([]catalog.Option, len(in.Options))
+	for i, o := range in.Options {
+		if o == nil {
+			return catalog.Product{}, fmt.Errorf("%w: option at index %d is nil", ErrInvalidParameter, i)
+		}
+		options[i] = catalog.Option{Name: o.Name, Values: o.Values}
+	}
+	variants := make([]catalog.Variant, len(in.Variants))
+	for i, v := range in.Variants {
+		if v == nil {
+			return catalog.Product{}, fmt.Errorf("%w: variant at index %d is nil", ErrInvalidParameter, i)
+		}
+		attributes := make([]catalog.Attribute, 0, len(v.Attributes))
+		for _, a := range v.Attributes {
+			if a != nil {
+				attributes = append(attributes, catalog.Attribute{Name: a.Name, Value: a.Value})
+			}
+		}
+		variants[i] = catalog.Variant{
+			ID:         stringValue(v.ID),
+			SKU:        v.Sku,
+			Price:      floatValue(v.Price),
+			Stock:      v.Stock,
+			Attributes: attributes,
+		}
+	}
+	return catalog.Product{
+		Name:        in.Name,
+		Description: in.Description,
+		Price:       in.Price,
+		TaxCategory: stringValue(in.TaxCategory),
+		Category:    stringValue(in.Category),
+		Weight:      floatValue(in.Weight),
+		Options:     options,
+		Variants:    variants,
+	}, nil
+}
+
+func addressFromInput(accountID string, in AddressInput) (account.Address, error) {
+	if accountID == "" {
+		return account.Address{}, fmt.Errorf("%w: accountId is required", ErrInvalidParameter)
+	}
+	if in.Name == "" || in.Line1 == "" || in.City == "" || in.Country == "" {
+		return account.Address{}, fmt.Errorf("%w: name, line1, city and country are required", ErrInvalidParameter)
+	}
+	return account.Address{
+		AccountID:  accountID,
+		Name:       in.Name,
+		Line1:      in.Line1,
+		Line2:      stringValue(in.Line2),
+		City:       in.City,
+		Region:     stringValue(in.Region),
+		PostalCode: stringValue(in.PostalCode),
+		Country:    in.Country,
 	}, nil
 }
+
+func addressError(err error, accountID string) error {
+	switch {
+	case strings.Contains(err.Error(), "address not found"):
+		return fmt.Errorf("%w: address does not exist", ErrNotFound)
+	case strings.Contains(err.Error(), "not found"):
+		return fmt.Errorf("%w: account with ID %s does not exist", ErrNotFound, accountID)
+	case strings.Contains(err.Error(), "failed to"):
+		return fmt.Errorf("failed to save address: %v", err)
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidParameter, rpcMessage(err))
+}
+
+func isShippingError(err error) bool {
+	for _, msg := range []string{
+		order.ErrShippingAddressNotFound.Error(),
+		order.ErrShippingAddressRequired.Error(),
+		order.ErrUnknownShippingMethod.Error(),
+	} {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func shippingError(err error, in OrderInput) error {
+	if strings.Contains(err.Error(), order.ErrShippingAddressNotFound.Error()) {
+		return fmt.Errorf("%w: address with ID %s does not exist for this account", ErrNotFound, stringValue(in.ShippingAddressID))
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidParameter, rpcMessage(err))
+}
+
+func taxLocation(in OrderInput) order.TaxLocation {
+	return order.TaxLocation{
+		Country: stringValue(in.Country),
+		Region:  stringValue(in.Region),
+	}
+}
+
+func promotionFromInput(in PromotionInput) (promotion.Promotion, error) {
+	if in.Code == "" {
+		return promotion.Promotion{}, fmt.Errorf("%w: code is required", ErrInvalidParameter)
+	}
+	if !in.Kind.IsValid() {
+		return promotion.Promotion{}, fmt.Errorf("%w: unknown promotion kind %s", ErrInvalidParameter, in.Kind)
+	}
+
+	p := promotion.Promotion{
+		Code:        in.Code,
+		Description: stringValue(in.Description),
+		Kind:        promotion.Kind(in.Kind),
+		ProductIDs:  in.ProductIds,
+		Active:      true,
+	}
+	if in.Value != nil {
+		p.Value = *in.Value
+	}
+	if in.MinSpend != nil {
+		p.MinSpend = *in.MinSpend
+	}
+	for _, q := range []struct {
+		name  string
+		value *int
+		dest  *uint32
+	}{
+		{"buyQuantity", in.BuyQuantity, &p.BuyQuantity},
+		{"getQuantity", in.GetQuantity, &p.GetQuantity},
+		{"usageLimitPerAccount", in.UsageLimitPerAccount, &p.UsageLimitPerAccount},
+	} {
+		if q.value == nil {
+			continue
+		}
+		if *q.value < 0 {
+			return promotion.Promotion{}, fmt.Errorf("%w: %s cannot be negative", ErrInvalidParameter, q.name)
+		}
+		*q.dest = uint32(*q.value)
+	}
+	if in.ValidFrom != nil {
+		p.ValidFrom = in.ValidFrom.UTC()
+	}
+	if in.ValidUntil != nil {
+		p.ValidUntil = in.ValidUntil.UTC()
+	}
+	if in.Active != nil {
+		p.Active = *in.Active
+	}
+	return p, nil
+}
+
+func promotionError(err error) error {
+	switch {
+	case strings.Contains(err.Error(), "promotion not found"):
+		return fmt.Errorf("%w: promotion does not exist", ErrNotFound)
+	case strings.Contains(err.Error(), "already in use"):
+		return fmt.Errorf("%w: a promotion with this code already exists", ErrAlreadyExists)
+	case strings.Contains(err.Error(), "failed to"):
+		return fmt.Errorf("failed to save promotion: %v", err)
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidParameter, rpcMessage(err))
+}
+
+// couponMessage extracts why the order service refused a coupon.
+func couponMessage(err error) string {
+	msg := err.Error()
+	if i := strings.Index(msg, "coupon cannot be applied"); i >= 0 {
+		return msg[i:]
+	}
+	return msg
+}
+
+// rpcMessage strips the gRPC status prefix from an error message.
+func rpcMessage(err error) string {
+	msg := err.Error()
+	if i := strings.Index(msg, "desc = "); i >= 0 {
+		return msg[i+len("desc = "):]
+	}
+	return msg
+}
+
+// authorizeProductSeller checks that the request may edit the product with
+// id: only its seller may, if it has one.
+func (r *mutationResolver) authorizeProductSeller(ctx context.Context, id string) error {
+	if r.server.auth == nil {
+		return nil
+	}
+	p, err := r.server.catalogClient.GetProduct(ctx, id)
+	if err != nil {
+		log.Printf("Error fetching product %s: %v", id, err)
+		if strings.Contains(err.Error(), catalog.ErrNotFound.Error()) {
+			return fmt.Errorf("%w: product does not exist", ErrNotFound)
+		}
+		return fmt.Errorf("failed to fetch product: %v", err)
+	}
+	if p.SellerID == "" {
+		return nil
+	}
+	return r.server.authorizeAccount(ctx, p.SellerID)
+}
+
+// productImageError maps the errors of the catalog's product image and
+// deletion calls to the gateway's.
+func productImageError(err error, message string) error {
+	switch {
+	case strings.Contains(err.Error(), catalog.ErrImageNotFound.Error()):
+		return fmt.Errorf("%w: image does not exist", ErrNotFound)
+	case strings.Contains(err.Error(), catalog.ErrNotFound.Error()):
+		return fmt.Errorf("%w: product does not exist", ErrNotFound)
+	case strings.Contains(err.Error(), catalog.ErrTooManyImages.Error()),
+		strings.Contains(err.Error(), "desc = image "):
+		return fmt.Errorf("%w: %s", ErrInvalidParameter, rpcMessage(err))
+	}
+	return fmt.Errorf("%s: %v", message, err)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func floatValue(f *float64) float64 {
+	if f == nil {
+		return 0
+	}
+	return *f
+}
+
+// idempotencyMessage turns an idempotency error from a backend service into
+// a message fit for clients.
+func idempotencyMessage(err error) string {
+	if strings.Contains(err.Error(), "in progress") {
+		return "a request with this idempotency key is still in progress"
+	}
+	return "idempotency key was already used with a different request"
+}
+
+// rejectedLinesError reports the order lines the order service refused, with
+// the index, product and reason of each line in the error's extensions.
+func rejectedLinesError(lines []order.RejectedLine) error {
+	rejected := make([]map[string]interface{}, len(lines))
+	for i, l := range lines {
+		rejected[i] = map[string]interface{}{
+			"index":     l.Index,
+			"productId": l.ProductID,
+			"variantId": l.VariantID,
+			"quantity":  l.Quantity,
+			"reason":    string(l.Reason),
+		}
+	}
+	return &gqlerror.Error{
+		Message: fmt.Sprintf("%d order line(s) were rejected; no order was placed", len(lines)),
+		Extensions: map[string]interface{}{
+			"code":          "ORDER_LINES_REJECTED",
+			"rejectedLines": rejected,
+		},
+	}
+}
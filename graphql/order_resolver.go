@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+type orderResolver struct {
+	server *Server
+}
+
+func (r *orderResolver) Returns(ctx context.Context, obj *Order) ([]*Return, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("order object is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	returnList, err := r.server.orderClient.GetReturnsForOrder(ctx, obj.ID)
+	if err != nil {
+		log.Printf("Error fetching returns for order %s: %v", obj.ID, err)
+		return nil, fmt.Errorf("failed to fetch returns for order: %v", err)
+	}
+
+	returns := make([]*Return, len(returnList))
+	for i, ret := range returnList {
+		returns[i] = newReturn(ret)
+	}
+	return returns, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+type orderedProductResolver struct {
+	server *Server
+}
+
+func (r *orderedProductResolver) CurrentProduct(ctx context.Context, obj *OrderedProduct) (*Product, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("ordered product object is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	p, err := r.server.catalogClient.GetProduct(ctx, obj.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+		log.Printf("Error fetching current product %s: %v", obj.ID, err)
+		return nil, fmt.Errorf("failed to fetch current product: %v", err)
+	}
+
+	return newProduct(*p), nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+type productResolver struct {
+	server *Server
+}
+
+func (r *productResolver) Reviews(ctx context.Context, obj *Product, pagination *PaginationInput) ([]*Review, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("product object is required")
+	}
+	skip, take, err := pageBounds(pagination)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	reviews, err := r.server.reviewClient.GetProductReviews(ctx, obj.ID, skip, take)
+	if err != nil {
+		log.Printf("Error fetching reviews of product %s: %v", obj.ID, err)
+		return nil, fmt.Errorf("failed to fetch reviews: %v", err)
+	}
+	return newReviews(reviews), nil
+}
@@ -6,6 +6,10 @@ import (
 	"log"
 	"strings"
 	"time"
+
+	"github.com/donaldnash/go-marketplace/account"
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/review"
 )
 
 type queryResolver struct {
@@ -24,6 +28,9 @@ func (r *queryResolver) Accounts(ctx context.Context, pagination *PaginationInpu
 		if *id == "" {
 			return nil, fmt.Errorf("%w: id cannot be empty when provided", ErrInvalidParameter)
 		}
+		if err := r.server.authorizeAccount(ctx, *id); err != nil {
+			return nil, err
+		}
 
 		account, err := r.server.accountClient.GetAccount(ctx, *id)
 		if err != nil {
@@ -63,6 +70,10 @@ func (r *queryResolver) Accounts(ctx context.Context, pagination *PaginationInpu
 			take = uint64(*pagination.Take)
 		}
 	}
+	// Listing every account is for staff only.
+	if err := r.server.authorizeRole(ctx, roleAdmin); err != nil {
+		return nil, err
+	}
 
 	accountList, err := r.server.accountClient.GetAccounts(ctx, skip, take)
 	if err != nil {
@@ -87,7 +98,7 @@ func (r *queryResolver) Accounts(ctx context.Context, pagination *PaginationInpu
 	return accounts, nil
 }
 
-func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInput, query *string, id *string, ids []string) ([]*Product, error) {
+func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInput, query *string, id *string, ids []string, minRating *float64, sort *ProductSort) ([]*Product, error) {
 	if ctx == nil {
 		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
 	}
@@ -114,12 +125,7 @@ func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInpu
 			return []*Product{}, nil
 		}
 
-		return []*Product{{
-			ID:          product.ID,
-			Name:        product.Name,
-			Description: product.Description,
-			Price:       product.Price,
-		}}, nil
+		return []*Product{newProduct(*product)}, nil
 	}
 
 	// Handle multiple products lookup by IDs
@@ -149,12 +155,7 @@ func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInpu
 
 		result := make([]*Product, len(products))
 		for i, p := range products {
-			result[i] = &Product{
-				ID:          p.ID,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			}
+			result[i] = newProduct(p)
 		}
 		return result, nil
 	}
@@ -185,7 +186,22 @@ func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInpu
 		queryStr = *query
 	}
 
-	products, err := r.server.catalogClient.GetProducts(ctx, skip, take, nil, queryStr)
+	filter := catalog.ProductFilter{
+		Query:        queryStr,
+		MinRating:    floatValue(minRating),
+		SortByRating: sort != nil && *sort == ProductSortRating,
+	}
+	if filter.MinRating < 0 || filter.MinRating > catalog.MaxRating {
+		return nil, fmt.Errorf("%w: minRating must be between 0 and %d", ErrInvalidParameter, catalog.MaxRating)
+	}
+
+	var products []catalog.Product
+	var err error
+	if filter.MinRating > 0 || filter.SortByRating {
+		products, err = r.server.catalogClient.FilterProducts(ctx, filter, skip, take)
+	} else {
+		products, err = r.server.catalogClient.GetProducts(ctx, skip, take, nil, queryStr)
+	}
 	if err != nil {
 		log.Printf("Error fetching products: %v", err)
 		if strings.Contains(err.Error(), "not found") {
@@ -200,16 +216,187 @@ func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInpu
 
 	result := make([]*Product, len(products))
 	for i, p := range products {
-		result[i] = &Product{
-			ID:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		}
+		result[i] = newProduct(p)
 	}
 	return result, nil
 }
 
+func (r *queryResolver) Promotions(ctx context.Context, pagination *PaginationInput, id *string) ([]*Promotion, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if err := r.server.authorizeRole(ctx, roleAdmin); err != nil {
+		return nil, err
+	}
+
+	if id != nil {
+		if *id == "" {
+			return nil, fmt.Errorf("%w: id cannot be empty when provided", ErrInvalidParameter)
+		}
+
+		p, err := r.server.orderClient.GetPromotion(ctx, *id)
+		if err != nil {
+			log.Printf("Error fetching promotion with ID %s: %v", *id, err)
+			if strings.Contains(err.Error(), "not found") {
+				return []*Promotion{}, nil
+			}
+			return nil, fmt.Errorf("failed to fetch promotion: %v", err)
+		}
+		return []*Promotion{newPromotion(*p)}, nil
+	}
+
+	skip, take := uint64(0), uint64(100)
+	if pagination != nil {
+		if pagination.Skip != nil && *pagination.Skip < 0 {
+			return nil, fmt.Errorf("%w: skip cannot be negative", ErrInvalidParameter)
+		}
+		if pagination.Take != nil && *pagination.Take < 0 {
+			return nil, fmt.Errorf("%w: take cannot be negative", ErrInvalidParameter)
+		}
+		if pagination.Take != nil && *pagination.Take > 100 {
+			return nil, fmt.Errorf("%w: take cannot exceed 100", ErrInvalidParameter)
+		}
+		skip, take = pagination.bounds()
+		if pagination.Take == nil {
+			take = 100
+		}
+	}
+
+	promotionList, err := r.server.orderClient.GetPromotions(ctx, skip, take)
+	if err != nil {
+		log.Printf("Error fetching promotions: %v", err)
+		return nil, fmt.Errorf("failed to fetch promotions: %v", err)
+	}
+
+	promotions := make([]*Promotion, len(promotionList))
+	for i, p := range promotionList {
+		promotions[i] = newPromotion(p)
+	}
+	return promotions, nil
+}
+
+func (r *queryResolver) Sellers(ctx context.Context, pagination *PaginationInput, id *string) ([]*Seller, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if id != nil {
+		if *id == "" {
+			return nil, fmt.Errorf("%w: id cannot be empty when provided", ErrInvalidParameter)
+		}
+
+		seller, err := r.server.accountClient.GetSeller(ctx, *id)
+		if err != nil {
+			log.Printf("Error fetching seller with ID %s: %v", *id, err)
+			if strings.Contains(err.Error(), "not found") {
+				return []*Seller{}, nil
+			}
+			return nil, fmt.Errorf("failed to fetch seller: %v", err)
+		}
+		return []*Seller{newSeller(*seller)}, nil
+	}
+
+	skip, take, err := pageBounds(pagination)
+	if err != nil {
+		return nil, err
+	}
+	sellerList, err := r.server.accountClient.GetSellers(ctx, skip, take)
+	if err != nil {
+		log.Printf("Error fetching sellers: %v", err)
+		return nil, fmt.Errorf("failed to fetch sellers: %v", err)
+	}
+
+	sellers := make([]*Seller, len(sellerList))
+	for i, s := range sellerList {
+		sellers[i] = newSeller(s)
+	}
+	return sellers, nil
+}
+
+func (r *queryResolver) Reviews(ctx context.Context, pagination *PaginationInput, id *string, status *ReviewStatus) ([]*Review, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if id != nil {
+		if *id == "" {
+			return nil, fmt.Errorf("%w: id cannot be empty when provided", ErrInvalidParameter)
+		}
+
+		rv, err := r.server.reviewClient.GetReview(ctx, *id)
+		if err != nil {
+			log.Printf("Error fetching review with ID %s: %v", *id, err)
+			if strings.Contains(err.Error(), review.ErrReviewNotFound.Error()) {
+				return []*Review{}, nil
+			}
+			return nil, fmt.Errorf("failed to fetch review: %v", err)
+		}
+		if rv.Status != review.StatusApproved {
+			// Only its author and moderators see a review before it is
+			// approved; to anyone else it does not exist.
+			if r.server.authorizeRole(ctx, roleModerator) != nil && r.server.authorizeAccount(ctx, rv.AccountID) != nil {
+				return []*Review{}, nil
+			}
+			cacheResponsePrivately(ctx)
+		}
+		return []*Review{newReview(*rv)}, nil
+	}
+
+	skip, take, err := pageBounds(pagination)
+	if err != nil {
+		return nil, err
+	}
+	reviewStatus := review.StatusPending
+	if status != nil {
+		reviewStatus = review.Status(*status)
+	}
+	if reviewStatus != review.StatusApproved {
+		if err := r.server.authorizeRole(ctx, roleModerator); err != nil {
+			return nil, err
+		}
+		cacheResponsePrivately(ctx)
+	}
+	reviews, err := r.server.reviewClient.GetReviewsByStatus(ctx, reviewStatus, skip, take)
+	if err != nil {
+		log.Printf("Error fetching %s reviews: %v", reviewStatus, err)
+		return nil, fmt.Errorf("failed to fetch reviews: %v", err)
+	}
+	return newReviews(reviews), nil
+}
+
+func (r *queryResolver) SharedWishlist(ctx context.Context, token string) (*Wishlist, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if token == "" {
+		return nil, fmt.Errorf("%w: token is required", ErrInvalidParameter)
+	}
+
+	w, err := r.server.accountClient.GetSharedWishlist(ctx, token)
+	if err != nil {
+		if strings.Contains(err.Error(), account.ErrWishlistNotFound.Error()) {
+			return nil, nil
+		}
+		log.Printf("Error fetching shared wishlist: %v", err)
+		return nil, fmt.Errorf("failed to fetch wishlist: %v", err)
+	}
+	return r.server.newWishlist(ctx, *w)
+}
+
 func (p *PaginationInput) bounds() (uint64, uint64) {
 	skip, take := uint64(0), uint64(0)
 
@@ -223,3 +410,25 @@ func (p *PaginationInput) bounds() (uint64, uint64) {
 
 	return skip, take
 }
+
+// pageBounds checks pagination and returns its skip and take, taking 100 when
+// take is left out.
+func pageBounds(pagination *PaginationInput) (uint64, uint64, error) {
+	if pagination == nil {
+		return 0, 100, nil
+	}
+	if pagination.Skip != nil && *pagination.Skip < 0 {
+		return 0, 0, fmt.Errorf("%w: skip cannot be negative", ErrInvalidParameter)
+	}
+	if pagination.Take != nil && *pagination.Take < 0 {
+		return 0, 0, fmt.Errorf("%w: take cannot be negative", ErrInvalidParameter)
+	}
+	if pagination.Take != nil && *pagination.Take > 100 {
+		return 0, 0, fmt.Errorf("%w: take cannot exceed 100", ErrInvalidParameter)
+	}
+	skip, take := pagination.bounds()
+	if pagination.Take == nil {
+		take = 100
+	}
+	return skip, take, nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/donaldnash/go-marketplace/ratelimit"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const errRateLimited = "RATE_LIMITED"
+
+// RateLimits throttles the clients of the gateway. Limits are written as
+// "<requests>/<s|m|h>[:<burst>]"; an empty limit turns it off.
+type RateLimits struct {
+	// PerIP limits every request from a client IP address.
+	PerIP string `envconfig:"RATE_LIMIT_IP" default:"20/s:40"`
+	// PerAccount limits every request authenticated as an account, wherever
+	// it comes from.
+	PerAccount string `envconfig:"RATE_LIMIT_ACCOUNT" default:"10/s:20"`
+	// Mutation limits each mutation for each client: the account of an
+	// authenticated request, or the IP address of an anonymous one.
+	Mutation string `envconfig:"RATE_LIMIT_MUTATION" default:"2/s:10"`
+	// Mutations overrides Mutation for the mutations it names.
+	Mutations string `envconfig:"RATE_LIMIT_MUTATIONS" default:"createAccount=10/m:3,createOrder=10/m:3,payOrder=10/m:3,requestReturn=10/m:3,addProductImage=30/m:10"`
+	// TrustForwardedFor takes the client IP address from the last
+	// X-Forwarded-For entry, for a gateway behind a reverse proxy.
+	TrustForwardedFor bool `envconfig:"RATE_LIMIT_TRUST_FORWARDED_FOR"`
+}
+
+// rateLimiter throttles requests by client IP address and account, and
+// mutations by client and mutation.
+type rateLimiter struct {
+	store             ratelimit.Store
+	perIP             ratelimit.Limit
+	perAccount        ratelimit.Limit
+	mutation          ratelimit.Limit
+	mutations         map[string]ratelimit.Limit
+	trustForwardedFor bool
+}
+
+var _ interface {
+	graphql.OperationContextMutator
+	graphql.HandlerExtension
+} = &rateLimiter{}
+
+type rateLimitKey struct{}
+
+// rateLimitState is what the rate limiter knows about a request: the client
+// its mutations are counted against, and how long a limited mutation has to
+// wait.
+type rateLimitState struct {
+	client string
+
+	mu         sync.Mutex
+	retryAfter string
+}
+
+func newRateLimiter(store ratelimit.Store, cfg RateLimits) (*rateLimiter, error) {
+	if store == nil {
+		panic("rate limit store cannot be nil")
+	}
+
+	l := &rateLimiter{store: store, trustForwardedFor: cfg.TrustForwardedFor}
+	var err error
+	if l.perIP, err = ratelimit.ParseLimit(cfg.PerIP); err != nil {
+		return nil, err
+	}
+	if l.perAccount, err = ratelimit.ParseLimit(cfg.PerAccount); err != nil {
+		return nil, err
+	}
+	if l.mutation, err = ratelimit.ParseLimit(cfg.Mutation); err != nil {
+		return nil, err
+	}
+	if l.mutations, err = ratelimit.ParseLimits(cfg.Mutations); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// middleware turns away clients over their IP address or account limit with
+// HTTP 429. It has to run after authentication, to see the account.
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		client := "ip:" + l.clientIP(r)
+		if !l.allow(w, ctx, client, l.perIP) {
+			return
+		}
+		if p, ok := principalFromContext(ctx); ok {
+			client = "account:" + p.AccountID
+			if !l.allow(w, ctx, client, l.perAccount) {
+				return
+			}
+		}
+
+		state := &rateLimitState{client: client}
+		r = r.WithContext(context.WithValue(ctx, rateLimitKey{}, state))
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			// The websocket transport needs the original writer to take over
+			// the connection.
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&retryAfterWriter{ResponseWriter: w, state: state}, r)
+	})
+}
+
+func (l *rateLimiter) allow(w http.ResponseWriter, ctx context.Context, key string, limit ratelimit.Limit) bool {
+	allowed, wait, err := l.store.Take(ctx, key, limit)
+	if err != nil {
+		log.Printf("Error checking rate limit of %s: %v", key, err)
+		return true
+	}
+	if !allowed {
+		w.Header().Set("Retry-After", ratelimit.RetryAfter(wait))
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+	}
+	return allowed
+}
+
+func (l *rateLimiter) clientIP(r *http.Request) string {
+	if l.trustForwardedFor {
+		// The last entry is the one added by the proxy in front of the
+		// gateway; the ones before it come from the client.
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			entries := strings.Split(values[len(values)-1], ",")
+			if ip := strings.TrimSpace(entries[len(entries)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (l *rateLimiter) ExtensionName() string {
+	return "RateLimit"
+}
+
+func (l *rateLimiter) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+// MutateOperationContext takes a token for every mutation an operation runs,
+// before any of them runs.
+func (l *rateLimiter) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	if opCtx.Operation.Operation != ast.Mutation {
+		return nil
+	}
+	state, ok := ctx.Value(rateLimitKey{}).(*rateLimitState)
+	if !ok {
+		return nil
+	}
+
+	for _, name := range rootFieldNames(opCtx.Operation.SelectionSet) {
+		limit, ok := l.mutations[name]
+		if !ok {
+			limit = l.mutation
+		}
+		allowed, wait, err := l.store.Take(ctx, fmt.Sprintf("mutation:%s:%s", name, state.client), limit)
+		if err != nil {
+			log.Printf("Error checking rate limit of %s: %v", name, err)
+			continue
+		}
+		if !allowed {
+			retryAfter := ratelimit.RetryAfter(wait)
+			state.mu.Lock()
+			state.retryAfter = retryAfter
+			state.mu.Unlock()
+
+			err := gqlerror.Errorf("rate limit of %s exceeded; retry after %s seconds", name, retryAfter)
+			errcode.Set(err, errRateLimited)
+			return err
+		}
+	}
+	return nil
+}
+
+// rootFieldNames lists the fields an operation selects at its root, once for
+// every time they are selected.
+func rootFieldNames(selections ast.SelectionSet) []string {
+	names := []string{}
+	for _, selection := range selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			if !strings.HasPrefix(s.Name, "__") {
+				names = append(names, s.Name)
+			}
+		case *ast.InlineFragment:
+			names = append(names, rootFieldNames(s.SelectionSet)...)
+		case *ast.FragmentSpread:
+			if s.Definition != nil {
+				names = append(names, rootFieldNames(s.Definition.SelectionSet)...)
+			}
+		}
+	}
+	return names
+}
+
+// retryAfterWriter answers with HTTP 429 and a Retry-After header when the
+// operation was rate limited.
+type retryAfterWriter struct {
+	http.ResponseWriter
+	state       *rateLimitState
+	wroteHeader bool
+}
+
+func (w *retryAfterWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.state.mu.Lock()
+		retryAfter := w.state.retryAfter
+		w.state.mu.Unlock()
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+			code = http.StatusTooManyRequests
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *retryAfterWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/donaldnash/go-marketplace/ratelimit"
+	"github.com/vektah/gqlparser/v2"
+)
+
+// The limits below refill one request an hour, so no token comes back while
+// a test runs and the Retry-After values are exact.
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	l, err := newRateLimiter(ratelimit.NewMemoryStore(), RateLimits{PerIP: "1/h:2", PerAccount: "1/h:1"})
+	if err != nil {
+		t.Fatalf("newRateLimiter: %v", err)
+	}
+	h := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(remoteAddr string, ctx context.Context) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/graphql", nil).WithContext(ctx)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if w := serve("10.0.0.1:1234", ctx); w.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst: status %d", i+1, w.Code)
+		}
+	}
+	w := serve("10.0.0.1:5678", ctx)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the IP limit: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("Retry-After = %q, want 3600", got)
+	}
+
+	// Another address has its own bucket.
+	if w := serve("10.0.0.2:1234", ctx); w.Code != http.StatusOK {
+		t.Errorf("request from another address: status %d", w.Code)
+	}
+
+	// An account is limited wherever its requests come from.
+	alice := context.WithValue(ctx, principalKey{}, principal{AccountID: "alice"})
+	if w := serve("10.0.0.3:1234", alice); w.Code != http.StatusOK {
+		t.Fatalf("first request of the account: status %d", w.Code)
+	}
+	if w := serve("10.0.0.4:1234", alice); w.Code != http.StatusTooManyRequests {
+		t.Errorf("request over the account limit: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimiterMutations(t *testing.T) {
+	l, err := newRateLimiter(ratelimit.NewMemoryStore(), RateLimits{Mutation: "1/h:2", Mutations: "createOrder=1/h:1"})
+	if err != nil {
+		t.Fatalf("newRateLimiter: %v", err)
+	}
+	es := (&Server{}).ToExecutableSchema(queryComplexity(10))
+
+	// run runs the root fields of query for client and returns the status
+	// and Retry-After header the response gets.
+	run := func(client string, query string) (int, string) {
+		t.Helper()
+		doc, gerr := gqlparser.LoadQuery(es.Schema(), query)
+		if gerr != nil {
+			t.Fatalf("LoadQuery: %v", gerr)
+		}
+		state := &rateLimitState{client: client}
+		ctx := context.WithValue(context.Background(), rateLimitKey{}, state)
+		l.MutateOperationContext(ctx, &graphql.OperationContext{Operation: doc.Operations[0]})
+
+		rec := httptest.NewRecorder()
+		w := &retryAfterWriter{ResponseWriter: rec, state: state}
+		w.Write([]byte("{}"))
+		return rec.Code, rec.Header().Get("Retry-After")
+	}
+	createOrder := `mutation { createOrder(order: {accountId: "alice", products: []}) { id } }`
+	deleteProduct := `mutation { deleteProduct(id: "p1") }`
+
+	if code, _ := run("ip:10.0.0.1", createOrder); code != http.StatusOK {
+		t.Fatalf("first createOrder: status %d", code)
+	}
+	code, retryAfter := run("ip:10.0.0.1", createOrder)
+	if code != http.StatusTooManyRequests || retryAfter != "3600" {
+		t.Errorf("second createOrder = %d with Retry-After %q, want %d with 3600", code, retryAfter, http.StatusTooManyRequests)
+	}
+
+	// Other mutations and other clients have buckets of their own.
+	if code, _ := run("ip:10.0.0.1", deleteProduct); code != http.StatusOK {
+		t.Errorf("another mutation: status %d", code)
+	}
+	if code, _ := run("ip:10.0.0.2", createOrder); code != http.StatusOK {
+		t.Errorf("createOrder of another client: status %d", code)
+	}
+
+	// A mutation selected twice takes two tokens.
+	twice := `mutation { a: deleteProduct(id: "p1") b: deleteProduct(id: "p2") }`
+	if code, _ := run("ip:10.0.0.3", twice); code != http.StatusOK {
+		t.Errorf("two mutations within the burst: status %d", code)
+	}
+	if code, _ := run("ip:10.0.0.3", deleteProduct); code != http.StatusTooManyRequests {
+		t.Errorf("mutation after the burst was used: status %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// Queries are not counted.
+	for i := 0; i < 3; i++ {
+		if code, _ := run("ip:10.0.0.1", `{ products { id } }`); code != http.StatusOK {
+			t.Errorf("query %d: status %d", i+1, code)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// maxCachedResponseSize bounds the requests and responses the response cache
+// keeps; larger ones are always run.
+const maxCachedResponseSize = 1 << 20
+
+// cachePolicy is how long the result of an operation may be cached, and
+// whether only for the account that requested it.
+type cachePolicy struct {
+	maxAge  int
+	private bool
+}
+
+// responseCache serves the results of queries again until they expire, as
+// allowed by the @cacheControl hints of the fields they select, and answers
+// GET requests whose If-None-Match header names the current result with 304.
+// Public results are shared by every client; private ones are only kept for
+// the account that requested them, and never for anonymous requests.
+type responseCache struct {
+	// entries is nil when results are not kept.
+	entries graphql.Cache[*cachedResponse]
+	schema  *ast.Schema
+}
+
+var _ interface {
+	graphql.OperationContextMutator
+	graphql.ResponseInterceptor
+	graphql.HandlerExtension
+} = &responseCache{}
+
+type cachedResponse struct {
+	body        []byte
+	contentType string
+	etag        string
+	maxAge      int
+	private     bool
+	storedAt    time.Time
+	expiresAt   time.Time
+}
+
+type responseCacheKey struct{}
+
+// responseCacheState carries the cache policy of the operation a request ran
+// from the extension to the middleware.
+type responseCacheState struct {
+	mu      sync.Mutex
+	policy  *cachePolicy
+	failed  bool
+	private bool
+}
+
+// newResponseCache keeps up to size results; 0 keeps none, but still sets the
+// Cache-Control and ETag headers of responses.
+func newResponseCache(size int) *responseCache {
+	c := &responseCache{}
+	if size > 0 {
+		c.entries = lru.New[*cachedResponse](size)
+	}
+	return c
+}
+
+// middleware has to run after authentication, to keep private results apart.
+func (c *responseCache) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodPost) || strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		w.Header().Add("Vary", "Authorization")
+
+		p, authenticated := principalFromContext(ctx)
+		request, cacheable := requestCacheKey(r)
+		publicKey := responseKey("public", request)
+		privateKey := ""
+		if authenticated {
+			// Staff may see more of the same account than its owner.
+			privateKey = responseKey("account:"+p.AccountID+":"+p.Role, request)
+		}
+
+		if cacheable && c.entries != nil {
+			for _, key := range []string{publicKey, privateKey} {
+				if key == "" {
+					continue
+				}
+				if e, ok := c.entries.Get(ctx, key); ok && time.Now().Before(e.expiresAt) {
+					w.Header().Set("X-Cache", "HIT")
+					e.serve(w, r)
+					return
+				}
+			}
+		}
+
+		state := &responseCacheState{}
+		rec := &responseRecorder{header: w.Header(), code: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(ctx, responseCacheKey{}, state)))
+
+		state.mu.Lock()
+		policy, failed := state.policy, state.failed
+		if policy != nil && state.private {
+			policy.private = true
+		}
+		state.mu.Unlock()
+		if rec.code != http.StatusOK {
+			w.WriteHeader(rec.code)
+			w.Write(rec.body.Bytes())
+			return
+		}
+
+		e := &cachedResponse{
+			body:        rec.body.Bytes(),
+			contentType: w.Header().Get("Content-Type"),
+			etag:        etag(rec.body.Bytes()),
+		}
+		if policy == nil || failed || policy.maxAge <= 0 || (policy.private && !authenticated) {
+			// The result is not stored, but the client may still keep it and
+			// ask whether it changed.
+			w.Header().Set("Cache-Control", "private, no-cache")
+			e.write(w, r)
+			return
+		}
+
+		e.maxAge = policy.maxAge
+		e.private = policy.private
+		e.storedAt = time.Now()
+		e.expiresAt = e.storedAt.Add(time.Duration(policy.maxAge) * time.Second)
+		if cacheable && c.entries != nil && len(e.body) <= maxCachedResponseSize {
+			key := publicKey
+			if e.private {
+				key = privateKey
+			}
+			c.entries.Add(ctx, key, e)
+			w.Header().Set("X-Cache", "MISS")
+		}
+		e.serve(w, r)
+	})
+}
+
+// requestCacheKey returns what identifies the operation of r: the query
+// string of a GET request or the body of a JSON POST request. Other requests
+// are not cached.
+func requestCacheKey(r *http.Request) (string, bool) {
+	if r.Method == http.MethodGet {
+		return "GET\n" + r.URL.RawQuery, true
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return "", false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCachedResponseSize+1))
+	// The handler reads the body again, including what was not read here.
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || len(body) > maxCachedResponseSize {
+		return "", false
+	}
+	return "POST\n" + string(body), true
+}
+
+func responseKey(scope string, request string) string {
+	sum := sha256.Sum256([]byte(scope + "\n" + request))
+	return hex.EncodeToString(sum[:])
+}
+
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// serve writes a stored result with the time it has left.
+func (e *cachedResponse) serve(w http.ResponseWriter, r *http.Request) {
+	age := int(time.Since(e.storedAt).Seconds())
+	scope := "public"
+	if e.private {
+		scope = "private"
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, max(e.maxAge-age, 0)))
+	w.Header().Set("Age", strconv.Itoa(age))
+	e.write(w, r)
+}
+
+func (e *cachedResponse) write(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("ETag", e.etag)
+	if r.Method == http.MethodGet && etagMatches(r.Header.Get("If-None-Match"), e.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if e.contentType != "" {
+		w.Header().Set("Content-Type", e.contentType)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(e.body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(e.body)
+}
+
+// etagMatches reports whether an If-None-Match header names etag. Weak and
+// strong tags compare the same, as RFC 9110 asks for If-None-Match.
+func etagMatches(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// responseRecorder holds a response back until the middleware knows how it
+// may be cached.
+type responseRecorder struct {
+	header      http.Header
+	code        int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *responseRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.code = code
+	}
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (c *responseCache) ExtensionName() string {
+	return "ResponseCache"
+}
+
+func (c *responseCache) Validate(schema graphql.ExecutableSchema) error {
+	c.schema = schema.Schema()
+	return nil
+}
+
+// MutateOperationContext works out the cache policy of queries from the
+// fields they select. Mutations are never cached.
+func (c *responseCache) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	state, ok := ctx.Value(responseCacheKey{}).(*responseCacheState)
+	if !ok || opCtx.Operation.Operation != ast.Query {
+		return nil
+	}
+	policy := operationCachePolicy(c.schema, opCtx.Operation.SelectionSet)
+	state.mu.Lock()
+	state.policy = &policy
+	state.mu.Unlock()
+	return nil
+}
+
+// cacheResponsePrivately keeps the result of the request of ctx for the
+// account that made it only, whatever the fields it selects allow. Resolvers
+// call it when what they return depends on who asks.
+func cacheResponsePrivately(ctx context.Context) {
+	if state, ok := ctx.Value(responseCacheKey{}).(*responseCacheState); ok {
+		state.mu.Lock()
+		state.private = true
+		state.mu.Unlock()
+	}
+}
+
+// InterceptResponse keeps results with errors out of the cache: they may be
+// caused by an unavailable service and go away on their own.
+func (c *responseCache) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	res := next(ctx)
+	if state, ok := ctx.Value(responseCacheKey{}).(*responseCacheState); ok && res != nil && len(res.Errors) > 0 {
+		state.mu.Lock()
+		state.failed = true
+		state.mu.Unlock()
+	}
+	return res
+}
+
+// operationCachePolicy caches an operation for the shortest maxAge of the
+// fields it selects, and privately if any of them is private.
+func operationCachePolicy(schema *ast.Schema, selections ast.SelectionSet) cachePolicy {
+	policy := cachePolicy{maxAge: -1}
+	walkCachePolicy(schema, selections, 0, &policy)
+	if policy.maxAge < 0 {
+		policy.maxAge = 0
+	}
+	return policy
+}
+
+func walkCachePolicy(schema *ast.Schema, selections ast.SelectionSet, parentMaxAge int, policy *cachePolicy) {
+	for _, selection := range selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			// __typename is the same whatever the data
+			if s.Definition == nil || s.Name == "__typename" {
+				continue
+			}
+			maxAge, hasMaxAge, private := cacheHint(s.Definition.Directives)
+			if def := schema.Types[s.Definition.Type.Name()]; def != nil && def.IsCompositeType() {
+				typeMaxAge, typeHasMaxAge, typePrivate := cacheHint(def.Directives)
+				if !hasMaxAge {
+					maxAge, hasMaxAge = typeMaxAge, typeHasMaxAge
+				}
+				private = private || typePrivate
+			} else if !hasMaxAge {
+				maxAge = parentMaxAge
+			}
+
+			if policy.maxAge < 0 || maxAge < policy.maxAge {
+				policy.maxAge = maxAge
+			}
+			policy.private = policy.private || private
+			walkCachePolicy(schema, s.SelectionSet, maxAge, policy)
+		case *ast.InlineFragment:
+			walkCachePolicy(schema, s.SelectionSet, parentMaxAge, policy)
+		case *ast.FragmentSpread:
+			if s.Definition != nil {
+				walkCachePolicy(schema, s.Definition.SelectionSet, parentMaxAge, policy)
+			}
+		}
+	}
+}
+
+// cacheHint reads a @cacheControl directive. A hint without maxAge only sets
+// the scope.
+func cacheHint(directives ast.DirectiveList) (maxAge int, hasMaxAge bool, private bool) {
+	d := directives.ForName("cacheControl")
+	if d == nil {
+		return 0, false, false
+	}
+	if arg := d.Arguments.ForName("maxAge"); arg != nil && arg.Value != nil {
+		n, err := strconv.Atoi(arg.Value.Raw)
+		if err != nil {
+			log.Printf("Warning: invalid @cacheControl maxAge %q", arg.Value.Raw)
+		} else {
+			maxAge, hasMaxAge = n, true
+		}
+	}
+	if arg := d.Arguments.ForName("scope"); arg != nil && arg.Value != nil {
+		private = arg.Value.Raw == string(CacheControlScopePrivate)
+	}
+	return maxAge, hasMaxAge, private
+}
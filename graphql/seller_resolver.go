@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+type sellerResolver struct {
+	server *Server
+}
+
+func (r *sellerResolver) Products(ctx context.Context, obj *Seller, pagination *PaginationInput) ([]*Product, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("seller object is required")
+	}
+	skip, take, err := pageBounds(pagination)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	productList, err := r.server.catalogClient.GetSellerProducts(ctx, obj.ID, skip, take)
+	if err != nil {
+		log.Printf("Error fetching products of seller %s: %v", obj.ID, err)
+		return nil, fmt.Errorf("failed to fetch products of seller: %v", err)
+	}
+
+	products := make([]*Product, len(productList))
+	for i, p := range productList {
+		products[i] = newProduct(p)
+	}
+	return products, nil
+}
+
+func (r *sellerResolver) Orders(ctx context.Context, obj *Seller, pagination *PaginationInput) ([]*SellerOrder, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("seller object is required")
+	}
+	skip, take, err := pageBounds(pagination)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.server.authorizeAccount(ctx, obj.ID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	orderList, err := r.server.orderClient.GetSellerOrders(ctx, obj.ID, skip, take)
+	if err != nil {
+		log.Printf("Error fetching orders of seller %s: %v", obj.ID, err)
+		return nil, fmt.Errorf("failed to fetch orders of seller: %v", err)
+	}
+
+	orders := make([]*SellerOrder, len(orderList))
+	for i, so := range orderList {
+		orders[i] = newSellerOrder(so, true)
+	}
+	return orders, nil
+}
+
+func (r *sellerResolver) SalesReport(ctx context.Context, obj *Seller, from time.Time, to time.Time) (*SalesReport, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("seller object is required")
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, obj.ID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	report, err := r.server.orderClient.GetSalesReport(ctx, obj.ID, from, to)
+	if err != nil {
+		log.Printf("Error fetching sales report of seller %s: %v", obj.ID, err)
+		return nil, fmt.Errorf("failed to fetch sales report: %v", err)
+	}
+	return newSalesReport(*report), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+type subscriptionResolver struct {
+	server *Server
+}
+
+func (r *subscriptionResolver) OrderUpdated(ctx context.Context, accountID string) (<-chan *Order, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("%w: accountId is required", ErrInvalidParameter)
+	}
+	if err := r.server.authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	orders, err := r.server.orderClient.WatchOrders(ctx, accountID)
+	if err != nil {
+		log.Printf("Error watching orders of account %s: %v", accountID, err)
+		return nil, fmt.Errorf("failed to watch orders: %v", err)
+	}
+
+	updates := make(chan *Order)
+	go func() {
+		defer close(updates)
+		for o := range orders {
+			select {
+			case updates <- newOrder(o):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return updates, nil
+}
+
+func (r *subscriptionResolver) ProductAdded(ctx context.Context, category *string) (<-chan *Product, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("%w: context is required", ErrInvalidContext)
+	}
+
+	products, err := r.server.catalogClient.WatchProducts(ctx, stringValue(category))
+	if err != nil {
+		log.Printf("Error watching products: %v", err)
+		return nil, fmt.Errorf("failed to watch products: %v", err)
+	}
+
+	added := make(chan *Product)
+	go func() {
+		defer close(added)
+		for p := range products {
+			select {
+			case added <- newProduct(p):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return added, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/order"
+	"github.com/donaldnash/go-marketplace/payment"
+)
+
+const (
+	maxWebhookBody     = 64 << 10
+	webhookTolerance   = 5 * time.Minute
+	webhookCallTimeout = 5 * time.Second
+)
+
+type paymentWebhook struct {
+	orderClient *order.Client
+	secret      []byte
+}
+
+// newPaymentWebhook returns the handler payment providers call back. Only
+// requests signed with secret are passed on to the order service.
+func newPaymentWebhook(orderClient *order.Client, secret string) http.Handler {
+	if orderClient == nil {
+		panic("order client cannot be nil")
+	}
+	if secret == "" {
+		panic("webhook secret cannot be empty")
+	}
+	return &paymentWebhook{orderClient, []byte(secret)}
+}
+
+func (h *paymentWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	header := r.Header.Get(payment.SignatureHeader)
+	if err := payment.VerifySignature(h.secret, header, body, time.Now(), webhookTolerance); err != nil {
+		log.Printf("Rejected payment webhook: %v", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	e, err := payment.ParseEvent(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), webhookCallTimeout)
+	defer cancel()
+
+	if err := h.orderClient.ApplyPaymentEvent(ctx, *e); err != nil {
+		log.Printf("Error applying payment event %s: %v", e.ID, err)
+		if strings.Contains(err.Error(), payment.ErrUnknownTransaction.Error()) {
+			http.Error(w, "unknown transaction", http.StatusNotFound)
+			return
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			http.Error(w, "timed out", http.StatusGatewayTimeout)
+			return
+		}
+		// Anything else is worth a retry by the provider.
+		http.Error(w, "failed to apply event", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/grpcclient"
+	"github.com/donaldnash/go-marketplace/order"
+	orderpb "github.com/donaldnash/go-marketplace/order/pb"
+	"github.com/donaldnash/go-marketplace/payment"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// eventServer records the payment events the order service gets. Events of
+// the reference "unknown" are refused like the order service refuses them.
+type eventServer struct {
+	orderpb.UnimplementedOrderServiceServer
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (s *eventServer) ApplyPaymentEvent(ctx context.Context, r *orderpb.ApplyPaymentEventRequest) (*orderpb.ApplyPaymentEventResponse, error) {
+	if r.Event.Reference == "unknown" {
+		return nil, status.Error(codes.Unknown, payment.ErrUnknownTransaction.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, r.Event.Id)
+	return &orderpb.ApplyPaymentEventResponse{}, nil
+}
+
+func (s *eventServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.events...)
+}
+
+// newTestWebhook serves s in process and returns the webhook calling it.
+func newTestWebhook(t *testing.T, s *eventServer, secret string) http.Handler {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	orderpb.RegisterOrderServiceServer(srv, s)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	options := grpcclient.DefaultOptions()
+	options.Dialer = func(ctx context.Context, addr string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	client, err := order.NewClientWithOptions("passthrough:///order", options)
+	if err != nil {
+		t.Fatalf("NewClientWithOptions: %v", err)
+	}
+	t.Cleanup(client.Close)
+	return newPaymentWebhook(client, secret)
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	secret := []byte("whsec")
+	captured := `{"id":"evt-1","type":"payment.captured","provider":"fake","reference":"ref-1","amount":10}`
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		header func(body string) string
+		want   int
+		events []string
+	}{
+		{
+			name:   "signed event",
+			body:   captured,
+			header: func(body string) string { return payment.Sign(secret, time.Now(), []byte(body)) },
+			want:   http.StatusNoContent,
+			events: []string{"evt-1"},
+		},
+		{
+			name:   "tampered body",
+			body:   strings.Replace(captured, `"amount":10`, `"amount":1000`, 1),
+			header: func(body string) string { return payment.Sign(secret, time.Now(), []byte(captured)) },
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong secret",
+			body:   captured,
+			header: func(body string) string { return payment.Sign([]byte("other"), time.Now(), []byte(body)) },
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "malformed header",
+			body:   captured,
+			header: func(body string) string { return "v1=deadbeef" },
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "signed too long ago",
+			body:   captured,
+			header: func(body string) string { return payment.Sign(secret, time.Now().Add(-10*time.Minute), []byte(body)) },
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "unknown event type",
+			body:   `{"id":"evt-2","type":"payment.disputed","provider":"fake","reference":"ref-1"}`,
+			header: func(body string) string { return payment.Sign(secret, time.Now(), []byte(body)) },
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "unknown transaction",
+			body:   `{"id":"evt-3","type":"payment.captured","provider":"fake","reference":"unknown"}`,
+			header: func(body string) string { return payment.Sign(secret, time.Now(), []byte(body)) },
+			want:   http.StatusNotFound,
+		},
+		{
+			name:   "not a POST",
+			method: http.MethodGet,
+			header: func(body string) string { return payment.Sign(secret, time.Now(), []byte(body)) },
+			want:   http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &eventServer{}
+			h := newTestWebhook(t, s, string(secret))
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			r := httptest.NewRequest(method, "/webhooks/payments", strings.NewReader(tt.body))
+			r.Header.Set(payment.SignatureHeader, tt.header(tt.body))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if got := s.received(); strings.Join(got, ",") != strings.Join(tt.events, ",") {
+				t.Errorf("order service got events %v, want %v", got, tt.events)
+			}
+		})
+	}
+}
+
+func TestPaymentWebhookRedelivery(t *testing.T) {
+	secret := "whsec"
+	s := &eventServer{}
+	h := newTestWebhook(t, s, secret)
+	body := `{"id":"evt-1","type":"payment.refunded","provider":"fake","reference":"ref-1"}`
+
+	// A provider that did not see the first answer delivers the event again.
+	// Both deliveries are acknowledged; the order service ignores the repeat.
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/webhooks/payments", strings.NewReader(body))
+		r.Header.Set(payment.SignatureHeader, payment.Sign([]byte(secret), time.Now(), []byte(body)))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("delivery %d: status = %d, want %d", i+1, w.Code, http.StatusNoContent)
+		}
+	}
+	if got := s.received(); len(got) != 2 {
+		t.Errorf("order service got events %v, want evt-1 twice", got)
+	}
+}
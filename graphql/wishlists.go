@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/donaldnash/go-marketplace/account"
+	"github.com/donaldnash/go-marketplace/catalog"
+)
+
+// The catalog looks up at most this many products by ID at once.
+const productLookupBatch = 100
+
+// newWishlists converts wishlists with the current catalog price of their
+// products, looked up in as few requests as possible.
+func (s *Server) newWishlists(ctx context.Context, lists []account.Wishlist) ([]*Wishlist, error) {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, w := range lists {
+		for _, item := range w.Items {
+			if !seen[item.ProductID] {
+				seen[item.ProductID] = true
+				ids = append(ids, item.ProductID)
+			}
+		}
+	}
+
+	products := make(map[string]catalog.Product, len(ids))
+	for start := 0; start < len(ids); start += productLookupBatch {
+		end := min(start+productLookupBatch, len(ids))
+		batch, err := s.catalogClient.GetProducts(ctx, 0, 0, ids[start:end], "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch wishlist products: %v", err)
+		}
+		for _, p := range batch {
+			products[p.ID] = p
+		}
+	}
+
+	result := make([]*Wishlist, len(lists))
+	for i, w := range lists {
+		result[i] = newWishlist(w, products)
+	}
+	return result, nil
+}
+
+func (s *Server) newWishlist(ctx context.Context, w account.Wishlist) (*Wishlist, error) {
+	lists, err := s.newWishlists(ctx, []account.Wishlist{w})
+	if err != nil {
+		return nil, err
+	}
+	return lists[0], nil
+}
+
+func newWishlist(w account.Wishlist, products map[string]catalog.Product) *Wishlist {
+	items := make([]*WishlistItem, len(w.Items))
+	for i, item := range w.Items {
+		items[i] = &WishlistItem{
+			ProductID:  item.ProductID,
+			VariantID:  stringOrNil(item.VariantID),
+			SavedPrice: item.SavedPrice,
+			AddedAt:    item.AddedAt,
+		}
+		p, ok := products[item.ProductID]
+		if !ok {
+			continue
+		}
+		price, ok := wishlistPrice(p, item.VariantID)
+		if !ok {
+			continue
+		}
+		items[i].Product = newProduct(p)
+		items[i].CurrentPrice = &price
+		if drop := item.SavedPrice - price; drop > 0 {
+			items[i].PriceDrop = math.Round(drop*100) / 100
+		}
+	}
+	return &Wishlist{
+		ID:         w.ID,
+		Name:       w.Name,
+		ShareToken: stringOrNil(w.ShareToken),
+		Items:      items,
+		CreatedAt:  w.CreatedAt,
+	}
+}
+
+// wishlistPrice is what the saved variant of p sells for, or p itself when no
+// variant was saved. It is false when the variant no longer exists.
+func wishlistPrice(p catalog.Product, variantID string) (float64, bool) {
+	if variantID == "" {
+		return p.Price, true
+	}
+	v, ok := p.Variant(variantID)
+	if !ok {
+		return 0, false
+	}
+	return p.PriceOf(v), true
+}
+
+func wishlistError(err error, accountID string) error {
+	switch {
+	case strings.Contains(err.Error(), account.ErrWishlistNotFound.Error()):
+		return fmt.Errorf("%w: wishlist does not exist", ErrNotFound)
+	case strings.Contains(err.Error(), account.ErrWishlistNameTaken.Error()):
+		return fmt.Errorf("%w: account %s already has a wishlist with this name", ErrAlreadyExists, accountID)
+	case strings.Contains(err.Error(), account.ErrWishlistFull.Error()):
+		return fmt.Errorf("%w: %s", ErrConflict, rpcMessage(err))
+	case strings.Contains(err.Error(), "not found"):
+		return fmt.Errorf("%w: account with ID %s does not exist", ErrNotFound, accountID)
+	case strings.Contains(err.Error(), "failed to"):
+		return fmt.Errorf("failed to save wishlist: %v", err)
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidParameter, rpcMessage(err))
+}
@@ -0,0 +1,140 @@
+package grpcclient
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// Breaker stops calling a service that keeps being unavailable. It opens
+// after a number of such failures in a row and fails calls straight away
+// with ErrCircuitOpen. Once its cooldown has passed, it lets one call
+// through: if that call succeeds the breaker closes, otherwise it opens
+// again. Calls the service answers, even with an error, count as successes.
+type Breaker struct {
+	name     string
+	failures int
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu          sync.Mutex
+	state       breakerState
+	consecutive int
+	openedAt    time.Time
+}
+
+func NewBreaker(name string, failures int, cooldown time.Duration) *Breaker {
+	if failures <= 0 {
+		panic("breaker failures must be positive")
+	}
+	return &Breaker{
+		name:     name,
+		failures: failures,
+		cooldown: cooldown,
+		now:      time.Now,
+	}
+}
+
+// Allow reports whether a call may go through. Every allowed call must be
+// followed by a call to Done.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// A trial call is in flight.
+		return false
+	}
+	return true
+}
+
+// Done records the outcome of an allowed call.
+func (b *Breaker) Done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !IsUnavailable(err) {
+		if b.state != breakerClosed {
+			log.Printf("Circuit breaker for %s closed", b.name)
+		}
+		b.state = breakerClosed
+		b.consecutive = 0
+		return
+	}
+
+	b.consecutive++
+	if b.state == breakerHalfOpen || b.consecutive >= b.failures {
+		if b.state != breakerOpen {
+			log.Printf("Circuit breaker for %s opened after %d failures: %v", b.name, b.consecutive, err)
+		}
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// abandon records an allowed call that ended without an outcome. A trial
+// call leaves the breaker open, and the next call is tried instead.
+func (b *Breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
+
+func (b *Breaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !b.Allow() {
+			return &circuitOpenError{b.name}
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if ctx.Err() == context.Canceled {
+			// The caller gave up, which says nothing about the service.
+			b.abandon()
+			return err
+		}
+		b.Done(err)
+		return err
+	}
+}
+
+// circuitOpenError is ErrCircuitOpen with the gRPC status Unavailable, so
+// callers can treat it like any other unavailable service.
+type circuitOpenError struct {
+	name string
+}
+
+func (e *circuitOpenError) Error() string {
+	return ErrCircuitOpen.Error() + " for " + e.name
+}
+
+func (e *circuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+func (e *circuitOpenError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.Error())
+}
@@ -0,0 +1,158 @@
+// Package grpcclient connects the service clients to their servers: lazily,
+// balanced over every replica, with retries for reads, default deadlines and
+// a circuit breaker.
+package grpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// Options tune how a client calls its service.
+type Options struct {
+	// Timeout is the deadline of calls whose context has none.
+	Timeout time.Duration `envconfig:"RPC_TIMEOUT" default:"5s"`
+	// MaxAttempts is how many times a read is tried while the service is
+	// unavailable, including the first attempt; 1 disables retries.
+	MaxAttempts int `envconfig:"RPC_MAX_ATTEMPTS" default:"3"`
+	// BreakerFailures is how many calls in a row may fail because the
+	// service is unavailable before the circuit breaker opens; 0 disables
+	// the breaker.
+	BreakerFailures int `envconfig:"RPC_BREAKER_FAILURES" default:"5"`
+	// BreakerCooldown is how long the breaker stays open before it lets a
+	// call through to try the service again.
+	BreakerCooldown time.Duration `envconfig:"RPC_BREAKER_COOLDOWN" default:"10s"`
+	// LoadBalancing spreads calls over the addresses of a service:
+	// "round_robin" uses them all in turn, "pick_first" sticks to one.
+	LoadBalancing string `envconfig:"RPC_LOAD_BALANCING" default:"round_robin"`
+	// Dialer connects to an address of the service instead of TCP, such as
+	// to an in-process server in tests.
+	Dialer func(ctx context.Context, addr string) (net.Conn, error) `ignored:"true"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout:         5 * time.Second,
+		MaxAttempts:     3,
+		BreakerFailures: 5,
+		BreakerCooldown: 10 * time.Second,
+		LoadBalancing:   "round_robin",
+	}
+}
+
+// Dial returns a connection to the service at url, which Target turns into
+// the addresses of its replicas. It does not wait for the service: the
+// connections are made on the first call and remade whenever they are lost,
+// so a client can be created before its service is up. reads names the
+// methods of service that change nothing and can be retried.
+func Dial(url string, service string, reads []string, o Options) (*grpc.ClientConn, error) {
+	config, err := serviceConfig(service, reads, o.MaxAttempts, o.LoadBalancing)
+	if err != nil {
+		return nil, err
+	}
+
+	interceptors := []grpc.UnaryClientInterceptor{}
+	if o.BreakerFailures > 0 {
+		interceptors = append(interceptors, NewBreaker(service, o.BreakerFailures, o.BreakerCooldown).UnaryClientInterceptor())
+	}
+	if o.Timeout > 0 {
+		interceptors = append(interceptors, deadlineInterceptor(o.Timeout))
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithResolvers(registeredResolvers()...),
+		grpc.WithDefaultServiceConfig(config),
+		grpc.WithChainUnaryInterceptor(interceptors...),
+	}
+	if o.Dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(o.Dialer))
+	}
+	return grpc.NewClient(Target(url), opts...)
+}
+
+// serviceConfig balances calls with the loadBalancing policy, and retries
+// reads that fail because the service is unavailable, such as while it
+// starts or restarts, backing off between attempts.
+func serviceConfig(service string, reads []string, maxAttempts int, loadBalancing string) (string, error) {
+	switch loadBalancing {
+	case "":
+		loadBalancing = "pick_first"
+	case "round_robin", "pick_first":
+	default:
+		return "", fmt.Errorf("unknown load balancing policy %q", loadBalancing)
+	}
+
+	type name struct {
+		Service string `json:"service"`
+		Method  string `json:"method"`
+	}
+	type retryPolicy struct {
+		MaxAttempts          int      `json:"maxAttempts"`
+		InitialBackoff       string   `json:"initialBackoff"`
+		MaxBackoff           string   `json:"maxBackoff"`
+		BackoffMultiplier    float64  `json:"backoffMultiplier"`
+		RetryableStatusCodes []string `json:"retryableStatusCodes"`
+	}
+	type methodConfig struct {
+		Name        []name       `json:"name"`
+		RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+	}
+	config := struct {
+		LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig"`
+		MethodConfig        []methodConfig        `json:"methodConfig"`
+	}{
+		LoadBalancingConfig: []map[string]struct{}{{loadBalancing: {}}},
+		MethodConfig:        []methodConfig{},
+	}
+
+	if maxAttempts > 1 && len(reads) > 0 {
+		m := methodConfig{RetryPolicy: &retryPolicy{
+			MaxAttempts:          maxAttempts,
+			InitialBackoff:       "0.1s",
+			MaxBackoff:           "1s",
+			BackoffMultiplier:    2,
+			RetryableStatusCodes: []string{"UNAVAILABLE"},
+		}}
+		for _, method := range reads {
+			m.Name = append(m.Name, name{service, method})
+		}
+		config.MethodConfig = append(config.MethodConfig, m)
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to build service config: %v", err)
+	}
+	return string(data), nil
+}
+
+func deadlineInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// IsUnavailable reports whether err means the service could not be reached
+// or did not answer in time, rather than that it refused the request. It is
+// true while the circuit breaker is open.
+func IsUnavailable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
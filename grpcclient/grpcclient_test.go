@@ -0,0 +1,256 @@
+package grpcclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testService = "grpc.health.v1.Health"
+
+// faultServer fails the next failures calls with code, or answers each call
+// after delay. It records the deadline every call arrived with.
+type faultServer struct {
+	healthpb.UnimplementedHealthServer
+
+	mu        sync.Mutex
+	calls     int
+	failures  int
+	code      codes.Code
+	delay     time.Duration
+	deadlines []time.Duration
+}
+
+func (s *faultServer) Check(ctx context.Context, r *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	s.mu.Lock()
+	s.calls++
+	deadline, ok := ctx.Deadline()
+	if ok {
+		s.deadlines = append(s.deadlines, time.Until(deadline))
+	} else {
+		s.deadlines = append(s.deadlines, 0)
+	}
+	fail := s.failures > 0
+	if fail {
+		s.failures--
+	}
+	code, delay := s.code, s.delay
+	s.mu.Unlock()
+
+	if fail {
+		return nil, status.Error(code, "injected failure")
+	}
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+// fail makes the next n calls fail with code.
+func (s *faultServer) fail(n int, code codes.Code) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures, s.code = n, code
+}
+
+func (s *faultServer) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// dialTest serves s in process and dials it with o, treating Check as a
+// read.
+func dialTest(t *testing.T, s *faultServer, o Options) healthpb.HealthClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, s)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	o.Dialer = func(ctx context.Context, addr string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	conn, err := Dial("passthrough:///health", testService, []string{"Check"}, o)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func check(ctx context.Context, c healthpb.HealthClient) error {
+	_, err := c.Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func TestDialRetriesUnavailableReads(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		failures    int
+		code        codes.Code
+		want        codes.Code
+		calls       int
+	}{
+		{"recovers within the attempts", 3, 2, codes.Unavailable, codes.OK, 3},
+		{"gives up after the attempts", 3, 5, codes.Unavailable, codes.Unavailable, 3},
+		{"retries disabled", 1, 1, codes.Unavailable, codes.Unavailable, 1},
+		{"answered errors are not retried", 3, 1, codes.NotFound, codes.NotFound, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &faultServer{}
+			s.fail(tt.failures, tt.code)
+			c := dialTest(t, s, Options{Timeout: 5 * time.Second, MaxAttempts: tt.maxAttempts, LoadBalancing: "pick_first"})
+
+			err := check(context.Background(), c)
+			if status.Code(err) != tt.want {
+				t.Errorf("Check = %v, want %v", err, tt.want)
+			}
+			if n := s.callCount(); n != tt.calls {
+				t.Errorf("server got %d calls, want %d", n, tt.calls)
+			}
+		})
+	}
+}
+
+func TestDialPropagatesDeadlines(t *testing.T) {
+	s := &faultServer{}
+	c := dialTest(t, s, Options{Timeout: 2 * time.Second, LoadBalancing: "pick_first"})
+
+	// A call without a deadline gets the default one.
+	if err := check(context.Background(), c); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	// The caller's deadline is kept, even when it is longer.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := check(ctx, c); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	s.mu.Lock()
+	deadlines := s.deadlines
+	s.mu.Unlock()
+	if d := deadlines[0]; d <= time.Second || d > 2*time.Second {
+		t.Errorf("default deadline reached the server as %v, want about 2s", d)
+	}
+	if d := deadlines[1]; d <= 50*time.Second || d > time.Minute {
+		t.Errorf("caller's deadline reached the server as %v, want about 1m", d)
+	}
+
+	// A server slower than the deadline is cut off.
+	s.mu.Lock()
+	s.delay = time.Second
+	s.mu.Unlock()
+	short := dialTest(t, s, Options{Timeout: 50 * time.Millisecond, LoadBalancing: "pick_first"})
+	err := check(context.Background(), short)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Check of a slow server = %v, want %v", err, codes.DeadlineExceeded)
+	}
+	if !IsUnavailable(err) {
+		t.Errorf("IsUnavailable(%v) = false, want true", err)
+	}
+}
+
+func TestDialBreaker(t *testing.T) {
+	s := &faultServer{}
+	s.fail(100, codes.Unavailable)
+	cooldown := 100 * time.Millisecond
+	c := dialTest(t, s, Options{
+		Timeout:         5 * time.Second,
+		MaxAttempts:     1,
+		BreakerFailures: 3,
+		BreakerCooldown: cooldown,
+		LoadBalancing:   "pick_first",
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := check(ctx, c); status.Code(err) != codes.Unavailable || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("call %d = %v, want the server's Unavailable", i+1, err)
+		}
+	}
+	// The breaker is open: calls fail without reaching the server.
+	err := check(ctx, c)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("call with the breaker open = %v, want %v", err, ErrCircuitOpen)
+	}
+	if !IsUnavailable(err) {
+		t.Errorf("IsUnavailable(%v) = false, want true", err)
+	}
+	if n := s.callCount(); n != 3 {
+		t.Fatalf("server got %d calls, want 3", n)
+	}
+
+	// After the cooldown one trial call goes through; it fails, so the
+	// breaker opens again.
+	time.Sleep(cooldown)
+	if err := check(ctx, c); errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("trial call = %v, want it to reach the server", err)
+	}
+	if n := s.callCount(); n != 4 {
+		t.Fatalf("server got %d calls, want 4", n)
+	}
+	if err := check(ctx, c); !errors.Is(err, ErrCircuitOpen) || s.callCount() != 4 {
+		t.Fatalf("call after a failed trial = %v, want the breaker open again", err)
+	}
+
+	// The next trial succeeds and closes the breaker.
+	s.fail(0, codes.OK)
+	time.Sleep(cooldown)
+	for i := 0; i < 3; i++ {
+		if err := check(ctx, c); err != nil {
+			t.Fatalf("call %d after the service recovered: %v", i+1, err)
+		}
+	}
+	if n := s.callCount(); n != 7 {
+		t.Errorf("server got %d calls, want 7", n)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	b := NewBreaker("test", 2, time.Minute)
+	b.now = func() time.Time { return now }
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("call %d not allowed while the breaker is closed", i+1)
+		}
+		b.Done(unavailable)
+	}
+	if b.Allow() {
+		t.Fatal("call allowed while the breaker is open")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.Allow() {
+		t.Fatal("trial call not allowed after the cooldown")
+	}
+	if b.Allow() {
+		t.Error("second call allowed while the trial call is in flight")
+	}
+	b.abandon()
+	if !b.Allow() {
+		t.Fatal("call not allowed after the trial call was abandoned")
+	}
+	b.Done(status.Error(codes.NotFound, "answered"))
+	if !b.Allow() || !b.Allow() {
+		t.Error("calls not allowed after the trial call succeeded")
+	}
+}
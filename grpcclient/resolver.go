@@ -0,0 +1,81 @@
+package grpcclient
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// StaticScheme names the resolver of fixed address lists, as in
+// "static:///catalog-1:8082,catalog-2:8082".
+const StaticScheme = "static"
+
+var (
+	resolversMu sync.RWMutex
+	resolvers   = map[string]resolver.Builder{StaticScheme: staticBuilder{}}
+)
+
+// RegisterResolver makes the scheme of b available to the URLs of every
+// client dialed afterwards, for service discovery beyond DNS and static
+// lists. It replaces a resolver registered for the same scheme.
+func RegisterResolver(b resolver.Builder) {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	resolvers[b.Scheme()] = b
+}
+
+func registeredResolvers() []resolver.Builder {
+	resolversMu.RLock()
+	defer resolversMu.RUnlock()
+	builders := make([]resolver.Builder, 0, len(resolvers))
+	for _, b := range resolvers {
+		builders = append(builders, b)
+	}
+	return builders
+}
+
+// Target turns a service URL into a gRPC target. A comma-separated list of
+// addresses is resolved statically; a URL with a scheme, such as
+// "dns:///catalog:8082", is used as it is; a single address is resolved
+// through DNS, so all the addresses a host name resolves to are used.
+func Target(url string) string {
+	switch {
+	case strings.Contains(url, "://"):
+		return url
+	case strings.Contains(url, ","):
+		return StaticScheme + ":///" + url
+	}
+	return "dns:///" + url
+}
+
+type staticBuilder struct{}
+
+func (staticBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	addresses := []resolver.Address{}
+	for _, addr := range strings.Split(target.Endpoint(), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addresses = append(addresses, resolver.Address{Addr: addr})
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("static target %q has no addresses", target.URL.String())
+	}
+
+	if err := cc.UpdateState(resolver.State{Addresses: addresses}); err != nil {
+		return nil, err
+	}
+	return staticResolver{}, nil
+}
+
+func (staticBuilder) Scheme() string {
+	return StaticScheme
+}
+
+// staticResolver has nothing to resolve again: its addresses never change.
+type staticResolver struct{}
+
+func (staticResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (staticResolver) Close() {}
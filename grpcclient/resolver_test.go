@@ -0,0 +1,171 @@
+package grpcclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestTarget(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"catalog:8082", "dns:///catalog:8082"},
+		{"catalog-1:8082,catalog-2:8082", "static:///catalog-1:8082,catalog-2:8082"},
+		{"static:///catalog-1:8082", "static:///catalog-1:8082"},
+		{"dns://8.8.8.8/catalog.internal:8082", "dns://8.8.8.8/catalog.internal:8082"},
+	}
+	for _, tt := range tests {
+		if got := Target(tt.url); got != tt.want {
+			t.Errorf("Target(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+// serveReplicas serves n replicas in process, at the addresses replica-0:1
+// to replica-<n-1>:1, and returns their servers and a dialer of them.
+func serveReplicas(t *testing.T, n int) ([]*faultServer, []string, func(context.Context, string) (net.Conn, error)) {
+	t.Helper()
+	servers := []*faultServer{}
+	addresses := []string{}
+	listeners := map[string]*bufconn.Listener{}
+	for i := 0; i < n; i++ {
+		s := &faultServer{}
+		lis := bufconn.Listen(1 << 20)
+		srv := grpc.NewServer()
+		healthpb.RegisterHealthServer(srv, s)
+		go srv.Serve(lis)
+		t.Cleanup(srv.Stop)
+
+		addr := fmt.Sprintf("replica-%d:1", i)
+		servers = append(servers, s)
+		addresses = append(addresses, addr)
+		listeners[addr] = lis
+	}
+	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		lis, ok := listeners[addr]
+		if !ok {
+			return nil, fmt.Errorf("no replica at %s", addr)
+		}
+		return lis.DialContext(ctx)
+	}
+	return servers, addresses, dialer
+}
+
+// callCounts returns how many calls each server got.
+func callCounts(servers []*faultServer) []int {
+	counts := []int{}
+	for _, s := range servers {
+		counts = append(counts, s.callCount())
+	}
+	return counts
+}
+
+// reached returns how many servers got a call.
+func reached(servers []*faultServer) int {
+	n := 0
+	for _, s := range servers {
+		if s.callCount() > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDialBalancesStaticAddresses(t *testing.T) {
+	tests := []struct {
+		name string
+		url  func(addresses []string) string
+	}{
+		{"address list", func(addresses []string) string { return strings.Join(addresses, ",") }},
+		{"static scheme with spaces", func(addresses []string) string { return "static:///" + strings.Join(addresses, ", ") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers, addresses, dialer := serveReplicas(t, 3)
+			conn, err := Dial(tt.url(addresses), testService, nil, Options{Timeout: 5 * time.Second, LoadBalancing: "round_robin", Dialer: dialer})
+			if err != nil {
+				t.Fatalf("Dial: %v", err)
+			}
+			defer conn.Close()
+			c := healthpb.NewHealthClient(conn)
+			ctx := context.Background()
+
+			// Calls go to the replicas that are connected; wait until every
+			// replica is.
+			deadline := time.Now().Add(5 * time.Second)
+			for reached(servers) < len(servers) {
+				if time.Now().After(deadline) {
+					t.Fatalf("calls reached only %v of the replicas", callCounts(servers))
+				}
+				if err := check(ctx, c); err != nil {
+					t.Fatalf("Check: %v", err)
+				}
+			}
+
+			before := callCounts(servers)
+			for i := 0; i < 30; i++ {
+				if err := check(ctx, c); err != nil {
+					t.Fatalf("Check: %v", err)
+				}
+			}
+			for i, n := range callCounts(servers) {
+				if got := n - before[i]; got != 10 {
+					t.Errorf("replica %d got %d of 30 calls, want 10", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDialPickFirst(t *testing.T) {
+	servers, addresses, dialer := serveReplicas(t, 3)
+	conn, err := Dial(strings.Join(addresses, ","), testService, nil, Options{Timeout: 5 * time.Second, LoadBalancing: "pick_first", Dialer: dialer})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	c := healthpb.NewHealthClient(conn)
+
+	for i := 0; i < 30; i++ {
+		if err := check(context.Background(), c); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+	}
+	if n := reached(servers); n != 1 {
+		t.Errorf("calls were spread as %v, want them all on one replica", callCounts(servers))
+	}
+}
+
+func TestDialSkipsDownReplicas(t *testing.T) {
+	servers, addresses, dialer := serveReplicas(t, 2)
+	// The first replica in the list is not running.
+	url := "replica-down:1," + strings.Join(addresses, ",")
+	conn, err := Dial(url, testService, nil, Options{Timeout: 5 * time.Second, LoadBalancing: "round_robin", Dialer: dialer})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	c := healthpb.NewHealthClient(conn)
+
+	for i := 0; i < 20; i++ {
+		if err := check(context.Background(), c); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	total := 0
+	for _, n := range callCounts(servers) {
+		total += n
+	}
+	if total != 20 {
+		t.Errorf("running replicas got %d of 20 calls", total)
+	}
+}
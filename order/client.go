@@ -3,12 +3,15 @@ package order
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"time"
 
+	"github.com/donaldnash/go-marketplace/grpcclient"
 	"github.com/donaldnash/go-marketplace/order/pb"
+	"github.com/donaldnash/go-marketplace/payment"
+	"github.com/donaldnash/go-marketplace/promotion"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 type Client struct {
@@ -16,20 +19,33 @@ type Client struct {
 	service pb.OrderServiceClient
 }
 
+// readMethods are the methods retried while the order service is unavailable.
+var readMethods = []string{
+	"GetOrdersForAccount",
+	"GetOrder",
+	"HasOrdered",
+	"QuoteOrder",
+	"GetPromotion",
+	"GetPromotions",
+	"GetReturnsForOrder",
+	"GetSellerOrders",
+	"GetSalesReport",
+}
+
+// NewClient returns a client of the order service at url with the default
+// options. It does not wait for the service to be up.
 func NewClient(url string) (*Client, error) {
+	return NewClientWithOptions(url, grpcclient.DefaultOptions())
+}
+
+func NewClientWithOptions(url string, o grpcclient.Options) (*Client, error) {
 	if url == "" {
 		return nil, fmt.Errorf("order service URL cannot be empty")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	conn, err := grpc.DialContext(ctx, url,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock(),
-	)
+	conn, err := grpcclient.Dial(url, pb.OrderService_ServiceDesc.ServiceName, readMethods, o)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to order service: %v", err)
+		return nil, fmt.Errorf("failed to create order service client: %v", err)
 	}
 	c := pb.NewOrderServiceClient(conn)
 	return &Client{conn, c}, nil
@@ -39,33 +55,51 @@ func (c *Client) Close() {
 	c.conn.Close()
 }
 
-func (c *Client) PostOrder(ctx context.Context, accountID string, products []OrderedProduct) (*Order, error) {
-	protoProducts := []*pb.PostOrderRequest_OrderProduct{}
-	for _, p := range products {
-		protoProducts = append(protoProducts, &pb.PostOrderRequest_OrderProduct{
-			ProductId: p.ID,
-			Quantity:  p.Quantity,
-		})
+// PostOrder asks the order service to price and place an order. Only the ID
+// and quantity of each product are sent. If any line is rejected, no order is
+// placed and the result lists the rejected lines instead.
+func (c *Client) PostOrder(ctx context.Context, r OrderRequest) (*PostOrderResult, error) {
+	res, err := c.service.PostOrder(ctx, &pb.PostOrderRequest{
+		AccountId:         r.AccountID,
+		Products:          orderLinesToProto(r.Products),
+		CouponCode:        r.CouponCode,
+		TaxCountry:        r.TaxLocation.Country,
+		TaxRegion:         r.TaxLocation.Region,
+		ShippingAddressId: r.ShippingAddressID,
+		ShippingMethod:    r.ShippingMethod,
+		IdempotencyKey:    r.IdempotencyKey,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	r, err := c.service.PostOrder(ctx, &pb.PostOrderRequest{
-		AccountId: accountID,
-		Products:  protoProducts,
+	if len(res.RejectedLines) > 0 {
+		return &PostOrderResult{RejectedLines: rejectedLinesFromProto(res.RejectedLines)}, nil
+	}
+	o := orderFromProto(res.Order)
+	return &PostOrderResult{Order: &o}, nil
+}
+
+// QuoteOrder prices an order, including its coupon, without placing it.
+func (c *Client) QuoteOrder(ctx context.Context, r OrderRequest) (*PostOrderResult, error) {
+	res, err := c.service.QuoteOrder(ctx, &pb.QuoteOrderRequest{
+		AccountId:         r.AccountID,
+		Products:          orderLinesToProto(r.Products),
+		CouponCode:        r.CouponCode,
+		TaxCountry:        r.TaxLocation.Country,
+		TaxRegion:         r.TaxLocation.Region,
+		ShippingAddressId: r.ShippingAddressID,
+		ShippingMethod:    r.ShippingMethod,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	newOrder := r.Order
-	newOrderCreatedAt := time.Time{}
-	newOrderCreatedAt.UnmarshalBinary(newOrder.CreatedAt)
-	return &Order{
-		ID:         newOrder.Id,
-		CreatedAt:  newOrderCreatedAt,
-		TotalPrice: newOrder.TotalPrice,
-		AccountID:  newOrder.AccountId,
-		Products:   products,
-	}, nil
+	if len(res.RejectedLines) > 0 {
+		return &PostOrderResult{RejectedLines: rejectedLinesFromProto(res.RejectedLines)}, nil
+	}
+	o := orderFromProto(res.Order)
+	return &PostOrderResult{Order: &o}, nil
 }
 
 func (c *Client) GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error) {
@@ -80,26 +114,232 @@ func (c *Client) GetOrdersForAccount(ctx context.Context, accountID string) ([]O
 
 	orders := []Order{}
 	for _, orderProto := range r.Orders {
-		newOrder := Order{
-			ID:         orderProto.Id,
-			TotalPrice: orderProto.TotalPrice,
-			AccountID:  orderProto.AccountId,
-		}
-		newOrder.CreatedAt = time.Time{}
-		newOrder.CreatedAt.UnmarshalBinary(orderProto.CreatedAt)
-		products := []OrderedProduct{}
-		for _, p := range orderProto.Products {
-			products = append(products, OrderedProduct{
-				ID:          p.Id,
-				Quantity:    p.Quantity,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
-		}
-		newOrder.Products = products
-		orders = append(orders, newOrder)
+		orders = append(orders, orderFromProto(orderProto))
+	}
+
+	return orders, nil
+}
+
+// HasOrdered reports whether accountID has paid for an order of productID.
+func (c *Client) HasOrdered(ctx context.Context, accountID string, productID string) (bool, error) {
+	r, err := c.service.HasOrdered(ctx, &pb.HasOrderedRequest{
+		AccountId: accountID,
+		ProductId: productID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return r.Ordered, nil
+}
+
+func (c *Client) GetSellerOrders(ctx context.Context, sellerID string, skip uint64, take uint64) ([]SellerOrder, error) {
+	r, err := c.service.GetSellerOrders(ctx, &pb.GetSellerOrdersRequest{
+		SellerId: sellerID,
+		Skip:     skip,
+		Take:     take,
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	orders := []SellerOrder{}
+	for _, so := range r.Orders {
+		orders = append(orders, sellerOrderFromProto(so))
+	}
 	return orders, nil
 }
+
+func (c *Client) GetSalesReport(ctx context.Context, sellerID string, from time.Time, to time.Time) (*SalesReport, error) {
+	r, err := c.service.GetSalesReport(ctx, &pb.GetSalesReportRequest{
+		SellerId: sellerID,
+		From:     timeToProto(from),
+		To:       timeToProto(to),
+	})
+	if err != nil {
+		return nil, err
+	}
+	report := salesReportFromProto(r.Report)
+	return &report, nil
+}
+
+func (c *Client) GetOrder(ctx context.Context, id string) (*Order, error) {
+	r, err := c.service.GetOrder(ctx, &pb.GetOrderRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	o := orderFromProto(r.Order)
+	return &o, nil
+}
+
+// WatchOrders streams the orders of accountID as they are placed or change
+// status. The channel is closed when ctx is done or the stream breaks.
+func (c *Client) WatchOrders(ctx context.Context, accountID string) (<-chan Order, error) {
+	stream, err := c.service.WatchOrders(ctx, &pb.WatchOrdersRequest{
+		AccountId: accountID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make(chan Order)
+	go func() {
+		defer close(orders)
+		for {
+			op, err := stream.Recv()
+			if err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					log.Printf("Error watching orders of account %s: %v", accountID, err)
+				}
+				return
+			}
+			select {
+			case orders <- orderFromProto(op):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return orders, nil
+}
+
+// PayOrder charges a pending order of accountID to the payment method behind
+// token.
+func (c *Client) PayOrder(ctx context.Context, orderID string, accountID string, token string) (*payment.Payment, error) {
+	r, err := c.service.PayOrder(ctx, &pb.PayOrderRequest{
+		OrderId:      orderID,
+		AccountId:    accountID,
+		PaymentToken: token,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p := paymentFromProto(r.Payment)
+	return &p, nil
+}
+
+// CancelOrder cancels an order of accountID that is awaiting payment.
+func (c *Client) CancelOrder(ctx context.Context, orderID string, accountID string) (*Order, error) {
+	r, err := c.service.CancelOrder(ctx, &pb.CancelOrderRequest{
+		OrderId:   orderID,
+		AccountId: accountID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	o := orderFromProto(r.Order)
+	return &o, nil
+}
+
+// ApplyPaymentEvent hands a verified provider callback to the order service.
+func (c *Client) ApplyPaymentEvent(ctx context.Context, e payment.Event) error {
+	_, err := c.service.ApplyPaymentEvent(ctx, &pb.ApplyPaymentEventRequest{
+		Event: &pb.PaymentEvent{
+			Id:        e.ID,
+			Type:      string(e.Type),
+			Provider:  e.Provider,
+			Reference: e.Reference,
+			Amount:    e.Amount,
+			Reason:    e.Reason,
+		},
+	})
+	return err
+}
+
+func (c *Client) RequestReturn(ctx context.Context, r ReturnRequest) (*Return, error) {
+	return returnResult(c.service.RequestReturn(ctx, &pb.RequestReturnRequest{
+		OrderId:   r.OrderID,
+		AccountId: r.AccountID,
+		Reason:    r.Reason,
+		Lines:     returnLinesToProto(r.Lines),
+	}))
+}
+
+func (c *Client) ApproveReturn(ctx context.Context, id string) (*Return, error) {
+	return returnResult(c.service.ApproveReturn(ctx, &pb.ReturnIdRequest{Id: id}))
+}
+
+func (c *Client) RejectReturn(ctx context.Context, id string, reason string) (*Return, error) {
+	return returnResult(c.service.RejectReturn(ctx, &pb.RejectReturnRequest{Id: id, Reason: reason}))
+}
+
+func (c *Client) ReceiveReturn(ctx context.Context, id string) (*Return, error) {
+	return returnResult(c.service.ReceiveReturn(ctx, &pb.ReturnIdRequest{Id: id}))
+}
+
+// RefundReturn refunds amount of a received return; 0 refunds all of it.
+func (c *Client) RefundReturn(ctx context.Context, id string, amount float64) (*Return, error) {
+	return returnResult(c.service.RefundReturn(ctx, &pb.RefundReturnRequest{Id: id, Amount: amount}))
+}
+
+func returnResult(r *pb.ReturnResponse, err error) (*Return, error) {
+	if err != nil {
+		return nil, err
+	}
+	ret := returnFromProto(r.Return)
+	return &ret, nil
+}
+
+func (c *Client) GetReturnsForOrder(ctx context.Context, orderID string) ([]Return, error) {
+	r, err := c.service.GetReturnsForOrder(ctx, &pb.GetReturnsForOrderRequest{OrderId: orderID})
+	if err != nil {
+		return nil, err
+	}
+
+	returns := []Return{}
+	for _, ret := range r.Returns {
+		returns = append(returns, returnFromProto(ret))
+	}
+	return returns, nil
+}
+
+func (c *Client) PostPromotion(ctx context.Context, p promotion.Promotion) (*promotion.Promotion, error) {
+	r, err := c.service.PostPromotion(ctx, &pb.PostPromotionRequest{
+		Promotion: promotionToProto(p),
+	})
+	if err != nil {
+		return nil, err
+	}
+	created := promotionFromProto(r.Promotion)
+	return &created, nil
+}
+
+func (c *Client) UpdatePromotion(ctx context.Context, p promotion.Promotion) (*promotion.Promotion, error) {
+	r, err := c.service.UpdatePromotion(ctx, &pb.UpdatePromotionRequest{
+		Promotion: promotionToProto(p),
+	})
+	if err != nil {
+		return nil, err
+	}
+	updated := promotionFromProto(r.Promotion)
+	return &updated, nil
+}
+
+func (c *Client) DeletePromotion(ctx context.Context, id string) error {
+	_, err := c.service.DeletePromotion(ctx, &pb.DeletePromotionRequest{Id: id})
+	return err
+}
+
+func (c *Client) GetPromotion(ctx context.Context, id string) (*promotion.Promotion, error) {
+	r, err := c.service.GetPromotion(ctx, &pb.GetPromotionRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	p := promotionFromProto(r.Promotion)
+	return &p, nil
+}
+
+func (c *Client) GetPromotions(ctx context.Context, skip uint64, take uint64) ([]promotion.Promotion, error) {
+	r, err := c.service.GetPromotions(ctx, &pb.GetPromotionsRequest{
+		Skip: skip,
+		Take: take,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	promotions := []promotion.Promotion{}
+	for _, p := range r.Promotions {
+		promotions = append(promotions, promotionFromProto(p))
+	}
+	return promotions, nil
+}
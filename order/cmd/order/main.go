@@ -1,27 +1,67 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/donaldnash/go-marketplace/account"
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/grpcclient"
+	"github.com/donaldnash/go-marketplace/migrate"
 	"github.com/donaldnash/go-marketplace/order"
+	"github.com/donaldnash/go-marketplace/outbox"
+	"github.com/donaldnash/go-marketplace/payment"
+	"github.com/donaldnash/go-marketplace/promotion"
+	"github.com/donaldnash/go-marketplace/ratelimit"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tinrab/retry"
+	"google.golang.org/grpc"
 )
 
+type MigrateConfig struct {
+	DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
+}
+
 type Config struct {
 	DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
 	AccountURL  string `envconfig:"ACCOUNT_SERVICE_URL" required:"true"`
 	CatalogURL  string `envconfig:"CATALOG_SERVICE_URL" required:"true"`
 	Port        int    `envconfig:"PORT" default:"8083"`
+	AutoMigrate bool   `envconfig:"AUTO_MIGRATE" default:"false"`
+	// How long account and product lookups are cached by the order service
+	ReferenceCacheTTL time.Duration `envconfig:"REFERENCE_CACHE_TTL" default:"30s"`
+	// JSON file with tax rules; the built-in rules are used when unset
+	TaxRulesFile string `envconfig:"TAX_RULES_FILE"`
+	// Standard shipping costs a base rate plus a rate per kilogram and is
+	// free from a minimum order amount on; express shipping is a flat rate
+	ShippingBaseRate    float64 `envconfig:"SHIPPING_BASE_RATE" default:"4.99"`
+	ShippingRatePerKg   float64 `envconfig:"SHIPPING_RATE_PER_KG" default:"1.50"`
+	ShippingFreeOver    float64 `envconfig:"SHIPPING_FREE_OVER" default:"50"`
+	ShippingExpressRate float64 `envconfig:"SHIPPING_EXPRESS_RATE" default:"14.99"`
+	PaymentProvider     string  `envconfig:"PAYMENT_PROVIDER" default:"fake"`
+	// Share of each seller's sales the marketplace keeps
+	CommissionRate float64 `envconfig:"COMMISSION_RATE" default:"0.10"`
+	// Per-method gRPC quotas such as "PostOrder=10/s:20"; other methods get
+	// RATE_LIMIT_DEFAULT, or no limit when it is empty
+	RateLimits       string `envconfig:"RATE_LIMITS"`
+	RateLimitDefault string `envconfig:"RATE_LIMIT_DEFAULT"`
+	outbox.Config
+	grpcclient.Options
 }
 
 func main() {
 	// Initialize logger
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	log.Println("Starting Order service...")
 
 	// Load configuration
@@ -30,8 +70,13 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	log.Printf("Configuration loaded:\n  Database URL: %s\n  Account URL: %s\n  Catalog URL: %s\n  Port: %d",
-		cfg.DatabaseURL, cfg.AccountURL, cfg.CatalogURL, cfg.Port)
+	log.Printf("Configuration loaded:\n  Database URL: %s\n  Account URL: %s\n  Catalog URL: %s\n  Port: %d\n  Auto migrate: %t\n  Reference cache TTL: %s\n  Event publisher: %s",
+		cfg.DatabaseURL, cfg.AccountURL, cfg.CatalogURL, cfg.Port, cfg.AutoMigrate, cfg.ReferenceCacheTTL, cfg.Publisher)
+
+	// Apply pending schema migrations
+	if cfg.AutoMigrate {
+		applyMigrations(cfg.DatabaseURL)
+	}
 
 	// Initialize repository with retry
 	var repository order.Repository
@@ -50,8 +95,70 @@ func main() {
 
 	log.Println("Successfully connected to database")
 
+	// Relay domain events from the outbox
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	startRelay(relayCtx, cfg.DatabaseURL, cfg.Config)
+
+	// Promotions live in the order database
+	promotionRepository, err := promotion.NewPostgresRepository(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to create promotion repository: %v", err)
+	}
+	defer promotionRepository.Close()
+	promotions := promotion.NewService(promotionRepository)
+
+	// Clients of the services that own accounts and products connect on
+	// first use, so they can start after this service
+	accountClient, err := account.NewClientWithOptions(cfg.AccountURL, cfg.Options)
+	if err != nil {
+		log.Fatalf("Failed to create account client: %v", err)
+	}
+	defer accountClient.Close()
+
+	catalogClient, err := catalog.NewClientWithOptions(cfg.CatalogURL, cfg.Options)
+	if err != nil {
+		log.Fatalf("Failed to create catalog client: %v", err)
+	}
+	defer catalogClient.Close()
+
+	taxCalculator, err := order.NewRuleTaxCalculator(loadTaxRules(cfg.TaxRulesFile))
+	if err != nil {
+		log.Fatalf("Invalid tax rules: %v", err)
+	}
+
+	standardShipping := order.NewWeightRate(cfg.ShippingBaseRate, cfg.ShippingRatePerKg)
+	if cfg.ShippingFreeOver > 0 {
+		standardShipping = order.NewFreeOver(cfg.ShippingFreeOver, standardShipping)
+	}
+	shipping := order.NewShippingMethods(map[string]order.ShippingCalculator{
+		order.DefaultShippingMethod: standardShipping,
+		"express":                   order.NewFlatRate(cfg.ShippingExpressRate),
+	})
+
+	commission, err := order.NewFlatCommission(cfg.CommissionRate)
+	if err != nil {
+		log.Fatalf("Invalid commission rate: %v", err)
+	}
+
+	payments := newPaymentProvider(cfg.PaymentProvider)
+	feed := order.NewFeed()
+	inventory := order.NewCatalogInventory(catalogClient)
+
 	// Create service
-	service := order.NewService(repository)
+	service := order.NewService(
+		repository,
+		order.NewCachedAccountDirectory(accountClient, cfg.ReferenceCacheTTL),
+		order.NewCachedProductDirectory(catalogClient, cfg.ReferenceCacheTTL),
+		inventory,
+		promotions,
+		taxCalculator,
+		shipping,
+		commission,
+		payments,
+		feed,
+	)
+	returns := order.NewReturnService(repository, payments, order.NewInventoryRestocker(inventory), feed)
 
 	// Handle graceful shutdown
 	done := make(chan bool)
@@ -61,16 +168,117 @@ func main() {
 	go func() {
 		<-quit
 		log.Println("Service is shutting down...")
+		stopRelay()
 		repository.Close()
 		close(done)
 	}()
 
+	limiter, err := ratelimit.NewServerInterceptor(ratelimit.NewMemoryStore(), cfg.RateLimits, cfg.RateLimitDefault)
+	if err != nil {
+		log.Fatalf("Failed to configure rate limits: %v", err)
+	}
+
 	// Start gRPC server
 	log.Printf("Starting gRPC server on port %d...", cfg.Port)
-	if err := order.ListenGRPC(service, cfg.AccountURL, cfg.CatalogURL, cfg.Port); err != nil {
+	if err := order.ListenGRPC(service, promotions, returns, cfg.Port, grpc.UnaryInterceptor(limiter)); err != nil {
 		log.Fatalf("Failed to start gRPC server: %v", err)
 	}
 
 	<-done
 	log.Println("Service stopped")
 }
+
+func loadTaxRules(path string) []order.TaxRule {
+	if path == "" {
+		return order.DefaultTaxRules()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open tax rules: %v", err)
+	}
+	defer f.Close()
+
+	rules, err := order.LoadTaxRules(f)
+	if err != nil {
+		log.Fatalf("Failed to load tax rules: %v", err)
+	}
+	log.Printf("Loaded %d tax rules from %s", len(rules), path)
+	return rules
+}
+
+// newPaymentProvider returns the provider named by PAYMENT_PROVIDER. Only the
+// fake provider exists so far; it never moves real money.
+func newPaymentProvider(name string) payment.Provider {
+	switch name {
+	case "fake":
+		log.Println("Using the fake payment provider")
+		return payment.NewFakeProvider()
+	}
+	log.Fatalf("Unknown payment provider %q", name)
+	return nil
+}
+
+func startRelay(ctx context.Context, databaseURL string, cfg outbox.Config) {
+	publisher, err := outbox.NewPublisher(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create event publisher: %v", err)
+	}
+
+	var store outbox.Store
+	retry.ForeverSleep(2*time.Second, func(_ int) error {
+		store, err = outbox.NewPostgresStore(databaseURL)
+		if err != nil {
+			log.Printf("Failed to connect to outbox: %v", err)
+			return err
+		}
+		return nil
+	})
+
+	go func() {
+		defer store.Close()
+		defer publisher.Close()
+		outbox.NewRelay(store, publisher, cfg.PollInterval).Run(ctx)
+	}()
+}
+
+func runMigrate(args []string) {
+	var cfg MigrateConfig
+	if err := envconfig.Process("", &cfg); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	m, err := migrate.Open(cfg.DatabaseURL, order.Migrations())
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer m.Close()
+
+	if err := migrate.Run(context.Background(), m, args, os.Stdout); err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
+
+func applyMigrations(databaseURL string) {
+	var m *migrate.Migrator
+	var err error
+
+	log.Println("Applying database migrations...")
+	retry.ForeverSleep(2*time.Second, func(_ int) error {
+		m, err = migrate.Open(databaseURL, order.Migrations())
+		if err != nil {
+			log.Printf("Failed to connect to database: %v", err)
+			return err
+		}
+		return nil
+	})
+	defer m.Close()
+
+	applied, err := m.Up(context.Background())
+	for _, mig := range applied {
+		log.Printf("Applied migration %04d_%s", mig.Version, mig.Name)
+	}
+	if err != nil {
+		log.Fatalf("Failed to apply migrations: %v", err)
+	}
+}
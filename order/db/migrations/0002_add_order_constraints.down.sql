@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS order_products_product_id_idx;
+DROP INDEX IF EXISTS orders_account_id_created_at_idx;
+
+ALTER TABLE orders
+    DROP CONSTRAINT IF EXISTS orders_total_price_check;
+
+ALTER TABLE order_products
+    DROP CONSTRAINT IF EXISTS order_products_price_check,
+    DROP CONSTRAINT IF EXISTS order_products_quantity_check,
+    DROP CONSTRAINT IF EXISTS order_products_order_id_fkey;
@@ -0,0 +1,11 @@
+ALTER TABLE order_products
+    ADD CONSTRAINT order_products_order_id_fkey
+        FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    ADD CONSTRAINT order_products_quantity_check CHECK (quantity > 0),
+    ADD CONSTRAINT order_products_price_check CHECK (price >= 0);
+
+ALTER TABLE orders
+    ADD CONSTRAINT orders_total_price_check CHECK (total_price >= 0);
+
+CREATE INDEX IF NOT EXISTS orders_account_id_created_at_idx ON orders(account_id, created_at);
+CREATE INDEX IF NOT EXISTS order_products_product_id_idx ON order_products(product_id);
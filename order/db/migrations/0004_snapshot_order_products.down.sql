@@ -0,0 +1,3 @@
+ALTER TABLE order_products
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS name;
@@ -0,0 +1,5 @@
+-- Lines placed before this migration have no snapshot; their name and
+-- description are filled in from the catalog when they are read.
+ALTER TABLE order_products
+    ADD COLUMN IF NOT EXISTS name VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS discount_total,
+    DROP COLUMN IF EXISTS subtotal;
+
+DROP TABLE IF EXISTS order_discounts;
+DROP TABLE IF EXISTS promotions;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS promotions (
+    id VARCHAR PRIMARY KEY,
+    code VARCHAR NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    kind VARCHAR NOT NULL CHECK (kind IN ('PERCENTAGE', 'FIXED_AMOUNT', 'BUY_X_GET_Y')),
+    value DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (value >= 0),
+    buy_quantity INTEGER NOT NULL DEFAULT 0 CHECK (buy_quantity >= 0),
+    get_quantity INTEGER NOT NULL DEFAULT 0 CHECK (get_quantity >= 0),
+    product_ids VARCHAR[] NOT NULL DEFAULT '{}',
+    min_spend DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (min_spend >= 0),
+    usage_limit_per_account INTEGER NOT NULL DEFAULT 0 CHECK (usage_limit_per_account >= 0),
+    valid_from TIMESTAMP,
+    valid_until TIMESTAMP,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS order_discounts (
+    order_id VARCHAR NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    promotion_id VARCHAR NOT NULL REFERENCES promotions(id) ON DELETE RESTRICT,
+    code VARCHAR NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    amount DECIMAL(10,2) NOT NULL CHECK (amount >= 0),
+    PRIMARY KEY (order_id, promotion_id)
+);
+
+CREATE INDEX IF NOT EXISTS order_discounts_promotion_id_idx ON order_discounts(promotion_id);
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS subtotal DECIMAL(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS discount_total DECIMAL(10,2) NOT NULL DEFAULT 0;
+
+UPDATE orders SET subtotal = total_price;
@@ -0,0 +1,8 @@
+ALTER TABLE order_products
+    DROP COLUMN IF EXISTS tax,
+    DROP COLUMN IF EXISTS tax_category;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS tax_total,
+    DROP COLUMN IF EXISTS tax_region,
+    DROP COLUMN IF EXISTS tax_country;
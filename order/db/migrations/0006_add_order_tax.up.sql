@@ -0,0 +1,8 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS tax_country VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tax_region VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tax_total DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (tax_total >= 0);
+
+ALTER TABLE order_products
+    ADD COLUMN IF NOT EXISTS tax_category VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tax DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (tax >= 0);
@@ -0,0 +1,14 @@
+ALTER TABLE order_products
+    DROP COLUMN IF EXISTS weight;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS shipping_total,
+    DROP COLUMN IF EXISTS shipping_method,
+    DROP COLUMN IF EXISTS shipping_country,
+    DROP COLUMN IF EXISTS shipping_postal_code,
+    DROP COLUMN IF EXISTS shipping_region,
+    DROP COLUMN IF EXISTS shipping_city,
+    DROP COLUMN IF EXISTS shipping_line2,
+    DROP COLUMN IF EXISTS shipping_line1,
+    DROP COLUMN IF EXISTS shipping_name,
+    DROP COLUMN IF EXISTS shipping_address_id;
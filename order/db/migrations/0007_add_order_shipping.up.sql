@@ -0,0 +1,14 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS shipping_address_id VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS shipping_name VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS shipping_line1 VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS shipping_line2 VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS shipping_city VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS shipping_region VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS shipping_postal_code VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS shipping_country VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS shipping_method VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS shipping_total DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (shipping_total >= 0);
+
+ALTER TABLE order_products
+    ADD COLUMN IF NOT EXISTS weight DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (weight >= 0);
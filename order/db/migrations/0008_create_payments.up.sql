@@ -0,0 +1,27 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS status VARCHAR NOT NULL DEFAULT 'PENDING'
+        CHECK (status IN ('PENDING', 'PAID', 'REFUNDED'));
+
+CREATE TABLE IF NOT EXISTS payments (
+    id VARCHAR PRIMARY KEY,
+    order_id VARCHAR NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    provider VARCHAR NOT NULL,
+    reference VARCHAR NOT NULL DEFAULT '',
+    amount DECIMAL(10,2) NOT NULL CHECK (amount >= 0),
+    status VARCHAR NOT NULL
+        CHECK (status IN ('PENDING', 'AUTHORIZED', 'CAPTURED', 'FAILED', 'VOIDED', 'REFUNDED')),
+    failure_reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS payments_order_id_idx ON payments(order_id);
+
+-- Webhooks find payments by the provider's reference.
+CREATE UNIQUE INDEX IF NOT EXISTS payments_provider_reference_idx
+    ON payments(provider, reference) WHERE reference <> '';
+
+-- At most one payment per order may be in flight or have succeeded, so two
+-- concurrent attempts cannot both charge the customer.
+CREATE UNIQUE INDEX IF NOT EXISTS payments_active_order_idx
+    ON payments(order_id) WHERE status IN ('PENDING', 'AUTHORIZED', 'CAPTURED');
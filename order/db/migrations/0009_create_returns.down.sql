@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS return_lines;
+DROP TABLE IF EXISTS returns;
+
+ALTER TABLE payments
+    DROP COLUMN IF EXISTS refunded_amount;
+
+UPDATE orders SET status = 'PAID' WHERE status = 'PARTIALLY_REFUNDED';
+
+ALTER TABLE orders
+    DROP CONSTRAINT IF EXISTS orders_status_check,
+    ADD CONSTRAINT orders_status_check
+        CHECK (status IN ('PENDING', 'PAID', 'REFUNDED'));
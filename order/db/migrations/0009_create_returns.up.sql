@@ -0,0 +1,32 @@
+ALTER TABLE orders
+    DROP CONSTRAINT IF EXISTS orders_status_check,
+    ADD CONSTRAINT orders_status_check
+        CHECK (status IN ('PENDING', 'PAID', 'PARTIALLY_REFUNDED', 'REFUNDED'));
+
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS refunded_amount DECIMAL(10,2) NOT NULL DEFAULT 0
+        CHECK (refunded_amount >= 0 AND refunded_amount <= amount);
+
+CREATE TABLE IF NOT EXISTS returns (
+    id VARCHAR PRIMARY KEY,
+    order_id VARCHAR NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    account_id VARCHAR NOT NULL,
+    status VARCHAR NOT NULL
+        CHECK (status IN ('REQUESTED', 'APPROVED', 'REJECTED', 'RECEIVED', 'REFUNDING', 'REFUNDED')),
+    reason TEXT NOT NULL DEFAULT '',
+    rejection_reason TEXT NOT NULL DEFAULT '',
+    refundable_amount DECIMAL(10,2) NOT NULL CHECK (refundable_amount >= 0),
+    refund_amount DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (refund_amount >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS returns_order_id_idx ON returns(order_id);
+
+CREATE TABLE IF NOT EXISTS return_lines (
+    return_id VARCHAR NOT NULL REFERENCES returns(id) ON DELETE CASCADE,
+    product_id VARCHAR NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    amount DECIMAL(10,2) NOT NULL CHECK (amount >= 0),
+    PRIMARY KEY (return_id, product_id)
+);
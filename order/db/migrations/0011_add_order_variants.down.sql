@@ -0,0 +1,14 @@
+-- Fails while an order or a return holds more than one variant of a product.
+ALTER TABLE return_lines
+    DROP CONSTRAINT IF EXISTS return_lines_pkey,
+    ADD PRIMARY KEY (return_id, product_id);
+ALTER TABLE return_lines
+    DROP COLUMN IF EXISTS variant_id;
+
+ALTER TABLE order_products
+    DROP CONSTRAINT IF EXISTS order_products_pkey,
+    ADD PRIMARY KEY (order_id, product_id);
+ALTER TABLE order_products
+    DROP COLUMN IF EXISTS attributes,
+    DROP COLUMN IF EXISTS sku,
+    DROP COLUMN IF EXISTS variant_id;
@@ -0,0 +1,15 @@
+-- Lines of products without variants have an empty variant_id, so an order
+-- can hold several variants of a product but each variant only once.
+ALTER TABLE order_products
+    ADD COLUMN IF NOT EXISTS variant_id VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS sku VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE order_products
+    DROP CONSTRAINT IF EXISTS order_products_pkey,
+    ADD PRIMARY KEY (order_id, product_id, variant_id);
+
+ALTER TABLE return_lines
+    ADD COLUMN IF NOT EXISTS variant_id VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE return_lines
+    DROP CONSTRAINT IF EXISTS return_lines_pkey,
+    ADD PRIMARY KEY (return_id, product_id, variant_id);
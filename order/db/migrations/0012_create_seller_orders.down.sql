@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS seller_orders;
+
+DROP INDEX IF EXISTS order_products_seller_id_idx;
+
+ALTER TABLE order_products
+    DROP COLUMN IF EXISTS seller_id;
@@ -0,0 +1,21 @@
+-- Lines of products the marketplace sells itself have an empty seller_id.
+ALTER TABLE order_products
+    ADD COLUMN IF NOT EXISTS seller_id VARCHAR NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS order_products_seller_id_idx ON order_products(seller_id, order_id);
+
+-- The part of an order each seller sells, with the commission as it was
+-- when the order was placed.
+CREATE TABLE IF NOT EXISTS seller_orders (
+    order_id VARCHAR NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    seller_id VARCHAR NOT NULL,
+    subtotal DECIMAL(10,2) NOT NULL CHECK (subtotal >= 0),
+    discount_total DECIMAL(10,2) NOT NULL CHECK (discount_total >= 0),
+    tax_total DECIMAL(10,2) NOT NULL CHECK (tax_total >= 0),
+    commission_rate DECIMAL(5,4) NOT NULL CHECK (commission_rate >= 0 AND commission_rate <= 1),
+    commission DECIMAL(10,2) NOT NULL CHECK (commission >= 0),
+    payout DECIMAL(10,2) NOT NULL CHECK (payout >= 0),
+    PRIMARY KEY (order_id, seller_id)
+);
+
+CREATE INDEX IF NOT EXISTS seller_orders_seller_id_idx ON seller_orders(seller_id);
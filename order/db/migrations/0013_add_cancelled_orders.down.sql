@@ -0,0 +1,7 @@
+-- Cancelled orders cannot be told apart from abandoned ones afterwards.
+UPDATE orders SET status = 'PENDING' WHERE status = 'CANCELLED';
+
+ALTER TABLE orders
+    DROP CONSTRAINT IF EXISTS orders_status_check,
+    ADD CONSTRAINT orders_status_check
+        CHECK (status IN ('PENDING', 'PAID', 'PARTIALLY_REFUNDED', 'REFUNDED'));
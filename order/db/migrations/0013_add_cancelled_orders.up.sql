@@ -0,0 +1,4 @@
+ALTER TABLE orders
+    DROP CONSTRAINT IF EXISTS orders_status_check,
+    ADD CONSTRAINT orders_status_check
+        CHECK (status IN ('PENDING', 'PAID', 'PARTIALLY_REFUNDED', 'REFUNDED', 'CANCELLED'));
@@ -0,0 +1,50 @@
+package order
+
+import (
+	"time"
+
+	"github.com/donaldnash/go-marketplace/outbox"
+)
+
+// EventOrderPlaced is recorded in the outbox when an order is placed.
+const EventOrderPlaced = "OrderPlaced"
+
+type orderPlacedPayload struct {
+	ID             string               `json:"id"`
+	AccountID      string               `json:"account_id"`
+	CreatedAt      time.Time            `json:"created_at"`
+	TotalPrice     float64              `json:"total_price"`
+	ShippingMethod string               `json:"shipping_method"`
+	Products       []orderPlacedProduct `json:"products"`
+}
+
+type orderPlacedProduct struct {
+	ID        string  `json:"id"`
+	VariantID string  `json:"variant_id,omitempty"`
+	SKU       string  `json:"sku,omitempty"`
+	SellerID  string  `json:"seller_id,omitempty"`
+	Quantity  uint32  `json:"quantity"`
+	Price     float64 `json:"price"`
+}
+
+func orderPlacedEvent(o Order) (outbox.Event, error) {
+	payload := orderPlacedPayload{
+		ID:             o.ID,
+		AccountID:      o.AccountID,
+		CreatedAt:      o.CreatedAt,
+		TotalPrice:     o.TotalPrice,
+		ShippingMethod: o.ShippingMethod,
+		Products:       make([]orderPlacedProduct, len(o.Products)),
+	}
+	for i, p := range o.Products {
+		payload.Products[i] = orderPlacedProduct{
+			ID:        p.ID,
+			VariantID: p.VariantID,
+			SKU:       p.SKU,
+			SellerID:  p.SellerID,
+			Quantity:  p.Quantity,
+			Price:     p.Price,
+		}
+	}
+	return outbox.NewEvent(EventOrderPlaced, o.ID, payload)
+}
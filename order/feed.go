@@ -0,0 +1,71 @@
+package order
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// feedBuffer is how many updates a watcher may lag behind before it is
+// dropped.
+const feedBuffer = 16
+
+// Feed fans order changes out to the clients watching an account's orders.
+// It only sees changes made through this process.
+type Feed struct {
+	mu       sync.Mutex
+	watchers map[chan Order]string
+}
+
+func NewFeed() *Feed {
+	return &Feed{watchers: map[chan Order]string{}}
+}
+
+// Subscribe returns a channel that receives the orders of accountID whenever
+// they change. The channel is closed by cancel, or when the watcher stops
+// keeping up.
+func (f *Feed) Subscribe(accountID string) (<-chan Order, func()) {
+	ch := make(chan Order, feedBuffer)
+
+	f.mu.Lock()
+	f.watchers[ch] = accountID
+	f.mu.Unlock()
+
+	cancel := func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.watchers[ch]; ok {
+			delete(f.watchers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+func (f *Feed) Publish(o Order) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch, accountID := range f.watchers {
+		if accountID != o.AccountID {
+			continue
+		}
+		select {
+		case ch <- o:
+		default:
+			log.Printf("Dropping order watcher of account %s that fell behind", accountID)
+			delete(f.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publishOrder sends the current state of order id to its watchers.
+func publishOrder(ctx context.Context, feed *Feed, r Repository, id string) {
+	o, err := r.GetOrder(ctx, id)
+	if err != nil {
+		log.Printf("Error loading order %s for watchers: %v", id, err)
+		return
+	}
+	feed.Publish(*o)
+}
@@ -0,0 +1,90 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/grpcclient"
+)
+
+var ErrOutOfStock = errors.New("product is out of stock")
+
+// releaseTimeout bounds putting stock back after the request that took it
+// is done.
+const releaseTimeout = 5 * time.Second
+
+// Inventory keeps the stock of the product variants orders are placed for.
+// Lines without a variant have no stock and are left alone.
+type Inventory interface {
+	// ReserveStock takes the quantities of lines out of stock, all of them
+	// or none. It fails with ErrOutOfStock when a variant has less stock
+	// than its line asks for.
+	ReserveStock(ctx context.Context, lines []OrderedProduct) error
+	// ReleaseStock puts the quantities of lines back into stock.
+	ReleaseStock(ctx context.Context, lines []OrderedProduct) error
+}
+
+type catalogInventory struct {
+	client *catalog.Client
+}
+
+// NewCatalogInventory keeps stock in the catalog service behind c.
+func NewCatalogInventory(c *catalog.Client) Inventory {
+	if c == nil {
+		panic("catalog client cannot be nil")
+	}
+	return &catalogInventory{c}
+}
+
+func (i *catalogInventory) ReserveStock(ctx context.Context, lines []OrderedProduct) error {
+	stock := stockLines(lines)
+	if len(stock) == 0 {
+		return nil
+	}
+	if err := i.client.ReserveStock(ctx, stock); err != nil {
+		switch {
+		case strings.Contains(err.Error(), catalog.ErrInsufficientStock.Error()):
+			return ErrOutOfStock
+		case grpcclient.IsUnavailable(err):
+			return fmt.Errorf("%w: %v", ErrCatalogUnavailable, err)
+		}
+		return fmt.Errorf("failed to reserve stock: %v", err)
+	}
+	return nil
+}
+
+func (i *catalogInventory) ReleaseStock(ctx context.Context, lines []OrderedProduct) error {
+	stock := stockLines(lines)
+	if len(stock) == 0 {
+		return nil
+	}
+	if err := i.client.ReleaseStock(ctx, stock); err != nil {
+		return fmt.Errorf("failed to release stock: %v", err)
+	}
+	return nil
+}
+
+func stockLines(lines []OrderedProduct) []catalog.StockLine {
+	stock := []catalog.StockLine{}
+	for _, l := range lines {
+		if l.VariantID != "" && l.Quantity > 0 {
+			stock = append(stock, catalog.StockLine{ProductID: l.ID, VariantID: l.VariantID, Quantity: l.Quantity})
+		}
+	}
+	return stock
+}
+
+// releaseStock puts lines back into stock even if ctx is done, since the
+// stock would be lost otherwise. Failures are only logged.
+func (s *orderService) releaseStock(ctx context.Context, lines []OrderedProduct, why string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+	defer cancel()
+	if err := s.inventory.ReleaseStock(ctx, lines); err != nil {
+		log.Printf("Error releasing stock %s: %v", why, err)
+	}
+}
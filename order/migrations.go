@@ -0,0 +1,18 @@
+package order
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed db/migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations returns the versioned schema migrations for the order database.
+func Migrations() fs.FS {
+	sub, err := fs.Sub(migrationFiles, "db/migrations")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,202 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/payment"
+	"github.com/segmentio/ksuid"
+)
+
+type Status string
+
+const (
+	StatusPending           Status = "PENDING"
+	StatusPaid              Status = "PAID"
+	StatusPartiallyRefunded Status = "PARTIALLY_REFUNDED"
+	StatusRefunded          Status = "REFUNDED"
+	// StatusCancelled is a pending order its account gave up on; its stock
+	// was put back.
+	StatusCancelled Status = "CANCELLED"
+)
+
+var (
+	ErrOrderNotFound       = errors.New("order not found")
+	ErrOrderNotPayable     = errors.New("order is not awaiting payment")
+	ErrOrderNotCancellable = errors.New("only orders awaiting payment can be cancelled")
+	ErrPaymentInProgress   = errors.New("another payment for this order is in progress")
+	ErrPaymentTokenMissing = errors.New("payment token is required")
+	// ErrPaymentDeclined wraps the reason the provider refused a payment.
+	ErrPaymentDeclined = errors.New("payment was declined")
+)
+
+// PaymentRequest asks to pay an order of AccountID with the payment method
+// behind Token.
+type PaymentRequest struct {
+	OrderID   string
+	AccountID string
+	Token     string
+}
+
+// orderStatus is the order status a payment in status s leads to, if any.
+func orderStatus(s payment.Status) (Status, bool) {
+	switch s {
+	case payment.StatusCaptured:
+		return StatusPaid, true
+	case payment.StatusRefunded:
+		return StatusRefunded, true
+	}
+	return "", false
+}
+
+func (s *orderService) PayOrder(ctx context.Context, r PaymentRequest) (*payment.Payment, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if r.Token == "" {
+		return nil, ErrPaymentTokenMissing
+	}
+
+	o, err := s.repository.GetOrder(ctx, r.OrderID)
+	if err != nil {
+		if errors.Is(err, ErrOrderNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get order: %v", err)
+	}
+	if o.AccountID != r.AccountID {
+		return nil, ErrOrderNotFound
+	}
+	if o.Status != StatusPending {
+		return nil, ErrOrderNotPayable
+	}
+
+	now := time.Now().UTC()
+	p := payment.Payment{
+		ID:        ksuid.New().String(),
+		OrderID:   o.ID,
+		Provider:  s.payments.Name(),
+		Amount:    o.TotalPrice,
+		Status:    payment.StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repository.PutPayment(ctx, p); err != nil {
+		// The order may have been cancelled since it was read.
+		if errors.Is(err, ErrPaymentInProgress) || errors.Is(err, ErrOrderNotPayable) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to record payment: %v", err)
+	}
+
+	// Orders that cost nothing are paid without asking the provider.
+	if p.Amount <= 0 {
+		return s.updatePayment(ctx, p, payment.StatusCaptured, "")
+	}
+
+	t, err := s.payments.Authorize(ctx, payment.AuthorizeRequest{
+		OrderID:        o.ID,
+		Amount:         p.Amount,
+		Token:          r.Token,
+		IdempotencyKey: p.ID,
+	})
+	if err != nil {
+		log.Printf("Error authorizing payment %s of order %s: %v", p.ID, o.ID, err)
+		reason := "provider error"
+		if errors.Is(err, payment.ErrDeclined) {
+			reason = strings.TrimPrefix(err.Error(), payment.ErrDeclined.Error()+": ")
+		}
+		if _, updateErr := s.updatePayment(ctx, p, payment.StatusFailed, reason); updateErr != nil {
+			log.Printf("Error recording failed payment %s: %v", p.ID, updateErr)
+		}
+		if errors.Is(err, payment.ErrDeclined) {
+			return nil, fmt.Errorf("%w: %s", ErrPaymentDeclined, reason)
+		}
+		return nil, fmt.Errorf("failed to authorize payment: %v", err)
+	}
+
+	p.Reference = t.Reference
+	authorized, err := s.updatePayment(ctx, p, payment.StatusAuthorized, "")
+	if err != nil {
+		s.voidPayment(ctx, p)
+		return nil, err
+	}
+	p = *authorized
+
+	if _, err := s.payments.Capture(ctx, p.Reference, p.Amount); err != nil {
+		log.Printf("Error capturing payment %s of order %s: %v", p.ID, o.ID, err)
+		s.voidPayment(ctx, p)
+		return nil, fmt.Errorf("failed to capture payment: %v", err)
+	}
+
+	// If recording the capture fails, the payment stays authorized here and
+	// the provider's payment.captured webhook settles it later.
+	return s.updatePayment(ctx, p, payment.StatusCaptured, "")
+}
+
+// voidPayment releases an authorization that will not be captured.
+func (s *orderService) voidPayment(ctx context.Context, p payment.Payment) {
+	if _, err := s.payments.Void(ctx, p.Reference); err != nil {
+		log.Printf("Error voiding payment %s: %v", p.ID, err)
+		return
+	}
+	if _, err := s.updatePayment(ctx, p, payment.StatusVoided, ""); err != nil {
+		log.Printf("Error recording voided payment %s: %v", p.ID, err)
+	}
+}
+
+func (s *orderService) updatePayment(ctx context.Context, p payment.Payment, next payment.Status, reason string) (*payment.Payment, error) {
+	p.Status = next
+	p.FailureReason = reason
+	p.UpdatedAt = time.Now().UTC()
+
+	status, changed := orderStatus(next)
+	if err := s.repository.UpdatePayment(ctx, p, status); err != nil {
+		return nil, fmt.Errorf("failed to update payment: %v", err)
+	}
+	if changed {
+		publishOrder(ctx, s.feed, s.repository, p.OrderID)
+	}
+	return &p, nil
+}
+
+// ApplyPaymentEvent records what a provider reported about one of its
+// transactions. Repeated and out-of-date events are ignored, since providers
+// deliver callbacks at least once and in no particular order.
+func (s *orderService) ApplyPaymentEvent(ctx context.Context, e payment.Event) error {
+	if ctx == nil {
+		return fmt.Errorf("context is required")
+	}
+	next, ok := e.Type.Status()
+	if !ok {
+		return fmt.Errorf("unknown payment event type %q", e.Type)
+	}
+
+	p, err := s.repository.GetPaymentByReference(ctx, e.Provider, e.Reference)
+	if err != nil {
+		if errors.Is(err, payment.ErrUnknownTransaction) {
+			return err
+		}
+		return fmt.Errorf("failed to get payment: %v", err)
+	}
+
+	if p.Status == next {
+		return nil
+	}
+	if !p.Status.CanBecome(next) {
+		log.Printf("Ignoring %s event %s for payment %s in status %s", e.Type, e.ID, p.ID, p.Status)
+		return nil
+	}
+
+	if next == payment.StatusRefunded {
+		p.RefundedAmount = p.Amount
+	}
+	// A refund does not put the units back into stock: the goods may never
+	// come back. Returns restock what is received.
+	_, err = s.updatePayment(ctx, *p, next, e.Reason)
+	return err
+}
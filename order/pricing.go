@@ -0,0 +1,329 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/promotion"
+)
+
+type RejectionReason string
+
+const (
+	RejectUnknownProduct   RejectionReason = "UNKNOWN_PRODUCT"
+	RejectDuplicateProduct RejectionReason = "DUPLICATE_PRODUCT"
+	RejectZeroQuantity     RejectionReason = "ZERO_QUANTITY"
+	// RejectUnknownVariant is a line of a product with variants that names
+	// none of them, or a line naming a variant of a product without any.
+	RejectUnknownVariant RejectionReason = "UNKNOWN_VARIANT"
+	// RejectOutOfStock is a line of more units than its variant has in
+	// stock.
+	RejectOutOfStock RejectionReason = "OUT_OF_STOCK"
+)
+
+// RejectedLine is a requested order line that could not be accepted. Index is
+// the line's position in the request.
+type RejectedLine struct {
+	Index     int
+	ProductID string
+	VariantID string
+	Quantity  uint32
+	Reason    RejectionReason
+}
+
+// PostOrderResult holds either the placed order or, when any requested line
+// was rejected, the rejected lines and no order.
+type PostOrderResult struct {
+	Order         *Order
+	RejectedLines []RejectedLine
+}
+
+// priceOrder validates r and prices it: lines come from the catalog, the
+// coupon, if any, from the promotion service, and the shipping address from
+// the account's address book. The returned order has no ID yet.
+func (s *orderService) priceOrder(ctx context.Context, r OrderRequest) (*PostOrderResult, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if r.AccountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+	if len(r.Products) == 0 {
+		return nil, fmt.Errorf("at least one product is required")
+	}
+	if len(r.Products) > 100 {
+		return nil, fmt.Errorf("cannot order more than 100 products at once")
+	}
+
+	if _, err := s.accounts.GetAccount(ctx, r.AccountID); err != nil {
+		log.Printf("Error getting account %s: %v", r.AccountID, err)
+		return nil, ErrAccountNotFound
+	}
+
+	var address *ShippingAddress
+	if r.ShippingAddressID != "" {
+		a, err := s.accounts.GetAddress(ctx, r.AccountID, r.ShippingAddressID)
+		if err != nil {
+			log.Printf("Error getting address %s of account %s: %v", r.ShippingAddressID, r.AccountID, err)
+			return nil, ErrShippingAddressNotFound
+		}
+		address = &ShippingAddress{
+			AddressID:  a.ID,
+			Name:       a.Name,
+			Line1:      a.Line1,
+			Line2:      a.Line2,
+			City:       a.City,
+			Region:     a.Region,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		}
+	} else if r.ShippingMethod != "" {
+		return nil, ErrShippingAddressRequired
+	}
+
+	// Price every line from the catalog. Nothing is placed if any line is
+	// rejected, so the caller can fix the request and try again.
+	products, rejected, err := s.priceLines(ctx, r.Products)
+	if err != nil {
+		return nil, err
+	}
+	if len(rejected) > 0 {
+		return &PostOrderResult{RejectedLines: rejected}, nil
+	}
+
+	o := &Order{
+		AccountID: r.AccountID,
+		TaxLocation: TaxLocation{
+			Country: strings.ToUpper(strings.TrimSpace(r.TaxLocation.Country)),
+			Region:  strings.ToUpper(strings.TrimSpace(r.TaxLocation.Region)),
+		},
+		Products:  products,
+		Discounts: []promotion.Discount{},
+	}
+	if address != nil {
+		o.ShippingAddress = address
+		o.ShippingMethod = strings.ToLower(strings.TrimSpace(r.ShippingMethod))
+		if o.ShippingMethod == "" {
+			o.ShippingMethod = DefaultShippingMethod
+		}
+		o.TaxLocation = TaxLocation{Country: address.Country, Region: address.Region}
+	}
+	lines := make([]promotion.Line, len(products))
+	for i, p := range products {
+		o.Subtotal += p.Price * float64(p.Quantity)
+		lines[i] = promotion.Line{ProductID: p.ID, Price: p.Price, Quantity: p.Quantity}
+	}
+	o.Subtotal = promotion.RoundCents(o.Subtotal)
+
+	if r.CouponCode != "" {
+		d, err := s.promotions.Apply(ctx, r.CouponCode, r.AccountID, lines)
+		if err != nil {
+			if isCouponError(err) {
+				return nil, fmt.Errorf("%w: %v", ErrCouponRejected, err)
+			}
+			return nil, fmt.Errorf("failed to apply coupon: %v", err)
+		}
+		o.Discounts = append(o.Discounts, *d)
+		o.DiscountTotal += d.Amount
+	}
+
+	if err := s.applyShipping(ctx, o); err != nil {
+		return nil, err
+	}
+	if err := s.applyTax(ctx, o); err != nil {
+		return nil, err
+	}
+	if err := s.splitBySeller(ctx, o); err != nil {
+		return nil, err
+	}
+
+	o.TotalPrice = promotion.RoundCents(o.Subtotal - o.DiscountTotal + o.TaxTotal + o.ShippingTotal)
+	return &PostOrderResult{Order: o}, nil
+}
+
+// applyShipping prices the shipment of o. Orders without a shipping address
+// ship for free.
+func (s *orderService) applyShipping(ctx context.Context, o *Order) error {
+	if o.ShippingAddress == nil {
+		return nil
+	}
+
+	shipment := Shipment{
+		Method:  o.ShippingMethod,
+		Address: *o.ShippingAddress,
+		Lines:   make([]ShippableLine, len(o.Products)),
+		Amount:  promotion.RoundCents(o.Subtotal - o.DiscountTotal),
+	}
+	for i, p := range o.Products {
+		shipment.Lines[i] = ShippableLine{ProductID: p.ID, Weight: p.Weight, Quantity: p.Quantity}
+	}
+
+	amount, err := s.shipping.CalculateShipping(ctx, shipment)
+	if err != nil {
+		if errors.Is(err, ErrUnknownShippingMethod) {
+			return err
+		}
+		return fmt.Errorf("failed to calculate shipping: %v", err)
+	}
+	o.ShippingTotal = promotion.RoundCents(amount)
+	return nil
+}
+
+// applyTax taxes every line of o. Order discounts are spread over the lines
+// in proportion to their amount before tax is calculated.
+func (s *orderService) applyTax(ctx context.Context, o *Order) error {
+	share := 0.0
+	if o.Subtotal > 0 {
+		share = o.DiscountTotal / o.Subtotal
+	}
+
+	lines := make([]TaxableLine, len(o.Products))
+	for i, p := range o.Products {
+		lines[i] = TaxableLine{
+			ProductID:   p.ID,
+			TaxCategory: p.TaxCategory,
+			Amount:      promotion.RoundCents(p.Price * float64(p.Quantity) * (1 - share)),
+		}
+	}
+
+	taxes, err := s.tax.CalculateTax(ctx, o.TaxLocation, lines)
+	if err != nil {
+		return fmt.Errorf("failed to calculate tax: %v", err)
+	}
+	if len(taxes) != len(lines) {
+		return fmt.Errorf("failed to calculate tax: got %d amounts for %d lines", len(taxes), len(lines))
+	}
+
+	o.TaxTotal = 0
+	for i, tax := range taxes {
+		o.Products[i].Tax = tax
+		o.TaxTotal += tax
+	}
+	o.TaxTotal = promotion.RoundCents(o.TaxTotal)
+	return nil
+}
+
+func isCouponError(err error) bool {
+	for _, target := range []error{
+		promotion.ErrNotFound,
+		promotion.ErrInactive,
+		promotion.ErrNotYetValid,
+		promotion.ErrExpired,
+		promotion.ErrUsageLimitReached,
+		promotion.ErrMinSpendNotMet,
+		promotion.ErrNotApplicable,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// priceLines checks the requested lines and prices the accepted ones from the
+// catalog. Only the product ID, variant ID and quantity of each line are
+// read; anything else the caller sent is replaced by catalog data.
+func (s *orderService) priceLines(ctx context.Context, lines []OrderedProduct) ([]OrderedProduct, []RejectedLine, error) {
+	rejected := []RejectedLine{}
+	accepted := []int{}
+	seen := map[string]bool{}
+	reject := func(i int, reason RejectionReason) {
+		rejected = append(rejected, RejectedLine{
+			Index:     i,
+			ProductID: lines[i].ID,
+			VariantID: lines[i].VariantID,
+			Quantity:  lines[i].Quantity,
+			Reason:    reason,
+		})
+	}
+
+	for i, l := range lines {
+		key := l.ID + "\x00" + l.VariantID
+		switch {
+		case l.ID == "":
+			reject(i, RejectUnknownProduct)
+		case seen[key]:
+			reject(i, RejectDuplicateProduct)
+		case l.Quantity == 0:
+			seen[key] = true
+			reject(i, RejectZeroQuantity)
+		default:
+			seen[key] = true
+			accepted = append(accepted, i)
+		}
+	}
+
+	productIDs := []string{}
+	requested := map[string]bool{}
+	for _, idx := range accepted {
+		if id := lines[idx].ID; !requested[id] {
+			requested[id] = true
+			productIDs = append(productIDs, id)
+		}
+	}
+
+	// Prices and stock must be the catalog's current ones, never cached.
+	catalogProducts, err := s.products.GetCurrentProducts(ctx, productIDs)
+	if err != nil {
+		log.Printf("Error getting products: %v", err)
+		if errors.Is(err, ErrCatalogUnavailable) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("failed to get products: %v", err)
+	}
+	byID := map[string]catalog.Product{}
+	for _, p := range catalogProducts {
+		byID[p.ID] = p
+	}
+
+	priced := []OrderedProduct{}
+	for _, idx := range accepted {
+		l := lines[idx]
+		p, ok := byID[l.ID]
+		if !ok {
+			reject(idx, RejectUnknownProduct)
+			continue
+		}
+		line := OrderedProduct{
+			ID:          p.ID,
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Quantity:    l.Quantity,
+			TaxCategory: p.TaxCategory,
+			Weight:      p.Weight,
+			SellerID:    p.SellerID,
+		}
+
+		// A product with variants is ordered as one of them.
+		if len(p.Variants) > 0 || l.VariantID != "" {
+			v, ok := p.Variant(l.VariantID)
+			if !ok {
+				reject(idx, RejectUnknownVariant)
+				continue
+			}
+			if l.Quantity > uint32(v.Stock) {
+				reject(idx, RejectOutOfStock)
+				continue
+			}
+			line.VariantID = v.ID
+			line.SKU = v.SKU
+			line.Price = p.PriceOf(v)
+			line.Attributes = make([]Attribute, len(v.Attributes))
+			for i, a := range v.Attributes {
+				line.Attributes[i] = Attribute{Name: a.Name, Value: a.Value}
+			}
+		}
+		priced = append(priced, line)
+	}
+
+	sort.Slice(rejected, func(i, j int) bool {
+		return rejected[i].Index < rejected[j].Index
+	})
+	return priced, rejected, nil
+}
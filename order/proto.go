@@ -0,0 +1,437 @@
+package order
+
+import (
+	"time"
+
+	"github.com/donaldnash/go-marketplace/order/pb"
+	"github.com/donaldnash/go-marketplace/payment"
+	"github.com/donaldnash/go-marketplace/promotion"
+)
+
+func orderToProto(o Order) *pb.Order {
+	op := &pb.Order{
+		Id:              o.ID,
+		CreatedAt:       timeToProto(o.CreatedAt),
+		AccountId:       o.AccountID,
+		Status:          string(o.Status),
+		Subtotal:        o.Subtotal,
+		DiscountTotal:   o.DiscountTotal,
+		TaxTotal:        o.TaxTotal,
+		TotalPrice:      o.TotalPrice,
+		TaxCountry:      o.TaxLocation.Country,
+		TaxRegion:       o.TaxLocation.Region,
+		ShippingMethod:  o.ShippingMethod,
+		ShippingTotal:   o.ShippingTotal,
+		ShippingAddress: shippingAddressToProto(o.ShippingAddress),
+		Products:        orderedProductsToProto(o.Products),
+		Discounts:       []*pb.Discount{},
+		SellerOrders:    []*pb.SellerOrder{},
+	}
+	// Buyers do not see what the marketplace keeps of each seller order.
+	for _, so := range o.SellerOrders {
+		pso := sellerOrderToProto(so)
+		pso.CommissionRate, pso.Commission, pso.Payout = 0, 0, 0
+		op.SellerOrders = append(op.SellerOrders, pso)
+	}
+	for _, d := range o.Discounts {
+		op.Discounts = append(op.Discounts, &pb.Discount{
+			PromotionId: d.PromotionID,
+			Code:        d.Code,
+			Description: d.Description,
+			Amount:      d.Amount,
+		})
+	}
+	return op
+}
+
+func orderFromProto(op *pb.Order) Order {
+	o := Order{
+		ID:              op.Id,
+		CreatedAt:       timeFromProto(op.CreatedAt),
+		AccountID:       op.AccountId,
+		Status:          Status(op.Status),
+		Subtotal:        op.Subtotal,
+		DiscountTotal:   op.DiscountTotal,
+		TaxTotal:        op.TaxTotal,
+		TotalPrice:      op.TotalPrice,
+		TaxLocation:     TaxLocation{Country: op.TaxCountry, Region: op.TaxRegion},
+		ShippingMethod:  op.ShippingMethod,
+		ShippingTotal:   op.ShippingTotal,
+		ShippingAddress: shippingAddressFromProto(op.ShippingAddress),
+		Products:        orderedProductsFromProto(op.Products),
+		Discounts:       []promotion.Discount{},
+		SellerOrders:    []SellerOrder{},
+	}
+	for _, pso := range op.SellerOrders {
+		o.SellerOrders = append(o.SellerOrders, sellerOrderFromProto(pso))
+	}
+	for _, d := range op.Discounts {
+		o.Discounts = append(o.Discounts, promotion.Discount{
+			PromotionID: d.PromotionId,
+			Code:        d.Code,
+			Description: d.Description,
+			Amount:      d.Amount,
+		})
+	}
+	return o
+}
+
+func shippingAddressToProto(a *ShippingAddress) *pb.ShippingAddress {
+	if a == nil {
+		return nil
+	}
+	return &pb.ShippingAddress{
+		AddressId:  a.AddressID,
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+func shippingAddressFromProto(a *pb.ShippingAddress) *ShippingAddress {
+	if a == nil {
+		return nil
+	}
+	return &ShippingAddress{
+		AddressID:  a.AddressId,
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
+
+func orderedProductsToProto(products []OrderedProduct) []*pb.Order_OrderProduct {
+	res := []*pb.Order_OrderProduct{}
+	for _, p := range products {
+		res = append(res, &pb.Order_OrderProduct{
+			Id:          p.ID,
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Quantity:    p.Quantity,
+			TaxCategory: p.TaxCategory,
+			Tax:         p.Tax,
+			Weight:      p.Weight,
+			VariantId:   p.VariantID,
+			Sku:         p.SKU,
+			Attributes:  attributesToProto(p.Attributes),
+			SellerId:    p.SellerID,
+		})
+	}
+	return res
+}
+
+func orderedProductsFromProto(products []*pb.Order_OrderProduct) []OrderedProduct {
+	res := []OrderedProduct{}
+	for _, p := range products {
+		res = append(res, OrderedProduct{
+			ID:          p.Id,
+			Name:        p.Name,
+			Description: p.Description,
+			Price:       p.Price,
+			Quantity:    p.Quantity,
+			TaxCategory: p.TaxCategory,
+			Tax:         p.Tax,
+			Weight:      p.Weight,
+			VariantID:   p.VariantId,
+			SKU:         p.Sku,
+			Attributes:  attributesFromProto(p.Attributes),
+			SellerID:    p.SellerId,
+		})
+	}
+	return res
+}
+
+func sellerOrderToProto(so SellerOrder) *pb.SellerOrder {
+	return &pb.SellerOrder{
+		OrderId:         so.OrderID,
+		SellerId:        so.SellerID,
+		CreatedAt:       timeToProto(so.CreatedAt),
+		Status:          string(so.Status),
+		ShippingAddress: shippingAddressToProto(so.ShippingAddress),
+		ShippingMethod:  so.ShippingMethod,
+		Products:        orderedProductsToProto(so.Products),
+		Subtotal:        so.Subtotal,
+		DiscountTotal:   so.DiscountTotal,
+		TaxTotal:        so.TaxTotal,
+		CommissionRate:  so.CommissionRate,
+		Commission:      so.Commission,
+		Payout:          so.Payout,
+	}
+}
+
+func sellerOrderFromProto(pso *pb.SellerOrder) SellerOrder {
+	return SellerOrder{
+		OrderID:         pso.OrderId,
+		SellerID:        pso.SellerId,
+		CreatedAt:       timeFromProto(pso.CreatedAt),
+		Status:          Status(pso.Status),
+		ShippingAddress: shippingAddressFromProto(pso.ShippingAddress),
+		ShippingMethod:  pso.ShippingMethod,
+		Products:        orderedProductsFromProto(pso.Products),
+		Subtotal:        pso.Subtotal,
+		DiscountTotal:   pso.DiscountTotal,
+		TaxTotal:        pso.TaxTotal,
+		CommissionRate:  pso.CommissionRate,
+		Commission:      pso.Commission,
+		Payout:          pso.Payout,
+	}
+}
+
+func salesReportToProto(r SalesReport) *pb.SalesReport {
+	return &pb.SalesReport{
+		SellerId:      r.SellerID,
+		From:          timeToProto(r.From),
+		To:            timeToProto(r.To),
+		Orders:        uint32(r.Orders),
+		Units:         uint32(r.Units),
+		Subtotal:      r.Subtotal,
+		DiscountTotal: r.DiscountTotal,
+		TaxTotal:      r.TaxTotal,
+		Commission:    r.Commission,
+		Payout:        r.Payout,
+	}
+}
+
+func salesReportFromProto(pr *pb.SalesReport) SalesReport {
+	return SalesReport{
+		SellerID:      pr.SellerId,
+		From:          timeFromProto(pr.From),
+		To:            timeFromProto(pr.To),
+		Orders:        int(pr.Orders),
+		Units:         int(pr.Units),
+		Subtotal:      pr.Subtotal,
+		DiscountTotal: pr.DiscountTotal,
+		TaxTotal:      pr.TaxTotal,
+		Commission:    pr.Commission,
+		Payout:        pr.Payout,
+	}
+}
+
+func orderLinesToProto(products []OrderedProduct) []*pb.PostOrderRequest_OrderProduct {
+	lines := []*pb.PostOrderRequest_OrderProduct{}
+	for _, p := range products {
+		lines = append(lines, &pb.PostOrderRequest_OrderProduct{
+			ProductId: p.ID,
+			VariantId: p.VariantID,
+			Quantity:  p.Quantity,
+		})
+	}
+	return lines
+}
+
+func orderLinesFromProto(lines []*pb.PostOrderRequest_OrderProduct) []OrderedProduct {
+	products := []OrderedProduct{}
+	for _, l := range lines {
+		products = append(products, OrderedProduct{
+			ID:        l.ProductId,
+			VariantID: l.VariantId,
+			Quantity:  l.Quantity,
+		})
+	}
+	return products
+}
+
+func attributesToProto(attributes []Attribute) []*pb.Attribute {
+	res := make([]*pb.Attribute, len(attributes))
+	for i, a := range attributes {
+		res[i] = &pb.Attribute{Name: a.Name, Value: a.Value}
+	}
+	return res
+}
+
+func attributesFromProto(attributes []*pb.Attribute) []Attribute {
+	var res []Attribute
+	for _, a := range attributes {
+		res = append(res, Attribute{Name: a.Name, Value: a.Value})
+	}
+	return res
+}
+
+var rejectionReasonToProto = map[RejectionReason]pb.RejectedLine_Reason{
+	RejectUnknownProduct:   pb.RejectedLine_UNKNOWN_PRODUCT,
+	RejectDuplicateProduct: pb.RejectedLine_DUPLICATE_PRODUCT,
+	RejectZeroQuantity:     pb.RejectedLine_ZERO_QUANTITY,
+	RejectUnknownVariant:   pb.RejectedLine_UNKNOWN_VARIANT,
+	RejectOutOfStock:       pb.RejectedLine_OUT_OF_STOCK,
+}
+
+var rejectionReasonFromProto = map[pb.RejectedLine_Reason]RejectionReason{
+	pb.RejectedLine_UNKNOWN_PRODUCT:   RejectUnknownProduct,
+	pb.RejectedLine_DUPLICATE_PRODUCT: RejectDuplicateProduct,
+	pb.RejectedLine_ZERO_QUANTITY:     RejectZeroQuantity,
+	pb.RejectedLine_UNKNOWN_VARIANT:   RejectUnknownVariant,
+	pb.RejectedLine_OUT_OF_STOCK:      RejectOutOfStock,
+}
+
+func rejectedLinesToProto(lines []RejectedLine) []*pb.RejectedLine {
+	rejected := []*pb.RejectedLine{}
+	for _, l := range lines {
+		rejected = append(rejected, &pb.RejectedLine{
+			Index:     uint32(l.Index),
+			ProductId: l.ProductID,
+			VariantId: l.VariantID,
+			Quantity:  l.Quantity,
+			Reason:    rejectionReasonToProto[l.Reason],
+		})
+	}
+	return rejected
+}
+
+func rejectedLinesFromProto(lines []*pb.RejectedLine) []RejectedLine {
+	rejected := []RejectedLine{}
+	for _, l := range lines {
+		rejected = append(rejected, RejectedLine{
+			Index:     int(l.Index),
+			ProductID: l.ProductId,
+			VariantID: l.VariantId,
+			Quantity:  l.Quantity,
+			Reason:    rejectionReasonFromProto[l.Reason],
+		})
+	}
+	return rejected
+}
+
+func promotionToProto(p promotion.Promotion) *pb.Promotion {
+	return &pb.Promotion{
+		Id:                   p.ID,
+		Code:                 p.Code,
+		Description:          p.Description,
+		Kind:                 string(p.Kind),
+		Value:                p.Value,
+		BuyQuantity:          p.BuyQuantity,
+		GetQuantity:          p.GetQuantity,
+		ProductIds:           p.ProductIDs,
+		MinSpend:             p.MinSpend,
+		UsageLimitPerAccount: p.UsageLimitPerAccount,
+		ValidFrom:            timeToProto(p.ValidFrom),
+		ValidUntil:           timeToProto(p.ValidUntil),
+		Active:               p.Active,
+		CreatedAt:            timeToProto(p.CreatedAt),
+	}
+}
+
+func promotionFromProto(pp *pb.Promotion) promotion.Promotion {
+	if pp == nil {
+		return promotion.Promotion{}
+	}
+	return promotion.Promotion{
+		ID:                   pp.Id,
+		Code:                 pp.Code,
+		Description:          pp.Description,
+		Kind:                 promotion.Kind(pp.Kind),
+		Value:                pp.Value,
+		BuyQuantity:          pp.BuyQuantity,
+		GetQuantity:          pp.GetQuantity,
+		ProductIDs:           pp.ProductIds,
+		MinSpend:             pp.MinSpend,
+		UsageLimitPerAccount: pp.UsageLimitPerAccount,
+		ValidFrom:            timeFromProto(pp.ValidFrom),
+		ValidUntil:           timeFromProto(pp.ValidUntil),
+		Active:               pp.Active,
+		CreatedAt:            timeFromProto(pp.CreatedAt),
+	}
+}
+
+func paymentToProto(p payment.Payment) *pb.Payment {
+	return &pb.Payment{
+		Id:             p.ID,
+		OrderId:        p.OrderID,
+		Provider:       p.Provider,
+		Reference:      p.Reference,
+		Amount:         p.Amount,
+		RefundedAmount: p.RefundedAmount,
+		Status:         string(p.Status),
+		FailureReason:  p.FailureReason,
+		CreatedAt:      timeToProto(p.CreatedAt),
+		UpdatedAt:      timeToProto(p.UpdatedAt),
+	}
+}
+
+func paymentFromProto(pp *pb.Payment) payment.Payment {
+	return payment.Payment{
+		ID:             pp.Id,
+		OrderID:        pp.OrderId,
+		Provider:       pp.Provider,
+		Reference:      pp.Reference,
+		Amount:         pp.Amount,
+		RefundedAmount: pp.RefundedAmount,
+		Status:         payment.Status(pp.Status),
+		FailureReason:  pp.FailureReason,
+		CreatedAt:      timeFromProto(pp.CreatedAt),
+		UpdatedAt:      timeFromProto(pp.UpdatedAt),
+	}
+}
+
+func returnToProto(r Return) *pb.Return {
+	return &pb.Return{
+		Id:               r.ID,
+		OrderId:          r.OrderID,
+		AccountId:        r.AccountID,
+		Status:           string(r.Status),
+		Reason:           r.Reason,
+		RejectionReason:  r.RejectionReason,
+		Lines:            returnLinesToProto(r.Lines),
+		RefundableAmount: r.RefundableAmount,
+		RefundAmount:     r.RefundAmount,
+		CreatedAt:        timeToProto(r.CreatedAt),
+		UpdatedAt:        timeToProto(r.UpdatedAt),
+	}
+}
+
+func returnFromProto(pr *pb.Return) Return {
+	return Return{
+		ID:               pr.Id,
+		OrderID:          pr.OrderId,
+		AccountID:        pr.AccountId,
+		Status:           ReturnStatus(pr.Status),
+		Reason:           pr.Reason,
+		RejectionReason:  pr.RejectionReason,
+		Lines:            returnLinesFromProto(pr.Lines),
+		RefundableAmount: pr.RefundableAmount,
+		RefundAmount:     pr.RefundAmount,
+		CreatedAt:        timeFromProto(pr.CreatedAt),
+		UpdatedAt:        timeFromProto(pr.UpdatedAt),
+	}
+}
+
+func returnLinesToProto(lines []ReturnLine) []*pb.ReturnLine {
+	pls := make([]*pb.ReturnLine, len(lines))
+	for i, l := range lines {
+		pls[i] = &pb.ReturnLine{ProductId: l.ProductID, VariantId: l.VariantID, Quantity: l.Quantity, Amount: l.Amount}
+	}
+	return pls
+}
+
+func returnLinesFromProto(pls []*pb.ReturnLine) []ReturnLine {
+	lines := make([]ReturnLine, len(pls))
+	for i, l := range pls {
+		lines[i] = ReturnLine{ProductID: l.ProductId, VariantID: l.VariantId, Quantity: l.Quantity, Amount: l.Amount}
+	}
+	return lines
+}
+
+// An unset time travels as no bytes rather than as an encoded zero time.
+func timeToProto(t time.Time) []byte {
+	if t.IsZero() {
+		return nil
+	}
+	b, _ := t.MarshalBinary()
+	return b
+}
+
+func timeFromProto(b []byte) time.Time {
+	t := time.Time{}
+	if len(b) > 0 {
+		t.UnmarshalBinary(b)
+	}
+	return t
+}
@@ -0,0 +1,225 @@
+package order
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/account"
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/grpcclient"
+)
+
+// maxCachedReferences bounds each directory cache; the least recently used
+// entry is evicted once it is reached. Until then, expired entries are still
+// served when the service that owns them is unavailable.
+const maxCachedReferences = 10000
+
+// ErrCatalogUnavailable is returned when products must be read from the
+// catalog as they are now and the catalog service cannot be reached.
+var ErrCatalogUnavailable = errors.New("catalog service is unavailable")
+
+// AccountDirectory resolves account IDs owned by the account service.
+type AccountDirectory interface {
+	GetAccount(ctx context.Context, id string) (*account.Account, error)
+	GetAddress(ctx context.Context, accountID string, id string) (*account.Address, error)
+}
+
+// ProductDirectory resolves product IDs owned by the catalog service. Unknown
+// IDs are left out of the result rather than reported as an error.
+type ProductDirectory interface {
+	// GetProducts may answer from a cache, and with stale products while
+	// the catalog is down. It is meant for display and existence checks.
+	GetProducts(ctx context.Context, ids []string) ([]catalog.Product, error)
+	// GetCurrentProducts always asks the catalog, so prices and stock are
+	// the current ones. It fails with ErrCatalogUnavailable while the
+	// catalog cannot be reached.
+	GetCurrentProducts(ctx context.Context, ids []string) ([]catalog.Product, error)
+}
+
+// referenceCache keeps up to size values by ID and evicts the least recently
+// used one when it is full. Expired values are kept until they are evicted
+// or replaced, to stand in for a service that is down.
+type referenceCache struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	recent  *list.List
+}
+
+type referenceEntry struct {
+	id        string
+	value     interface{}
+	expiresAt time.Time
+}
+
+func newReferenceCache(size int) *referenceCache {
+	return &referenceCache{
+		size:    size,
+		entries: map[string]*list.Element{},
+		recent:  list.New(),
+	}
+}
+
+// get returns the value cached for id, expired or not, and whether it is
+// still fresh at now.
+func (c *referenceCache) get(id string, now time.Time) (value interface{}, fresh bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[id]
+	if !ok {
+		return nil, false, false
+	}
+	c.recent.MoveToFront(el)
+	e := el.Value.(*referenceEntry)
+	return e.value, now.Before(e.expiresAt), true
+}
+
+func (c *referenceCache) put(id string, value interface{}, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[id]; ok {
+		el.Value = &referenceEntry{id: id, value: value, expiresAt: expiresAt}
+		c.recent.MoveToFront(el)
+		return
+	}
+	c.entries[id] = c.recent.PushFront(&referenceEntry{id: id, value: value, expiresAt: expiresAt})
+	if c.recent.Len() > c.size {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*referenceEntry).id)
+	}
+}
+
+type cachedAccountDirectory struct {
+	client *account.Client
+	ttl    time.Duration
+	cache  *referenceCache
+}
+
+// NewCachedAccountDirectory looks accounts up through c and remembers the ones
+// it found for ttl. Misses are never cached, so a freshly created account is
+// visible immediately.
+func NewCachedAccountDirectory(c *account.Client, ttl time.Duration) AccountDirectory {
+	if c == nil {
+		panic("account client cannot be nil")
+	}
+	return &cachedAccountDirectory{
+		client: c,
+		ttl:    ttl,
+		cache:  newReferenceCache(maxCachedReferences),
+	}
+}
+
+func (d *cachedAccountDirectory) GetAccount(ctx context.Context, id string) (*account.Account, error) {
+	now := time.Now()
+
+	cached, fresh, ok := d.cache.get(id, now)
+	if ok && fresh {
+		a := cached.(account.Account)
+		return &a, nil
+	}
+
+	a, err := d.client.GetAccount(ctx, id)
+	if err != nil {
+		if ok && grpcclient.IsUnavailable(err) {
+			log.Printf("Account service is unavailable, using cached account %s: %v", id, err)
+			a := cached.(account.Account)
+			return &a, nil
+		}
+		return nil, err
+	}
+
+	d.cache.put(id, *a, now.Add(d.ttl))
+	return a, nil
+}
+
+// GetAddress is not cached: an order must ship to the address as it is now.
+func (d *cachedAccountDirectory) GetAddress(ctx context.Context, accountID string, id string) (*account.Address, error) {
+	return d.client.GetAddress(ctx, accountID, id)
+}
+
+type cachedProductDirectory struct {
+	client *catalog.Client
+	ttl    time.Duration
+	cache  *referenceCache
+}
+
+// NewCachedProductDirectory looks products up through c and remembers the
+// ones it found for ttl. Only IDs missing from the cache are sent to the
+// catalog service.
+func NewCachedProductDirectory(c *catalog.Client, ttl time.Duration) ProductDirectory {
+	if c == nil {
+		panic("catalog client cannot be nil")
+	}
+	return &cachedProductDirectory{
+		client: c,
+		ttl:    ttl,
+		cache:  newReferenceCache(maxCachedReferences),
+	}
+}
+
+func (d *cachedProductDirectory) GetProducts(ctx context.Context, ids []string) ([]catalog.Product, error) {
+	now := time.Now()
+	products := make([]catalog.Product, 0, len(ids))
+	missing := []string{}
+	stale := []catalog.Product{}
+
+	for _, id := range ids {
+		cached, fresh, ok := d.cache.get(id, now)
+		if ok && fresh {
+			products = append(products, cached.(catalog.Product))
+			continue
+		}
+		missing = append(missing, id)
+		if ok {
+			stale = append(stale, cached.(catalog.Product))
+		}
+	}
+
+	if len(missing) == 0 {
+		return products, nil
+	}
+
+	fetched, err := d.client.GetProducts(ctx, 0, 0, missing, "")
+	if err != nil {
+		// Expired entries stand in for the catalog while it is down, but
+		// only if there is one for every product: leaving a product out
+		// would report it as unknown.
+		if len(stale) == len(missing) && grpcclient.IsUnavailable(err) {
+			log.Printf("Catalog service is unavailable, using %d cached products: %v", len(stale), err)
+			return append(products, stale...), nil
+		}
+		return nil, err
+	}
+	d.remember(fetched, now)
+
+	return append(products, fetched...), nil
+}
+
+func (d *cachedProductDirectory) GetCurrentProducts(ctx context.Context, ids []string) ([]catalog.Product, error) {
+	if len(ids) == 0 {
+		return []catalog.Product{}, nil
+	}
+	products, err := d.client.GetProducts(ctx, 0, 0, ids, "")
+	if err != nil {
+		if grpcclient.IsUnavailable(err) {
+			return nil, fmt.Errorf("%w: %v", ErrCatalogUnavailable, err)
+		}
+		return nil, err
+	}
+	d.remember(products, time.Now())
+	return products, nil
+}
+
+// remember caches products fetched at now.
+func (d *cachedProductDirectory) remember(products []catalog.Product, now time.Time) {
+	for _, p := range products {
+		d.cache.put(p.ID, p, now.Add(d.ttl))
+	}
+}
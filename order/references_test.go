@@ -0,0 +1,67 @@
+package order
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestReferenceCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := newReferenceCache(3)
+	for i := 0; i < 3; i++ {
+		c.put(fmt.Sprintf("id-%d", i), i, now.Add(time.Minute))
+	}
+
+	// id-0 is used again, so id-1 is the least recently used.
+	if _, _, ok := c.get("id-0", now); !ok {
+		t.Fatal("id-0 is not cached")
+	}
+	c.put("id-3", 3, now.Add(time.Minute))
+	if _, _, ok := c.get("id-1", now); ok {
+		t.Error("id-1 is still cached, want it evicted")
+	}
+	for _, id := range []string{"id-0", "id-2", "id-3"} {
+		if _, _, ok := c.get(id, now); !ok {
+			t.Errorf("%s is not cached", id)
+		}
+	}
+
+	// Replacing an entry does not grow the cache.
+	c.put("id-3", 33, now.Add(time.Minute))
+	if v, _, _ := c.get("id-3", now); v != 33 {
+		t.Errorf("id-3 = %v, want 33", v)
+	}
+	if n := c.recent.Len(); n != 3 {
+		t.Errorf("cache holds %d entries, want 3", n)
+	}
+}
+
+func TestReferenceCacheBoundedWithoutExpiredEntries(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := newReferenceCache(100)
+	// None of the entries has expired, so none could be swept.
+	for i := 0; i < 1000; i++ {
+		c.put(fmt.Sprintf("id-%d", i), i, now.Add(time.Hour))
+	}
+	if n := c.recent.Len(); n != 100 {
+		t.Errorf("cache holds %d entries, want 100", n)
+	}
+	if n := len(c.entries); n != 100 {
+		t.Errorf("cache indexes %d entries, want 100", n)
+	}
+}
+
+func TestReferenceCacheKeepsExpiredEntries(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := newReferenceCache(10)
+	c.put("id", "value", now.Add(time.Minute))
+
+	if v, fresh, ok := c.get("id", now); !ok || !fresh || v != "value" {
+		t.Errorf("get before expiry = %v, %v, %v, want a fresh value", v, fresh, ok)
+	}
+	// An expired entry can still stand in for a service that is down.
+	if v, fresh, ok := c.get("id", now.Add(time.Minute)); !ok || fresh || v != "value" {
+		t.Errorf("get after expiry = %v, %v, %v, want a stale value", v, fresh, ok)
+	}
+}
@@ -3,15 +3,56 @@ package order
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/donaldnash/go-marketplace/outbox"
+	"github.com/donaldnash/go-marketplace/payment"
+	"github.com/donaldnash/go-marketplace/promotion"
 	"github.com/lib/pq"
 )
 
 type Repository interface {
 	Close()
 	PutOrder(ctx context.Context, o Order) error
+	PutOrderWithKey(ctx context.Context, o Order, key string, requestHash string) (*Order, error)
+	// GetOrderByKey returns the order stored under the account's idempotency
+	// key. It fails with ErrOrderNotFound if the key was not used yet, and
+	// with ErrIdempotencyKeyReused if it was used for another request.
+	GetOrderByKey(ctx context.Context, accountID string, key string, requestHash string) (*Order, error)
 	GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error)
+	GetOrder(ctx context.Context, id string) (*Order, error)
+	HasOrdered(ctx context.Context, accountID string, productID string) (bool, error)
+	// GetSellerOrders lists the seller orders of sellerID, newest first.
+	GetSellerOrders(ctx context.Context, sellerID string, skip uint64, take uint64) ([]SellerOrder, error)
+	// GetSalesReport sums up the seller orders of sellerID placed from from
+	// until to, leaving out orders that were not paid.
+	GetSalesReport(ctx context.Context, sellerID string, from time.Time, to time.Time) (*SalesReport, error)
+	// CancelOrder moves a pending order to StatusCancelled. It fails with
+	// ErrOrderNotCancellable if the order is no longer pending or a payment
+	// of it is in progress.
+	CancelOrder(ctx context.Context, id string) error
+	// PutPayment stores p if its order is still pending, and fails with
+	// ErrOrderNotPayable otherwise.
+	PutPayment(ctx context.Context, p payment.Payment) error
+	// UpdatePayment stores the new state of p and, if status is set, moves
+	// its order to status in the same transaction.
+	UpdatePayment(ctx context.Context, p payment.Payment, status Status) error
+	GetPaymentByReference(ctx context.Context, provider string, reference string) (*payment.Payment, error)
+	// GetCapturedPayment returns the payment that paid the order.
+	GetCapturedPayment(ctx context.Context, orderID string) (*payment.Payment, error)
+	// PutReturn stores ret unless it would return more of a product than was
+	// ordered, counting every return of the order that was not rejected.
+	PutReturn(ctx context.Context, ret Return) error
+	GetReturn(ctx context.Context, id string) (*Return, error)
+	GetReturnsForOrder(ctx context.Context, orderID string) ([]Return, error)
+	// UpdateReturnStatus moves a return from one status to another and fails
+	// with ErrReturnStatus if it is no longer in from.
+	UpdateReturnStatus(ctx context.Context, id string, from ReturnStatus, to ReturnStatus, rejectionReason string) error
+	// RecordRefund marks a refunding return as refunded by amount and stores
+	// the refunded payment and order status in the same transaction.
+	RecordRefund(ctx context.Context, returnID string, amount float64, p payment.Payment, status Status) error
 }
 
 type postgresRepository struct {
@@ -52,29 +93,144 @@ func (r *postgresRepository) PutOrder(ctx context.Context, o Order) error {
 		}
 	}()
 
+	if err = insertOrder(ctx, tx, o); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// PutOrderWithKey inserts o and records it under the account's idempotency
+// key in the same transaction. If the key was used before, the order stored
+// with it is returned instead; concurrent calls with the same key wait for
+// the first one to commit.
+func (r *postgresRepository) PutOrderWithKey(ctx context.Context, o Order, key string, requestHash string) (*Order, error) {
+	if key == "" {
+		return nil, fmt.Errorf("idempotency key is required")
+	}
+
+	response, err := json.Marshal(o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal order: %v", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO idempotency_keys(account_id, key, request_hash, response)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`,
+		o.AccountID,
+		key,
+		requestHash,
+		response,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record idempotency key: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to record idempotency key: %v", err)
+	} else if n == 0 {
+		tx.Rollback()
+		return r.GetOrderByKey(ctx, o.AccountID, key, requestHash)
+	}
+
+	if err = insertOrder(ctx, tx, o); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return &o, nil
+}
+
+func (r *postgresRepository) GetOrderByKey(ctx context.Context, accountID string, key string, requestHash string) (*Order, error) {
+	var storedHash string
+	var response []byte
+	row := r.db.QueryRowContext(
+		ctx,
+		"SELECT request_hash, response FROM idempotency_keys WHERE account_id = $1 AND key = $2",
+		accountID,
+		key,
+	)
+	if err := row.Scan(&storedHash, &response); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("failed to load idempotency key: %v", err)
+	}
+	if storedHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	o := &Order{}
+	if err := json.Unmarshal(response, o); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal stored order: %v", err)
+	}
+	return o, nil
+}
+
+func insertOrder(ctx context.Context, tx *sql.Tx, o Order) error {
+	shipping := ShippingAddress{}
+	if o.ShippingAddress != nil {
+		shipping = *o.ShippingAddress
+	}
+
 	// Insert order
-	_, err = tx.ExecContext(
+	_, err := tx.ExecContext(
 		ctx,
-		"INSERT INTO orders(id, created_at, account_id, total_price) VALUES ($1, $2, $3, $4)",
+		`INSERT INTO orders(
+			id, created_at, account_id, status,
+			subtotal, discount_total, tax_total, shipping_total, total_price,
+			tax_country, tax_region, shipping_method,
+			shipping_address_id, shipping_name, shipping_line1, shipping_line2,
+			shipping_city, shipping_region, shipping_postal_code, shipping_country
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)`,
 		o.ID,
 		o.CreatedAt,
 		o.AccountID,
+		o.Status,
+		o.Subtotal,
+		o.DiscountTotal,
+		o.TaxTotal,
+		o.ShippingTotal,
 		o.TotalPrice,
+		o.TaxLocation.Country,
+		o.TaxLocation.Region,
+		o.ShippingMethod,
+		shipping.AddressID,
+		shipping.Name,
+		shipping.Line1,
+		shipping.Line2,
+		shipping.City,
+		shipping.Region,
+		shipping.PostalCode,
+		shipping.Country,
 	)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			switch pqErr.Code.Name() {
-			case "foreign_key_violation":
-				return fmt.Errorf("account with ID %s does not exist", o.AccountID)
 			case "unique_violation":
 				return fmt.Errorf("order with ID %s already exists", o.ID)
+			case "check_violation":
+				return fmt.Errorf("order amounts cannot be negative")
 			}
 		}
 		return fmt.Errorf("failed to insert order: %v", err)
 	}
 
 	// Prepare statement for order products
-	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("order_products", "order_id", "product_id", "quantity", "price"))
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("order_products", "order_id", "product_id", "quantity", "price", "name", "description", "tax_category", "tax", "weight", "variant_id", "sku", "attributes", "seller_id"))
 	if err != nil {
 		return fmt.Errorf("failed to prepare order products statement: %v", err)
 	}
@@ -82,7 +238,11 @@ func (r *postgresRepository) PutOrder(ctx context.Context, o Order) error {
 
 	// Insert order products
 	for _, p := range o.Products {
-		_, err = stmt.ExecContext(ctx, o.ID, p.ID, p.Quantity, p.Price)
+		attributes, err := json.Marshal(attributeDocuments(p.Attributes))
+		if err != nil {
+			return fmt.Errorf("failed to marshal attributes of order product (ID: %s): %v", p.ID, err)
+		}
+		_, err = stmt.ExecContext(ctx, o.ID, p.ID, p.Quantity, p.Price, p.Name, p.Description, p.TaxCategory, p.Tax, p.Weight, p.VariantID, p.SKU, string(attributes), p.SellerID)
 		if err != nil {
 			return fmt.Errorf("failed to insert order product (ID: %s): %v", p.ID, err)
 		}
@@ -91,42 +251,216 @@ func (r *postgresRepository) PutOrder(ctx context.Context, o Order) error {
 	// Execute the prepared statement
 	_, err = stmt.ExecContext(ctx)
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
-			return fmt.Errorf("one or more products in your order could not be found")
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "foreign_key_violation":
+				return fmt.Errorf("order with ID %s does not exist", o.ID)
+			case "check_violation":
+				return fmt.Errorf("order products must have a positive quantity and a non-negative price and tax")
+			case "unique_violation":
+				return fmt.Errorf("order contains the same product variant more than once")
+			}
 		}
 		return fmt.Errorf("failed to execute order products statement: %v", err)
 	}
 
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+	for _, so := range o.SellerOrders {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO seller_orders(
+				order_id, seller_id, subtotal, discount_total, tax_total, commission_rate, commission, payout
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			o.ID,
+			so.SellerID,
+			so.Subtotal,
+			so.DiscountTotal,
+			so.TaxTotal,
+			so.CommissionRate,
+			so.Commission,
+			so.Payout,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert seller order of seller %s: %v", so.SellerID, err)
+		}
+	}
+
+	for _, d := range o.Discounts {
+		if err := redeemDiscount(ctx, tx, o, d); err != nil {
+			return err
+		}
+	}
+
+	e, err := orderPlacedEvent(o)
+	if err != nil {
+		return err
+	}
+	return outbox.Insert(ctx, tx, e)
+}
+
+// redeemDiscount records d against o. The promotion row stays locked until
+// the transaction ends, so concurrent orders of one account cannot both take
+// its last allowed use.
+func redeemDiscount(ctx context.Context, tx *sql.Tx, o Order, d promotion.Discount) error {
+	var limit uint32
+	err := tx.QueryRowContext(
+		ctx,
+		"SELECT usage_limit_per_account FROM promotions WHERE id = $1 FOR UPDATE",
+		d.PromotionID,
+	).Scan(&limit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return promotion.ErrNotFound
+		}
+		return fmt.Errorf("failed to lock promotion %s: %v", d.PromotionID, err)
+	}
+
+	if limit > 0 {
+		var uses uint32
+		err = tx.QueryRowContext(
+			ctx,
+			`SELECT COUNT(*)
+			FROM order_discounts d
+			JOIN orders o ON o.id = d.order_id
+			WHERE d.promotion_id = $1 AND o.account_id = $2`,
+			d.PromotionID,
+			o.AccountID,
+		).Scan(&uses)
+		if err != nil {
+			return fmt.Errorf("failed to count redemptions: %v", err)
+		}
+		if uses >= limit {
+			return promotion.ErrUsageLimitReached
+		}
 	}
 
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO order_discounts(order_id, promotion_id, code, description, amount)
+		VALUES ($1, $2, $3, $4, $5)`,
+		o.ID,
+		d.PromotionID,
+		d.Code,
+		d.Description,
+		d.Amount,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert order discount (promotion ID: %s): %v", d.PromotionID, err)
+	}
 	return nil
 }
 
+const orderQuery = `SELECT
+		o.id,
+		o.created_at,
+		o.account_id,
+		o.status,
+		o.subtotal::float8,
+		o.discount_total::float8,
+		o.tax_total::float8,
+		o.shipping_total::float8,
+		o.total_price::money::numeric::float8,
+		o.tax_country,
+		o.tax_region,
+		o.shipping_method,
+		o.shipping_address_id,
+		o.shipping_name,
+		o.shipping_line1,
+		o.shipping_line2,
+		o.shipping_city,
+		o.shipping_region,
+		o.shipping_postal_code,
+		o.shipping_country,
+		op.product_id,
+		op.quantity,
+		op.price,
+		op.name,
+		op.description,
+		op.tax_category,
+		op.tax::float8,
+		op.weight,
+		op.variant_id,
+		op.sku,
+		op.attributes,
+		op.seller_id
+	FROM orders o 
+	JOIN order_products op ON o.id = op.order_id`
+
 func (r *postgresRepository) GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error) {
 	if accountID == "" {
 		return nil, fmt.Errorf("account ID is required")
 	}
+	return r.queryOrders(ctx, orderQuery+" WHERE o.account_id = $1 ORDER BY o.created_at, o.id", accountID)
+}
 
-	// Query orders and their products
-	rows, err := r.db.QueryContext(
+func (r *postgresRepository) GetOrder(ctx context.Context, id string) (*Order, error) {
+	if id == "" {
+		return nil, ErrOrderNotFound
+	}
+	orders, err := r.queryOrders(ctx, orderQuery+" WHERE o.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, ErrOrderNotFound
+	}
+	return &orders[0], nil
+}
+
+// HasOrdered leaves out pending and cancelled orders, which were never paid.
+func (r *postgresRepository) HasOrdered(ctx context.Context, accountID string, productID string) (bool, error) {
+	var ordered bool
+	err := r.db.QueryRowContext(
 		ctx,
-		`SELECT
-			o.id,
-			o.created_at,
-			o.account_id,
-			o.total_price::money::numeric::float8,
-			op.product_id,
-			op.quantity,
-			op.price
-		FROM orders o 
-		JOIN order_products op ON o.id = op.order_id
-		WHERE o.account_id = $1
-		ORDER BY o.id`,
+		`SELECT EXISTS (
+			SELECT 1
+			FROM orders o
+			JOIN order_products op ON o.id = op.order_id
+			WHERE o.account_id = $1 AND op.product_id = $2 AND o.status NOT IN ($3, $4)
+		)`,
 		accountID,
-	)
+		productID,
+		StatusPending,
+		StatusCancelled,
+	).Scan(&ordered)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up orders of product: %v", err)
+	}
+	return ordered, nil
+}
+
+// attributeDocument is how the attributes of an ordered variant are stored
+// in the attributes column.
+type attributeDocument struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func attributeDocuments(attributes []Attribute) []attributeDocument {
+	docs := make([]attributeDocument, len(attributes))
+	for i, a := range attributes {
+		docs[i] = attributeDocument{Name: a.Name, Value: a.Value}
+	}
+	return docs
+}
+
+func parseAttributes(data []byte) ([]Attribute, error) {
+	var docs []attributeDocument
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal order product attributes: %v", err)
+	}
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	attributes := make([]Attribute, len(docs))
+	for i, d := range docs {
+		attributes[i] = Attribute{Name: d.Name, Value: d.Value}
+	}
+	return attributes, nil
+}
+
+func (r *postgresRepository) queryOrders(ctx context.Context, query string, args ...interface{}) ([]Order, error) {
+	// Query orders and their products
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return []Order{}, nil
@@ -136,27 +470,62 @@ func (r *postgresRepository) GetOrdersForAccount(ctx context.Context, accountID
 	defer rows.Close()
 
 	orderMap := make(map[string]*Order)
+	orderIDs := []string{}
 	var orders []Order
 
 	// Scan rows into orders
 	for rows.Next() {
 		var order Order
 		var product OrderedProduct
+		var shipping ShippingAddress
+		var attributes []byte
 		if err = rows.Scan(
 			&order.ID,
 			&order.CreatedAt,
 			&order.AccountID,
+			&order.Status,
+			&order.Subtotal,
+			&order.DiscountTotal,
+			&order.TaxTotal,
+			&order.ShippingTotal,
 			&order.TotalPrice,
+			&order.TaxLocation.Country,
+			&order.TaxLocation.Region,
+			&order.ShippingMethod,
+			&shipping.AddressID,
+			&shipping.Name,
+			&shipping.Line1,
+			&shipping.Line2,
+			&shipping.City,
+			&shipping.Region,
+			&shipping.PostalCode,
+			&shipping.Country,
 			&product.ID,
 			&product.Quantity,
 			&product.Price,
+			&product.Name,
+			&product.Description,
+			&product.TaxCategory,
+			&product.Tax,
+			&product.Weight,
+			&product.VariantID,
+			&product.SKU,
+			&attributes,
+			&product.SellerID,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan order row: %v", err)
 		}
+		if product.Attributes, err = parseAttributes(attributes); err != nil {
+			return nil, err
+		}
+		if shipping.AddressID != "" {
+			order.ShippingAddress = &shipping
+		}
 
 		if existingOrder, ok := orderMap[order.ID]; !ok {
 			order.Products = []OrderedProduct{product}
 			orderMap[order.ID] = &order
+			orderIDs = append(orderIDs, order.ID)
 		} else {
 			existingOrder.Products = append(existingOrder.Products, product)
 		}
@@ -167,10 +536,715 @@ func (r *postgresRepository) GetOrdersForAccount(ctx context.Context, accountID
 		return nil, fmt.Errorf("error iterating over order rows: %v", err)
 	}
 
-	// Convert map to slice
-	for _, order := range orderMap {
-		orders = append(orders, *order)
+	if err = r.loadDiscounts(ctx, orderIDs, orderMap); err != nil {
+		return nil, err
+	}
+	if err = r.loadSellerOrders(ctx, orderIDs, orderMap); err != nil {
+		return nil, err
+	}
+
+	// Convert map to slice, keeping the query's order
+	for _, id := range orderIDs {
+		orders = append(orders, *orderMap[id])
+	}
+
+	return orders, nil
+}
+
+func (r *postgresRepository) loadDiscounts(ctx context.Context, orderIDs []string, orderMap map[string]*Order) error {
+	for _, o := range orderMap {
+		o.Discounts = []promotion.Discount{}
+	}
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT order_id, promotion_id, code, description, amount::float8
+		FROM order_discounts
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, code`,
+		pq.Array(orderIDs),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query order discounts: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID string
+		var d promotion.Discount
+		if err := rows.Scan(&orderID, &d.PromotionID, &d.Code, &d.Description, &d.Amount); err != nil {
+			return fmt.Errorf("failed to scan order discount row: %v", err)
+		}
+		if o, ok := orderMap[orderID]; ok {
+			o.Discounts = append(o.Discounts, d)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over order discount rows: %v", err)
+	}
+	return nil
+}
+
+const sellerOrderColumns = `so.subtotal::float8,
+		so.discount_total::float8,
+		so.tax_total::float8,
+		so.commission_rate::float8,
+		so.commission::float8,
+		so.payout::float8`
+
+func (r *postgresRepository) loadSellerOrders(ctx context.Context, orderIDs []string, orderMap map[string]*Order) error {
+	for _, o := range orderMap {
+		o.SellerOrders = []SellerOrder{}
+	}
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT so.order_id, so.seller_id, `+sellerOrderColumns+`
+		FROM seller_orders so
+		WHERE so.order_id = ANY($1)
+		ORDER BY so.order_id, so.seller_id`,
+		pq.Array(orderIDs),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query seller orders: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var so SellerOrder
+		if err := rows.Scan(
+			&so.OrderID,
+			&so.SellerID,
+			&so.Subtotal,
+			&so.DiscountTotal,
+			&so.TaxTotal,
+			&so.CommissionRate,
+			&so.Commission,
+			&so.Payout,
+		); err != nil {
+			return fmt.Errorf("failed to scan seller order row: %v", err)
+		}
+		o, ok := orderMap[so.OrderID]
+		if !ok {
+			continue
+		}
+		for _, p := range o.Products {
+			if p.SellerID == so.SellerID {
+				so.Products = append(so.Products, p)
+			}
+		}
+		o.SellerOrders = append(o.SellerOrders, so)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over seller order rows: %v", err)
+	}
+
+	for _, o := range orderMap {
+		o.setSellerOrderDetails()
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetSellerOrders(ctx context.Context, sellerID string, skip uint64, take uint64) ([]SellerOrder, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT
+			o.id,
+			o.created_at,
+			o.status,
+			o.shipping_method,
+			o.shipping_address_id,
+			o.shipping_name,
+			o.shipping_line1,
+			o.shipping_line2,
+			o.shipping_city,
+			o.shipping_region,
+			o.shipping_postal_code,
+			o.shipping_country,
+			`+sellerOrderColumns+`
+		FROM seller_orders so
+		JOIN orders o ON o.id = so.order_id
+		WHERE so.seller_id = $1
+		ORDER BY o.created_at DESC, o.id DESC
+		OFFSET $2 LIMIT $3`,
+		sellerID,
+		skip,
+		take,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query seller orders: %v", err)
+	}
+	defer rows.Close()
+
+	orders := []SellerOrder{}
+	orderIDs := []string{}
+	for rows.Next() {
+		so := SellerOrder{SellerID: sellerID, Products: []OrderedProduct{}}
+		var shipping ShippingAddress
+		if err := rows.Scan(
+			&so.OrderID,
+			&so.CreatedAt,
+			&so.Status,
+			&so.ShippingMethod,
+			&shipping.AddressID,
+			&shipping.Name,
+			&shipping.Line1,
+			&shipping.Line2,
+			&shipping.City,
+			&shipping.Region,
+			&shipping.PostalCode,
+			&shipping.Country,
+			&so.Subtotal,
+			&so.DiscountTotal,
+			&so.TaxTotal,
+			&so.CommissionRate,
+			&so.Commission,
+			&so.Payout,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan seller order row: %v", err)
+		}
+		if shipping.AddressID != "" {
+			so.ShippingAddress = &shipping
+		}
+		orders = append(orders, so)
+		orderIDs = append(orderIDs, so.OrderID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over seller order rows: %v", err)
+	}
+	if len(orders) == 0 {
+		return orders, nil
+	}
+
+	lines, err := r.db.QueryContext(
+		ctx,
+		`SELECT order_id, product_id, quantity, price, name, description, tax_category, tax::float8, weight, variant_id, sku, attributes
+		FROM order_products
+		WHERE order_id = ANY($1) AND seller_id = $2
+		ORDER BY order_id, product_id, variant_id`,
+		pq.Array(orderIDs),
+		sellerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query seller order products: %v", err)
 	}
+	defer lines.Close()
 
+	byID := map[string]*SellerOrder{}
+	for i := range orders {
+		byID[orders[i].OrderID] = &orders[i]
+	}
+	for lines.Next() {
+		var orderID string
+		var attributes []byte
+		p := OrderedProduct{SellerID: sellerID}
+		if err := lines.Scan(
+			&orderID,
+			&p.ID,
+			&p.Quantity,
+			&p.Price,
+			&p.Name,
+			&p.Description,
+			&p.TaxCategory,
+			&p.Tax,
+			&p.Weight,
+			&p.VariantID,
+			&p.SKU,
+			&attributes,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan seller order product row: %v", err)
+		}
+		if p.Attributes, err = parseAttributes(attributes); err != nil {
+			return nil, err
+		}
+		if so, ok := byID[orderID]; ok {
+			so.Products = append(so.Products, p)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over seller order product rows: %v", err)
+	}
 	return orders, nil
 }
+
+func (r *postgresRepository) GetSalesReport(ctx context.Context, sellerID string, from time.Time, to time.Time) (*SalesReport, error) {
+	report := &SalesReport{SellerID: sellerID, From: from, To: to}
+	row := r.db.QueryRowContext(
+		ctx,
+		`SELECT
+			COUNT(*),
+			COALESCE(SUM(so.subtotal), 0)::float8,
+			COALESCE(SUM(so.discount_total), 0)::float8,
+			COALESCE(SUM(so.tax_total), 0)::float8,
+			COALESCE(SUM(so.commission), 0)::float8,
+			COALESCE(SUM(so.payout), 0)::float8,
+			COALESCE((
+				SELECT SUM(op.quantity)
+				FROM order_products op
+				JOIN orders po ON po.id = op.order_id
+				WHERE op.seller_id = $1 AND po.status NOT IN ($4, $5) AND po.created_at >= $2 AND po.created_at < $3
+			), 0)
+		FROM seller_orders so
+		JOIN orders o ON o.id = so.order_id
+		WHERE so.seller_id = $1 AND o.status NOT IN ($4, $5) AND o.created_at >= $2 AND o.created_at < $3`,
+		sellerID,
+		from,
+		to,
+		StatusPending,
+		StatusCancelled,
+	)
+	if err := row.Scan(
+		&report.Orders,
+		&report.Subtotal,
+		&report.DiscountTotal,
+		&report.TaxTotal,
+		&report.Commission,
+		&report.Payout,
+		&report.Units,
+	); err != nil {
+		return nil, fmt.Errorf("failed to scan sales report: %v", err)
+	}
+	return report, nil
+}
+
+func (r *postgresRepository) CancelOrder(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Locking the order waits for a payment being stored by PutPayment, so
+	// the check below sees it.
+	var status Status
+	err = tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = $1 FOR UPDATE", id).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrOrderNotFound
+		}
+		return fmt.Errorf("failed to lock order: %v", err)
+	}
+	if status != StatusPending {
+		return ErrOrderNotCancellable
+	}
+
+	var paying bool
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT EXISTS(SELECT 1 FROM payments WHERE order_id = $1 AND status IN ($2, $3, $4))",
+		id,
+		payment.StatusPending,
+		payment.StatusAuthorized,
+		payment.StatusCaptured,
+	).Scan(&paying)
+	if err != nil {
+		return fmt.Errorf("failed to check payments: %v", err)
+	}
+	if paying {
+		return ErrOrderNotCancellable
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE orders SET status = $2 WHERE id = $1", id, StatusCancelled); err != nil {
+		return fmt.Errorf("failed to update order status: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) PutPayment(ctx context.Context, p payment.Payment) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// The order stays locked until the payment is stored, so it cannot be
+	// cancelled in between.
+	var status Status
+	err = tx.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = $1 FOR SHARE", p.OrderID).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrOrderNotFound
+		}
+		return fmt.Errorf("failed to lock order: %v", err)
+	}
+	if status != StatusPending {
+		return ErrOrderNotPayable
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO payments(id, order_id, provider, reference, amount, refunded_amount, status, failure_reason, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		p.ID,
+		p.OrderID,
+		p.Provider,
+		p.Reference,
+		p.Amount,
+		p.RefundedAmount,
+		p.Status,
+		p.FailureReason,
+		p.CreatedAt,
+		p.UpdatedAt,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				return ErrPaymentInProgress
+			case "foreign_key_violation":
+				return ErrOrderNotFound
+			}
+		}
+		return fmt.Errorf("failed to insert payment: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) UpdatePayment(ctx context.Context, p payment.Payment, status Status) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err = updatePayment(ctx, tx, p, status); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func updatePayment(ctx context.Context, tx *sql.Tx, p payment.Payment, status Status) error {
+	res, err := tx.ExecContext(
+		ctx,
+		`UPDATE payments SET
+			reference = $2,
+			refunded_amount = $3,
+			status = $4,
+			failure_reason = $5,
+			updated_at = $6
+		WHERE id = $1`,
+		p.ID,
+		p.Reference,
+		p.RefundedAmount,
+		p.Status,
+		p.FailureReason,
+		p.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update payment: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return payment.ErrUnknownTransaction
+	}
+
+	if status != "" {
+		_, err = tx.ExecContext(ctx, "UPDATE orders SET status = $2 WHERE id = $1", p.OrderID, status)
+		if err != nil {
+			return fmt.Errorf("failed to update order status: %v", err)
+		}
+	}
+	return nil
+}
+
+const paymentColumns = `id, order_id, provider, reference, amount::float8, refunded_amount::float8,
+	status, failure_reason, created_at, updated_at`
+
+func (r *postgresRepository) GetPaymentByReference(ctx context.Context, provider string, reference string) (*payment.Payment, error) {
+	if reference == "" {
+		return nil, payment.ErrUnknownTransaction
+	}
+	row := r.db.QueryRowContext(
+		ctx,
+		"SELECT "+paymentColumns+" FROM payments WHERE provider = $1 AND reference = $2",
+		provider,
+		reference,
+	)
+	return scanPayment(row)
+}
+
+func (r *postgresRepository) GetCapturedPayment(ctx context.Context, orderID string) (*payment.Payment, error) {
+	row := r.db.QueryRowContext(
+		ctx,
+		"SELECT "+paymentColumns+" FROM payments WHERE order_id = $1 AND status = $2",
+		orderID,
+		payment.StatusCaptured,
+	)
+	return scanPayment(row)
+}
+
+func scanPayment(row *sql.Row) (*payment.Payment, error) {
+	p := &payment.Payment{}
+	err := row.Scan(
+		&p.ID,
+		&p.OrderID,
+		&p.Provider,
+		&p.Reference,
+		&p.Amount,
+		&p.RefundedAmount,
+		&p.Status,
+		&p.FailureReason,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, payment.ErrUnknownTransaction
+		}
+		return nil, fmt.Errorf("failed to scan payment row: %v", err)
+	}
+	return p, nil
+}
+
+func (r *postgresRepository) PutReturn(ctx context.Context, ret Return) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the order so concurrent returns of it are counted one after the
+	// other.
+	var orderID string
+	err = tx.QueryRowContext(ctx, "SELECT id FROM orders WHERE id = $1 FOR UPDATE", ret.OrderID).Scan(&orderID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrOrderNotFound
+		}
+		return fmt.Errorf("failed to lock order: %v", err)
+	}
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT op.product_id, op.variant_id, op.quantity, COALESCE(SUM(rl.quantity), 0)
+		FROM order_products op
+		LEFT JOIN returns rt ON rt.order_id = op.order_id AND rt.status <> $2
+		LEFT JOIN return_lines rl ON rl.return_id = rt.id AND rl.product_id = op.product_id
+			AND rl.variant_id = op.variant_id
+		WHERE op.order_id = $1
+		GROUP BY op.product_id, op.variant_id, op.quantity`,
+		ret.OrderID,
+		ReturnRejected,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to count returned products: %v", err)
+	}
+	returnable := map[string]uint32{}
+	for rows.Next() {
+		var productID, variantID string
+		var ordered, returned uint32
+		if err := rows.Scan(&productID, &variantID, &ordered, &returned); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan returned products: %v", err)
+		}
+		if returned < ordered {
+			returnable[productID+"\x00"+variantID] = ordered - returned
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over returned products: %v", err)
+	}
+	for _, l := range ret.Lines {
+		if n := returnable[l.ProductID+"\x00"+l.VariantID]; l.Quantity > n {
+			return fmt.Errorf("%w: only %d more of %s can be returned", ErrInvalidReturn, n, l.describe())
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO returns(id, order_id, account_id, status, reason, refundable_amount, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		ret.ID,
+		ret.OrderID,
+		ret.AccountID,
+		ret.Status,
+		ret.Reason,
+		ret.RefundableAmount,
+		ret.CreatedAt,
+		ret.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert return: %v", err)
+	}
+	for _, l := range ret.Lines {
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO return_lines(return_id, product_id, variant_id, quantity, amount) VALUES ($1, $2, $3, $4, $5)",
+			ret.ID,
+			l.ProductID,
+			l.VariantID,
+			l.Quantity,
+			l.Amount,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert return line (product ID: %s): %v", l.ProductID, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+const returnColumns = `id, order_id, account_id, status, reason, rejection_reason,
+	refundable_amount::float8, refund_amount::float8, created_at, updated_at`
+
+func (r *postgresRepository) GetReturn(ctx context.Context, id string) (*Return, error) {
+	returns, err := r.queryReturns(ctx, "SELECT "+returnColumns+" FROM returns WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(returns) == 0 {
+		return nil, ErrReturnNotFound
+	}
+	return &returns[0], nil
+}
+
+func (r *postgresRepository) GetReturnsForOrder(ctx context.Context, orderID string) ([]Return, error) {
+	return r.queryReturns(ctx, "SELECT "+returnColumns+" FROM returns WHERE order_id = $1 ORDER BY created_at, id", orderID)
+}
+
+func (r *postgresRepository) queryReturns(ctx context.Context, query string, args ...interface{}) ([]Return, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query returns: %v", err)
+	}
+	defer rows.Close()
+
+	returns := []Return{}
+	ids := []string{}
+	for rows.Next() {
+		var ret Return
+		if err := rows.Scan(
+			&ret.ID,
+			&ret.OrderID,
+			&ret.AccountID,
+			&ret.Status,
+			&ret.Reason,
+			&ret.RejectionReason,
+			&ret.RefundableAmount,
+			&ret.RefundAmount,
+			&ret.CreatedAt,
+			&ret.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan return row: %v", err)
+		}
+		ret.Lines = []ReturnLine{}
+		returns = append(returns, ret)
+		ids = append(ids, ret.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over return rows: %v", err)
+	}
+	if len(ids) == 0 {
+		return returns, nil
+	}
+
+	lineRows, err := r.db.QueryContext(
+		ctx,
+		`SELECT return_id, product_id, variant_id, quantity, amount::float8
+		FROM return_lines
+		WHERE return_id = ANY($1)
+		ORDER BY return_id, product_id, variant_id`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query return lines: %v", err)
+	}
+	defer lineRows.Close()
+
+	index := map[string]int{}
+	for i, ret := range returns {
+		index[ret.ID] = i
+	}
+	for lineRows.Next() {
+		var returnID string
+		var l ReturnLine
+		if err := lineRows.Scan(&returnID, &l.ProductID, &l.VariantID, &l.Quantity, &l.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan return line row: %v", err)
+		}
+		if i, ok := index[returnID]; ok {
+			returns[i].Lines = append(returns[i].Lines, l)
+		}
+	}
+	if err := lineRows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over return line rows: %v", err)
+	}
+	return returns, nil
+}
+
+func (r *postgresRepository) UpdateReturnStatus(ctx context.Context, id string, from ReturnStatus, to ReturnStatus, rejectionReason string) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		`UPDATE returns SET status = $3, rejection_reason = $4, updated_at = $5
+		WHERE id = $1 AND status = $2`,
+		id,
+		from,
+		to,
+		rejectionReason,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update return: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		var exists bool
+		if err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM returns WHERE id = $1)", id).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check return: %v", err)
+		}
+		if !exists {
+			return ErrReturnNotFound
+		}
+		return ErrReturnStatus
+	}
+	return nil
+}
+
+func (r *postgresRepository) RecordRefund(ctx context.Context, returnID string, amount float64, p payment.Payment, status Status) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		`UPDATE returns SET status = $3, refund_amount = $4, updated_at = $5
+		WHERE id = $1 AND status = $2`,
+		returnID,
+		ReturnRefunding,
+		ReturnRefunded,
+		amount,
+		p.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update return: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrReturnStatus
+	}
+
+	if err = updatePayment(ctx, tx, p, status); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/migrate"
+	"github.com/segmentio/ksuid"
+)
+
+// openTestRepository connects to the database in ORDER_TEST_DATABASE_URL and
+// migrates it. Tests using it are skipped without one.
+func openTestRepository(t *testing.T) Repository {
+	t.Helper()
+
+	url := os.Getenv("ORDER_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("ORDER_TEST_DATABASE_URL is not set")
+	}
+
+	m, err := migrate.Open(url, Migrations())
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer m.Close()
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	r, err := NewPostgresRepository(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	return r
+}
+
+func testOrder(accountID string) Order {
+	return Order{
+		ID:         ksuid.New().String(),
+		CreatedAt:  time.Now().UTC(),
+		AccountID:  accountID,
+		Status:     StatusPending,
+		Subtotal:   10,
+		TotalPrice: 10,
+		Products:   []OrderedProduct{{ID: "book", Name: "Book", Price: 10, Quantity: 1}},
+	}
+}
+
+func TestPutOrderWithKeyConcurrent(t *testing.T) {
+	r := openTestRepository(t)
+	ctx := context.Background()
+	accountID := ksuid.New().String()
+
+	const calls = 20
+	ids := make([]string, calls)
+	errs := make([]error, calls)
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stored, err := r.PutOrderWithKey(ctx, testOrder(accountID), "key-1", "hash-1")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			ids[i] = stored.ID
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if ids[i] != ids[0] {
+			t.Errorf("call %d returned order %s, want %s", i, ids[i], ids[0])
+		}
+	}
+
+	orders, err := r.GetOrdersForAccount(ctx, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 {
+		t.Errorf("stored %d orders, want 1", len(orders))
+	}
+}
+
+func TestPutOrderWithKeyReused(t *testing.T) {
+	r := openTestRepository(t)
+	ctx := context.Background()
+	accountID := ksuid.New().String()
+
+	first, err := r.PutOrderWithKey(ctx, testOrder(accountID), "key-1", "hash-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys belong to an account; another account may use the same one.
+	other, err := r.PutOrderWithKey(ctx, testOrder(ksuid.New().String()), "key-1", "hash-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID == first.ID {
+		t.Errorf("another account's key returned order %s of the first account", first.ID)
+	}
+
+	if _, err := r.PutOrderWithKey(ctx, testOrder(accountID), "key-1", "hash-2"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("PutOrderWithKey with another request = %v, want %v", err, ErrIdempotencyKeyReused)
+	}
+	if _, err := r.GetOrderByKey(ctx, accountID, "key-1", "hash-2"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("GetOrderByKey with another request = %v, want %v", err, ErrIdempotencyKeyReused)
+	}
+}
+
+func TestGetOrderByKey(t *testing.T) {
+	r := openTestRepository(t)
+	ctx := context.Background()
+	accountID := ksuid.New().String()
+
+	if _, err := r.GetOrderByKey(ctx, accountID, "key-1", "hash-1"); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("GetOrderByKey before the key is used = %v, want %v", err, ErrOrderNotFound)
+	}
+
+	stored, err := r.PutOrderWithKey(ctx, testOrder(accountID), "key-1", "hash-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := r.GetOrderByKey(ctx, accountID, "key-1", "hash-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.ID != stored.ID || replayed.TotalPrice != stored.TotalPrice {
+		t.Errorf("GetOrderByKey = %+v, want %+v", replayed, stored)
+	}
+}
@@ -0,0 +1,350 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/payment"
+	"github.com/donaldnash/go-marketplace/promotion"
+	"github.com/segmentio/ksuid"
+)
+
+type ReturnStatus string
+
+const (
+	ReturnRequested ReturnStatus = "REQUESTED"
+	ReturnApproved  ReturnStatus = "APPROVED"
+	ReturnRejected  ReturnStatus = "REJECTED"
+	ReturnReceived  ReturnStatus = "RECEIVED"
+	// ReturnRefunding is held while the payment provider is asked for the
+	// refund, so the same return cannot be refunded twice.
+	ReturnRefunding ReturnStatus = "REFUNDING"
+	ReturnRefunded  ReturnStatus = "REFUNDED"
+)
+
+var (
+	ErrReturnNotFound = errors.New("return not found")
+	// ErrInvalidReturn wraps the reason a return request was refused.
+	ErrInvalidReturn = errors.New("invalid return")
+	// ErrReturnStatus is returned when a return is not in the status an
+	// action needs, for example when receiving goods of an unapproved return.
+	ErrReturnStatus = errors.New("return is not in the right status for this action")
+	// ErrInvalidRefund wraps the reason a refund amount was refused.
+	ErrInvalidRefund = errors.New("invalid refund")
+)
+
+// Return is a request to send back some of an order's products. Amount on
+// each line is what the customer paid for the returned units, after
+// discounts and with tax; RefundableAmount is their sum. Shipping is not
+// refunded.
+type Return struct {
+	ID               string
+	OrderID          string
+	AccountID        string
+	Status           ReturnStatus
+	Reason           string
+	RejectionReason  string
+	Lines            []ReturnLine
+	RefundableAmount float64
+	RefundAmount     float64
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+type ReturnLine struct {
+	ProductID string
+	// VariantID is the ordered variant, if the product has variants.
+	VariantID string
+	Quantity  uint32
+	Amount    float64
+}
+
+// describe names the product, and variant if any, of l in errors.
+func (l ReturnLine) describe() string {
+	if l.VariantID != "" {
+		return fmt.Sprintf("variant %s of product %s", l.VariantID, l.ProductID)
+	}
+	return "product " + l.ProductID
+}
+
+// ReturnRequest asks to return Lines of an order of AccountID. Only the
+// product ID, variant ID and quantity of each line are read.
+type ReturnRequest struct {
+	OrderID   string
+	AccountID string
+	Reason    string
+	Lines     []ReturnLine
+}
+
+type ReturnService interface {
+	RequestReturn(ctx context.Context, r ReturnRequest) (*Return, error)
+	ApproveReturn(ctx context.Context, id string) (*Return, error)
+	RejectReturn(ctx context.Context, id string, reason string) (*Return, error)
+	// ReceiveReturn records that the goods came back and restocks them.
+	ReceiveReturn(ctx context.Context, id string) (*Return, error)
+	// RefundReturn pays amount back to the customer through the order's
+	// payment. An amount of 0 refunds the whole refundable amount.
+	RefundReturn(ctx context.Context, id string, amount float64) (*Return, error)
+	GetReturnsForOrder(ctx context.Context, orderID string) ([]Return, error)
+}
+
+// Restocker puts returned goods back into stock.
+type Restocker interface {
+	Restock(ctx context.Context, orderID string, lines []ReturnLine) error
+}
+
+type inventoryRestocker struct {
+	inventory Inventory
+}
+
+// NewInventoryRestocker puts returned goods back into the stock kept by
+// inventory, the same stock orders take them from.
+func NewInventoryRestocker(inventory Inventory) Restocker {
+	if inventory == nil {
+		panic("inventory cannot be nil")
+	}
+	return inventoryRestocker{inventory}
+}
+
+func (r inventoryRestocker) Restock(ctx context.Context, orderID string, lines []ReturnLine) error {
+	returned := make([]OrderedProduct, len(lines))
+	for i, l := range lines {
+		returned[i] = OrderedProduct{ID: l.ProductID, VariantID: l.VariantID, Quantity: l.Quantity}
+	}
+	if err := r.inventory.ReleaseStock(ctx, returned); err != nil {
+		return fmt.Errorf("failed to restock goods returned for order %s: %v", orderID, err)
+	}
+	return nil
+}
+
+type returnService struct {
+	repository Repository
+	payments   payment.Provider
+	restocker  Restocker
+	feed       *Feed
+}
+
+func NewReturnService(r Repository, payments payment.Provider, restocker Restocker, feed *Feed) ReturnService {
+	if r == nil {
+		panic("repository cannot be nil")
+	}
+	if payments == nil {
+		panic("payment provider cannot be nil")
+	}
+	if restocker == nil {
+		panic("restocker cannot be nil")
+	}
+	if feed == nil {
+		panic("feed cannot be nil")
+	}
+	return &returnService{r, payments, restocker, feed}
+}
+
+func (s *returnService) RequestReturn(ctx context.Context, r ReturnRequest) (*Return, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if len(r.Lines) == 0 {
+		return nil, fmt.Errorf("%w: at least one line is required", ErrInvalidReturn)
+	}
+
+	o, err := s.repository.GetOrder(ctx, r.OrderID)
+	if err != nil {
+		if errors.Is(err, ErrOrderNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get order: %v", err)
+	}
+	if o.AccountID != r.AccountID {
+		return nil, ErrOrderNotFound
+	}
+	if o.Status != StatusPaid && o.Status != StatusPartiallyRefunded {
+		return nil, fmt.Errorf("%w: only paid orders can be returned", ErrInvalidReturn)
+	}
+
+	ordered := map[string]OrderedProduct{}
+	for _, p := range o.Products {
+		ordered[p.ID+"\x00"+p.VariantID] = p
+	}
+
+	now := time.Now().UTC()
+	ret := Return{
+		ID:        ksuid.New().String(),
+		OrderID:   o.ID,
+		AccountID: o.AccountID,
+		Status:    ReturnRequested,
+		Reason:    r.Reason,
+		Lines:     make([]ReturnLine, len(r.Lines)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	seen := map[string]bool{}
+	for i, l := range r.Lines {
+		key := l.ProductID + "\x00" + l.VariantID
+		p, ok := ordered[key]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("%w: %s is not part of the order", ErrInvalidReturn, l.describe())
+		case seen[key]:
+			return nil, fmt.Errorf("%w: %s appears more than once", ErrInvalidReturn, l.describe())
+		case l.Quantity == 0:
+			return nil, fmt.Errorf("%w: quantity of %s must be positive", ErrInvalidReturn, l.describe())
+		case l.Quantity > p.Quantity:
+			return nil, fmt.Errorf("%w: only %d of %s were ordered", ErrInvalidReturn, p.Quantity, l.describe())
+		}
+		seen[key] = true
+
+		ret.Lines[i] = ReturnLine{
+			ProductID: l.ProductID,
+			VariantID: l.VariantID,
+			Quantity:  l.Quantity,
+			Amount:    paidForUnits(*o, p, l.Quantity),
+		}
+		ret.RefundableAmount += ret.Lines[i].Amount
+	}
+	ret.RefundableAmount = promotion.RoundCents(ret.RefundableAmount)
+
+	// The repository checks, under a lock on the order, that earlier returns
+	// and this one do not add up to more than was ordered.
+	if err := s.repository.PutReturn(ctx, ret); err != nil {
+		if errors.Is(err, ErrInvalidReturn) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create return: %v", err)
+	}
+	return &ret, nil
+}
+
+// paidForUnits is what the customer paid for quantity units of line p of o:
+// the line's share of the order discount comes off, its tax goes on.
+func paidForUnits(o Order, p OrderedProduct, quantity uint32) float64 {
+	gross := p.Price * float64(p.Quantity)
+	discount := 0.0
+	if o.Subtotal > 0 {
+		discount = o.DiscountTotal * gross / o.Subtotal
+	}
+	paid := gross - discount + p.Tax
+	return promotion.RoundCents(paid * float64(quantity) / float64(p.Quantity))
+}
+
+func (s *returnService) ApproveReturn(ctx context.Context, id string) (*Return, error) {
+	return s.moveReturn(ctx, id, ReturnRequested, ReturnApproved, "")
+}
+
+func (s *returnService) RejectReturn(ctx context.Context, id string, reason string) (*Return, error) {
+	return s.moveReturn(ctx, id, ReturnRequested, ReturnRejected, reason)
+}
+
+func (s *returnService) ReceiveReturn(ctx context.Context, id string) (*Return, error) {
+	ret, err := s.moveReturn(ctx, id, ReturnApproved, ReturnReceived, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// The goods are back either way; a failed restock is fixed by hand.
+	if err := s.restocker.Restock(ctx, ret.OrderID, ret.Lines); err != nil {
+		log.Printf("Error restocking return %s: %v", ret.ID, err)
+	}
+	return ret, nil
+}
+
+func (s *returnService) moveReturn(ctx context.Context, id string, from ReturnStatus, to ReturnStatus, rejectionReason string) (*Return, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if id == "" {
+		return nil, ErrReturnNotFound
+	}
+
+	if err := s.repository.UpdateReturnStatus(ctx, id, from, to, rejectionReason); err != nil {
+		if errors.Is(err, ErrReturnNotFound) || errors.Is(err, ErrReturnStatus) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update return: %v", err)
+	}
+	return s.repository.GetReturn(ctx, id)
+}
+
+func (s *returnService) RefundReturn(ctx context.Context, id string, amount float64) (*Return, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+
+	ret, err := s.repository.GetReturn(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Status != ReturnReceived {
+		return nil, ErrReturnStatus
+	}
+
+	amount = promotion.RoundCents(amount)
+	if amount == 0 {
+		amount = ret.RefundableAmount
+	}
+	if amount <= 0 || amount > ret.RefundableAmount {
+		return nil, fmt.Errorf("%w: amount must be positive and at most %.2f", ErrInvalidRefund, ret.RefundableAmount)
+	}
+
+	p, err := s.repository.GetCapturedPayment(ctx, ret.OrderID)
+	if err != nil {
+		if errors.Is(err, payment.ErrUnknownTransaction) {
+			return nil, fmt.Errorf("%w: the order has no payment to refund", ErrInvalidRefund)
+		}
+		return nil, fmt.Errorf("failed to get payment: %v", err)
+	}
+	if remaining := promotion.RoundCents(p.Amount - p.RefundedAmount); amount > remaining {
+		return nil, fmt.Errorf("%w: only %.2f of the payment is left to refund", ErrInvalidRefund, remaining)
+	}
+
+	if err := s.repository.UpdateReturnStatus(ctx, ret.ID, ReturnReceived, ReturnRefunding, ""); err != nil {
+		if errors.Is(err, ErrReturnStatus) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update return: %v", err)
+	}
+
+	t, err := s.payments.Refund(ctx, p.Reference, amount)
+	if err != nil {
+		log.Printf("Error refunding return %s: %v", ret.ID, err)
+		if revertErr := s.repository.UpdateReturnStatus(ctx, ret.ID, ReturnRefunding, ReturnReceived, ""); revertErr != nil {
+			log.Printf("Error reverting return %s after a failed refund: %v", ret.ID, revertErr)
+		}
+		return nil, fmt.Errorf("failed to refund payment: %v", err)
+	}
+
+	p.RefundedAmount = promotion.RoundCents(p.RefundedAmount + amount)
+	p.Status = t.Status
+	p.UpdatedAt = time.Now().UTC()
+	status := StatusPartiallyRefunded
+	if p.Status == payment.StatusRefunded {
+		status = StatusRefunded
+	}
+
+	if err := s.repository.RecordRefund(ctx, ret.ID, amount, *p, status); err != nil {
+		// The money went back; the return stays REFUNDING until this is
+		// reconciled.
+		log.Printf("Error recording refund of %.2f for return %s: %v", amount, ret.ID, err)
+		return nil, fmt.Errorf("failed to record refund: %v", err)
+	}
+	publishOrder(ctx, s.feed, s.repository, ret.OrderID)
+	return s.repository.GetReturn(ctx, ret.ID)
+}
+
+func (s *returnService) GetReturnsForOrder(ctx context.Context, orderID string) ([]Return, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if orderID == "" {
+		return nil, fmt.Errorf("order ID is required")
+	}
+
+	returns, err := s.repository.GetReturnsForOrder(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get returns for order: %v", err)
+	}
+	return returns, nil
+}
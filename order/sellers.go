@@ -0,0 +1,162 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/promotion"
+)
+
+// SellerOrder is the part of an order sold by one seller, which the seller
+// fulfils on its own. Its discount is its lines' share of the order's
+// discount. The marketplace keeps Commission out of the discounted amount
+// and pays the seller the rest; tax and shipping stay with the marketplace.
+type SellerOrder struct {
+	OrderID         string
+	SellerID        string
+	CreatedAt       time.Time
+	Status          Status
+	ShippingAddress *ShippingAddress
+	ShippingMethod  string
+	Products        []OrderedProduct
+	Subtotal        float64
+	DiscountTotal   float64
+	TaxTotal        float64
+	CommissionRate  float64
+	Commission      float64
+	Payout          float64
+}
+
+// SalesReport sums up the paid seller orders of a seller placed from From
+// until To. Refunds are not taken off.
+type SalesReport struct {
+	SellerID      string
+	From          time.Time
+	To            time.Time
+	Orders        int
+	Units         int
+	Subtotal      float64
+	DiscountTotal float64
+	TaxTotal      float64
+	Commission    float64
+	Payout        float64
+}
+
+type CommissionCalculator interface {
+	// CommissionRate returns the share, between 0 and 1, of a seller's sales
+	// the marketplace keeps.
+	CommissionRate(ctx context.Context, sellerID string) (float64, error)
+}
+
+type flatCommission struct {
+	rate float64
+}
+
+// NewFlatCommission charges every seller the same rate.
+func NewFlatCommission(rate float64) (CommissionCalculator, error) {
+	if rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("commission rate must be between 0 and 1")
+	}
+	return flatCommission{rate}, nil
+}
+
+func (c flatCommission) CommissionRate(ctx context.Context, sellerID string) (float64, error) {
+	return c.rate, nil
+}
+
+// splitBySeller groups the lines of o into seller orders, ordered by seller
+// ID. The order's discount is spread over the lines in proportion to their
+// amount, like for tax. Lines of products the marketplace sells itself
+// belong to no seller order.
+func (s *orderService) splitBySeller(ctx context.Context, o *Order) error {
+	share := 0.0
+	if o.Subtotal > 0 {
+		share = o.DiscountTotal / o.Subtotal
+	}
+
+	bySeller := map[string]*SellerOrder{}
+	for _, p := range o.Products {
+		if p.SellerID == "" {
+			continue
+		}
+		so, ok := bySeller[p.SellerID]
+		if !ok {
+			rate, err := s.commission.CommissionRate(ctx, p.SellerID)
+			if err != nil {
+				return fmt.Errorf("failed to get commission rate of seller %s: %v", p.SellerID, err)
+			}
+			so = &SellerOrder{SellerID: p.SellerID, CommissionRate: rate}
+			bySeller[p.SellerID] = so
+		}
+		amount := p.Price * float64(p.Quantity)
+		so.Products = append(so.Products, p)
+		so.Subtotal += amount
+		so.DiscountTotal += amount * share
+		so.TaxTotal += p.Tax
+	}
+
+	o.SellerOrders = []SellerOrder{}
+	for _, so := range bySeller {
+		so.Subtotal = promotion.RoundCents(so.Subtotal)
+		so.DiscountTotal = promotion.RoundCents(so.DiscountTotal)
+		so.TaxTotal = promotion.RoundCents(so.TaxTotal)
+		so.Commission = promotion.RoundCents((so.Subtotal - so.DiscountTotal) * so.CommissionRate)
+		so.Payout = promotion.RoundCents(so.Subtotal - so.DiscountTotal - so.Commission)
+		o.SellerOrders = append(o.SellerOrders, *so)
+	}
+	sort.Slice(o.SellerOrders, func(i, j int) bool {
+		return o.SellerOrders[i].SellerID < o.SellerOrders[j].SellerID
+	})
+	o.setSellerOrderDetails()
+	return nil
+}
+
+// setSellerOrderDetails copies what the seller orders of o share with it.
+func (o *Order) setSellerOrderDetails() {
+	for i := range o.SellerOrders {
+		so := &o.SellerOrders[i]
+		so.OrderID = o.ID
+		so.CreatedAt = o.CreatedAt
+		so.Status = o.Status
+		so.ShippingAddress = o.ShippingAddress
+		so.ShippingMethod = o.ShippingMethod
+	}
+}
+
+func (s *orderService) GetSellerOrders(ctx context.Context, sellerID string, skip uint64, take uint64) ([]SellerOrder, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if sellerID == "" {
+		return nil, fmt.Errorf("seller ID is required")
+	}
+	if take > 100 || take == 0 {
+		take = 100
+	}
+
+	orders, err := s.repository.GetSellerOrders(ctx, sellerID, skip, take)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get seller orders: %v", err)
+	}
+	return orders, nil
+}
+
+func (s *orderService) GetSalesReport(ctx context.Context, sellerID string, from time.Time, to time.Time) (*SalesReport, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if sellerID == "" {
+		return nil, fmt.Errorf("seller ID is required")
+	}
+	if from.IsZero() || to.IsZero() || !from.Before(to) {
+		return nil, fmt.Errorf("report period must end after it starts")
+	}
+
+	report, err := s.repository.GetSalesReport(ctx, sellerID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sales report: %v", err)
+	}
+	return report, nil
+}
@@ -7,177 +7,337 @@ import (
 	"log"
 	"net"
 
-	"github.com/donaldnash/go-marketplace/account"
-	"github.com/donaldnash/go-marketplace/catalog"
 	"github.com/donaldnash/go-marketplace/order/pb"
+	"github.com/donaldnash/go-marketplace/payment"
+	"github.com/donaldnash/go-marketplace/promotion"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 var (
-	ErrAccountNotFound = errors.New("account not found")
-	ErrProductNotFound = errors.New("product not found")
-	ErrPostOrder       = errors.New("could not post order")
+	ErrPostOrder   = errors.New("could not post order")
+	ErrPayOrder    = errors.New("could not pay order")
+	ErrCancelOrder = errors.New("could not cancel order")
+	// ErrWatchLagging ends a watch whose client did not keep up.
+	ErrWatchLagging = errors.New("order watcher fell behind")
 )
 
 type grpcServer struct {
-	service       Service
-	accountClient *account.Client
-	catalogClient *catalog.Client
+	service    Service
+	promotions promotion.Service
+	returns    ReturnService
 	pb.UnimplementedOrderServiceServer
 }
 
-func ListenGRPC(s Service, accountURL string, catalogURL string, port int) error {
-	accountClient, err := account.NewClient(accountURL)
+func ListenGRPC(s Service, promotions promotion.Service, returns ReturnService, port int, opts ...grpc.ServerOption) error {
+	list, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return err
 	}
+	serv := grpc.NewServer(opts...)
+	pb.RegisterOrderServiceServer(serv, &grpcServer{service: s, promotions: promotions, returns: returns})
+	reflection.Register(serv)
+	return serv.Serve(list)
+}
 
-	catalogClient, err := catalog.NewClient(catalogURL)
+func (s *grpcServer) PostOrder(ctx context.Context, r *pb.PostOrderRequest) (*pb.PostOrderResponse, error) {
+	res, err := s.service.PostOrder(ctx, OrderRequest{
+		AccountID:         r.AccountId,
+		Products:          orderLinesFromProto(r.Products),
+		CouponCode:        r.CouponCode,
+		TaxLocation:       TaxLocation{Country: r.TaxCountry, Region: r.TaxRegion},
+		ShippingAddressID: r.ShippingAddressId,
+		ShippingMethod:    r.ShippingMethod,
+		IdempotencyKey:    r.IdempotencyKey,
+	})
 	if err != nil {
-		accountClient.Close()
-		return err
+		log.Println("Error posting order: ", err)
+		return nil, orderError(err)
 	}
 
-	list, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if len(res.RejectedLines) > 0 {
+		return &pb.PostOrderResponse{RejectedLines: rejectedLinesToProto(res.RejectedLines)}, nil
+	}
+	return &pb.PostOrderResponse{
+		Order: orderToProto(*res.Order),
+	}, nil
+}
+
+func (s *grpcServer) QuoteOrder(ctx context.Context, r *pb.QuoteOrderRequest) (*pb.QuoteOrderResponse, error) {
+	res, err := s.service.QuoteOrder(ctx, OrderRequest{
+		AccountID:         r.AccountId,
+		Products:          orderLinesFromProto(r.Products),
+		CouponCode:        r.CouponCode,
+		TaxLocation:       TaxLocation{Country: r.TaxCountry, Region: r.TaxRegion},
+		ShippingAddressID: r.ShippingAddressId,
+		ShippingMethod:    r.ShippingMethod,
+	})
 	if err != nil {
-		accountClient.Close()
-		catalogClient.Close()
+		log.Println("Error quoting order: ", err)
+		return nil, orderError(err)
+	}
+
+	if len(res.RejectedLines) > 0 {
+		return &pb.QuoteOrderResponse{RejectedLines: rejectedLinesToProto(res.RejectedLines)}, nil
+	}
+	return &pb.QuoteOrderResponse{
+		Order: orderToProto(*res.Order),
+	}, nil
+}
+
+// orderError keeps the errors a caller can act on and hides the rest.
+func orderError(err error) error {
+	switch {
+	case errors.Is(err, ErrAccountNotFound):
+		return ErrAccountNotFound
+	case errors.Is(err, ErrCatalogUnavailable):
+		// Orders are never priced from stale products; the caller may try
+		// again once the catalog is back.
+		return status.Error(codes.Unavailable, ErrCatalogUnavailable.Error())
+	case errors.Is(err, ErrIdempotencyKeyReused),
+		errors.Is(err, ErrOutOfStock),
+		errors.Is(err, ErrCouponRejected),
+		errors.Is(err, ErrShippingAddressNotFound),
+		errors.Is(err, ErrShippingAddressRequired),
+		errors.Is(err, ErrUnknownShippingMethod):
 		return err
 	}
+	return ErrPostOrder
+}
 
-	serv := grpc.NewServer()
-	pb.RegisterOrderServiceServer(serv, &grpcServer{
-		service:       s,
-		accountClient: accountClient,
-		catalogClient: catalogClient,
-	})
-	reflection.Register(serv)
-	return serv.Serve(list)
+func (s *grpcServer) GetOrdersForAccount(ctx context.Context, r *pb.GetOrdersForAccountRequest) (*pb.GetOrdersForAccountResponse, error) {
+	accountOrders, err := s.service.GetOrdersForAccount(ctx, r.AccountId)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	orders := []*pb.Order{}
+	for _, o := range accountOrders {
+		orders = append(orders, orderToProto(o))
+	}
+
+	return &pb.GetOrdersForAccountResponse{Orders: orders}, nil
 }
 
-func (s *grpcServer) PostOrder(ctx context.Context, r *pb.PostOrderRequest) (*pb.PostOrderResponse, error) {
-	_, err := s.accountClient.GetAccount(ctx, r.AccountId)
+func (s *grpcServer) GetOrder(ctx context.Context, r *pb.GetOrderRequest) (*pb.GetOrderResponse, error) {
+	o, err := s.service.GetOrder(ctx, r.Id)
 	if err != nil {
-		log.Println("Error getting account: ", err)
-		return nil, ErrAccountNotFound
+		log.Println(err)
+		return nil, err
 	}
+	return &pb.GetOrderResponse{Order: orderToProto(*o)}, nil
+}
 
-	productIDs := []string{}
-	for _, p := range r.Products {
-		productIDs = append(productIDs, p.ProductId)
+func (s *grpcServer) HasOrdered(ctx context.Context, r *pb.HasOrderedRequest) (*pb.HasOrderedResponse, error) {
+	ordered, err := s.service.HasOrdered(ctx, r.AccountId, r.ProductId)
+	if err != nil {
+		log.Println(err)
+		return nil, err
 	}
+	return &pb.HasOrderedResponse{Ordered: ordered}, nil
+}
 
-	orderedProducts, err := s.catalogClient.GetProducts(ctx, 0, 0, productIDs, "")
+func (s *grpcServer) GetSellerOrders(ctx context.Context, r *pb.GetSellerOrdersRequest) (*pb.GetSellerOrdersResponse, error) {
+	sellerOrders, err := s.service.GetSellerOrders(ctx, r.SellerId, r.Skip, r.Take)
 	if err != nil {
-		log.Println("Error getting products: ", err)
-		return nil, ErrProductNotFound
+		log.Println(err)
+		return nil, err
 	}
 
-	products := []OrderedProduct{}
-	for _, p := range orderedProducts {
-		product := OrderedProduct{
-			ID:          p.ID,
-			Quantity:    0,
-			Price:       p.Price,
-			Name:        p.Name,
-			Description: p.Description,
-		}
-		for _, rp := range r.Products {
-			if rp.ProductId == p.ID {
-				product.Quantity = rp.Quantity
-				break
-			}
-		}
+	orders := []*pb.SellerOrder{}
+	for _, so := range sellerOrders {
+		orders = append(orders, sellerOrderToProto(so))
+	}
+	return &pb.GetSellerOrdersResponse{Orders: orders}, nil
+}
+
+func (s *grpcServer) GetSalesReport(ctx context.Context, r *pb.GetSalesReportRequest) (*pb.GetSalesReportResponse, error) {
+	report, err := s.service.GetSalesReport(ctx, r.SellerId, timeFromProto(r.From), timeFromProto(r.To))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.GetSalesReportResponse{Report: salesReportToProto(*report)}, nil
+}
+
+func (s *grpcServer) WatchOrders(r *pb.WatchOrdersRequest, stream pb.OrderService_WatchOrdersServer) error {
+	orders, err := s.service.WatchOrders(stream.Context(), r.AccountId)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
 
-		if product.Quantity != 0 {
-			products = append(products, product)
+	for o := range orders {
+		if err := stream.Send(orderToProto(o)); err != nil {
+			return err
 		}
 	}
+	if err := stream.Context().Err(); err != nil {
+		return err
+	}
+	return ErrWatchLagging
+}
 
-	order, err := s.service.PostOrder(ctx, r.AccountId, products)
+func (s *grpcServer) PayOrder(ctx context.Context, r *pb.PayOrderRequest) (*pb.PayOrderResponse, error) {
+	p, err := s.service.PayOrder(ctx, PaymentRequest{
+		OrderID:   r.OrderId,
+		AccountID: r.AccountId,
+		Token:     r.PaymentToken,
+	})
 	if err != nil {
-		log.Println("Error posting order: ", err)
-		return nil, ErrPostOrder
+		log.Println("Error paying order: ", err)
+		return nil, payOrderError(err)
 	}
+	return &pb.PayOrderResponse{Payment: paymentToProto(*p)}, nil
+}
 
-	orderProto := &pb.Order{
-		Id:         order.ID,
-		AccountId:  order.AccountID,
-		TotalPrice: order.TotalPrice,
-		Products:   []*pb.Order_OrderProduct{},
+func payOrderError(err error) error {
+	switch {
+	case errors.Is(err, ErrOrderNotFound),
+		errors.Is(err, ErrOrderNotPayable),
+		errors.Is(err, ErrPaymentInProgress),
+		errors.Is(err, ErrPaymentTokenMissing),
+		errors.Is(err, ErrPaymentDeclined):
+		return err
 	}
+	return ErrPayOrder
+}
 
-	orderProto.CreatedAt, _ = order.CreatedAt.MarshalBinary()
-	for _, p := range order.Products {
-		orderProto.Products = append(orderProto.Products, &pb.Order_OrderProduct{
-			Id:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-			Quantity:    p.Quantity,
-		})
+func (s *grpcServer) CancelOrder(ctx context.Context, r *pb.CancelOrderRequest) (*pb.CancelOrderResponse, error) {
+	o, err := s.service.CancelOrder(ctx, r.AccountId, r.OrderId)
+	if err != nil {
+		log.Println("Error cancelling order: ", err)
+		if errors.Is(err, ErrOrderNotFound) || errors.Is(err, ErrOrderNotCancellable) {
+			return nil, err
+		}
+		return nil, ErrCancelOrder
 	}
+	return &pb.CancelOrderResponse{Order: orderToProto(*o)}, nil
+}
 
-	return &pb.PostOrderResponse{
-		Order: orderProto,
-	}, nil
+func (s *grpcServer) ApplyPaymentEvent(ctx context.Context, r *pb.ApplyPaymentEventRequest) (*pb.ApplyPaymentEventResponse, error) {
+	if r.Event == nil {
+		return nil, fmt.Errorf("payment event is required")
+	}
+	err := s.service.ApplyPaymentEvent(ctx, payment.Event{
+		ID:        r.Event.Id,
+		Type:      payment.EventType(r.Event.Type),
+		Provider:  r.Event.Provider,
+		Reference: r.Event.Reference,
+		Amount:    r.Event.Amount,
+		Reason:    r.Event.Reason,
+	})
+	if err != nil {
+		log.Println("Error applying payment event: ", err)
+		return nil, err
+	}
+	return &pb.ApplyPaymentEventResponse{}, nil
 }
 
-func (s *grpcServer) GetOrdersForAccount(ctx context.Context, r *pb.GetOrdersForAccountRequest) (*pb.GetOrdersForAccountResponse, error) {
-	accountOrders, err := s.service.GetOrdersForAccount(ctx, r.AccountId)
+func (s *grpcServer) RequestReturn(ctx context.Context, r *pb.RequestReturnRequest) (*pb.ReturnResponse, error) {
+	ret, err := s.returns.RequestReturn(ctx, ReturnRequest{
+		OrderID:   r.OrderId,
+		AccountID: r.AccountId,
+		Reason:    r.Reason,
+		Lines:     returnLinesFromProto(r.Lines),
+	})
+	return returnResponse(ret, err)
+}
+
+func (s *grpcServer) ApproveReturn(ctx context.Context, r *pb.ReturnIdRequest) (*pb.ReturnResponse, error) {
+	return returnResponse(s.returns.ApproveReturn(ctx, r.Id))
+}
+
+func (s *grpcServer) RejectReturn(ctx context.Context, r *pb.RejectReturnRequest) (*pb.ReturnResponse, error) {
+	return returnResponse(s.returns.RejectReturn(ctx, r.Id, r.Reason))
+}
+
+func (s *grpcServer) ReceiveReturn(ctx context.Context, r *pb.ReturnIdRequest) (*pb.ReturnResponse, error) {
+	return returnResponse(s.returns.ReceiveReturn(ctx, r.Id))
+}
+
+func (s *grpcServer) RefundReturn(ctx context.Context, r *pb.RefundReturnRequest) (*pb.ReturnResponse, error) {
+	return returnResponse(s.returns.RefundReturn(ctx, r.Id, r.Amount))
+}
+
+func returnResponse(ret *Return, err error) (*pb.ReturnResponse, error) {
+	if err != nil {
+		log.Println("Error handling return: ", err)
+		switch {
+		case errors.Is(err, ErrOrderNotFound),
+			errors.Is(err, ErrReturnNotFound),
+			errors.Is(err, ErrInvalidReturn),
+			errors.Is(err, ErrReturnStatus),
+			errors.Is(err, ErrInvalidRefund):
+			return nil, err
+		}
+		return nil, errors.New("could not process return")
+	}
+	return &pb.ReturnResponse{Return: returnToProto(*ret)}, nil
+}
+
+func (s *grpcServer) GetReturnsForOrder(ctx context.Context, r *pb.GetReturnsForOrderRequest) (*pb.GetReturnsForOrderResponse, error) {
+	res, err := s.returns.GetReturnsForOrder(ctx, r.OrderId)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	productIDMap := map[string]bool{}
-	for _, o := range accountOrders {
-		for _, p := range o.Products {
-			productIDMap[p.ID] = true
-		}
+	returns := []*pb.Return{}
+	for _, ret := range res {
+		returns = append(returns, returnToProto(ret))
 	}
+	return &pb.GetReturnsForOrderResponse{Returns: returns}, nil
+}
 
-	productIDs := []string{}
-	for id := range productIDMap {
-		productIDs = append(productIDs, id)
+func (s *grpcServer) PostPromotion(ctx context.Context, r *pb.PostPromotionRequest) (*pb.PostPromotionResponse, error) {
+	p, err := s.promotions.PostPromotion(ctx, promotionFromProto(r.Promotion))
+	if err != nil {
+		log.Println("Error posting promotion: ", err)
+		return nil, err
 	}
+	return &pb.PostPromotionResponse{Promotion: promotionToProto(*p)}, nil
+}
 
-	products, err := s.catalogClient.GetProducts(ctx, 0, 0, productIDs, "")
+func (s *grpcServer) UpdatePromotion(ctx context.Context, r *pb.UpdatePromotionRequest) (*pb.UpdatePromotionResponse, error) {
+	p, err := s.promotions.UpdatePromotion(ctx, promotionFromProto(r.Promotion))
 	if err != nil {
-		log.Println("Error getting account products: ", err)
+		log.Println("Error updating promotion: ", err)
 		return nil, err
 	}
+	return &pb.UpdatePromotionResponse{Promotion: promotionToProto(*p)}, nil
+}
 
-	orders := []*pb.Order{}
-	for _, o := range accountOrders {
-		op := &pb.Order{
-			AccountId:  o.AccountID,
-			Id:         o.ID,
-			TotalPrice: o.TotalPrice,
-			Products:   []*pb.Order_OrderProduct{},
-		}
-		op.CreatedAt, _ = o.CreatedAt.MarshalBinary()
-
-		for _, product := range o.Products {
-			for _, p := range products {
-				if p.ID == product.ID {
-					product.Name = p.Name
-					product.Description = p.Description
-					product.Price = p.Price
-					break
-				}
-			}
-			op.Products = append(op.Products, &pb.Order_OrderProduct{
-				Id:          product.ID,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-				Quantity:    product.Quantity,
-			})
-		}
-		orders = append(orders, op)
+func (s *grpcServer) DeletePromotion(ctx context.Context, r *pb.DeletePromotionRequest) (*pb.DeletePromotionResponse, error) {
+	if err := s.promotions.DeletePromotion(ctx, r.Id); err != nil {
+		log.Println("Error deleting promotion: ", err)
+		return nil, err
 	}
+	return &pb.DeletePromotionResponse{}, nil
+}
 
-	return &pb.GetOrdersForAccountResponse{Orders: orders}, nil
+func (s *grpcServer) GetPromotion(ctx context.Context, r *pb.GetPromotionRequest) (*pb.GetPromotionResponse, error) {
+	p, err := s.promotions.GetPromotion(ctx, r.Id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &pb.GetPromotionResponse{Promotion: promotionToProto(*p)}, nil
+}
+
+func (s *grpcServer) GetPromotions(ctx context.Context, r *pb.GetPromotionsRequest) (*pb.GetPromotionsResponse, error) {
+	res, err := s.promotions.GetPromotions(ctx, r.Skip, r.Take)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	promotions := []*pb.Promotion{}
+	for _, p := range res {
+		promotions = append(promotions, promotionToProto(p))
+	}
+	return &pb.GetPromotionsResponse{Promotions: promotions}, nil
 }
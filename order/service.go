@@ -2,90 +2,315 @@ package order
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/donaldnash/go-marketplace/payment"
+	"github.com/donaldnash/go-marketplace/promotion"
 	"github.com/segmentio/ksuid"
 )
 
+var (
+	ErrAccountNotFound = errors.New("account not found")
+
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+
+	// ErrCouponRejected wraps the reason a coupon code could not be applied.
+	ErrCouponRejected = errors.New("coupon cannot be applied")
+)
+
 type Service interface {
-	PostOrder(ctx context.Context, accountID string, products []OrderedProduct) (*Order, error)
+	PostOrder(ctx context.Context, r OrderRequest) (*PostOrderResult, error)
+	// QuoteOrder prices r exactly like PostOrder would, without placing the
+	// order or redeeming its coupon.
+	QuoteOrder(ctx context.Context, r OrderRequest) (*PostOrderResult, error)
 	GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error)
+	GetOrder(ctx context.Context, id string) (*Order, error)
+	// HasOrdered reports whether accountID has paid for an order of
+	// productID.
+	HasOrdered(ctx context.Context, accountID string, productID string) (bool, error)
+	// PayOrder charges a pending order's total and marks it paid.
+	PayOrder(ctx context.Context, r PaymentRequest) (*payment.Payment, error)
+	// CancelOrder cancels an order of accountID that is awaiting payment and
+	// puts its stock back.
+	CancelOrder(ctx context.Context, accountID string, orderID string) (*Order, error)
+	ApplyPaymentEvent(ctx context.Context, e payment.Event) error
+	// WatchOrders streams the orders of accountID as they are placed or
+	// change status, until ctx is done.
+	WatchOrders(ctx context.Context, accountID string) (<-chan Order, error)
+	// GetSellerOrders lists the seller orders of sellerID, newest first.
+	GetSellerOrders(ctx context.Context, sellerID string, skip uint64, take uint64) ([]SellerOrder, error)
+	GetSalesReport(ctx context.Context, sellerID string, from time.Time, to time.Time) (*SalesReport, error)
 }
 
+// OrderRequest is an order as asked for by a customer. Only the ID, variant
+// ID and quantity of each product are read. When a shipping address is
+// given, the order is taxed where it ships to and TaxLocation is ignored.
+type OrderRequest struct {
+	AccountID         string
+	Products          []OrderedProduct
+	CouponCode        string
+	TaxLocation       TaxLocation
+	ShippingAddressID string
+	ShippingMethod    string
+	IdempotencyKey    string
+}
+
+// Order amounts add up as
+// Subtotal - DiscountTotal + TaxTotal + ShippingTotal = TotalPrice.
 type Order struct {
-	ID         string
-	CreatedAt  time.Time
-	AccountID  string
-	TotalPrice float64
-	Products   []OrderedProduct
+	ID              string
+	CreatedAt       time.Time
+	AccountID       string
+	Status          Status
+	Subtotal        float64
+	DiscountTotal   float64
+	TaxTotal        float64
+	ShippingTotal   float64
+	TotalPrice      float64
+	TaxLocation     TaxLocation
+	ShippingAddress *ShippingAddress
+	ShippingMethod  string
+	Products        []OrderedProduct
+	Discounts       []promotion.Discount
+	// SellerOrders split the lines of products with a seller by seller.
+	SellerOrders []SellerOrder
 }
 
 type OrderedProduct struct {
-	ID          string
+	ID string
+	// VariantID is the variant ordered of a product that has variants. SKU
+	// and Attributes describe it as it was when the order was placed.
+	VariantID   string
+	SKU         string
+	Attributes  []Attribute
 	Name        string
 	Description string
 	Price       float64
 	Quantity    uint32
+	TaxCategory string
+	Tax         float64
+	Weight      float64
+	// SellerID is the seller of the product when the order was placed.
+	SellerID string
+}
+
+// Attribute is the value of one option of an ordered variant, such as a
+// size.
+type Attribute struct {
+	Name  string
+	Value string
 }
 
 type orderService struct {
 	repository Repository
+	accounts   AccountDirectory
+	products   ProductDirectory
+	inventory  Inventory
+	promotions promotion.Service
+	tax        TaxCalculator
+	shipping   ShippingCalculator
+	commission CommissionCalculator
+	payments   payment.Provider
+	feed       *Feed
 }
 
-func NewService(r Repository) Service {
+func NewService(r Repository, accounts AccountDirectory, products ProductDirectory, inventory Inventory, promotions promotion.Service, tax TaxCalculator, shipping ShippingCalculator, commission CommissionCalculator, payments payment.Provider, feed *Feed) Service {
 	if r == nil {
 		panic("repository cannot be nil")
 	}
-	return &orderService{r}
+	if accounts == nil {
+		panic("account directory cannot be nil")
+	}
+	if products == nil {
+		panic("product directory cannot be nil")
+	}
+	if inventory == nil {
+		panic("inventory cannot be nil")
+	}
+	if promotions == nil {
+		panic("promotion service cannot be nil")
+	}
+	if tax == nil {
+		panic("tax calculator cannot be nil")
+	}
+	if shipping == nil {
+		panic("shipping calculator cannot be nil")
+	}
+	if commission == nil {
+		panic("commission calculator cannot be nil")
+	}
+	if payments == nil {
+		panic("payment provider cannot be nil")
+	}
+	if feed == nil {
+		panic("feed cannot be nil")
+	}
+	return &orderService{r, accounts, products, inventory, promotions, tax, shipping, commission, payments, feed}
 }
 
-func (s *orderService) PostOrder(ctx context.Context, accountID string, products []OrderedProduct) (*Order, error) {
+func (s *orderService) PostOrder(ctx context.Context, r OrderRequest) (*PostOrderResult, error) {
 	if ctx == nil {
 		return nil, fmt.Errorf("context is required")
 	}
-	if accountID == "" {
-		return nil, fmt.Errorf("account ID is required")
+
+	// A retried request returns the order placed the first time without
+	// being priced again: the account, products or coupon may have changed
+	// since, and would fail a request that already succeeded.
+	if r.IdempotencyKey != "" {
+		if stored, err := s.replayOrder(ctx, r); stored != nil || err != nil {
+			return stored, err
+		}
 	}
-	if len(products) == 0 {
-		return nil, fmt.Errorf("at least one product is required")
+
+	res, err := s.reserveOrder(ctx, r)
+	if err != nil || res.Order == nil {
+		if r.IdempotencyKey != "" {
+			// The first request may have been placed while this one was
+			// being priced.
+			if stored, replayErr := s.replayOrder(ctx, r); stored != nil || replayErr != nil {
+				return stored, replayErr
+			}
+		}
+		return res, err
 	}
-	if len(products) > 100 {
-		return nil, fmt.Errorf("cannot order more than 100 products at once")
+
+	// From here on the order holds stock, which must be put back if it is
+	// not stored.
+	o := res.Order
+	o.ID = ksuid.New().String()
+	o.CreatedAt = time.Now().UTC()
+	o.Status = StatusPending
+	o.setSellerOrderDetails()
+
+	if r.IdempotencyKey != "" {
+		stored, err := s.repository.PutOrderWithKey(ctx, *o, r.IdempotencyKey, orderRequestHash(r))
+		if err != nil {
+			s.releaseStock(ctx, o.Products, "of an order that was not stored")
+			return nil, postOrderError(err)
+		}
+		// A replayed request returns the order placed the first time, which
+		// holds its own stock.
+		if stored.ID != o.ID {
+			s.releaseStock(ctx, o.Products, "of a replayed order")
+			return &PostOrderResult{Order: stored}, nil
+		}
+		s.feed.Publish(*stored)
+		return &PostOrderResult{Order: stored}, nil
+	}
+
+	if err := s.repository.PutOrder(ctx, *o); err != nil {
+		s.releaseStock(ctx, o.Products, "of an order that was not stored")
+		return nil, postOrderError(err)
 	}
+	s.feed.Publish(*o)
+	return res, nil
+}
 
-	// Validate products
-	for i, p := range products {
-		if p.ID == "" {
-			return nil, fmt.Errorf("product ID is required for product at index %d", i)
+// maxReserveAttempts is how often an order is priced and its stock reserved
+// before giving up because other orders keep taking the stock first.
+const maxReserveAttempts = 3
+
+// reserveOrder prices r and reserves the stock of its lines. When other
+// orders took the stock since it was read, pricing again rejects the lines
+// that ran out.
+func (s *orderService) reserveOrder(ctx context.Context, r OrderRequest) (*PostOrderResult, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := s.priceOrder(ctx, r)
+		if err != nil || res.Order == nil {
+			return res, err
+		}
+		err = s.inventory.ReserveStock(ctx, res.Order.Products)
+		if err == nil {
+			return res, nil
 		}
-		if p.Quantity == 0 {
-			return nil, fmt.Errorf("quantity must be greater than 0 for product %s", p.ID)
+		if !errors.Is(err, ErrOutOfStock) || attempt == maxReserveAttempts {
+			return nil, postOrderError(err)
 		}
-		if p.Price < 0 {
-			return nil, fmt.Errorf("price cannot be negative for product %s", p.ID)
+	}
+}
+
+// replayOrder returns the order stored under r's idempotency key, or nothing
+// if the key was not used yet.
+func (s *orderService) replayOrder(ctx context.Context, r OrderRequest) (*PostOrderResult, error) {
+	stored, err := s.repository.GetOrderByKey(ctx, r.AccountID, r.IdempotencyKey, orderRequestHash(r))
+	if err != nil {
+		if errors.Is(err, ErrOrderNotFound) {
+			return nil, nil
 		}
+		return nil, postOrderError(err)
 	}
+	return &PostOrderResult{Order: stored}, nil
+}
+
+func (s *orderService) QuoteOrder(ctx context.Context, r OrderRequest) (*PostOrderResult, error) {
+	return s.priceOrder(ctx, r)
+}
 
-	o := &Order{
-		ID:        ksuid.New().String(),
-		CreatedAt: time.Now().UTC(),
-		AccountID: accountID,
-		Products:  products,
+func (s *orderService) CancelOrder(ctx context.Context, accountID string, orderID string) (*Order, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
 	}
 
-	// Calculate total price
-	o.TotalPrice = 0.0
-	for _, p := range products {
-		o.TotalPrice += p.Price * float64(p.Quantity)
+	o, err := s.repository.GetOrder(ctx, orderID)
+	if err != nil {
+		if errors.Is(err, ErrOrderNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get order: %v", err)
+	}
+	if o.AccountID != accountID {
+		return nil, ErrOrderNotFound
 	}
 
-	if err := s.repository.PutOrder(ctx, *o); err != nil {
-		return nil, fmt.Errorf("failed to create order: %v", err)
+	if err := s.repository.CancelOrder(ctx, orderID); err != nil {
+		if errors.Is(err, ErrOrderNotFound) || errors.Is(err, ErrOrderNotCancellable) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to cancel order: %v", err)
 	}
+	o.Status = StatusCancelled
+	s.releaseStock(ctx, o.Products, "of cancelled order "+o.ID)
+	s.feed.Publish(*o)
 	return o, nil
 }
 
+func (s *orderService) WatchOrders(ctx context.Context, accountID string) (<-chan Order, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+
+	orders, cancel := s.feed.Subscribe(accountID)
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+	return orders, nil
+}
+
+func postOrderError(err error) error {
+	switch {
+	case errors.Is(err, ErrIdempotencyKeyReused),
+		errors.Is(err, ErrOutOfStock),
+		errors.Is(err, ErrCatalogUnavailable):
+		return err
+	case isCouponError(err):
+		// Another order redeemed the coupon, or it was deleted, while this
+		// one was being placed.
+		return fmt.Errorf("%w: %v", ErrCouponRejected, err)
+	}
+	return fmt.Errorf("failed to create order: %v", err)
+}
+
 func (s *orderService) GetOrdersForAccount(ctx context.Context, accountID string) ([]Order, error) {
 	if ctx == nil {
 		return nil, fmt.Errorf("context is required")
@@ -98,5 +323,106 @@ func (s *orderService) GetOrdersForAccount(ctx context.Context, accountID string
 	if err != nil {
 		return nil, fmt.Errorf("failed to get orders for account: %v", err)
 	}
+	s.fillLegacyLines(ctx, orders)
 	return orders, nil
 }
+
+func (s *orderService) GetOrder(ctx context.Context, id string) (*Order, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+
+	o, err := s.repository.GetOrder(ctx, id)
+	if errors.Is(err, ErrOrderNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %v", err)
+	}
+	s.fillLegacyLines(ctx, []Order{*o})
+	return o, nil
+}
+
+func (s *orderService) HasOrdered(ctx context.Context, accountID string, productID string) (bool, error) {
+	if ctx == nil {
+		return false, fmt.Errorf("context is required")
+	}
+	if accountID == "" || productID == "" {
+		return false, fmt.Errorf("account ID and product ID are required")
+	}
+	return s.repository.HasOrdered(ctx, accountID, productID)
+}
+
+// fillLegacyLines fills in order lines that were stored without a name.
+func (s *orderService) fillLegacyLines(ctx context.Context, orders []Order) {
+	// Orders are served from the snapshot taken when they were placed. Only
+	// lines placed before snapshots existed get their name and description
+	// from the catalog; their price is never touched.
+	productIDMap := map[string]bool{}
+	for _, o := range orders {
+		for _, p := range o.Products {
+			if p.Name == "" {
+				productIDMap[p.ID] = true
+			}
+		}
+	}
+	if len(productIDMap) == 0 {
+		return
+	}
+
+	productIDs := []string{}
+	for id := range productIDMap {
+		productIDs = append(productIDs, id)
+	}
+
+	catalogProducts, err := s.products.GetProducts(ctx, productIDs)
+	if err != nil {
+		log.Printf("Error getting products for legacy order lines: %v", err)
+		return
+	}
+
+	for _, o := range orders {
+		for i := range o.Products {
+			if o.Products[i].Name != "" {
+				continue
+			}
+			for _, p := range catalogProducts {
+				if p.ID == o.Products[i].ID {
+					o.Products[i].Name = p.Name
+					o.Products[i].Description = p.Description
+					break
+				}
+			}
+		}
+	}
+}
+
+// orderRequestHash fingerprints the requested lines, independent of their
+// order, and everything else that decides its price so a retried request
+// can be told apart from a different one.
+func orderRequestHash(r OrderRequest) string {
+	lines := make([]string, len(r.Products))
+	for i, p := range r.Products {
+		lines[i] = fmt.Sprintf("%s:%d", p.ID, p.Quantity)
+		if p.VariantID != "" {
+			lines[i] = fmt.Sprintf("%s/%s:%d", p.ID, p.VariantID, p.Quantity)
+		}
+	}
+	sort.Strings(lines)
+	if r.CouponCode != "" {
+		lines = append(lines, "coupon:"+strings.ToUpper(strings.TrimSpace(r.CouponCode)))
+	}
+	if r.TaxLocation.Country != "" {
+		lines = append(lines, "tax:"+strings.ToUpper(r.TaxLocation.Country+"/"+r.TaxLocation.Region))
+	}
+	if r.ShippingAddressID != "" {
+		lines = append(lines, "ship:"+r.ShippingAddressID+"/"+strings.ToLower(r.ShippingMethod))
+	}
+
+	h := sha256.New()
+	for _, l := range lines {
+		h.Write([]byte(l))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,697 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/donaldnash/go-marketplace/account"
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/order/pb"
+	"github.com/donaldnash/go-marketplace/payment"
+	"github.com/donaldnash/go-marketplace/promotion"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// memoryRepository keeps orders in memory. Methods the tests do not need are
+// left to the embedded nil Repository and panic if called.
+type memoryRepository struct {
+	Repository
+
+	mu       sync.Mutex
+	orders   map[string]Order
+	keys     map[string]storedKey
+	payments map[string]payment.Payment
+	returns  map[string][]Return
+}
+
+type storedKey struct {
+	requestHash string
+	orderID     string
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		orders:   map[string]Order{},
+		keys:     map[string]storedKey{},
+		payments: map[string]payment.Payment{},
+		returns:  map[string][]Return{},
+	}
+}
+
+func (r *memoryRepository) PutOrder(ctx context.Context, o Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders[o.ID] = o
+	return nil
+}
+
+func (r *memoryRepository) PutOrderWithKey(ctx context.Context, o Order, key string, requestHash string) (*Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if k, ok := r.keys[o.AccountID+"\x00"+key]; ok {
+		if k.requestHash != requestHash {
+			return nil, ErrIdempotencyKeyReused
+		}
+		stored := r.orders[k.orderID]
+		return &stored, nil
+	}
+	r.keys[o.AccountID+"\x00"+key] = storedKey{requestHash, o.ID}
+	r.orders[o.ID] = o
+	return &o, nil
+}
+
+func (r *memoryRepository) GetOrderByKey(ctx context.Context, accountID string, key string, requestHash string) (*Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.keys[accountID+"\x00"+key]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	if k.requestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	stored := r.orders[k.orderID]
+	return &stored, nil
+}
+
+func (r *memoryRepository) GetOrder(ctx context.Context, id string) (*Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.orders[id]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	return &o, nil
+}
+
+func (r *memoryRepository) CancelOrder(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.orders[id]
+	if !ok {
+		return ErrOrderNotFound
+	}
+	if o.Status != StatusPending {
+		return ErrOrderNotCancellable
+	}
+	o.Status = StatusCancelled
+	r.orders[id] = o
+	return nil
+}
+
+func (r *memoryRepository) PutPayment(ctx context.Context, p payment.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.orders[p.OrderID].Status != StatusPending {
+		return ErrOrderNotPayable
+	}
+	r.payments[p.ID] = p
+	return nil
+}
+
+func (r *memoryRepository) UpdatePayment(ctx context.Context, p payment.Payment, status Status) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payments[p.ID] = p
+	if status != "" {
+		o := r.orders[p.OrderID]
+		o.Status = status
+		r.orders[p.OrderID] = o
+	}
+	return nil
+}
+
+func (r *memoryRepository) GetPaymentByReference(ctx context.Context, provider string, reference string) (*payment.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.payments {
+		if p.Provider == provider && p.Reference == reference {
+			return &p, nil
+		}
+	}
+	return nil, payment.ErrUnknownTransaction
+}
+
+func (r *memoryRepository) GetReturnsForOrder(ctx context.Context, orderID string) ([]Return, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.returns[orderID], nil
+}
+
+// redemptions counts the orders of accountID that used promotionID, as the
+// order_discounts table does.
+func (r *memoryRepository) redemptions(promotionID string, accountID string) uint32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := uint32(0)
+	for _, o := range r.orders {
+		for _, d := range o.Discounts {
+			if o.AccountID == accountID && d.PromotionID == promotionID {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+type memoryAccounts struct {
+	accounts map[string]bool
+}
+
+func (d memoryAccounts) GetAccount(ctx context.Context, id string) (*account.Account, error) {
+	if !d.accounts[id] {
+		return nil, errors.New("account not found")
+	}
+	return &account.Account{ID: id, Name: "account " + id}, nil
+}
+
+func (d memoryAccounts) GetAddress(ctx context.Context, accountID string, id string) (*account.Address, error) {
+	return nil, errors.New("address not found")
+}
+
+// memoryProducts is a catalog that counts how often it is asked and keeps the
+// stock of variants. GetProducts serves the products in cached ahead of the
+// current ones, like a directory with stale entries would; down makes the
+// catalog unreachable.
+type memoryProducts struct {
+	mu       sync.Mutex
+	products map[string]catalog.Product
+	cached   map[string]catalog.Product
+	down     bool
+	lookups  int
+}
+
+func (d *memoryProducts) GetProducts(ctx context.Context, ids []string) ([]catalog.Product, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lookups++
+	products := []catalog.Product{}
+	for _, id := range ids {
+		if p, ok := d.cached[id]; ok {
+			products = append(products, p)
+		} else if p, ok := d.products[id]; ok && !d.down {
+			products = append(products, p)
+		}
+	}
+	return products, nil
+}
+
+func (d *memoryProducts) GetCurrentProducts(ctx context.Context, ids []string) ([]catalog.Product, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lookups++
+	if d.down {
+		return nil, fmt.Errorf("%w: connection refused", ErrCatalogUnavailable)
+	}
+	products := []catalog.Product{}
+	for _, id := range ids {
+		if p, ok := d.products[id]; ok {
+			products = append(products, p)
+		}
+	}
+	return products, nil
+}
+
+func (d *memoryProducts) ReserveStock(ctx context.Context, lines []OrderedProduct) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, l := range lines {
+		if v := d.variant(l.ID, l.VariantID); v != nil && uint32(v.Stock) < l.Quantity {
+			return ErrOutOfStock
+		}
+	}
+	for _, l := range lines {
+		if v := d.variant(l.ID, l.VariantID); v != nil {
+			v.Stock -= int(l.Quantity)
+		}
+	}
+	return nil
+}
+
+func (d *memoryProducts) ReleaseStock(ctx context.Context, lines []OrderedProduct) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, l := range lines {
+		if v := d.variant(l.ID, l.VariantID); v != nil {
+			v.Stock += int(l.Quantity)
+		}
+	}
+	return nil
+}
+
+// variant returns the stored variant, to be changed in place. d.mu must be
+// held.
+func (d *memoryProducts) variant(productID string, variantID string) *catalog.Variant {
+	p, ok := d.products[productID]
+	if !ok || variantID == "" {
+		return nil
+	}
+	for i := range p.Variants {
+		if p.Variants[i].ID == variantID {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+func (d *memoryProducts) stock(productID string, variantID string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.variant(productID, variantID).Stock
+}
+
+func (d *memoryProducts) remove(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.products, id)
+}
+
+func (d *memoryProducts) lookupCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lookups
+}
+
+// memoryPromotions stores promotions for promotion.NewService and counts
+// redemptions from the orders in orders.
+type memoryPromotions struct {
+	promotion.Repository
+
+	promotions map[string]promotion.Promotion
+	orders     *memoryRepository
+}
+
+func (r *memoryPromotions) GetPromotionByCode(ctx context.Context, code string) (*promotion.Promotion, error) {
+	p, ok := r.promotions[code]
+	if !ok {
+		return nil, promotion.ErrNotFound
+	}
+	return &p, nil
+}
+
+func (r *memoryPromotions) CountRedemptions(ctx context.Context, promotionID string, accountID string) (uint32, error) {
+	return r.orders.redemptions(promotionID, accountID), nil
+}
+
+type testService struct {
+	Service
+	repository *memoryRepository
+	products   *memoryProducts
+}
+
+func newTestService(t *testing.T) testService {
+	t.Helper()
+
+	repository := newMemoryRepository()
+	products := &memoryProducts{products: map[string]catalog.Product{
+		"book": {ID: "book", Name: "Book", Price: 10, TaxCategory: catalog.DefaultTaxCategory},
+		"shirt": {
+			ID:          "shirt",
+			Name:        "Shirt",
+			Price:       20,
+			TaxCategory: catalog.DefaultTaxCategory,
+			Options:     []catalog.Option{{Name: "Size", Values: []string{"S", "M"}}},
+			Variants: []catalog.Variant{
+				{ID: "shirt-s", SKU: "SHIRT-S", Stock: 1, Attributes: []catalog.Attribute{{Name: "Size", Value: "S"}}},
+				{ID: "shirt-m", SKU: "SHIRT-M", Stock: 5, Attributes: []catalog.Attribute{{Name: "Size", Value: "M"}}},
+			},
+		},
+	}}
+	promotions := promotion.NewService(&memoryPromotions{
+		promotions: map[string]promotion.Promotion{
+			"ONCE": {ID: "once", Code: "ONCE", Kind: promotion.KindFixedAmount, Value: 5, UsageLimitPerAccount: 1, Active: true},
+		},
+		orders: repository,
+	})
+	tax, err := NewRuleTaxCalculator(DefaultTaxRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	commission, err := NewFlatCommission(0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewService(
+		repository,
+		memoryAccounts{accounts: map[string]bool{"alice": true}},
+		products,
+		products,
+		promotions,
+		tax,
+		NewFlatRate(0),
+		commission,
+		payment.NewFakeProvider(),
+		NewFeed(),
+	)
+	return testService{s, repository, products}
+}
+
+func TestPostOrderReplaysWithoutPricing(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	r := OrderRequest{
+		AccountID:      "alice",
+		Products:       []OrderedProduct{{ID: "book", Quantity: 2}},
+		CouponCode:     "once",
+		IdempotencyKey: "key-1",
+	}
+
+	first, err := s.PostOrder(ctx, r)
+	if err != nil {
+		t.Fatalf("PostOrder: %v", err)
+	}
+	if first.Order == nil || first.Order.DiscountTotal != 5 {
+		t.Fatalf("PostOrder = %+v, want an order with a discount of 5", first)
+	}
+	lookups := s.products.lookupCount()
+
+	// The coupon is used up and the product is gone, so pricing the retry
+	// again would fail it.
+	s.products.remove("book")
+	retry, err := s.PostOrder(ctx, r)
+	if err != nil {
+		t.Fatalf("retried PostOrder: %v", err)
+	}
+	if retry.Order == nil || retry.Order.ID != first.Order.ID {
+		t.Fatalf("retried PostOrder = %+v, want order %s", retry, first.Order.ID)
+	}
+	if n := s.products.lookupCount(); n != lookups {
+		t.Errorf("retry looked products up %d more times, want none", n-lookups)
+	}
+}
+
+func TestPostOrderRejectsReusedKey(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	r := OrderRequest{
+		AccountID:      "alice",
+		Products:       []OrderedProduct{{ID: "book", Quantity: 1}},
+		IdempotencyKey: "key-1",
+	}
+	if _, err := s.PostOrder(ctx, r); err != nil {
+		t.Fatalf("PostOrder: %v", err)
+	}
+
+	r.Products = []OrderedProduct{{ID: "book", Quantity: 3}}
+	if _, err := s.PostOrder(ctx, r); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("PostOrder with another request = %v, want %v", err, ErrIdempotencyKeyReused)
+	}
+}
+
+func TestPostOrderConcurrentRetries(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	r := OrderRequest{
+		AccountID:      "alice",
+		Products:       []OrderedProduct{{ID: "book", Quantity: 1}},
+		CouponCode:     "ONCE",
+		IdempotencyKey: "key-1",
+	}
+
+	const calls = 20
+	ids := make(chan string, calls)
+	errs := make(chan error, calls)
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := s.PostOrder(ctx, r)
+			if err != nil {
+				errs <- err
+				return
+			}
+			ids <- res.Order.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("PostOrder: %v", err)
+	}
+	seen := map[string]bool{}
+	for id := range ids {
+		seen[id] = true
+	}
+	if len(seen) != 1 {
+		t.Errorf("concurrent calls returned %d different orders, want 1", len(seen))
+	}
+	if n := len(s.repository.orders); n != 1 {
+		t.Errorf("stored %d orders, want 1", n)
+	}
+}
+
+func TestPostOrderPricesCurrentProducts(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	s.products.cached = map[string]catalog.Product{
+		"book": {ID: "book", Name: "Book", Price: 8, TaxCategory: catalog.DefaultTaxCategory},
+	}
+
+	res, err := s.PostOrder(ctx, OrderRequest{
+		AccountID: "alice",
+		Products:  []OrderedProduct{{ID: "book", Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("PostOrder: %v", err)
+	}
+	if res.Order == nil || res.Order.Subtotal != 10 {
+		t.Errorf("PostOrder = %+v, want a subtotal of 10 from the current price", res)
+	}
+}
+
+func TestPostOrderFailsWhileCatalogIsDown(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	s.products.cached = map[string]catalog.Product{
+		"book": {ID: "book", Name: "Book", Price: 10, TaxCategory: catalog.DefaultTaxCategory},
+	}
+	s.products.down = true
+
+	r := OrderRequest{AccountID: "alice", Products: []OrderedProduct{{ID: "book", Quantity: 1}}}
+	if _, err := s.PostOrder(ctx, r); !errors.Is(err, ErrCatalogUnavailable) {
+		t.Fatalf("PostOrder = %v, want %v", err, ErrCatalogUnavailable)
+	}
+	if _, err := s.QuoteOrder(ctx, r); !errors.Is(err, ErrCatalogUnavailable) {
+		t.Fatalf("QuoteOrder = %v, want %v", err, ErrCatalogUnavailable)
+	}
+	if len(s.repository.orders) != 0 {
+		t.Errorf("stored %d orders, want none", len(s.repository.orders))
+	}
+
+	_, err := (&grpcServer{service: s.Service}).PostOrder(ctx, &pb.PostOrderRequest{
+		AccountId: "alice",
+		Products:  []*pb.PostOrderRequest_OrderProduct{{ProductId: "book", Quantity: 1}},
+	})
+	if code := status.Code(err); code != codes.Unavailable {
+		t.Errorf("gRPC PostOrder = %v, want code %v", err, codes.Unavailable)
+	}
+}
+
+func TestPostOrderReservesStock(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+
+	res, err := s.PostOrder(ctx, OrderRequest{
+		AccountID: "alice",
+		Products:  []OrderedProduct{{ID: "shirt", VariantID: "shirt-m", Quantity: 2}, {ID: "book", Quantity: 1}},
+	})
+	if err != nil || res.Order == nil {
+		t.Fatalf("PostOrder = %+v, %v", res, err)
+	}
+	if n := s.products.stock("shirt", "shirt-m"); n != 3 {
+		t.Errorf("stock after the order = %d, want 3", n)
+	}
+}
+
+func TestPostOrderConcurrentLastUnit(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	r := OrderRequest{
+		AccountID: "alice",
+		Products:  []OrderedProduct{{ID: "shirt", VariantID: "shirt-s", Quantity: 1}},
+	}
+
+	const calls = 10
+	results := make(chan *PostOrderResult, calls)
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := s.PostOrder(ctx, r)
+			if err != nil && !errors.Is(err, ErrOutOfStock) {
+				t.Errorf("PostOrder: %v", err)
+				return
+			}
+			results <- res
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	placed := 0
+	for res := range results {
+		if res != nil && res.Order != nil {
+			placed++
+		}
+	}
+	if placed != 1 {
+		t.Errorf("placed %d orders of the last unit, want 1", placed)
+	}
+	if n := s.products.stock("shirt", "shirt-s"); n != 0 {
+		t.Errorf("stock after the orders = %d, want 0", n)
+	}
+}
+
+func TestPostOrderRejectsLineThatRanOut(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	r := OrderRequest{
+		AccountID: "alice",
+		Products:  []OrderedProduct{{ID: "shirt", VariantID: "shirt-s", Quantity: 1}},
+	}
+	if _, err := s.PostOrder(ctx, r); err != nil {
+		t.Fatalf("PostOrder: %v", err)
+	}
+
+	res, err := s.PostOrder(ctx, r)
+	if err != nil {
+		t.Fatalf("second PostOrder: %v", err)
+	}
+	if len(res.RejectedLines) != 1 || res.RejectedLines[0].Reason != RejectOutOfStock {
+		t.Errorf("second PostOrder = %+v, want the line rejected as out of stock", res)
+	}
+}
+
+func TestCancelOrderReleasesStock(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	res, err := s.PostOrder(ctx, OrderRequest{
+		AccountID: "alice",
+		Products:  []OrderedProduct{{ID: "shirt", VariantID: "shirt-m", Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatalf("PostOrder: %v", err)
+	}
+	id := res.Order.ID
+
+	if _, err := s.CancelOrder(ctx, "bob", id); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("CancelOrder by another account = %v, want %v", err, ErrOrderNotFound)
+	}
+	cancelled, err := s.CancelOrder(ctx, "alice", id)
+	if err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	if cancelled.Status != StatusCancelled {
+		t.Errorf("cancelled order has status %s, want %s", cancelled.Status, StatusCancelled)
+	}
+	if n := s.products.stock("shirt", "shirt-m"); n != 5 {
+		t.Errorf("stock after cancelling = %d, want 5", n)
+	}
+
+	// Cancelling twice must not put the stock back twice.
+	if _, err := s.CancelOrder(ctx, "alice", id); !errors.Is(err, ErrOrderNotCancellable) {
+		t.Errorf("second CancelOrder = %v, want %v", err, ErrOrderNotCancellable)
+	}
+	if n := s.products.stock("shirt", "shirt-m"); n != 5 {
+		t.Errorf("stock after cancelling twice = %d, want 5", n)
+	}
+	if _, err := s.PayOrder(ctx, PaymentRequest{OrderID: id, AccountID: "alice", Token: "tok_visa"}); !errors.Is(err, ErrOrderNotPayable) {
+		t.Errorf("PayOrder of a cancelled order = %v, want %v", err, ErrOrderNotPayable)
+	}
+}
+
+func TestProviderRefundKeepsStock(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	res, err := s.PostOrder(ctx, OrderRequest{
+		AccountID: "alice",
+		Products:  []OrderedProduct{{ID: "shirt", VariantID: "shirt-m", Quantity: 3}},
+	})
+	if err != nil {
+		t.Fatalf("PostOrder: %v", err)
+	}
+	p, err := s.PayOrder(ctx, PaymentRequest{OrderID: res.Order.ID, AccountID: "alice", Token: "tok_visa"})
+	if err != nil {
+		t.Fatalf("PayOrder: %v", err)
+	}
+
+	event := payment.Event{ID: "evt-1", Type: payment.EventRefunded, Provider: p.Provider, Reference: p.Reference}
+	for i := 0; i < 2; i++ {
+		if err := s.ApplyPaymentEvent(ctx, event); err != nil {
+			t.Fatalf("ApplyPaymentEvent: %v", err)
+		}
+	}
+	if n := s.products.stock("shirt", "shirt-m"); n != 2 {
+		t.Errorf("stock after the refund = %d, want 2", n)
+	}
+}
+
+func TestApplyPaymentEventReplays(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	res, err := s.PostOrder(ctx, OrderRequest{AccountID: "alice", Products: []OrderedProduct{{ID: "book", Quantity: 1}}})
+	if err != nil {
+		t.Fatalf("PostOrder: %v", err)
+	}
+	p, err := s.PayOrder(ctx, PaymentRequest{OrderID: res.Order.ID, AccountID: "alice", Token: "tok_visa"})
+	if err != nil {
+		t.Fatalf("PayOrder: %v", err)
+	}
+
+	refund := payment.Event{ID: "evt-1", Type: payment.EventRefunded, Provider: p.Provider, Reference: p.Reference}
+	if err := s.ApplyPaymentEvent(ctx, refund); err != nil {
+		t.Fatalf("ApplyPaymentEvent: %v", err)
+	}
+	refunded := s.repository.payments[p.ID]
+
+	// Providers deliver events at least once and in no particular order: a
+	// duplicate, and a capture that arrives after the refund, change nothing.
+	events := []payment.Event{
+		refund,
+		{ID: "evt-2", Type: payment.EventRefunded, Provider: p.Provider, Reference: p.Reference},
+		{ID: "evt-0", Type: payment.EventCaptured, Provider: p.Provider, Reference: p.Reference},
+		{ID: "evt-3", Type: payment.EventFailed, Provider: p.Provider, Reference: p.Reference, Reason: "late"},
+	}
+	for _, e := range events {
+		if err := s.ApplyPaymentEvent(ctx, e); err != nil {
+			t.Fatalf("ApplyPaymentEvent(%s %s): %v", e.ID, e.Type, err)
+		}
+	}
+	if got := s.repository.payments[p.ID]; got != refunded {
+		t.Errorf("payment after replayed events = %+v, want %+v", got, refunded)
+	}
+	if got := s.repository.orders[res.Order.ID].Status; got != StatusRefunded {
+		t.Errorf("order status = %s, want %s", got, StatusRefunded)
+	}
+
+	unknown := payment.Event{ID: "evt-4", Type: payment.EventCaptured, Provider: p.Provider, Reference: "nope"}
+	if err := s.ApplyPaymentEvent(ctx, unknown); !errors.Is(err, payment.ErrUnknownTransaction) {
+		t.Errorf("ApplyPaymentEvent of an unknown transaction = %v, want %v", err, payment.ErrUnknownTransaction)
+	}
+}
+
+func TestInventoryRestocker(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+
+	restocker := NewInventoryRestocker(s.products)
+	err := restocker.Restock(ctx, "order-1", []ReturnLine{
+		{ProductID: "shirt", VariantID: "shirt-s", Quantity: 2, Amount: 40},
+		{ProductID: "book", Quantity: 1, Amount: 10},
+	})
+	if err != nil {
+		t.Fatalf("Restock: %v", err)
+	}
+	if n := s.products.stock("shirt", "shirt-s"); n != 3 {
+		t.Errorf("stock after the return = %d, want 3", n)
+	}
+}
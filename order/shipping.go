@@ -0,0 +1,142 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/donaldnash/go-marketplace/promotion"
+)
+
+// DefaultShippingMethod is used for orders with a shipping address but no
+// shipping method.
+const DefaultShippingMethod = "standard"
+
+var (
+	ErrShippingAddressNotFound = errors.New("shipping address not found")
+	ErrShippingAddressRequired = errors.New("a shipping method needs a shipping address")
+	ErrUnknownShippingMethod   = errors.New("unknown shipping method")
+)
+
+// ShippingAddress is where an order ships to, copied from the account's
+// address book when the order is placed.
+type ShippingAddress struct {
+	AddressID  string
+	Name       string
+	Line1      string
+	Line2      string
+	City       string
+	Region     string
+	PostalCode string
+	Country    string
+}
+
+// Shipment is an order as seen by a ShippingCalculator. Amount is what the
+// customer pays for the goods after discounts and before tax.
+type Shipment struct {
+	Method  string
+	Address ShippingAddress
+	Lines   []ShippableLine
+	Amount  float64
+}
+
+type ShippableLine struct {
+	ProductID string
+	Weight    float64
+	Quantity  uint32
+}
+
+// Weight is the total weight of the shipment in kilograms. Products without
+// a known weight count as weightless.
+func (s Shipment) Weight() float64 {
+	w := 0.0
+	for _, l := range s.Lines {
+		w += l.Weight * float64(l.Quantity)
+	}
+	return w
+}
+
+type ShippingCalculator interface {
+	CalculateShipping(ctx context.Context, s Shipment) (float64, error)
+}
+
+type flatRate struct {
+	amount float64
+}
+
+// NewFlatRate charges the same amount for every shipment.
+func NewFlatRate(amount float64) ShippingCalculator {
+	if amount < 0 {
+		panic("shipping rate cannot be negative")
+	}
+	return &flatRate{amount}
+}
+
+func (r *flatRate) CalculateShipping(ctx context.Context, s Shipment) (float64, error) {
+	return r.amount, nil
+}
+
+type weightRate struct {
+	base  float64
+	perKg float64
+}
+
+// NewWeightRate charges base plus perKg for every kilogram the shipment
+// weighs.
+func NewWeightRate(base float64, perKg float64) ShippingCalculator {
+	if base < 0 || perKg < 0 {
+		panic("shipping rate cannot be negative")
+	}
+	return &weightRate{base, perKg}
+}
+
+func (r *weightRate) CalculateShipping(ctx context.Context, s Shipment) (float64, error) {
+	return promotion.RoundCents(r.base + r.perKg*s.Weight()), nil
+}
+
+type freeOver struct {
+	threshold float64
+	next      ShippingCalculator
+}
+
+// NewFreeOver ships for free once the shipment amount reaches threshold and
+// asks next otherwise.
+func NewFreeOver(threshold float64, next ShippingCalculator) ShippingCalculator {
+	if next == nil {
+		panic("shipping calculator cannot be nil")
+	}
+	return &freeOver{threshold, next}
+}
+
+func (r *freeOver) CalculateShipping(ctx context.Context, s Shipment) (float64, error) {
+	if s.Amount >= r.threshold {
+		return 0, nil
+	}
+	return r.next.CalculateShipping(ctx, s)
+}
+
+type shippingMethods struct {
+	methods map[string]ShippingCalculator
+}
+
+// NewShippingMethods prices each shipment with the calculator registered for
+// its method. Method names are matched case-insensitively.
+func NewShippingMethods(methods map[string]ShippingCalculator) ShippingCalculator {
+	normalized := map[string]ShippingCalculator{}
+	for name, c := range methods {
+		if c == nil {
+			panic(fmt.Sprintf("shipping calculator for %q cannot be nil", name))
+		}
+		normalized[strings.ToLower(name)] = c
+	}
+	return &shippingMethods{normalized}
+}
+
+func (m *shippingMethods) CalculateShipping(ctx context.Context, s Shipment) (float64, error) {
+	c, ok := m.methods[strings.ToLower(s.Method)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownShippingMethod, s.Method)
+	}
+	return c.CalculateShipping(ctx, s)
+}
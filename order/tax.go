@@ -0,0 +1,138 @@
+package order
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/donaldnash/go-marketplace/promotion"
+)
+
+// TaxLocation is where an order is taxed. Orders without a country are not
+// taxed.
+type TaxLocation struct {
+	Country string
+	Region  string
+}
+
+// TaxableLine is an order line as seen by a TaxCalculator. Amount is what the
+// customer pays for the line once discounts are taken off.
+type TaxableLine struct {
+	ProductID   string
+	TaxCategory string
+	Amount      float64
+}
+
+type TaxCalculator interface {
+	// CalculateTax returns the tax owed on each line, in the order of lines.
+	CalculateTax(ctx context.Context, location TaxLocation, lines []TaxableLine) ([]float64, error)
+}
+
+// TaxRule sets the rate for products of Category shipped to Country and
+// Region. An empty field matches anything; when several rules match a line,
+// the most specific one wins, with country weighing most and category least.
+type TaxRule struct {
+	Country  string  `json:"country,omitempty"`
+	Region   string  `json:"region,omitempty"`
+	Category string  `json:"category,omitempty"`
+	Rate     float64 `json:"rate"`
+}
+
+//go:embed tax_rules.json
+var defaultTaxRules []byte
+
+type ruleTaxCalculator struct {
+	rules []TaxRule
+}
+
+// NewRuleTaxCalculator taxes lines by looking their location and tax category
+// up in rules. Lines no rule matches are not taxed.
+func NewRuleTaxCalculator(rules []TaxRule) (TaxCalculator, error) {
+	normalized := make([]TaxRule, len(rules))
+	for i, r := range rules {
+		if r.Rate < 0 || r.Rate > 1 {
+			return nil, fmt.Errorf("tax rule %d: rate must be between 0 and 1", i)
+		}
+		if r.Region != "" && r.Country == "" {
+			return nil, fmt.Errorf("tax rule %d: a region needs a country", i)
+		}
+		normalized[i] = TaxRule{
+			Country:  strings.ToUpper(r.Country),
+			Region:   strings.ToUpper(r.Region),
+			Category: strings.ToLower(r.Category),
+			Rate:     r.Rate,
+		}
+	}
+	return &ruleTaxCalculator{normalized}, nil
+}
+
+// LoadTaxRules reads a JSON array of tax rules.
+func LoadTaxRules(r io.Reader) ([]TaxRule, error) {
+	rules := []TaxRule{}
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("failed to decode tax rules: %v", err)
+	}
+	return rules, nil
+}
+
+// DefaultTaxRules returns the rules built into the order service.
+func DefaultTaxRules() []TaxRule {
+	rules, err := LoadTaxRules(bytes.NewReader(defaultTaxRules))
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+func (c *ruleTaxCalculator) CalculateTax(ctx context.Context, location TaxLocation, lines []TaxableLine) ([]float64, error) {
+	taxes := make([]float64, len(lines))
+	if location.Country == "" {
+		return taxes, nil
+	}
+
+	country := strings.ToUpper(location.Country)
+	region := strings.ToUpper(location.Region)
+	for i, l := range lines {
+		if rule := c.match(country, region, strings.ToLower(l.TaxCategory)); rule != nil {
+			taxes[i] = promotion.RoundCents(l.Amount * rule.Rate)
+		}
+	}
+	return taxes, nil
+}
+
+func (c *ruleTaxCalculator) match(country string, region string, category string) *TaxRule {
+	var best *TaxRule
+	bestScore := -1
+	for i, r := range c.rules {
+		score := 0
+		switch r.Country {
+		case "":
+		case country:
+			score += 4
+		default:
+			continue
+		}
+		switch r.Region {
+		case "":
+		case region:
+			score += 2
+		default:
+			continue
+		}
+		switch r.Category {
+		case "":
+		case category:
+			score++
+		default:
+			continue
+		}
+		if score > bestScore {
+			best, bestScore = &c.rules[i], score
+		}
+	}
+	return best
+}
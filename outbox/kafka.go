@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// kafkaRESTPublisher produces events through a Kafka REST Proxy (v2 API),
+// keyed by aggregate ID so each aggregate's events land in one partition.
+type kafkaRESTPublisher struct {
+	endpoint string
+	client   *http.Client
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value Event  `json:"value"`
+}
+
+type kafkaProduceRequest struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaProduceResponse struct {
+	Offsets []struct {
+		Partition *int   `json:"partition"`
+		Offset    *int64 `json:"offset"`
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+func NewKafkaRESTPublisher(proxyURL string, topic string) (Publisher, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid Kafka REST Proxy URL %q", proxyURL)
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("Kafka topic is required")
+	}
+	return &kafkaRESTPublisher{
+		endpoint: strings.TrimSuffix(proxyURL, "/") + "/topics/" + url.PathEscape(topic),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *kafkaRESTPublisher) Publish(ctx context.Context, e Event) error {
+	body, err := json.Marshal(kafkaProduceRequest{
+		Records: []kafkaRecord{{Key: e.AggregateID, Value: e}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to produce event: %v", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to produce event: %s: %s", res.Status, bytes.TrimSpace(data))
+	}
+
+	var produced kafkaProduceResponse
+	if err := json.Unmarshal(data, &produced); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	for _, o := range produced.Offsets {
+		if o.ErrorCode != nil || o.Error != "" {
+			return fmt.Errorf("failed to produce event: %s", o.Error)
+		}
+	}
+	return nil
+}
+
+func (p *kafkaRESTPublisher) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
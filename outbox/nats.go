@@ -0,0 +1,162 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const natsTimeout = 5 * time.Second
+
+// natsPublisher speaks the NATS client protocol. Each event is flushed with
+// a PING so Publish only returns once the server has read it.
+type natsPublisher struct {
+	address       string
+	user          *url.Userinfo
+	subjectPrefix string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewNATSPublisher publishes events to the NATS server at rawURL, e.g.
+// nats://localhost:4222, on the subject "<subjectPrefix>.<event type>".
+func NewNATSPublisher(rawURL string, subjectPrefix string) (Publisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q", rawURL)
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	p := &natsPublisher{address: address, user: u.User, subjectPrefix: subjectPrefix}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.connect(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *natsPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", p.address, natsTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	reader := bufio.NewReader(conn)
+
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("unexpected NATS greeting %q: %v", line, err)
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "outbox",
+		"lang":     "go",
+		"version":  "1.0.0",
+	}
+	if p.user != nil {
+		options["user"] = p.user.Username()
+		if password, ok := p.user.Password(); ok {
+			options["pass"] = password
+		}
+	}
+	connect, _ := json.Marshal(options)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\n", connect); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to NATS: %v", err)
+	}
+
+	p.conn = conn
+	p.reader = reader
+	if err := p.ping(); err != nil {
+		p.disconnect()
+		return err
+	}
+	return nil
+}
+
+func (p *natsPublisher) disconnect() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+		p.reader = nil
+	}
+}
+
+// ping waits for the server to answer a PING, which it does after handling
+// everything sent before it.
+func (p *natsPublisher) ping() error {
+	if _, err := p.conn.Write([]byte("PING\r\n")); err != nil {
+		return fmt.Errorf("failed to write to NATS: %v", err)
+	}
+	for {
+		line, err := p.reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read from NATS: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return fmt.Errorf("failed to write to NATS: %v", err)
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+	subject := p.subjectPrefix + "." + e.Type
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+
+	deadline := time.Now().Add(natsTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	p.conn.SetDeadline(deadline)
+
+	if _, err := fmt.Fprintf(p.conn, "PUB %s %d\r\n%s\r\n", subject, len(data), data); err != nil {
+		p.disconnect()
+		return fmt.Errorf("failed to write to NATS: %v", err)
+	}
+	if err := p.ping(); err != nil {
+		p.disconnect()
+		return err
+	}
+	return nil
+}
+
+func (p *natsPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.disconnect()
+	return nil
+}
@@ -0,0 +1,54 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// Event is a domain event a service records together with the change that
+// caused it. AggregateID is the ID of the account, product or order the
+// event is about; events of one aggregate are published in the order they
+// occurred.
+type Event struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID string          `json:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+}
+
+// NewEvent returns an event of eventType about aggregateID carrying payload
+// encoded as JSON.
+func NewEvent(eventType string, aggregateID string, payload interface{}) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to marshal %s event: %v", eventType, err)
+	}
+	return Event{
+		ID:          ksuid.New().String(),
+		Type:        eventType,
+		AggregateID: aggregateID,
+		Payload:     data,
+		OccurredAt:  time.Now().UTC(),
+	}, nil
+}
+
+type Publisher interface {
+	// Publish returns once e has been handed over for delivery. After an
+	// error, e is published again later.
+	Publish(ctx context.Context, e Event) error
+	Close() error
+}
+
+// Store holds the events a service recorded but has not published yet.
+type Store interface {
+	Close()
+	// Pending returns up to limit unpublished events, oldest first.
+	Pending(ctx context.Context, limit int) ([]Event, error)
+	// MarkPublished drops events from the store.
+	MarkPublished(ctx context.Context, events []Event) error
+}
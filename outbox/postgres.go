@@ -0,0 +1,92 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Execer is satisfied by *sql.Tx. Events must be inserted in the transaction
+// that makes the change they describe.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Insert records e in the outbox table of the service's database.
+func Insert(ctx context.Context, tx Execer, e Event) error {
+	_, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO outbox(id, type, aggregate_id, payload, occurred_at) VALUES ($1, $2, $3, $4, $5)",
+		e.ID,
+		e.Type,
+		e.AggregateID,
+		[]byte(e.Payload),
+		e.OccurredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert %s event: %v", e.Type, err)
+	}
+	return nil
+}
+
+type postgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(url string) (Store, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	err = db.Ping()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	return &postgresStore{db}, nil
+}
+
+func (s *postgresStore) Close() {
+	if s.db != nil {
+		s.db.Close()
+	}
+}
+
+func (s *postgresStore) Pending(ctx context.Context, limit int) ([]Event, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT id, type, aggregate_id, payload, occurred_at FROM outbox ORDER BY occurred_at, id LIMIT $1",
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox: %v", err)
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.Type, &e.AggregateID, &payload, &e.OccurredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox row: %v", err)
+		}
+		e.Payload = payload
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over outbox rows: %v", err)
+	}
+	return events, nil
+}
+
+func (s *postgresStore) MarkPublished(ctx context.Context, events []Event) error {
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM outbox WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to delete published events: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Config selects the publisher a service relays its events to.
+type Config struct {
+	// Publisher is "log", "nats" or "kafka-rest".
+	Publisher string `envconfig:"EVENT_PUBLISHER" default:"log"`
+	// PublisherURL is the NATS server or the Kafka REST Proxy.
+	PublisherURL string `envconfig:"EVENT_PUBLISHER_URL"`
+	// Topic is the NATS subject prefix or the Kafka topic.
+	Topic        string        `envconfig:"EVENT_TOPIC" default:"marketplace"`
+	PollInterval time.Duration `envconfig:"OUTBOX_POLL_INTERVAL" default:"1s"`
+}
+
+func NewPublisher(c Config) (Publisher, error) {
+	switch c.Publisher {
+	case "log":
+		return NewLogPublisher(), nil
+	case "nats":
+		return NewNATSPublisher(c.PublisherURL, c.Topic)
+	case "kafka-rest":
+		return NewKafkaRESTPublisher(c.PublisherURL, c.Topic)
+	}
+	return nil, fmt.Errorf("unknown event publisher %q", c.Publisher)
+}
+
+// ChannelPublisher hands events to a consumer in the same process. Nothing
+// outside the process can read them, so it is not one of the publishers
+// Config selects; code that consumes events itself, such as tests, creates
+// it with NewChannelPublisher.
+type ChannelPublisher struct {
+	mu     sync.RWMutex
+	events chan Event
+	closed bool
+}
+
+// NewChannelPublisher returns a publisher whose events are read from
+// Events. Publish blocks while buffer events are waiting to be read.
+func NewChannelPublisher(buffer int) *ChannelPublisher {
+	return &ChannelPublisher{events: make(chan Event, buffer)}
+}
+
+func (p *ChannelPublisher) Events() <-chan Event {
+	return p.events
+}
+
+func (p *ChannelPublisher) Publish(ctx context.Context, e Event) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return fmt.Errorf("publisher is closed")
+	}
+
+	select {
+	case p.events <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the Events channel once no Publish is in progress.
+func (p *ChannelPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.events)
+	}
+	return nil
+}
+
+type logPublisher struct{}
+
+// NewLogPublisher returns a publisher that only logs events, for running
+// without a message broker.
+func NewLogPublisher() Publisher {
+	return logPublisher{}
+}
+
+func (logPublisher) Publish(ctx context.Context, e Event) error {
+	log.Printf("Event %s %s (aggregate %s): %s", e.Type, e.ID, e.AggregateID, e.Payload)
+	return nil
+}
+
+func (logPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,84 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const relayBatchSize = 100
+
+// Relay moves events from a Store to a Publisher. An event leaves the store
+// only after it was published, so every event is published at least once;
+// a relay that stops between the two steps publishes it again on restart.
+type Relay struct {
+	store     Store
+	publisher Publisher
+	interval  time.Duration
+}
+
+func NewRelay(store Store, publisher Publisher, interval time.Duration) *Relay {
+	if store == nil {
+		panic("store cannot be nil")
+	}
+	if publisher == nil {
+		panic("publisher cannot be nil")
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &Relay{store, publisher, interval}
+}
+
+// Run flushes the store every interval until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error relaying events: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publishes every pending event and returns how many were published.
+// It stops at the first event that cannot be published, so that later
+// events of the same aggregate do not overtake it.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		events, err := r.store.Pending(ctx, relayBatchSize)
+		if err != nil {
+			return published, err
+		}
+
+		done := 0
+		var publishErr error
+		for _, e := range events {
+			if publishErr = r.publisher.Publish(ctx, e); publishErr != nil {
+				break
+			}
+			done++
+		}
+
+		if done > 0 {
+			if err := r.store.MarkPublished(ctx, events[:done]); err != nil {
+				return published, err
+			}
+			published += done
+		}
+		if publishErr != nil {
+			return published, publishErr
+		}
+		if len(events) < relayBatchSize {
+			return published, nil
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps pending events in memory. failMarks makes that many
+// MarkPublished calls fail, as if the relay stopped right after publishing.
+type memoryStore struct {
+	mu        sync.Mutex
+	events    []Event
+	failMarks int
+}
+
+func (s *memoryStore) add(events ...Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+}
+
+func (s *memoryStore) Close() {}
+
+func (s *memoryStore) Pending(ctx context.Context, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event{}, s.events[:min(limit, len(s.events))]...), nil
+}
+
+func (s *memoryStore) MarkPublished(ctx context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failMarks > 0 {
+		s.failMarks--
+		return errors.New("database is unavailable")
+	}
+	published := map[string]bool{}
+	for _, e := range events {
+		published[e.ID] = true
+	}
+	pending := []Event{}
+	for _, e := range s.events {
+		if !published[e.ID] {
+			pending = append(pending, e)
+		}
+	}
+	s.events = pending
+	return nil
+}
+
+func (s *memoryStore) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+// flakyPublisher fails to publish the events in failures, once each.
+type flakyPublisher struct {
+	*ChannelPublisher
+	mu       sync.Mutex
+	failures map[string]bool
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, e Event) error {
+	p.mu.Lock()
+	fail := p.failures[e.ID]
+	delete(p.failures, e.ID)
+	p.mu.Unlock()
+	if fail {
+		return errors.New("broker is unavailable")
+	}
+	return p.ChannelPublisher.Publish(ctx, e)
+}
+
+// testEvents returns n events spread over aggregates, in the order they
+// occurred.
+func testEvents(t *testing.T, n int, aggregates int) []Event {
+	t.Helper()
+	events := make([]Event, n)
+	for i := range events {
+		e, err := NewEvent("test.happened", fmt.Sprintf("aggregate-%d", i%aggregates), i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.ID = fmt.Sprintf("event-%04d", i)
+		events[i] = e
+	}
+	return events
+}
+
+// received drains the events published so far.
+func received(p *ChannelPublisher) []Event {
+	events := []Event{}
+	for {
+		select {
+		case e := <-p.Events():
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+// checkAggregateOrder fails unless the events of every aggregate came in the
+// order they occurred.
+func checkAggregateOrder(t *testing.T, events []Event) {
+	t.Helper()
+	last := map[string]string{}
+	for _, e := range events {
+		if prev, ok := last[e.AggregateID]; ok && e.ID < prev {
+			t.Errorf("event %s of %s came after %s", e.ID, e.AggregateID, prev)
+		}
+		last[e.AggregateID] = e.ID
+	}
+}
+
+func TestRelayFlushPublishesEveryEvent(t *testing.T) {
+	ctx := context.Background()
+	events := testEvents(t, 2*relayBatchSize+50, 3)
+	store := &memoryStore{}
+	store.add(events...)
+	publisher := NewChannelPublisher(len(events))
+
+	n, err := NewRelay(store, publisher, time.Second).Flush(ctx)
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if n != len(events) {
+		t.Errorf("Flush published %d events, want %d", n, len(events))
+	}
+
+	got := received(publisher)
+	if len(got) != len(events) {
+		t.Fatalf("received %d events, want %d", len(got), len(events))
+	}
+	for i, e := range got {
+		if e.ID != events[i].ID {
+			t.Fatalf("event %d is %s, want %s", i, e.ID, events[i].ID)
+		}
+	}
+	if n := store.pending(); n != 0 {
+		t.Errorf("%d events are still pending", n)
+	}
+}
+
+func TestRelayRetriesAfterPublishFailure(t *testing.T) {
+	ctx := context.Background()
+	events := testEvents(t, 10, 2)
+	store := &memoryStore{}
+	store.add(events...)
+	publisher := &flakyPublisher{
+		ChannelPublisher: NewChannelPublisher(len(events)),
+		failures:         map[string]bool{events[3].ID: true},
+	}
+	relay := NewRelay(store, publisher, time.Second)
+
+	n, err := relay.Flush(ctx)
+	if err == nil {
+		t.Fatal("Flush succeeded while the broker failed")
+	}
+	if n != 3 {
+		t.Errorf("Flush published %d events before the failure, want 3", n)
+	}
+	// Nothing after the failed event goes out, or it would overtake it.
+	first := received(publisher.ChannelPublisher)
+	if len(first) != 3 {
+		t.Fatalf("received %d events before the failure, want 3", len(first))
+	}
+	if n := store.pending(); n != len(events)-3 {
+		t.Errorf("%d events are pending after the failure, want %d", n, len(events)-3)
+	}
+
+	n, err = relay.Flush(ctx)
+	if err != nil {
+		t.Fatalf("second Flush: %v", err)
+	}
+	if n != len(events)-3 {
+		t.Errorf("second Flush published %d events, want %d", n, len(events)-3)
+	}
+	got := append(first, received(publisher.ChannelPublisher)...)
+	if len(got) != len(events) {
+		t.Fatalf("received %d events, want %d", len(got), len(events))
+	}
+	for i, e := range got {
+		if e.ID != events[i].ID {
+			t.Errorf("event %d is %s, want %s", i, e.ID, events[i].ID)
+		}
+	}
+}
+
+func TestRelayPublishesAtLeastOnce(t *testing.T) {
+	ctx := context.Background()
+	events := testEvents(t, 5, 2)
+	store := &memoryStore{failMarks: 1}
+	store.add(events...)
+	publisher := NewChannelPublisher(2 * len(events))
+	relay := NewRelay(store, publisher, time.Second)
+
+	// The events go out, but the store does not learn about it.
+	if _, err := relay.Flush(ctx); err == nil {
+		t.Fatal("Flush succeeded while the store failed")
+	}
+	if n := store.pending(); n != len(events) {
+		t.Fatalf("%d events are pending, want %d", n, len(events))
+	}
+
+	if _, err := relay.Flush(ctx); err != nil {
+		t.Fatalf("second Flush: %v", err)
+	}
+	got := received(publisher)
+	if len(got) != 2*len(events) {
+		t.Fatalf("received %d events, want every event twice (%d)", len(got), 2*len(events))
+	}
+	seen := map[string]int{}
+	for _, e := range got {
+		seen[e.ID]++
+	}
+	for _, e := range events {
+		if seen[e.ID] == 0 {
+			t.Errorf("event %s was never published", e.ID)
+		}
+	}
+	checkAggregateOrder(t, got[len(events):])
+	if n := store.pending(); n != 0 {
+		t.Errorf("%d events are still pending", n)
+	}
+}
+
+func TestRelayRunKeepsAggregateOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events := testEvents(t, 60, 4)
+	store := &memoryStore{}
+	failures := map[string]bool{}
+	for i := 5; i < len(events); i += 10 {
+		failures[events[i].ID] = true
+	}
+	publisher := &flakyPublisher{ChannelPublisher: NewChannelPublisher(len(events)), failures: failures}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewRelay(store, publisher, time.Millisecond).Run(ctx)
+	}()
+	// Events keep being recorded while the relay runs.
+	for start := 0; start < len(events); start += 20 {
+		store.add(events[start : start+20]...)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	got := []Event{}
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(events) {
+		select {
+		case e := <-publisher.Events():
+			got = append(got, e)
+		case <-timeout:
+			t.Fatalf("received %d of %d events", len(got), len(events))
+		}
+	}
+	cancel()
+	<-done
+
+	checkAggregateOrder(t, got)
+	seen := map[string]bool{}
+	for _, e := range got {
+		if seen[e.ID] {
+			t.Errorf("event %s was published twice", e.ID)
+		}
+		seen[e.ID] = true
+	}
+}
@@ -0,0 +1,140 @@
+package payment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Tokens the fake provider understands. Any other non-empty token is
+// authorized.
+const (
+	FakeTokenDeclined          = "tok_declined"
+	FakeTokenInsufficientFunds = "tok_insufficient_funds"
+	FakeTokenProviderError     = "tok_provider_error"
+)
+
+type fakeProvider struct {
+	mu           sync.Mutex
+	transactions map[string]*Transaction
+}
+
+// NewFakeProvider returns a provider that keeps transactions in memory and
+// decides every outcome from the payment token, so local runs and tests get
+// the same results every time. References are derived from the idempotency
+// key, which makes retried authorizations return the same transaction.
+func NewFakeProvider() Provider {
+	return &fakeProvider{transactions: map[string]*Transaction{}}
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) Authorize(ctx context.Context, r AuthorizeRequest) (*Transaction, error) {
+	if r.Token == "" {
+		return nil, fmt.Errorf("payment token is required")
+	}
+	if r.Amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	switch r.Token {
+	case FakeTokenDeclined:
+		return nil, fmt.Errorf("%w: card declined", ErrDeclined)
+	case FakeTokenInsufficientFunds:
+		return nil, fmt.Errorf("%w: insufficient funds", ErrDeclined)
+	case FakeTokenProviderError:
+		return nil, fmt.Errorf("fake provider is unavailable")
+	}
+
+	key := r.IdempotencyKey
+	if key == "" {
+		key = r.OrderID
+	}
+	sum := sha256.Sum256([]byte(key))
+	reference := "fake_" + hex.EncodeToString(sum[:12])
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t, ok := p.transactions[reference]; ok {
+		if t.Amount != r.Amount {
+			return nil, fmt.Errorf("idempotency key was already used for a different amount")
+		}
+		copied := *t
+		return &copied, nil
+	}
+
+	t := &Transaction{Reference: reference, Amount: r.Amount, Status: StatusAuthorized}
+	p.transactions[reference] = t
+	copied := *t
+	return &copied, nil
+}
+
+func (p *fakeProvider) Capture(ctx context.Context, reference string, amount float64) (*Transaction, error) {
+	return p.transition(reference, StatusCaptured, func(t *Transaction) error {
+		if amount <= 0 || amount > t.Amount {
+			return fmt.Errorf("capture amount must be positive and at most the authorized amount")
+		}
+		t.Amount = amount
+		return nil
+	})
+}
+
+func (p *fakeProvider) Refund(ctx context.Context, reference string, amount float64) (*Transaction, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, ok := p.transactions[reference]
+	if !ok {
+		return nil, ErrUnknownTransaction
+	}
+	if t.Status != StatusCaptured {
+		return nil, fmt.Errorf("%w: cannot refund a %s payment", ErrInvalidTransition, t.Status)
+	}
+	remaining := math.Round((t.Amount-t.Refunded)*100) / 100
+	if amount <= 0 || amount > remaining {
+		return nil, fmt.Errorf("refund amount must be positive and at most %.2f", remaining)
+	}
+
+	t.Refunded = math.Round((t.Refunded+amount)*100) / 100
+	if t.Refunded >= t.Amount {
+		t.Status = StatusRefunded
+	}
+	copied := *t
+	return &copied, nil
+}
+
+func (p *fakeProvider) Void(ctx context.Context, reference string) (*Transaction, error) {
+	return p.transition(reference, StatusVoided, nil)
+}
+
+func (p *fakeProvider) transition(reference string, next Status, check func(t *Transaction) error) (*Transaction, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, ok := p.transactions[reference]
+	if !ok {
+		return nil, ErrUnknownTransaction
+	}
+	if t.Status == next {
+		copied := *t
+		return &copied, nil
+	}
+	if !t.Status.CanBecome(next) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, t.Status, next)
+	}
+	if check != nil {
+		if err := check(t); err != nil {
+			return nil, err
+		}
+	}
+
+	t.Status = next
+	copied := *t
+	return &copied, nil
+}
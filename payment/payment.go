@@ -0,0 +1,91 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type Status string
+
+const (
+	// StatusPending is a payment that was recorded before its provider was
+	// asked to authorize it.
+	StatusPending    Status = "PENDING"
+	StatusAuthorized Status = "AUTHORIZED"
+	StatusCaptured   Status = "CAPTURED"
+	StatusFailed     Status = "FAILED"
+	StatusVoided     Status = "VOIDED"
+	StatusRefunded   Status = "REFUNDED"
+)
+
+var (
+	// ErrDeclined wraps the reason a provider refused a payment.
+	ErrDeclined = errors.New("payment was declined")
+	// ErrUnknownTransaction is returned for references a provider or the
+	// order service does not know.
+	ErrUnknownTransaction = errors.New("unknown payment transaction")
+	// ErrInvalidTransition is returned when a transaction cannot move to the
+	// requested status, such as refunding an uncaptured payment.
+	ErrInvalidTransition = errors.New("payment cannot move to that status")
+)
+
+// CanBecome reports whether a payment in status s may move to next.
+func (s Status) CanBecome(next Status) bool {
+	switch s {
+	case StatusPending:
+		return next == StatusAuthorized || next == StatusCaptured || next == StatusFailed
+	case StatusAuthorized:
+		return next == StatusCaptured || next == StatusVoided || next == StatusFailed
+	case StatusCaptured:
+		return next == StatusRefunded
+	}
+	return false
+}
+
+// Payment is one attempt to pay an order. Reference is the provider's ID for
+// the transaction and is empty until the provider has seen it. A captured
+// payment stays CAPTURED while it is partly refunded and becomes REFUNDED
+// once RefundedAmount reaches Amount.
+type Payment struct {
+	ID             string
+	OrderID        string
+	Provider       string
+	Reference      string
+	Amount         float64
+	RefundedAmount float64
+	Status         Status
+	FailureReason  string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+type AuthorizeRequest struct {
+	OrderID string
+	Amount  float64
+	// Token identifies the payment method, as handed to the customer by the
+	// provider.
+	Token string
+	// IdempotencyKey lets the provider recognize a retried authorization.
+	IdempotencyKey string
+}
+
+// Transaction is a provider's view of a payment.
+type Transaction struct {
+	Reference string
+	Amount    float64
+	Refunded  float64
+	Status    Status
+}
+
+// Provider moves money through a payment service provider. Amounts are in
+// the marketplace currency. Authorize returns an error wrapping ErrDeclined
+// when the provider refuses the payment method. Refund may be called several
+// times for parts of a captured amount.
+type Provider interface {
+	Name() string
+	Authorize(ctx context.Context, r AuthorizeRequest) (*Transaction, error)
+	Capture(ctx context.Context, reference string, amount float64) (*Transaction, error)
+	Refund(ctx context.Context, reference string, amount float64) (*Transaction, error)
+	Void(ctx context.Context, reference string) (*Transaction, error)
+}
@@ -0,0 +1,104 @@
+package payment
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("whsec")
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"id":"evt-1","type":"payment.captured","provider":"fake","reference":"ref-1","amount":10}`)
+	valid := Sign(secret, now, body)
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		header  string
+		body    []byte
+		wantErr bool
+	}{
+		{"valid", secret, valid, body, false},
+		{"valid with spaces", secret, strings.ReplaceAll(valid, ",", ", "), body, false},
+		{"one of several signatures valid", secret, valid + ",v1=00", body, false},
+		{"signed just within the tolerance", secret, Sign(secret, now.Add(-5*time.Minute), body), body, false},
+		{"tampered body", secret, valid, []byte(strings.Replace(string(body), "10", "1000", 1)), true},
+		{"wrong secret", []byte("other"), valid, body, true},
+		{"empty header", secret, "", body, true},
+		{"no timestamp", secret, valid[strings.Index(valid, "v1="):], body, true},
+		{"no signature", secret, valid[:strings.Index(valid, ",")], body, true},
+		{"malformed timestamp", secret, "t=noon," + valid[strings.Index(valid, "v1="):], body, true},
+		{"malformed parts", secret, "garbage", body, true},
+		{"unknown scheme only", secret, strings.Replace(valid, "v1=", "v0=", 1), body, true},
+		{"too old", secret, Sign(secret, now.Add(-6*time.Minute), body), body, true},
+		{"from the future", secret, Sign(secret, now.Add(6*time.Minute), body), body, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(tt.secret, tt.header, tt.body, now, 5*time.Minute)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("VerifySignature: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("VerifySignature = %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    Event
+		wantErr string
+	}{
+		{
+			name: "captured",
+			body: `{"id":"evt-1","type":"payment.captured","provider":"fake","reference":"ref-1","amount":10}`,
+			want: Event{ID: "evt-1", Type: EventCaptured, Provider: "fake", Reference: "ref-1", Amount: 10},
+		},
+		{
+			name: "failed with a reason",
+			body: `{"id":"evt-2","type":"payment.failed","provider":"fake","reference":"ref-1","reason":"card expired"}`,
+			want: Event{ID: "evt-2", Type: EventFailed, Provider: "fake", Reference: "ref-1", Reason: "card expired"},
+		},
+		{
+			name:    "unknown event type",
+			body:    `{"id":"evt-3","type":"payment.disputed","provider":"fake","reference":"ref-1"}`,
+			wantErr: "unknown payment event type",
+		},
+		{
+			name:    "no reference",
+			body:    `{"id":"evt-4","type":"payment.refunded","provider":"fake"}`,
+			wantErr: "needs a provider and a reference",
+		},
+		{
+			name:    "not JSON",
+			body:    `type=payment.captured`,
+			wantErr: "failed to decode",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := ParseEvent([]byte(tt.body))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseEvent = %v, %v, want an error with %q", e, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEvent: %v", err)
+			}
+			if *e != tt.want {
+				t.Errorf("ParseEvent = %+v, want %+v", *e, tt.want)
+			}
+		})
+	}
+}
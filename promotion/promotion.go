@@ -0,0 +1,183 @@
+package promotion
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+type Kind string
+
+const (
+	// KindPercentage takes Value percent off the eligible lines.
+	KindPercentage Kind = "PERCENTAGE"
+	// KindFixedAmount takes Value off the eligible lines, never more than
+	// they cost.
+	KindFixedAmount Kind = "FIXED_AMOUNT"
+	// KindBuyXGetY makes GetQuantity units free for every BuyQuantity units
+	// bought of the same eligible product.
+	KindBuyXGetY Kind = "BUY_X_GET_Y"
+)
+
+var (
+	ErrNotFound          = errors.New("promotion not found")
+	ErrCodeInUse         = errors.New("promotion code is already in use")
+	ErrInactive          = errors.New("promotion is not active")
+	ErrNotYetValid       = errors.New("promotion is not valid yet")
+	ErrExpired           = errors.New("promotion has expired")
+	ErrUsageLimitReached = errors.New("promotion usage limit reached for this account")
+	ErrMinSpendNotMet    = errors.New("order does not reach the promotion's minimum spend")
+	ErrNotApplicable     = errors.New("promotion does not apply to any product in the order")
+)
+
+type Promotion struct {
+	ID          string
+	Code        string
+	Description string
+	Kind        Kind
+	Value       float64
+	BuyQuantity uint32
+	GetQuantity uint32
+	// ProductIDs restricts the promotion to these products; empty means every
+	// product in the order is eligible.
+	ProductIDs []string
+	// MinSpend is compared against the whole order's subtotal.
+	MinSpend float64
+	// UsageLimitPerAccount is how often one account may redeem the
+	// promotion; 0 means unlimited.
+	UsageLimitPerAccount uint32
+	ValidFrom            time.Time
+	ValidUntil           time.Time
+	Active               bool
+	CreatedAt            time.Time
+}
+
+// Line is one priced order line a promotion is evaluated against.
+type Line struct {
+	ProductID string
+	Price     float64
+	Quantity  uint32
+}
+
+// Discount is the result of applying a promotion to an order.
+type Discount struct {
+	PromotionID string
+	Code        string
+	Description string
+	Amount      float64
+}
+
+// Validate checks that p is a well-formed promotion definition.
+func (p Promotion) Validate() error {
+	if p.Code == "" {
+		return fmt.Errorf("promotion code is required")
+	}
+	if p.MinSpend < 0 {
+		return fmt.Errorf("minimum spend cannot be negative")
+	}
+	if !p.ValidFrom.IsZero() && !p.ValidUntil.IsZero() && !p.ValidUntil.After(p.ValidFrom) {
+		return fmt.Errorf("validity window must end after it starts")
+	}
+
+	switch p.Kind {
+	case KindPercentage:
+		if p.Value <= 0 || p.Value > 100 {
+			return fmt.Errorf("percentage must be greater than 0 and at most 100")
+		}
+	case KindFixedAmount:
+		if p.Value <= 0 {
+			return fmt.Errorf("fixed amount must be greater than 0")
+		}
+	case KindBuyXGetY:
+		if p.BuyQuantity == 0 || p.GetQuantity == 0 {
+			return fmt.Errorf("buy and get quantities must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("unknown promotion kind %q", p.Kind)
+	}
+	return nil
+}
+
+// Evaluate applies p to the order lines at time now. uses is how often the
+// ordering account has already redeemed p. An error explains why the
+// promotion cannot be applied.
+func Evaluate(p Promotion, lines []Line, uses uint32, now time.Time) (*Discount, error) {
+	if !p.Active {
+		return nil, ErrInactive
+	}
+	if !p.ValidFrom.IsZero() && now.Before(p.ValidFrom) {
+		return nil, ErrNotYetValid
+	}
+	if !p.ValidUntil.IsZero() && !now.Before(p.ValidUntil) {
+		return nil, ErrExpired
+	}
+	if p.UsageLimitPerAccount > 0 && uses >= p.UsageLimitPerAccount {
+		return nil, ErrUsageLimitReached
+	}
+
+	subtotal := 0.0
+	for _, l := range lines {
+		subtotal += l.Price * float64(l.Quantity)
+	}
+	if subtotal < p.MinSpend {
+		return nil, ErrMinSpendNotMet
+	}
+
+	eligible := []Line{}
+	eligibleTotal := 0.0
+	for _, l := range lines {
+		if p.appliesTo(l.ProductID) {
+			eligible = append(eligible, l)
+			eligibleTotal += l.Price * float64(l.Quantity)
+		}
+	}
+	if eligibleTotal <= 0 {
+		return nil, ErrNotApplicable
+	}
+
+	amount := 0.0
+	switch p.Kind {
+	case KindPercentage:
+		amount = eligibleTotal * p.Value / 100
+	case KindFixedAmount:
+		amount = math.Min(p.Value, eligibleTotal)
+	case KindBuyXGetY:
+		group := p.BuyQuantity + p.GetQuantity
+		for _, l := range eligible {
+			free := l.Quantity / group * p.GetQuantity
+			amount += l.Price * float64(free)
+		}
+	default:
+		return nil, fmt.Errorf("unknown promotion kind %q", p.Kind)
+	}
+
+	amount = RoundCents(amount)
+	if amount <= 0 {
+		return nil, ErrNotApplicable
+	}
+
+	return &Discount{
+		PromotionID: p.ID,
+		Code:        p.Code,
+		Description: p.Description,
+		Amount:      amount,
+	}, nil
+}
+
+func (p Promotion) appliesTo(productID string) bool {
+	if len(p.ProductIDs) == 0 {
+		return true
+	}
+	for _, id := range p.ProductIDs {
+		if id == productID {
+			return true
+		}
+	}
+	return false
+}
+
+// RoundCents rounds an amount of money to two decimal places.
+func RoundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,175 @@
+package promotion
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	lines := []Line{
+		{ProductID: "book", Price: 10, Quantity: 3},
+		{ProductID: "pen", Price: 2.5, Quantity: 4},
+	}
+
+	tests := []struct {
+		name     string
+		p        Promotion
+		inactive bool
+		lines    []Line
+		uses     uint32
+		amount   float64
+		err      error
+	}{
+		{
+			name:   "percentage of every line",
+			p:      Promotion{Kind: KindPercentage, Value: 10},
+			amount: 4,
+		},
+		{
+			name:   "percentage of eligible products",
+			p:      Promotion{Kind: KindPercentage, Value: 15, ProductIDs: []string{"pen"}},
+			amount: 1.5,
+		},
+		{
+			name:   "percentage rounded to cents",
+			p:      Promotion{Kind: KindPercentage, Value: 33},
+			amount: 13.2,
+		},
+		{
+			name:   "fixed amount",
+			p:      Promotion{Kind: KindFixedAmount, Value: 5},
+			amount: 5,
+		},
+		{
+			name:   "fixed amount capped at the eligible lines",
+			p:      Promotion{Kind: KindFixedAmount, Value: 50, ProductIDs: []string{"pen"}},
+			amount: 10,
+		},
+		{
+			name:   "buy two get one",
+			p:      Promotion{Kind: KindBuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			amount: 12.5,
+		},
+		{
+			name:   "buy two get one of an eligible product",
+			p:      Promotion{Kind: KindBuyXGetY, BuyQuantity: 2, GetQuantity: 1, ProductIDs: []string{"book"}},
+			amount: 10,
+		},
+		{
+			name:  "buy three get two with too few units",
+			p:     Promotion{Kind: KindBuyXGetY, BuyQuantity: 3, GetQuantity: 2},
+			lines: []Line{{ProductID: "book", Price: 10, Quantity: 4}},
+			err:   ErrNotApplicable,
+		},
+		{
+			name:     "inactive",
+			p:        Promotion{Kind: KindFixedAmount, Value: 5},
+			inactive: true,
+			err:      ErrInactive,
+		},
+		{
+			name:   "inside the validity window",
+			p:      Promotion{Kind: KindFixedAmount, Value: 5, ValidFrom: now, ValidUntil: now.Add(time.Hour)},
+			amount: 5,
+		},
+		{
+			name: "before the validity window",
+			p:    Promotion{Kind: KindFixedAmount, Value: 5, ValidFrom: now.Add(time.Second)},
+			err:  ErrNotYetValid,
+		},
+		{
+			name: "at the end of the validity window",
+			p:    Promotion{Kind: KindFixedAmount, Value: 5, ValidUntil: now},
+			err:  ErrExpired,
+		},
+		{
+			name:   "minimum spend reached",
+			p:      Promotion{Kind: KindFixedAmount, Value: 5, MinSpend: 40},
+			amount: 5,
+		},
+		{
+			name: "minimum spend not reached",
+			p:    Promotion{Kind: KindFixedAmount, Value: 5, MinSpend: 40.01},
+			err:  ErrMinSpendNotMet,
+		},
+		{
+			name:   "minimum spend counts ineligible lines",
+			p:      Promotion{Kind: KindFixedAmount, Value: 5, MinSpend: 40, ProductIDs: []string{"pen"}},
+			amount: 5,
+		},
+		{
+			name:   "usage limit not reached",
+			p:      Promotion{Kind: KindFixedAmount, Value: 5, UsageLimitPerAccount: 2},
+			uses:   1,
+			amount: 5,
+		},
+		{
+			name: "usage limit reached",
+			p:    Promotion{Kind: KindFixedAmount, Value: 5, UsageLimitPerAccount: 2},
+			uses: 2,
+			err:  ErrUsageLimitReached,
+		},
+		{
+			name:   "no usage limit",
+			p:      Promotion{Kind: KindFixedAmount, Value: 5},
+			uses:   100,
+			amount: 5,
+		},
+		{
+			name: "no eligible product",
+			p:    Promotion{Kind: KindPercentage, Value: 10, ProductIDs: []string{"lamp"}},
+			err:  ErrNotApplicable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.p
+			p.ID, p.Code, p.Active = "promo", "PROMO", !tt.inactive
+			l := tt.lines
+			if l == nil {
+				l = lines
+			}
+
+			d, err := Evaluate(p, l, tt.uses, now)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Evaluate = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if d.Amount != tt.amount || d.PromotionID != "promo" || d.Code != "PROMO" {
+				t.Errorf("Evaluate = %+v, want an amount of %v", d, tt.amount)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		p     Promotion
+		valid bool
+	}{
+		{"percentage", Promotion{Code: "A", Kind: KindPercentage, Value: 100}, true},
+		{"percentage over 100", Promotion{Code: "A", Kind: KindPercentage, Value: 101}, false},
+		{"zero fixed amount", Promotion{Code: "A", Kind: KindFixedAmount}, false},
+		{"buy without get", Promotion{Code: "A", Kind: KindBuyXGetY, BuyQuantity: 2}, false},
+		{"missing code", Promotion{Kind: KindFixedAmount, Value: 5}, false},
+		{"negative minimum spend", Promotion{Code: "A", Kind: KindFixedAmount, Value: 5, MinSpend: -1}, false},
+		{"empty validity window", Promotion{Code: "A", Kind: KindFixedAmount, Value: 5, ValidFrom: now, ValidUntil: now}, false},
+		{"unknown kind", Promotion{Code: "A", Kind: "FREE"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.p.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package promotion
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Repository stores promotions in the order database, next to the orders
+// that redeem them.
+type Repository interface {
+	Close()
+	PutPromotion(ctx context.Context, p Promotion) error
+	UpdatePromotion(ctx context.Context, p Promotion) error
+	DeletePromotion(ctx context.Context, id string) error
+	GetPromotionByID(ctx context.Context, id string) (*Promotion, error)
+	GetPromotionByCode(ctx context.Context, code string) (*Promotion, error)
+	ListPromotions(ctx context.Context, skip uint64, take uint64) ([]Promotion, error)
+	CountRedemptions(ctx context.Context, promotionID string, accountID string) (uint32, error)
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+const promotionColumns = `id, code, description, kind, value, buy_quantity, get_quantity, product_ids,
+	min_spend, usage_limit_per_account, valid_from, valid_until, active, created_at`
+
+func NewPostgresRepository(url string) (Repository, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	err = db.Ping()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	return &postgresRepository{db}, nil
+}
+
+func (r *postgresRepository) Close() {
+	if r.db != nil {
+		r.db.Close()
+	}
+}
+
+func (r *postgresRepository) PutPromotion(ctx context.Context, p Promotion) error {
+	if p.ID == "" {
+		return fmt.Errorf("promotion ID is required")
+	}
+
+	_, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO promotions(`+promotionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		p.ID,
+		p.Code,
+		p.Description,
+		p.Kind,
+		p.Value,
+		p.BuyQuantity,
+		p.GetQuantity,
+		pq.Array(productIDs(p)),
+		p.MinSpend,
+		p.UsageLimitPerAccount,
+		nullTime(p.ValidFrom),
+		nullTime(p.ValidUntil),
+		p.Active,
+		p.CreatedAt,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return ErrCodeInUse
+		}
+		return fmt.Errorf("failed to insert promotion: %v", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) UpdatePromotion(ctx context.Context, p Promotion) error {
+	if p.ID == "" {
+		return fmt.Errorf("promotion ID is required")
+	}
+
+	res, err := r.db.ExecContext(
+		ctx,
+		`UPDATE promotions SET
+			code = $2,
+			description = $3,
+			kind = $4,
+			value = $5,
+			buy_quantity = $6,
+			get_quantity = $7,
+			product_ids = $8,
+			min_spend = $9,
+			usage_limit_per_account = $10,
+			valid_from = $11,
+			valid_until = $12,
+			active = $13
+		WHERE id = $1`,
+		p.ID,
+		p.Code,
+		p.Description,
+		p.Kind,
+		p.Value,
+		p.BuyQuantity,
+		p.GetQuantity,
+		pq.Array(productIDs(p)),
+		p.MinSpend,
+		p.UsageLimitPerAccount,
+		nullTime(p.ValidFrom),
+		nullTime(p.ValidUntil),
+		p.Active,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return ErrCodeInUse
+		}
+		return fmt.Errorf("failed to update promotion: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *postgresRepository) DeletePromotion(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM promotions WHERE id = $1", id)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
+			return fmt.Errorf("promotion %s has been redeemed and cannot be deleted; deactivate it instead", id)
+		}
+		return fmt.Errorf("failed to delete promotion: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetPromotionByID(ctx context.Context, id string) (*Promotion, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+promotionColumns+" FROM promotions WHERE id = $1", id)
+	return scanPromotion(row)
+}
+
+func (r *postgresRepository) GetPromotionByCode(ctx context.Context, code string) (*Promotion, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+promotionColumns+" FROM promotions WHERE code = $1", code)
+	return scanPromotion(row)
+}
+
+func (r *postgresRepository) ListPromotions(ctx context.Context, skip uint64, take uint64) ([]Promotion, error) {
+	// Validate pagination parameters
+	if take > 100 {
+		take = 100 // Enforce maximum limit
+	}
+	if take == 0 {
+		take = 10 // Default limit
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT "+promotionColumns+" FROM promotions ORDER BY created_at DESC, id OFFSET $1 LIMIT $2",
+		skip,
+		take,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query promotions: %v", err)
+	}
+	defer rows.Close()
+
+	promotions := []Promotion{}
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, *p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over promotion rows: %v", err)
+	}
+	return promotions, nil
+}
+
+// CountRedemptions counts the orders of accountID that redeemed the
+// promotion.
+func (r *postgresRepository) CountRedemptions(ctx context.Context, promotionID string, accountID string) (uint32, error) {
+	var n uint32
+	err := r.db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*)
+		FROM order_discounts d
+		JOIN orders o ON o.id = d.order_id
+		WHERE d.promotion_id = $1 AND o.account_id = $2`,
+		promotionID,
+		accountID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count redemptions: %v", err)
+	}
+	return n, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPromotion(row scanner) (*Promotion, error) {
+	p := &Promotion{}
+	var validFrom, validUntil sql.NullTime
+	var ids pq.StringArray
+	err := row.Scan(
+		&p.ID,
+		&p.Code,
+		&p.Description,
+		&p.Kind,
+		&p.Value,
+		&p.BuyQuantity,
+		&p.GetQuantity,
+		&ids,
+		&p.MinSpend,
+		&p.UsageLimitPerAccount,
+		&validFrom,
+		&validUntil,
+		&p.Active,
+		&p.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to scan promotion row: %v", err)
+	}
+	p.ProductIDs = ids
+	p.ValidFrom = validFrom.Time
+	p.ValidUntil = validUntil.Time
+	return p, nil
+}
+
+func productIDs(p Promotion) []string {
+	if p.ProductIDs == nil {
+		return []string{}
+	}
+	return p.ProductIDs
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
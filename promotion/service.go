@@ -0,0 +1,141 @@
+package promotion
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+type Service interface {
+	PostPromotion(ctx context.Context, p Promotion) (*Promotion, error)
+	UpdatePromotion(ctx context.Context, p Promotion) (*Promotion, error)
+	DeletePromotion(ctx context.Context, id string) error
+	GetPromotion(ctx context.Context, id string) (*Promotion, error)
+	GetPromotions(ctx context.Context, skip uint64, take uint64) ([]Promotion, error)
+	// Apply evaluates the promotion with the given coupon code for an order
+	// of accountID without redeeming it.
+	Apply(ctx context.Context, code string, accountID string, lines []Line) (*Discount, error)
+}
+
+type promotionService struct {
+	repository Repository
+}
+
+func NewService(r Repository) Service {
+	if r == nil {
+		panic("repository cannot be nil")
+	}
+	return &promotionService{r}
+}
+
+func (s *promotionService) PostPromotion(ctx context.Context, p Promotion) (*Promotion, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+
+	p.ID = ksuid.New().String()
+	p.Code = normalizeCode(p.Code)
+	p.CreatedAt = time.Now().UTC()
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.PutPromotion(ctx, p); err != nil {
+		if err == ErrCodeInUse {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create promotion: %v", err)
+	}
+	return &p, nil
+}
+
+func (s *promotionService) UpdatePromotion(ctx context.Context, p Promotion) (*Promotion, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if p.ID == "" {
+		return nil, fmt.Errorf("promotion ID is required")
+	}
+
+	p.Code = normalizeCode(p.Code)
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.UpdatePromotion(ctx, p); err != nil {
+		if err == ErrNotFound || err == ErrCodeInUse {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update promotion: %v", err)
+	}
+	return s.repository.GetPromotionByID(ctx, p.ID)
+}
+
+func (s *promotionService) DeletePromotion(ctx context.Context, id string) error {
+	if ctx == nil {
+		return fmt.Errorf("context is required")
+	}
+	if id == "" {
+		return fmt.Errorf("promotion ID is required")
+	}
+	return s.repository.DeletePromotion(ctx, id)
+}
+
+func (s *promotionService) GetPromotion(ctx context.Context, id string) (*Promotion, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if id == "" {
+		return nil, fmt.Errorf("promotion ID is required")
+	}
+	return s.repository.GetPromotionByID(ctx, id)
+}
+
+func (s *promotionService) GetPromotions(ctx context.Context, skip uint64, take uint64) ([]Promotion, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+
+	// Enforce pagination limits
+	if take > 100 || (skip == 0 && take == 0) {
+		take = 100
+	}
+
+	promotions, err := s.repository.ListPromotions(ctx, skip, take)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list promotions: %v", err)
+	}
+	return promotions, nil
+}
+
+func (s *promotionService) Apply(ctx context.Context, code string, accountID string, lines []Line) (*Discount, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if code == "" {
+		return nil, fmt.Errorf("coupon code is required")
+	}
+
+	p, err := s.repository.GetPromotionByCode(ctx, normalizeCode(code))
+	if err != nil {
+		return nil, err
+	}
+
+	uses := uint32(0)
+	if p.UsageLimitPerAccount > 0 {
+		uses, err = s.repository.CountRedemptions(ctx, p.ID, accountID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return Evaluate(*p, lines, uses, time.Now().UTC())
+}
+
+// Coupon codes are matched case-insensitively.
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"math"
+	"path"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// NewServerInterceptor enforces per-method quotas on unary RPCs. quotas
+// lists limits by method name, as in "PostOrder=10/s:20"; fallback is the
+// limit of the other methods, and leaves them unlimited when it is empty.
+// Each method has one bucket shared by all its callers. Calls over quota
+// fail with codes.ResourceExhausted and a "retry-after" header in seconds.
+func NewServerInterceptor(store Store, quotas string, fallback string) (grpc.UnaryServerInterceptor, error) {
+	if store == nil {
+		panic("rate limit store cannot be nil")
+	}
+	limits, err := ParseLimits(quotas)
+	if err != nil {
+		return nil, err
+	}
+	defaultLimit, err := ParseLimit(fallback)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		method := path.Base(info.FullMethod)
+		limit, ok := limits[method]
+		if !ok {
+			limit = defaultLimit
+		}
+
+		allowed, wait, err := store.Take(ctx, "grpc:"+info.FullMethod, limit)
+		if err != nil {
+			// Failing open keeps the service up when the store is not.
+			log.Printf("Error checking rate limit of %s: %v", method, err)
+			return handler(ctx, req)
+		}
+		if !allowed {
+			retryAfter := RetryAfter(wait)
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter))
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit of %s exceeded; retry after %s seconds", method, retryAfter)
+		}
+		return handler(ctx, req)
+	}, nil
+}
+
+// RetryAfter formats wait as whole seconds, rounded up, for a Retry-After
+// header.
+func RetryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// headerStream records the headers a handler sets.
+type headerStream struct {
+	method string
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string {
+	return s.method
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *headerStream) SetTrailer(md metadata.MD) error {
+	return nil
+}
+
+func TestServerInterceptor(t *testing.T) {
+	store, advance := testStore()
+	intercept, err := NewServerInterceptor(store, "PostOrder=1/m:2", "10/s")
+	if err != nil {
+		t.Fatalf("NewServerInterceptor: %v", err)
+	}
+
+	handled := 0
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled++
+		return "ok", nil
+	}
+	call := func(method string) (*headerStream, error) {
+		stream := &headerStream{method: method}
+		ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+		_, err := intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return stream, err
+	}
+
+	const postOrder = "/pb.OrderService/PostOrder"
+	for i := 0; i < 2; i++ {
+		if _, err := call(postOrder); err != nil {
+			t.Fatalf("call %d within the burst: %v", i+1, err)
+		}
+	}
+
+	// The bucket is empty; the next token comes back in a minute, of which
+	// 30s have passed.
+	advance(30 * time.Second)
+	stream, err := call(postOrder)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("call over quota = %v, want %v", err, codes.ResourceExhausted)
+	}
+	if got := stream.header.Get("retry-after"); len(got) != 1 || got[0] != "30" {
+		t.Errorf("retry-after = %v, want 30", got)
+	}
+	if handled != 2 {
+		t.Errorf("handler ran %d times, want 2", handled)
+	}
+
+	// Other methods have buckets of their own, with the fallback limit.
+	for i := 0; i < 10; i++ {
+		if _, err := call("/pb.OrderService/GetOrder"); err != nil {
+			t.Fatalf("GetOrder call %d: %v", i+1, err)
+		}
+	}
+	if _, err := call("/pb.OrderService/GetOrder"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("GetOrder call over the fallback limit = %v, want %v", err, codes.ResourceExhausted)
+	}
+
+	advance(30 * time.Second)
+	if _, err := call(postOrder); err != nil {
+		t.Errorf("call after the token came back: %v", err)
+	}
+}
+
+func TestServerInterceptorWithoutFallback(t *testing.T) {
+	store, _ := testStore()
+	intercept, err := NewServerInterceptor(store, "PostOrder=1/m", "")
+	if err != nil {
+		t.Fatalf("NewServerInterceptor: %v", err)
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb.OrderService/GetOrder"}
+	for i := 0; i < 100; i++ {
+		if _, err := intercept(context.Background(), nil, info, handler); err != nil {
+			t.Fatalf("call %d of a method without a limit: %v", i+1, err)
+		}
+	}
+
+	for _, quotas := range []string{"PostOrder", "PostOrder=often"} {
+		if _, err := NewServerInterceptor(store, quotas, ""); err == nil {
+			t.Errorf("NewServerInterceptor(%q) succeeded, want an error", quotas)
+		}
+	}
+}
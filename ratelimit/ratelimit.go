@@ -0,0 +1,172 @@
+// Package ratelimit throttles requests with token buckets.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket that refills at Rate tokens per second and holds at
+// most Burst tokens. Every request takes a token. The zero Limit does not
+// limit anything.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// ParseLimit parses a limit written as "<requests>/<s|m|h>[:<burst>]", for
+// example "10/s" or "30/m:5". The burst defaults to the number of requests.
+// An empty string is the zero Limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Limit{}, nil
+	}
+
+	rate, burst, hasBurst := strings.Cut(s, ":")
+	count, unit, ok := strings.Cut(rate, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: want <requests>/<s|m|h>[:<burst>]", s)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: requests must be a positive number", s)
+	}
+
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("invalid rate limit %q: unit must be s, m or h", s)
+	}
+
+	l := Limit{Rate: float64(n) / per.Seconds(), Burst: n}
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid rate limit %q: burst must be a positive number", s)
+		}
+	}
+	return l, nil
+}
+
+// ParseLimits parses a comma-separated list of "<name>=<limit>" pairs, such
+// as "PostOrder=10/s,GetProducts=100/s:200".
+func ParseLimits(s string) (map[string]Limit, error) {
+	limits := map[string]Limit{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, limit, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid rate limit %q: want <name>=<limit>", pair)
+		}
+		l, err := ParseLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		limits[strings.TrimSpace(name)] = l
+	}
+	return limits, nil
+}
+
+// Store keeps token buckets. Implementations must be safe for concurrent
+// use; a Store shared by several processes gives them a common limit.
+type Store interface {
+	// Take takes a token from the bucket of key, which follows limit. When
+	// the bucket is empty it returns false and how long until a token is
+	// available.
+	Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore keeps buckets in the memory of one process.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	limits    map[string]Limit
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// sweepInterval is how often buckets that have refilled are forgotten, so
+// keys that stop making requests do not use memory forever.
+const sweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   map[string]*bucket{},
+		limits:    map[string]Limit{},
+		now:       time.Now,
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	if limit.Unlimited() {
+		return true, 0, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	s.limits[key] = limit
+	b.refill(limit, now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration(math.Ceil((1 - b.tokens) / limit.Rate * float64(time.Second)))
+	return false, wait, nil
+}
+
+func (b *bucket) refill(limit Limit, now time.Time) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+	}
+	b.updated = now
+}
+
+// sweep forgets the buckets that are full again, since a missing bucket
+// starts full.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		limit := s.limits[key]
+		b.refill(limit, now)
+		if b.tokens >= float64(limit.Burst) {
+			delete(s.buckets, key)
+			delete(s.limits, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Limit
+		wantErr bool
+	}{
+		{"", Limit{}, false},
+		{"10/s", Limit{Rate: 10, Burst: 10}, false},
+		{"30/m:5", Limit{Rate: 0.5, Burst: 5}, false},
+		{" 3600/h ", Limit{Rate: 1, Burst: 3600}, false},
+		{"10", Limit{}, true},
+		{"0/s", Limit{}, true},
+		{"ten/s", Limit{}, true},
+		{"10/d", Limit{}, true},
+		{"10/s:0", Limit{}, true},
+		{"10/s:x", Limit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.s)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseLimit(%q) = %+v, want an error", tt.s, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, %v, want %+v", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits("PostOrder=10/s, GetProducts=100/s:200,")
+	if err != nil {
+		t.Fatalf("ParseLimits: %v", err)
+	}
+	want := map[string]Limit{
+		"PostOrder":   {Rate: 10, Burst: 10},
+		"GetProducts": {Rate: 100, Burst: 200},
+	}
+	if len(limits) != len(want) {
+		t.Errorf("ParseLimits = %v, want %v", limits, want)
+	}
+	for name, l := range want {
+		if limits[name] != l {
+			t.Errorf("limit of %s = %+v, want %+v", name, limits[name], l)
+		}
+	}
+
+	for _, s := range []string{"PostOrder", "=10/s", "PostOrder=10/d"} {
+		if _, err := ParseLimits(s); err == nil {
+			t.Errorf("ParseLimits(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+// testStore returns a memory store whose clock only moves when the returned
+// function is called.
+func testStore() (*MemoryStore, func(time.Duration)) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	s.lastSweep = now
+	return s, func(d time.Duration) { now = now.Add(d) }
+}
+
+// take takes a token, failing the test on a store error.
+func take(t *testing.T, s Store, key string, limit Limit) (bool, time.Duration) {
+	t.Helper()
+	allowed, wait, err := s.Take(context.Background(), key, limit)
+	if err != nil {
+		t.Fatalf("Take(%s): %v", key, err)
+	}
+	return allowed, wait
+}
+
+func TestMemoryStoreBurst(t *testing.T) {
+	s, _ := testStore()
+	limit := Limit{Rate: 1, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := take(t, s, "a", limit); !allowed {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	allowed, wait := take(t, s, "a", limit)
+	if allowed {
+		t.Fatal("request over the burst was allowed")
+	}
+	if wait != time.Second {
+		t.Errorf("wait = %v, want 1s", wait)
+	}
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	s, advance := testStore()
+	limit := Limit{Rate: 2, Burst: 2}
+	for i := 0; i < 2; i++ {
+		take(t, s, "a", limit)
+	}
+
+	// Half a token has come back after a quarter of a second.
+	advance(250 * time.Millisecond)
+	allowed, wait := take(t, s, "a", limit)
+	if allowed {
+		t.Fatal("request allowed with half a token")
+	}
+	if wait != 250*time.Millisecond {
+		t.Errorf("wait = %v, want 250ms", wait)
+	}
+
+	advance(250 * time.Millisecond)
+	if allowed, _ := take(t, s, "a", limit); !allowed {
+		t.Fatal("request refused after a token came back")
+	}
+
+	// A bucket never holds more than its burst, however long it waited.
+	advance(time.Hour)
+	for i := 0; i < 2; i++ {
+		if allowed, _ := take(t, s, "a", limit); !allowed {
+			t.Fatalf("request %d after an hour was refused", i+1)
+		}
+	}
+	if allowed, _ := take(t, s, "a", limit); allowed {
+		t.Error("request over the burst allowed after an hour")
+	}
+}
+
+func TestMemoryStoreKeysAreIsolated(t *testing.T) {
+	s, _ := testStore()
+	limit := Limit{Rate: 1, Burst: 1}
+
+	if allowed, _ := take(t, s, "a", limit); !allowed {
+		t.Fatal("first request of a was refused")
+	}
+	if allowed, _ := take(t, s, "a", limit); allowed {
+		t.Fatal("second request of a was allowed")
+	}
+	if allowed, _ := take(t, s, "b", limit); !allowed {
+		t.Error("first request of b was refused after a used its bucket")
+	}
+}
+
+func TestMemoryStoreUnlimited(t *testing.T) {
+	s, _ := testStore()
+	for i := 0; i < 100; i++ {
+		if allowed, _ := take(t, s, "a", Limit{}); !allowed {
+			t.Fatalf("request %d refused without a limit", i+1)
+		}
+	}
+	if len(s.buckets) != 0 {
+		t.Errorf("store keeps %d buckets without a limit, want none", len(s.buckets))
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s, advance := testStore()
+	take(t, s, "idle", Limit{Rate: 1, Burst: 1})
+	take(t, s, "slow", Limit{Rate: 1.0 / 3600, Burst: 1})
+
+	// After the sweep interval, the idle bucket is full again and forgotten;
+	// the slow one still has to refill.
+	advance(sweepInterval)
+	take(t, s, "other", Limit{Rate: 1, Burst: 1})
+	if _, ok := s.buckets["idle"]; ok {
+		t.Error("full bucket was not swept")
+	}
+	if _, ok := s.buckets["slow"]; !ok {
+		t.Error("bucket still refilling was swept")
+	}
+	if allowed, _ := take(t, s, "slow", Limit{Rate: 1.0 / 3600, Burst: 1}); allowed {
+		t.Error("sweeping gave the slow bucket its token back early")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want string
+	}{
+		{0, "1"},
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{time.Minute, "60"},
+	}
+	for _, tt := range tests {
+		if got := RetryAfter(tt.wait); got != tt.want {
+			t.Errorf("RetryAfter(%v) = %q, want %q", tt.wait, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package review
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/donaldnash/go-marketplace/grpcclient"
+	"github.com/donaldnash/go-marketplace/review/pb"
+	"google.golang.org/grpc"
+)
+
+type Client struct {
+	conn    *grpc.ClientConn
+	service pb.ReviewServiceClient
+}
+
+// readMethods are the methods retried while the review service is unavailable.
+var readMethods = []string{
+	"GetReview",
+	"GetProductReviews",
+	"GetReviewsByStatus",
+}
+
+// NewClient returns a client of the review service at url with the default
+// options. It does not wait for the service to be up.
+func NewClient(url string) (*Client, error) {
+	return NewClientWithOptions(url, grpcclient.DefaultOptions())
+}
+
+func NewClientWithOptions(url string, o grpcclient.Options) (*Client, error) {
+	if url == "" {
+		return nil, fmt.Errorf("review service URL cannot be empty")
+	}
+
+	conn, err := grpcclient.Dial(url, pb.ReviewService_ServiceDesc.ServiceName, readMethods, o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create review service client: %v", err)
+	}
+	c := pb.NewReviewServiceClient(conn)
+	return &Client{conn, c}, nil
+}
+
+func (c *Client) Close() {
+	c.conn.Close()
+}
+
+func (c *Client) PostReview(ctx context.Context, rv Review) (*Review, error) {
+	r, err := c.service.PostReview(ctx, &pb.PostReviewRequest{
+		ProductId: rv.ProductID,
+		AccountId: rv.AccountID,
+		Rating:    uint32(rv.Rating),
+		Title:     rv.Title,
+		Body:      rv.Body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	posted := reviewFromProto(r.Review)
+	return &posted, nil
+}
+
+func (c *Client) GetReview(ctx context.Context, id string) (*Review, error) {
+	r, err := c.service.GetReview(ctx, &pb.GetReviewRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	rv := reviewFromProto(r.Review)
+	return &rv, nil
+}
+
+func (c *Client) GetProductReviews(ctx context.Context, productID string, skip uint64, take uint64) ([]Review, error) {
+	r, err := c.service.GetProductReviews(ctx, &pb.GetProductReviewsRequest{ProductId: productID, Skip: skip, Take: take})
+	if err != nil {
+		return nil, err
+	}
+	return reviewsFromProto(r.Reviews), nil
+}
+
+func (c *Client) GetReviewsByStatus(ctx context.Context, status Status, skip uint64, take uint64) ([]Review, error) {
+	r, err := c.service.GetReviewsByStatus(ctx, &pb.GetReviewsByStatusRequest{Status: string(status), Skip: skip, Take: take})
+	if err != nil {
+		return nil, err
+	}
+	return reviewsFromProto(r.Reviews), nil
+}
+
+func (c *Client) ModerateReview(ctx context.Context, id string, status Status, note string) (*Review, error) {
+	r, err := c.service.ModerateReview(ctx, &pb.ModerateReviewRequest{Id: id, Status: string(status), Note: note})
+	if err != nil {
+		return nil, err
+	}
+	rv := reviewFromProto(r.Review)
+	return &rv, nil
+}
+
+func (c *Client) VoteHelpful(ctx context.Context, reviewID string, accountID string) (*Review, error) {
+	r, err := c.service.VoteHelpful(ctx, &pb.VoteHelpfulRequest{ReviewId: reviewID, AccountId: accountID})
+	if err != nil {
+		return nil, err
+	}
+	rv := reviewFromProto(r.Review)
+	return &rv, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/grpcclient"
+	"github.com/donaldnash/go-marketplace/migrate"
+	"github.com/donaldnash/go-marketplace/order"
+	"github.com/donaldnash/go-marketplace/outbox"
+	"github.com/donaldnash/go-marketplace/ratelimit"
+	"github.com/donaldnash/go-marketplace/review"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tinrab/retry"
+	"google.golang.org/grpc"
+)
+
+type MigrateConfig struct {
+	DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
+}
+
+type Config struct {
+	DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
+	OrderURL    string `envconfig:"ORDER_SERVICE_URL" required:"true"`
+	CatalogURL  string `envconfig:"CATALOG_SERVICE_URL" required:"true"`
+	Port        int    `envconfig:"PORT" default:"8085"`
+	AutoMigrate bool   `envconfig:"AUTO_MIGRATE" default:"false"`
+	// How often moderated ratings are sent to the catalog
+	RatingSyncInterval time.Duration `envconfig:"RATING_SYNC_INTERVAL" default:"5s"`
+	// Per-method gRPC quotas such as "PostReview=5/s:10"; other methods get
+	// RATE_LIMIT_DEFAULT, or no limit when it is empty
+	RateLimits       string `envconfig:"RATE_LIMITS"`
+	RateLimitDefault string `envconfig:"RATE_LIMIT_DEFAULT"`
+	outbox.Config
+	grpcclient.Options
+}
+
+func main() {
+	// Initialize logger
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	log.Println("Starting Review service...")
+
+	// Load configuration
+	var cfg Config
+	if err := envconfig.Process("", &cfg); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	log.Printf("Configuration loaded:\n  Database URL: %s\n  Order URL: %s\n  Catalog URL: %s\n  Port: %d\n  Auto migrate: %t\n  Rating sync interval: %s\n  Event publisher: %s",
+		cfg.DatabaseURL, cfg.OrderURL, cfg.CatalogURL, cfg.Port, cfg.AutoMigrate, cfg.RatingSyncInterval, cfg.Publisher)
+
+	// Apply pending schema migrations
+	if cfg.AutoMigrate {
+		applyMigrations(cfg.DatabaseURL)
+	}
+
+	// Initialize repository with retry
+	var repository review.Repository
+	var err error
+
+	log.Println("Connecting to database...")
+	retry.ForeverSleep(2*time.Second, func(_ int) error {
+		repository, err = review.NewPostgresRepository(cfg.DatabaseURL)
+		if err != nil {
+			log.Printf("Failed to connect to database: %v", err)
+			return err
+		}
+		return nil
+	})
+	defer repository.Close()
+
+	log.Println("Successfully connected to database")
+
+	// Relay domain events from the outbox
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	startRelay(relayCtx, cfg.DatabaseURL, cfg.Config)
+
+	// Clients of the services that own orders and products connect on
+	// first use, so they can start after this service
+	orderClient, err := order.NewClientWithOptions(cfg.OrderURL, cfg.Options)
+	if err != nil {
+		log.Fatalf("Failed to create order client: %v", err)
+	}
+	defer orderClient.Close()
+
+	catalogClient, err := catalog.NewClientWithOptions(cfg.CatalogURL, cfg.Options)
+	if err != nil {
+		log.Fatalf("Failed to create catalog client: %v", err)
+	}
+	defer catalogClient.Close()
+
+	// Send product ratings to the catalog
+	go review.NewRatingSync(repository, catalogClient, cfg.RatingSyncInterval).Run(relayCtx)
+
+	// Create service
+	service := review.NewService(repository, orderClient)
+
+	// Handle graceful shutdown
+	done := make(chan bool)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-quit
+		log.Println("Service is shutting down...")
+		stopRelay()
+		repository.Close()
+		close(done)
+	}()
+
+	limiter, err := ratelimit.NewServerInterceptor(ratelimit.NewMemoryStore(), cfg.RateLimits, cfg.RateLimitDefault)
+	if err != nil {
+		log.Fatalf("Failed to configure rate limits: %v", err)
+	}
+
+	// Start gRPC server
+	log.Printf("Starting gRPC server on port %d...", cfg.Port)
+	if err := review.ListenGRPC(service, cfg.Port, grpc.UnaryInterceptor(limiter)); err != nil {
+		log.Fatalf("Failed to start gRPC server: %v", err)
+	}
+
+	<-done
+	log.Println("Service stopped")
+}
+func startRelay(ctx context.Context, databaseURL string, cfg outbox.Config) {
+	publisher, err := outbox.NewPublisher(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create event publisher: %v", err)
+	}
+
+	var store outbox.Store
+	retry.ForeverSleep(2*time.Second, func(_ int) error {
+		store, err = outbox.NewPostgresStore(databaseURL)
+		if err != nil {
+			log.Printf("Failed to connect to outbox: %v", err)
+			return err
+		}
+		return nil
+	})
+
+	go func() {
+		defer store.Close()
+		defer publisher.Close()
+		outbox.NewRelay(store, publisher, cfg.PollInterval).Run(ctx)
+	}()
+}
+
+func runMigrate(args []string) {
+	var cfg MigrateConfig
+	if err := envconfig.Process("", &cfg); err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	m, err := migrate.Open(cfg.DatabaseURL, review.Migrations())
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer m.Close()
+
+	if err := migrate.Run(context.Background(), m, args, os.Stdout); err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
+
+func applyMigrations(databaseURL string) {
+	var m *migrate.Migrator
+	var err error
+
+	log.Println("Applying database migrations...")
+	retry.ForeverSleep(2*time.Second, func(_ int) error {
+		m, err = migrate.Open(databaseURL, review.Migrations())
+		if err != nil {
+			log.Printf("Failed to connect to database: %v", err)
+			return err
+		}
+		return nil
+	})
+	defer m.Close()
+
+	applied, err := m.Up(context.Background())
+	for _, mig := range applied {
+		log.Printf("Applied migration %04d_%s", mig.Version, mig.Name)
+	}
+	if err != nil {
+		log.Fatalf("Failed to apply migrations: %v", err)
+	}
+}
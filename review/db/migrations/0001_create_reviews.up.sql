@@ -0,0 +1,28 @@
+-- An account reviews a product at most once. Reviews wait in PENDING until a
+-- moderator approves or rejects them; only approved reviews are shown and
+-- count towards the product's rating.
+CREATE TABLE IF NOT EXISTS reviews (
+    id VARCHAR PRIMARY KEY,
+    product_id VARCHAR NOT NULL,
+    account_id VARCHAR NOT NULL,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    title VARCHAR NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR NOT NULL DEFAULT 'PENDING',
+    moderation_note VARCHAR NOT NULL DEFAULT '',
+    helpful_votes INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS reviews_account_product_idx ON reviews(account_id, product_id);
+CREATE INDEX IF NOT EXISTS reviews_product_idx ON reviews(product_id, status);
+CREATE INDEX IF NOT EXISTS reviews_status_idx ON reviews(status, created_at);
+
+-- One helpful vote per account per review.
+CREATE TABLE IF NOT EXISTS review_votes (
+    review_id VARCHAR NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    account_id VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (review_id, account_id)
+);
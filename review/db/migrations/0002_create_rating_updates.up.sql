@@ -0,0 +1,10 @@
+-- Products whose rating has to be sent to the catalog again. A row is queued
+-- in the same transaction as the review change that moved the rating, and is
+-- dropped once the catalog has the rating of its latest version.
+CREATE TABLE IF NOT EXISTS rating_updates (
+    product_id VARCHAR PRIMARY KEY,
+    version BIGINT NOT NULL DEFAULT 1,
+    queued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS rating_updates_queued_at_idx ON rating_updates(queued_at);
@@ -0,0 +1,130 @@
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/outbox"
+)
+
+// EventRatingChanged is what the rating queue looks like to the outbox relay
+// that empties it. These events are only handed to the catalog; they are not
+// published to the event publisher.
+const EventRatingChanged = "RatingChanged"
+
+// RatingIndex stores the rating of products where search can sort and filter
+// by it. *catalog.Client implements it.
+type RatingIndex interface {
+	SetProductRating(ctx context.Context, productID string, rating catalog.Rating) error
+}
+
+// RatingSync sends the ratings of the products queued by moderation to the
+// catalog. It is an outbox relay over the queue, so a product leaves the
+// queue only after the catalog took its rating, and ratings catch up after a
+// catalog outage.
+type RatingSync struct {
+	relay *outbox.Relay
+}
+
+func NewRatingSync(r Repository, index RatingIndex, interval time.Duration) *RatingSync {
+	if r == nil {
+		panic("repository cannot be nil")
+	}
+	if index == nil {
+		panic("rating index cannot be nil")
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &RatingSync{outbox.NewRelay(ratingQueue{r}, ratingPublisher{index}, interval)}
+}
+
+// Run flushes the queue every interval until ctx is done.
+func (s *RatingSync) Run(ctx context.Context) {
+	s.relay.Run(ctx)
+}
+
+// Flush sends every queued rating to the catalog and returns how many were
+// sent. Products the catalog no longer has are dropped from the queue.
+func (s *RatingSync) Flush(ctx context.Context) (int, error) {
+	return s.relay.Flush(ctx)
+}
+
+// ratingEvent is the payload of an EventRatingChanged event.
+type ratingEvent struct {
+	Rating  catalog.Rating `json:"rating"`
+	Version int64          `json:"version"`
+}
+
+// ratingQueue is the rating queue of a repository as an outbox.Store.
+type ratingQueue struct {
+	repository Repository
+}
+
+func (q ratingQueue) Close() {}
+
+func (q ratingQueue) Pending(ctx context.Context, limit int) ([]outbox.Event, error) {
+	updates, err := q.repository.PendingRatings(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]outbox.Event, len(updates))
+	for i, u := range updates {
+		payload, err := json.Marshal(ratingEvent{Rating: u.Rating, Version: u.version})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal rating of product %s: %v", u.ProductID, err)
+		}
+		events[i] = outbox.Event{
+			ID:          fmt.Sprintf("%s/%d", u.ProductID, u.version),
+			Type:        EventRatingChanged,
+			AggregateID: u.ProductID,
+			Payload:     payload,
+		}
+	}
+	return events, nil
+}
+
+func (q ratingQueue) MarkPublished(ctx context.Context, events []outbox.Event) error {
+	updates := make([]RatingUpdate, len(events))
+	for i, e := range events {
+		r, err := decodeRatingEvent(e)
+		if err != nil {
+			return err
+		}
+		updates[i] = RatingUpdate{ProductID: e.AggregateID, Rating: r.Rating, version: r.Version}
+	}
+	return q.repository.MarkRatingsSynced(ctx, updates)
+}
+
+// ratingPublisher publishes ratings to the catalog.
+type ratingPublisher struct {
+	index RatingIndex
+}
+
+func (p ratingPublisher) Publish(ctx context.Context, e outbox.Event) error {
+	r, err := decodeRatingEvent(e)
+	if err != nil {
+		return err
+	}
+	err = p.index.SetProductRating(ctx, e.AggregateID, r.Rating)
+	if err != nil && !strings.Contains(err.Error(), catalog.ErrNotFound.Error()) {
+		return fmt.Errorf("failed to set rating of product %s: %v", e.AggregateID, err)
+	}
+	return nil
+}
+
+func (p ratingPublisher) Close() error {
+	return nil
+}
+
+func decodeRatingEvent(e outbox.Event) (ratingEvent, error) {
+	r := ratingEvent{}
+	if err := json.Unmarshal(e.Payload, &r); err != nil {
+		return r, fmt.Errorf("failed to unmarshal rating of product %s: %v", e.AggregateID, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,99 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/catalog"
+)
+
+// memoryRatings queues rating updates in memory. Methods the tests do not use
+// are left to the nil Repository.
+type memoryRatings struct {
+	Repository
+
+	mu     sync.Mutex
+	queued []RatingUpdate
+}
+
+func (r *memoryRatings) PendingRatings(ctx context.Context, limit int) ([]RatingUpdate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RatingUpdate{}, r.queued[:min(limit, len(r.queued))]...), nil
+}
+
+func (r *memoryRatings) MarkRatingsSynced(ctx context.Context, updates []RatingUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range updates {
+		for i, q := range r.queued {
+			// A product queued again since has a newer version and stays.
+			if q.ProductID == u.ProductID && q.version == u.version {
+				r.queued = append(r.queued[:i], r.queued[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// memoryIndex records the ratings it is given and fails for products in
+// down.
+type memoryIndex struct {
+	ratings map[string]catalog.Rating
+	down    map[string]bool
+}
+
+func (x *memoryIndex) SetProductRating(ctx context.Context, productID string, rating catalog.Rating) error {
+	if x.down[productID] {
+		return errors.New("catalog is unavailable")
+	}
+	if productID == "gone" {
+		return fmt.Errorf("rpc error: %v", catalog.ErrNotFound)
+	}
+	x.ratings[productID] = rating
+	return nil
+}
+
+func TestRatingSyncFlush(t *testing.T) {
+	ctx := context.Background()
+	repository := &memoryRatings{queued: []RatingUpdate{
+		{ProductID: "p1", Rating: catalog.Rating{Average: 4, Count: 2}, version: 3},
+		{ProductID: "gone", Rating: catalog.Rating{Average: 5, Count: 1}, version: 1},
+		{ProductID: "p2", Rating: catalog.Rating{Average: 2.5, Count: 4}, version: 7},
+		{ProductID: "p3", Rating: catalog.Rating{Average: 1, Count: 1}, version: 2},
+	}}
+	index := &memoryIndex{ratings: map[string]catalog.Rating{}, down: map[string]bool{"p2": true}}
+	s := NewRatingSync(repository, index, time.Minute)
+
+	// The rating of p2 cannot be set, so it and the ratings queued after it
+	// stay in the queue. A product the catalog no longer has is dropped.
+	n, err := s.Flush(ctx)
+	if err == nil {
+		t.Fatal("Flush succeeded while the catalog failed for p2")
+	}
+	if n != 2 {
+		t.Errorf("Flush synced %d ratings, want 2", n)
+	}
+	if got := index.ratings["p1"]; got != (catalog.Rating{Average: 4, Count: 2}) {
+		t.Errorf("rating of p1 = %+v, want 4 from 2 reviews", got)
+	}
+	if len(repository.queued) != 2 || repository.queued[0].ProductID != "p2" || repository.queued[0].version != 7 {
+		t.Fatalf("queue = %+v, want p2 and p3", repository.queued)
+	}
+
+	index.down = nil
+	if n, err := s.Flush(ctx); err != nil || n != 2 {
+		t.Fatalf("Flush = %d, %v, want 2 ratings synced", n, err)
+	}
+	if len(repository.queued) != 0 {
+		t.Errorf("queue = %+v, want it empty", repository.queued)
+	}
+	if got := index.ratings["p3"]; got != (catalog.Rating{Average: 1, Count: 1}) {
+		t.Errorf("rating of p3 = %+v, want 1 from 1 review", got)
+	}
+}
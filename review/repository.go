@@ -0,0 +1,340 @@
+package review
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/donaldnash/go-marketplace/outbox"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	Close()
+	PutReview(ctx context.Context, r Review) error
+	GetReview(ctx context.Context, id string) (*Review, error)
+	ListProductReviews(ctx context.Context, productID string, skip uint64, take uint64) ([]Review, error)
+	ListReviewsByStatus(ctx context.Context, status Status, skip uint64, take uint64) ([]Review, error)
+	// UpdateReviewStatus moderates a review and, when that adds it to or
+	// takes it out of the approved reviews, queues its product's rating for
+	// the catalog in the same transaction.
+	UpdateReviewStatus(ctx context.Context, id string, status Status, note string, at time.Time) (*Review, error)
+	// PutVote records a helpful vote and returns the review with its new
+	// count. A repeated vote leaves the count as it is.
+	PutVote(ctx context.Context, reviewID string, accountID string) (*Review, error)
+	// PendingRatings returns up to limit queued products, oldest first, with
+	// their current rating.
+	PendingRatings(ctx context.Context, limit int) ([]RatingUpdate, error)
+	// MarkRatingsSynced drops updates from the queue, unless their product
+	// was queued again in the meantime.
+	MarkRatingsSynced(ctx context.Context, updates []RatingUpdate) error
+}
+
+// RatingUpdate is the rating a product has to be given in the catalog.
+type RatingUpdate struct {
+	ProductID string
+	Rating    catalog.Rating
+	version   int64
+}
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(url string) (Repository, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	err = db.Ping()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	return &postgresRepository{db}, nil
+}
+
+func (r *postgresRepository) Close() {
+	if r.db != nil {
+		r.db.Close()
+	}
+}
+
+const reviewColumns = "id, product_id, account_id, rating, title, body, status, moderation_note, helpful_votes, created_at, updated_at"
+
+// PutReview stores rv and records a ReviewPosted event in the same
+// transaction.
+func (r *postgresRepository) PutReview(ctx context.Context, rv Review) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO reviews("+reviewColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		rv.ID,
+		rv.ProductID,
+		rv.AccountID,
+		rv.Rating,
+		rv.Title,
+		rv.Body,
+		rv.Status,
+		rv.ModerationNote,
+		rv.HelpfulVotes,
+		rv.CreatedAt,
+		rv.UpdatedAt,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return ErrAlreadyReviewed
+		}
+		return fmt.Errorf("failed to insert review: %v", err)
+	}
+
+	e, err := outbox.NewEvent(EventReviewPosted, rv.ID, rv)
+	if err != nil {
+		return err
+	}
+	if err := outbox.Insert(ctx, tx, e); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetReview(ctx context.Context, id string) (*Review, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+reviewColumns+" FROM reviews WHERE id = $1", id)
+	rv, err := scanReview(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrReviewNotFound
+	}
+	return rv, err
+}
+
+func (r *postgresRepository) ListProductReviews(ctx context.Context, productID string, skip uint64, take uint64) ([]Review, error) {
+	return r.listReviews(
+		ctx,
+		"SELECT "+reviewColumns+` FROM reviews
+		WHERE product_id = $1 AND status = $2
+		ORDER BY helpful_votes DESC, created_at DESC, id
+		OFFSET $3 LIMIT $4`,
+		productID,
+		StatusApproved,
+		skip,
+		take,
+	)
+}
+
+func (r *postgresRepository) ListReviewsByStatus(ctx context.Context, status Status, skip uint64, take uint64) ([]Review, error) {
+	return r.listReviews(
+		ctx,
+		"SELECT "+reviewColumns+" FROM reviews WHERE status = $1 ORDER BY created_at, id OFFSET $2 LIMIT $3",
+		status,
+		skip,
+		take,
+	)
+}
+
+func (r *postgresRepository) listReviews(ctx context.Context, query string, args ...interface{}) ([]Review, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reviews: %v", err)
+	}
+	defer rows.Close()
+
+	reviews := []Review{}
+	for rows.Next() {
+		rv, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, *rv)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over review rows: %v", err)
+	}
+	return reviews, nil
+}
+
+func (r *postgresRepository) UpdateReviewStatus(ctx context.Context, id string, status Status, note string, at time.Time) (*Review, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rv, err := scanReview(tx.QueryRowContext(ctx, "SELECT "+reviewColumns+" FROM reviews WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrReviewNotFound
+		}
+		return nil, err
+	}
+	wasApproved := rv.Status == StatusApproved
+
+	rv.Status = status
+	rv.ModerationNote = note
+	rv.UpdatedAt = at
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE reviews SET status = $2, moderation_note = $3, updated_at = $4 WHERE id = $1",
+		rv.ID,
+		rv.Status,
+		rv.ModerationNote,
+		rv.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update review: %v", err)
+	}
+
+	if wasApproved != (status == StatusApproved) {
+		if err := queueRating(ctx, tx, rv.ProductID); err != nil {
+			return nil, err
+		}
+	}
+
+	e, err := outbox.NewEvent(EventReviewModerated, rv.ID, rv)
+	if err != nil {
+		return nil, err
+	}
+	if err := outbox.Insert(ctx, tx, e); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return rv, nil
+}
+
+func queueRating(ctx context.Context, tx *sql.Tx, productID string) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO rating_updates(product_id, version, queued_at) VALUES ($1, 1, NOW())
+		ON CONFLICT (product_id) DO UPDATE SET version = rating_updates.version + 1`,
+		productID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to queue rating update: %v", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) PutVote(ctx context.Context, reviewID string, accountID string) (*Review, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO review_votes(review_id, account_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		reviewID,
+		accountID,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
+			return nil, ErrReviewNotFound
+		}
+		return nil, fmt.Errorf("failed to insert vote: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to insert vote: %v", err)
+	} else if n > 0 {
+		_, err = tx.ExecContext(ctx, "UPDATE reviews SET helpful_votes = helpful_votes + 1 WHERE id = $1", reviewID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count vote: %v", err)
+		}
+	}
+
+	rv, err := scanReview(tx.QueryRowContext(ctx, "SELECT "+reviewColumns+" FROM reviews WHERE id = $1", reviewID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrReviewNotFound
+		}
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return rv, nil
+}
+
+func (r *postgresRepository) PendingRatings(ctx context.Context, limit int) ([]RatingUpdate, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT u.product_id, u.version, COALESCE(AVG(r.rating), 0), COUNT(r.id)
+		FROM rating_updates u
+		LEFT JOIN reviews r ON r.product_id = u.product_id AND r.status = $1
+		GROUP BY u.product_id, u.version, u.queued_at
+		ORDER BY u.queued_at, u.product_id
+		LIMIT $2`,
+		StatusApproved,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rating updates: %v", err)
+	}
+	defer rows.Close()
+
+	updates := []RatingUpdate{}
+	for rows.Next() {
+		u := RatingUpdate{}
+		if err := rows.Scan(&u.ProductID, &u.version, &u.Rating.Average, &u.Rating.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan rating update row: %v", err)
+		}
+		updates = append(updates, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rating update rows: %v", err)
+	}
+	return updates, nil
+}
+
+func (r *postgresRepository) MarkRatingsSynced(ctx context.Context, updates []RatingUpdate) error {
+	for _, u := range updates {
+		_, err := r.db.ExecContext(
+			ctx,
+			"DELETE FROM rating_updates WHERE product_id = $1 AND version = $2",
+			u.ProductID,
+			u.version,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to delete rating update: %v", err)
+		}
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReview(row scanner) (*Review, error) {
+	rv := &Review{}
+	err := row.Scan(
+		&rv.ID,
+		&rv.ProductID,
+		&rv.AccountID,
+		&rv.Rating,
+		&rv.Title,
+		&rv.Body,
+		&rv.Status,
+		&rv.ModerationNote,
+		&rv.HelpfulVotes,
+		&rv.CreatedAt,
+		&rv.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan review row: %v", err)
+	}
+	return rv, nil
+}
@@ -0,0 +1,134 @@
+package review
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/donaldnash/go-marketplace/review/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+type grpcServer struct {
+	service Service
+	pb.UnimplementedReviewServiceServer
+}
+
+func ListenGRPC(s Service, port int, opts ...grpc.ServerOption) error {
+	list, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	serv := grpc.NewServer(opts...)
+	pb.RegisterReviewServiceServer(serv, &grpcServer{service: s})
+	reflection.Register(serv)
+	return serv.Serve(list)
+}
+
+func (s *grpcServer) PostReview(ctx context.Context, r *pb.PostReviewRequest) (*pb.PostReviewResponse, error) {
+	rv, err := s.service.PostReview(ctx, Review{
+		ProductID: r.ProductId,
+		AccountID: r.AccountId,
+		Rating:    int(r.Rating),
+		Title:     r.Title,
+		Body:      r.Body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PostReviewResponse{Review: reviewToProto(*rv)}, nil
+}
+
+func (s *grpcServer) GetReview(ctx context.Context, r *pb.GetReviewRequest) (*pb.GetReviewResponse, error) {
+	rv, err := s.service.GetReview(ctx, r.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetReviewResponse{Review: reviewToProto(*rv)}, nil
+}
+
+func (s *grpcServer) GetProductReviews(ctx context.Context, r *pb.GetProductReviewsRequest) (*pb.GetProductReviewsResponse, error) {
+	reviews, err := s.service.GetProductReviews(ctx, r.ProductId, r.Skip, r.Take)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetProductReviewsResponse{Reviews: reviewsToProto(reviews)}, nil
+}
+
+func (s *grpcServer) GetReviewsByStatus(ctx context.Context, r *pb.GetReviewsByStatusRequest) (*pb.GetReviewsByStatusResponse, error) {
+	reviews, err := s.service.GetReviewsByStatus(ctx, Status(r.Status), r.Skip, r.Take)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetReviewsByStatusResponse{Reviews: reviewsToProto(reviews)}, nil
+}
+
+func (s *grpcServer) ModerateReview(ctx context.Context, r *pb.ModerateReviewRequest) (*pb.ModerateReviewResponse, error) {
+	rv, err := s.service.ModerateReview(ctx, r.Id, Status(r.Status), r.Note)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ModerateReviewResponse{Review: reviewToProto(*rv)}, nil
+}
+
+func (s *grpcServer) VoteHelpful(ctx context.Context, r *pb.VoteHelpfulRequest) (*pb.VoteHelpfulResponse, error) {
+	rv, err := s.service.VoteHelpful(ctx, r.ReviewId, r.AccountId)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.VoteHelpfulResponse{Review: reviewToProto(*rv)}, nil
+}
+
+func reviewToProto(r Review) *pb.Review {
+	pr := &pb.Review{
+		Id:             r.ID,
+		ProductId:      r.ProductID,
+		AccountId:      r.AccountID,
+		Rating:         uint32(r.Rating),
+		Title:          r.Title,
+		Body:           r.Body,
+		Status:         string(r.Status),
+		ModerationNote: r.ModerationNote,
+		HelpfulVotes:   uint32(r.HelpfulVotes),
+	}
+	pr.CreatedAt, _ = r.CreatedAt.MarshalBinary()
+	pr.UpdatedAt, _ = r.UpdatedAt.MarshalBinary()
+	return pr
+}
+
+func reviewsToProto(reviews []Review) []*pb.Review {
+	pr := make([]*pb.Review, len(reviews))
+	for i, r := range reviews {
+		pr[i] = reviewToProto(r)
+	}
+	return pr
+}
+
+func reviewFromProto(pr *pb.Review) Review {
+	if pr == nil {
+		return Review{}
+	}
+	r := Review{
+		ID:             pr.Id,
+		ProductID:      pr.ProductId,
+		AccountID:      pr.AccountId,
+		Rating:         int(pr.Rating),
+		Title:          pr.Title,
+		Body:           pr.Body,
+		Status:         Status(pr.Status),
+		ModerationNote: pr.ModerationNote,
+		HelpfulVotes:   int(pr.HelpfulVotes),
+	}
+	r.CreatedAt.UnmarshalBinary(pr.CreatedAt)
+	r.UpdatedAt.UnmarshalBinary(pr.UpdatedAt)
+	return r
+}
+
+func reviewsFromProto(pr []*pb.Review) []Review {
+	reviews := make([]Review, len(pr))
+	for i, r := range pr {
+		reviews[i] = reviewFromProto(r)
+	}
+	return reviews
+}
@@ -0,0 +1,265 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/donaldnash/go-marketplace/catalog"
+	"github.com/segmentio/ksuid"
+)
+
+var (
+	ErrReviewNotFound  = errors.New("review not found")
+	ErrInvalidReview   = errors.New("invalid review")
+	ErrNotPurchased    = errors.New("only accounts that ordered the product may review it")
+	ErrAlreadyReviewed = errors.New("account has already reviewed the product")
+	ErrNotApproved     = errors.New("only approved reviews can be voted on")
+	ErrOwnReview       = errors.New("accounts cannot vote on their own reviews")
+)
+
+const (
+	// EventReviewPosted is recorded in the outbox when an account posts a
+	// review.
+	EventReviewPosted = "ReviewPosted"
+	// EventReviewModerated is recorded in the outbox when a moderator
+	// approves or rejects a review.
+	EventReviewModerated = "ReviewModerated"
+)
+
+const (
+	MaxTitleLength          = 200
+	MaxBodyLength           = 5000
+	MaxModerationNoteLength = 500
+)
+
+// Status is the moderation state of a review. Reviews are posted PENDING and
+// are only shown, and only count towards the product's rating, once
+// APPROVED.
+type Status string
+
+const (
+	StatusPending  Status = "PENDING"
+	StatusApproved Status = "APPROVED"
+	StatusRejected Status = "REJECTED"
+)
+
+type Service interface {
+	// PostReview records a pending review by an account that ordered the
+	// product.
+	PostReview(ctx context.Context, r Review) (*Review, error)
+	GetReview(ctx context.Context, id string) (*Review, error)
+	// GetProductReviews lists the approved reviews of a product, the most
+	// helpful first.
+	GetProductReviews(ctx context.Context, productID string, skip uint64, take uint64) ([]Review, error)
+	// GetReviewsByStatus lists the reviews in a moderation state, oldest
+	// first.
+	GetReviewsByStatus(ctx context.Context, status Status, skip uint64, take uint64) ([]Review, error)
+	// ModerateReview approves or rejects a review. Reviews can be moderated
+	// again, e.g. to take down an approved review.
+	ModerateReview(ctx context.Context, id string, status Status, note string) (*Review, error)
+	// VoteHelpful records that an account found an approved review helpful.
+	// Voting twice counts once.
+	VoteHelpful(ctx context.Context, reviewID string, accountID string) (*Review, error)
+}
+
+type Review struct {
+	ID             string    `json:"id"`
+	ProductID      string    `json:"product_id"`
+	AccountID      string    `json:"account_id"`
+	Rating         int       `json:"rating"`
+	Title          string    `json:"title"`
+	Body           string    `json:"body"`
+	Status         Status    `json:"status"`
+	ModerationNote string    `json:"moderation_note,omitempty"`
+	HelpfulVotes   int       `json:"helpful_votes"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (r *Review) normalize() error {
+	r.Title = strings.TrimSpace(r.Title)
+	r.Body = strings.TrimSpace(r.Body)
+
+	switch {
+	case r.AccountID == "":
+		return fmt.Errorf("account ID is required")
+	case r.ProductID == "":
+		return fmt.Errorf("product ID is required")
+	case r.Rating < 1 || r.Rating > catalog.MaxRating:
+		return fmt.Errorf("%w: rating must be between 1 and %d", ErrInvalidReview, catalog.MaxRating)
+	case r.Title == "":
+		return fmt.Errorf("%w: title is required", ErrInvalidReview)
+	case utf8.RuneCountInString(r.Title) > MaxTitleLength:
+		return fmt.Errorf("%w: title cannot be longer than %d characters", ErrInvalidReview, MaxTitleLength)
+	case utf8.RuneCountInString(r.Body) > MaxBodyLength:
+		return fmt.Errorf("%w: body cannot be longer than %d characters", ErrInvalidReview, MaxBodyLength)
+	}
+	return nil
+}
+
+// OrderHistory tells whether an account ordered a product. *order.Client
+// implements it.
+type OrderHistory interface {
+	HasOrdered(ctx context.Context, accountID string, productID string) (bool, error)
+}
+
+type reviewService struct {
+	repository Repository
+	orders     OrderHistory
+}
+
+func NewService(r Repository, orders OrderHistory) Service {
+	if r == nil {
+		panic("repository cannot be nil")
+	}
+	if orders == nil {
+		panic("order history cannot be nil")
+	}
+	return &reviewService{r, orders}
+}
+
+func (s *reviewService) PostReview(ctx context.Context, r Review) (*Review, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if err := r.normalize(); err != nil {
+		return nil, err
+	}
+
+	ordered, err := s.orders.HasOrdered(ctx, r.AccountID, r.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check order history: %v", err)
+	}
+	if !ordered {
+		return nil, ErrNotPurchased
+	}
+
+	r.ID = ksuid.New().String()
+	r.Status = StatusPending
+	r.ModerationNote = ""
+	r.HelpfulVotes = 0
+	r.CreatedAt = time.Now().UTC()
+	r.UpdatedAt = r.CreatedAt
+	if err := s.repository.PutReview(ctx, r); err != nil {
+		if errors.Is(err, ErrAlreadyReviewed) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to post review: %v", err)
+	}
+	return &r, nil
+}
+
+func (s *reviewService) GetReview(ctx context.Context, id string) (*Review, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if id == "" {
+		return nil, fmt.Errorf("review ID is required")
+	}
+	return s.repository.GetReview(ctx, id)
+}
+
+func (s *reviewService) GetProductReviews(ctx context.Context, productID string, skip uint64, take uint64) ([]Review, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if productID == "" {
+		return nil, fmt.Errorf("product ID is required")
+	}
+	if take > 100 || (skip == 0 && take == 0) {
+		take = 100
+	}
+
+	reviews, err := s.repository.ListProductReviews(ctx, productID, skip, take)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reviews: %v", err)
+	}
+	return reviews, nil
+}
+
+func (s *reviewService) GetReviewsByStatus(ctx context.Context, status Status, skip uint64, take uint64) ([]Review, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if !status.valid() {
+		return nil, fmt.Errorf("unknown review status %q", status)
+	}
+	if take > 100 || (skip == 0 && take == 0) {
+		take = 100
+	}
+
+	reviews, err := s.repository.ListReviewsByStatus(ctx, status, skip, take)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reviews: %v", err)
+	}
+	return reviews, nil
+}
+
+func (s *reviewService) ModerateReview(ctx context.Context, id string, status Status, note string) (*Review, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if id == "" {
+		return nil, fmt.Errorf("review ID is required")
+	}
+	if status != StatusApproved && status != StatusRejected {
+		return nil, fmt.Errorf("%w: reviews can only be moderated to %s or %s", ErrInvalidReview, StatusApproved, StatusRejected)
+	}
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > MaxModerationNoteLength {
+		return nil, fmt.Errorf("%w: moderation note cannot be longer than %d characters", ErrInvalidReview, MaxModerationNoteLength)
+	}
+
+	r, err := s.repository.UpdateReviewStatus(ctx, id, status, note, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, ErrReviewNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to moderate review: %v", err)
+	}
+	return r, nil
+}
+
+func (s *reviewService) VoteHelpful(ctx context.Context, reviewID string, accountID string) (*Review, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("context is required")
+	}
+	if reviewID == "" {
+		return nil, fmt.Errorf("review ID is required")
+	}
+	if accountID == "" {
+		return nil, fmt.Errorf("account ID is required")
+	}
+
+	r, err := s.repository.GetReview(ctx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if r.Status != StatusApproved {
+		return nil, ErrNotApproved
+	}
+	if r.AccountID == accountID {
+		return nil, ErrOwnReview
+	}
+
+	r, err = s.repository.PutVote(ctx, reviewID, accountID)
+	if err != nil {
+		if errors.Is(err, ErrReviewNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to record vote: %v", err)
+	}
+	return r, nil
+}
+
+func (s Status) valid() bool {
+	switch s {
+	case StatusPending, StatusApproved, StatusRejected:
+		return true
+	}
+	return false
+}